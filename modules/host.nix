@@ -175,7 +175,14 @@ let
       allowedHosts = mkOption {
         type = types.listOf types.str;
         default = [ ];
-        description = "Allowed hosts when network = restricted";
+        description = "Allowed hosts when network = restricted. Entries starting with @ name a host group (e.g. @github, @pypi); entries may be IPs or CIDRs and may carry a :port suffix.";
+        example = [
+          "@github"
+          "@pypi"
+          "internal.example.com"
+          "registry.internal:5000"
+          "10.0.5.0/24:5432"
+        ];
       };
 
       readOnlyWorkspace = mkOption {
@@ -217,6 +224,230 @@ let
         ];
       };
 
+      services = mkOption {
+        type = types.attrsOf (
+          types.submodule {
+            options = {
+              package = mkOption {
+                type = types.package;
+                description = "Package providing the service";
+              };
+              command = mkOption {
+                type = types.str;
+                description = "Foreground command starting the service; $FORAGE_SERVICE_DATA holds its data directory";
+                example = "postgres -D $FORAGE_SERVICE_DATA -k /tmp";
+              };
+              ports = mkOption {
+                type = types.listOf types.port;
+                default = [ ];
+                description = "TCP ports the service listens on (used for readiness checks)";
+              };
+              env = mkOption {
+                type = types.attrsOf types.str;
+                default = { };
+                description = "Extra environment variables for the service";
+              };
+              storage = mkOption {
+                type = types.enum [
+                  "tmpfs"
+                  "persist"
+                ];
+                default = "tmpfs";
+                description = "Keep service data in tmpfs (lost on stop) or persist it on the host until the sandbox is removed";
+              };
+            };
+          }
+        );
+        default = { };
+        description = "Sidecar services (databases, caches, ...) running next to the agent in the sandbox";
+      };
+
+      probes = mkOption {
+        type = types.attrsOf (
+          types.submodule {
+            options = {
+              command = mkOption {
+                type = types.nullOr (types.listOf types.str);
+                default = null;
+                description = "Command run in the container; the probe passes when it exits with exitCode";
+                example = [
+                  "pg_isready"
+                  "-h"
+                  "localhost"
+                ];
+              };
+              exitCode = mkOption {
+                type = types.int;
+                default = 0;
+                description = "Exit code the command must return";
+              };
+              http = mkOption {
+                type = types.nullOr (
+                  types.submodule {
+                    options = {
+                      port = mkOption {
+                        type = types.port;
+                        description = "Port to send a GET to on the container IP";
+                      };
+                      path = mkOption {
+                        type = types.str;
+                        default = "/";
+                        description = "Request path";
+                      };
+                      status = mkOption {
+                        type = types.nullOr types.int;
+                        default = null;
+                        description = "Expected status code (default: any 2xx or 3xx)";
+                      };
+                    };
+                  }
+                );
+                default = null;
+                description = "HTTP check against the container IP";
+              };
+              process = mkOption {
+                type = types.nullOr types.str;
+                default = null;
+                description = "Process name that must be running in the container";
+                example = "postgres";
+              };
+              interval = mkOption {
+                type = types.str;
+                default = "30s";
+                description = "Minimum time between runs of the probe";
+              };
+              timeout = mkOption {
+                type = types.str;
+                default = "5s";
+                description = "Time a run may take before it counts as failed";
+              };
+              failureThreshold = mkOption {
+                type = types.ints.positive;
+                default = 3;
+                description = "Consecutive failures after which the sandbox is unhealthy";
+              };
+            };
+          }
+        );
+        default = { };
+        description = "Extra health checks; exactly one of command, http and process per probe";
+      };
+
+      idleTimeout = mkOption {
+        type = types.nullOr types.ints.positive;
+        default = null;
+        description = "Minutes of inactivity after which the health monitor stops sandboxes (default: the host's idleTimeout)";
+      };
+
+      restart = {
+        policy = mkOption {
+          type = types.nullOr (
+            types.enum [
+              "never"
+              "on-failure"
+              "always"
+            ]
+          );
+          default = null;
+          description = "When the health monitor restarts failed sandboxes: never, on-failure (crashed or unhealthy) or always (also when the multiplexer session ended)";
+        };
+        maxRetries = mkOption {
+          type = types.nullOr types.ints.positive;
+          default = null;
+          description = "Restarts before the monitor gives up and reports a crash loop (default: 5)";
+        };
+        backoff = mkOption {
+          type = types.nullOr types.str;
+          default = null;
+          description = "Delay before the second restart, doubling for each one after (default: 10s)";
+        };
+      };
+
+      waitingPatterns = mkOption {
+        type = types.listOf types.str;
+        default = [ ];
+        description = "Regular expressions matching the last lines of a pane whose agent waits for input (default: common permission prompts and yes/no questions)";
+        example = [ "^READY>" ];
+      };
+
+      budget = {
+        dailyTokens = mkOption {
+          type = types.nullOr types.ints.positive;
+          default = null;
+          description = "API tokens (input, output and cache writes) a sandbox may use per day";
+          example = 5000000;
+        };
+
+        totalTokens = mkOption {
+          type = types.nullOr types.ints.positive;
+          default = null;
+          description = "API tokens a sandbox may use in total";
+        };
+
+        dailyCost = mkOption {
+          type = types.nullOr (types.either types.int types.float);
+          default = null;
+          description = "Estimated API cost in USD a sandbox may incur per day";
+          example = 5;
+        };
+
+        totalCost = mkOption {
+          type = types.nullOr (types.either types.int types.float);
+          default = null;
+          description = "Estimated API cost in USD a sandbox may incur in total";
+          example = 50;
+        };
+
+        pause = mkOption {
+          type = types.bool;
+          default = false;
+          description = "Stop the sandbox once its budget is exhausted";
+        };
+      };
+
+      policy = {
+        allowedModels = mkOption {
+          type = types.listOf types.str;
+          default = [ ];
+          description = "Models API requests may use; a trailing * matches a prefix (empty = any model)";
+          example = [
+            "claude-sonnet-*"
+            "claude-haiku-*"
+          ];
+        };
+
+        defaultModel = mkOption {
+          type = types.nullOr types.str;
+          default = null;
+          description = "Rewrite requests for disallowed models to this model instead of rejecting them";
+          example = "claude-sonnet-4-5";
+        };
+
+        maxTokens = mkOption {
+          type = types.nullOr types.ints.positive;
+          default = null;
+          description = "Ceiling on requested output tokens; larger max_tokens values are lowered to it, and generation requests without one get it";
+          example = 16384;
+        };
+
+        forbiddenTools = mkOption {
+          type = types.listOf types.str;
+          default = [ ];
+          description = "Tool names or types API requests may not declare; a trailing * matches a prefix";
+          example = [
+            "web_search*"
+            "computer*"
+          ];
+        };
+
+        forbiddenBetas = mkOption {
+          type = types.listOf types.str;
+          default = [ ];
+          description = "anthropic-beta features API requests may not enable; a trailing * matches a prefix";
+          example = [ "computer-use-*" ];
+        };
+      };
+
       agentIdentity = {
         gitUser = mkOption {
           type = types.nullOr types.str;
@@ -368,6 +599,52 @@ in
       example = "eth0";
     };
 
+    subnetBase = mkOption {
+      type = types.str;
+      default = "10.100.0.0/16";
+      description = ''
+        IPv4 prefix that per-sandbox subnets are carved from. Change this if
+        the default range collides with a VPN or LAN. Existing sandboxes keep
+        the subnet they were created with.
+      '';
+      example = "172.30.0.0/16";
+    };
+
+    subnetPrefixLength = mkOption {
+      type = types.ints.between 2 30;
+      default = 24;
+      description = ''
+        Prefix length of each sandbox's subnet. Longer prefixes fit more
+        sandboxes into subnetBase (e.g. /28 in a /16 allows 4094 sandboxes).
+      '';
+      example = 28;
+    };
+
+    ipv6Ula = mkOption {
+      type = types.nullOr types.str;
+      default = null;
+      description = ''
+        Optional IPv6 unique local address (fc00::/7) prefix. When set, each
+        sandbox link also gets a /64 from this prefix.
+      '';
+      example = "fd42:f04a:7e11::/48";
+    };
+
+    ipv6Mode = mkOption {
+      type = types.enum [
+        "nat66"
+        "routed"
+      ];
+      default = "nat66";
+      description = ''
+        How sandbox IPv6 traffic leaves the host when ipv6Ula is set.
+        "nat66" masquerades sandbox addresses behind the host's IPv6
+        address on externalInterface. "routed" forwards sandbox traffic
+        unmodified; the upstream network must route ipv6Ula to this host
+        (e.g. to reach IPv6-only internal services).
+      '';
+    };
+
     containerUsername = mkOption {
       type = types.str;
       default = "agent";
@@ -403,6 +680,162 @@ in
       };
     };
 
+    hostGroups = mkOption {
+      type = types.attrsOf (types.listOf types.str);
+      default = { };
+      description = ''
+        Named host groups for template allowlists, referenced as "@name" in
+        allowedHosts. Groups may reference other groups and override the
+        built-in groups (anthropic, crates, github, go, nix, npm, pypi).
+      '';
+      example = {
+        internal = [
+          "git.internal.example.com"
+          "registry.internal.example.com"
+        ];
+      };
+    };
+
+    auditArchive = mkOption {
+      type = types.bool;
+      default = false;
+      description = ''
+        Keep the audit logs of removed sandboxes in `<stateDir>/audit-archive`
+        instead of deleting them, so `forage-ctl audit-log` can still show them.
+      '';
+    };
+
+    idleTimeout = mkOption {
+      type = types.nullOr types.ints.positive;
+      default = null;
+      example = 120;
+      description = ''
+        Minutes of inactivity after which the health monitor stops a sandbox:
+        no pane output, attached SSH session, workspace change or API request
+        through the proxy. Templates can override it. Requires the monitor.
+      '';
+    };
+
+    restart = {
+      policy = mkOption {
+        type = types.nullOr (
+          types.enum [
+            "never"
+            "on-failure"
+            "always"
+          ]
+        );
+        default = null;
+        description = "When the health monitor restarts failed sandboxes: never, on-failure (crashed or unhealthy) or always (also when the multiplexer session ended)";
+      };
+      maxRetries = mkOption {
+        type = types.nullOr types.ints.positive;
+        default = null;
+        description = "Restarts before the monitor gives up and reports a crash loop (default: 5)";
+      };
+      backoff = mkOption {
+        type = types.nullOr types.str;
+        default = null;
+        description = "Delay before the second restart, doubling for each one after (default: 10s)";
+      };
+    };
+
+    notifiers = mkOption {
+      type = types.listOf (
+        types.submodule {
+          options = {
+            command = mkOption {
+              type = types.nullOr (types.listOf types.str);
+              default = null;
+              description = "Command run as the forage user with the notification as JSON on stdin";
+              example = [
+                "notify-send"
+                "forage"
+              ];
+            };
+            webhook = mkOption {
+              type = types.nullOr types.str;
+              default = null;
+              description = "URL the notification is POSTed to as JSON";
+            };
+            fifo = mkOption {
+              type = types.nullOr types.str;
+              default = null;
+              description = "Named pipe the notification is written to as a JSON line";
+            };
+          };
+        }
+      );
+      default = [ ];
+      description = ''
+        Where the health monitor sends a notification when an agent waits for
+        input; exactly one of command, webhook and fifo per notifier.
+      '';
+    };
+
+    notifyDebounce = mkOption {
+      type = types.str;
+      default = "5m";
+      description = "Minimum time between two notifications about the same sandbox";
+    };
+
+    auditKeyFile = mkOption {
+      type = types.nullOr types.str;
+      default = null;
+      example = "/run/keys/forage-audit";
+      description = ''
+        File holding a secret (at least 16 bytes) that signs audit log entries
+        with an HMAC, so that `forage-ctl audit-log verify` detects rewritten
+        logs. Entries are hash chained either way; without a key, whoever can
+        write a log can also rebuild its chain. forage-ctl, the proxy and the
+        health monitor sign as `user`, so the file must be readable by that
+        user, and thus by anything running as it, including an agent that
+        escapes its sandbox. The HMAC guards against other accounts that can
+        write the logs and against logs copied off the host, not against
+        `user` itself.
+      '';
+    };
+
+    modelPrices = mkOption {
+      type = types.attrsOf (
+        types.submodule {
+          options = {
+            input = mkOption {
+              type = types.float;
+              description = "USD per million input tokens";
+            };
+            output = mkOption {
+              type = types.float;
+              description = "USD per million output tokens";
+            };
+            cacheWrite = mkOption {
+              type = types.float;
+              default = 0.0;
+              description = "USD per million cache write tokens";
+            };
+            cacheRead = mkOption {
+              type = types.float;
+              default = 0.0;
+              description = "USD per million cache read tokens";
+            };
+          };
+        }
+      );
+      default = { };
+      description = ''
+        Token prices used by `forage-ctl usage` to estimate API costs, keyed by
+        model name or model name prefix. Entries override the built-in table.
+      '';
+      example = {
+        "claude-sonnet-4" = {
+          input = 3.0;
+          output = 15.0;
+          cacheWrite = 3.75;
+          cacheRead = 0.3;
+        };
+      };
+    };
+
     monitor = {
       enable = mkOption {
         type = types.bool;
@@ -419,7 +852,7 @@ in
       autoRestart = mkOption {
         type = types.bool;
         default = false;
-        description = "Automatically restart unhealthy containers";
+        description = "Restart failed sandboxes whose template and host set no restart policy, as with policy on-failure";
       };
     };
   };
@@ -469,12 +902,27 @@ in
       self.packages.${pkgs.stdenv.hostPlatform.system}.forage-ctl
     ];
 
+    # Let nftables log rules inside container network namespaces reach the
+    # host kernel log, where `forage-ctl network blocked` reads them.
+    boot.kernel.sysctl."net.netfilter.nf_log_all_netns" = 1;
+
     # Enable NAT for container networking (only if externalInterface is set)
-    networking.nat = mkIf (cfg.externalInterface != null) {
-      enable = true;
-      internalInterfaces = [ "ve-+" ];
-      externalInterface = cfg.externalInterface;
-    };
+    networking.nat = mkIf (cfg.externalInterface != null) (
+      {
+        enable = true;
+        internalInterfaces = [ "ve-+" ];
+        externalInterface = cfg.externalInterface;
+      }
+      // lib.optionalAttrs (cfg.ipv6Ula != null && cfg.ipv6Mode == "nat66") {
+        enableIPv6 = true;
+        internalIPv6s = [ cfg.ipv6Ula ];
+      }
+    );
+
+    # Routed IPv6: forward sandbox traffic without translation
+    boot.kernel.sysctl."net.ipv6.conf.all.forwarding" = mkIf (
+      cfg.ipv6Ula != null && cfg.ipv6Mode == "routed"
+    ) 1;
 
     # Generate host configuration file and template configurations
     environment.etc = {
@@ -501,6 +949,39 @@ in
           // lib.optionalAttrs (cfg.workspacePath != "/workspace") {
             workspacePath = cfg.workspacePath;
           }
+          // lib.optionalAttrs (cfg.hostGroups != { }) {
+            hostGroups = cfg.hostGroups;
+          }
+          // lib.optionalAttrs (cfg.modelPrices != { }) {
+            modelPrices = cfg.modelPrices;
+          }
+          // lib.optionalAttrs cfg.auditArchive {
+            auditArchive = true;
+          }
+          // lib.optionalAttrs (cfg.auditKeyFile != null) {
+            auditKeyFile = cfg.auditKeyFile;
+          }
+          // lib.optionalAttrs (cfg.idleTimeout != null) {
+            idleTimeout = cfg.idleTimeout;
+          }
+          // lib.optionalAttrs (cfg.notifiers != [ ]) {
+            notifiers = map (lib.filterAttrs (_: v: v != null)) cfg.notifiers;
+          }
+          // lib.optionalAttrs (cfg.notifyDebounce != "5m") {
+            notifyDebounce = cfg.notifyDebounce;
+          }
+          // lib.optionalAttrs (lib.any (v: v != null) (lib.attrValues cfg.restart)) {
+            restart = lib.filterAttrs (_: v: v != null) cfg.restart;
+          }
+          // lib.optionalAttrs (cfg.subnetBase != "10.100.0.0/16") {
+            subnetBase = cfg.subnetBase;
+          }
+          // lib.optionalAttrs (cfg.subnetPrefixLength != 24) {
+            subnetPrefixLength = cfg.subnetPrefixLength;
+          }
+          // lib.optionalAttrs (cfg.ipv6Ula != null) {
+            ipv6Ula = cfg.ipv6Ula;
+          }
           //
             lib.optionalAttrs
               (
@@ -618,6 +1099,77 @@ in
           // lib.optionalAttrs (template.initCommands != [ ]) {
             inherit (template) initCommands;
           }
+          // lib.optionalAttrs (template.services != { }) {
+            services = lib.mapAttrsToList (name: svc: {
+              inherit name;
+              inherit (svc) command ports env storage;
+              package = svc.package.pname;
+            }) template.services;
+          }
+          // lib.optionalAttrs (template.probes != { }) {
+            probes = lib.mapAttrsToList (
+              name: probe:
+              lib.filterAttrs (_: v: v != null) {
+                inherit name;
+                inherit (probe)
+                  command
+                  exitCode
+                  process
+                  interval
+                  timeout
+                  failureThreshold
+                  ;
+                http = if probe.http == null then null else lib.filterAttrs (_: v: v != null) probe.http;
+              }
+            ) template.probes;
+          }
+          // lib.optionalAttrs (template.idleTimeout != null) {
+            inherit (template) idleTimeout;
+          }
+          // lib.optionalAttrs (template.waitingPatterns != [ ]) {
+            inherit (template) waitingPatterns;
+          }
+          // lib.optionalAttrs (lib.any (v: v != null) (lib.attrValues template.restart)) {
+            restart = lib.filterAttrs (_: v: v != null) template.restart;
+          }
+          //
+            lib.optionalAttrs
+              (
+                template.budget.dailyTokens != null
+                || template.budget.totalTokens != null
+                || template.budget.dailyCost != null
+                || template.budget.totalCost != null
+              )
+              {
+                budget = lib.filterAttrs (_: v: v != null && v != false) {
+                  inherit (template.budget)
+                    dailyTokens
+                    totalTokens
+                    dailyCost
+                    totalCost
+                    pause
+                    ;
+                };
+              }
+          //
+            lib.optionalAttrs
+              (
+                template.policy.allowedModels != [ ]
+                || template.policy.maxTokens != null
+                || template.policy.forbiddenTools != [ ]
+                || template.policy.forbiddenBetas != [ ]
+              )
+              {
+                policy = lib.filterAttrs (_: v: v != null && v != [ ]) {
+                  inherit (template.policy)
+                    allowedModels
+                    defaultModel
+                    maxTokens
+                    forbiddenTools
+                    forbiddenBetas
+                    ;
+                };
+              }
           //
             lib.optionalAttrs
               (
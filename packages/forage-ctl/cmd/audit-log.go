@@ -1,8 +1,13 @@
 package cmd
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
 
@@ -10,48 +15,215 @@ import (
 )
 
 var auditLogCmd = &cobra.Command{
-	Use:   "audit-log <name>",
-	Short: "Display the audit trail for a sandbox",
-	Args:  cobra.ExactArgs(1),
-	RunE:  runAuditLog,
+	Use:   "audit-log [name]",
+	Short: "Display the audit trail for a sandbox or the whole host",
+	Long: `Display the audit trail of a sandbox, or with --all the events of every
+sandbox merged in time order. Archived events of removed sandboxes are
+included (see auditArchive in the host config).
+
+Filter by --type (e.g. secret,policy) and time range. --since and --until
+accept a duration ago (2h) or a time (2026-01-02 15:04, RFC 3339).
+--follow keeps printing new events, including those of sandboxes created
+meanwhile.
+
+--format syslog writes RFC 5424 messages and --format journal the systemd
+Journal Export Format, for forwarding events to a SIEM:
+
+  forage-ctl audit-log --all --follow --format journal | \
+    /usr/lib/systemd/systemd-journal-remote -o /var/log/journal/remote/forage.journal -
+
+Use "forage-ctl audit-log verify" to check that audit logs were not
+tampered with.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runAuditLog,
 }
 
-var auditLogJSON bool
+var (
+	auditLogJSON   bool
+	auditLogAll    bool
+	auditLogSince  string
+	auditLogUntil  string
+	auditLogTypes  []string
+	auditLogFollow bool
+	auditLogFormat string
+)
 
 func init() {
-	auditLogCmd.Flags().BoolVar(&auditLogJSON, "json", false, "Output events as JSON lines")
+	auditLogCmd.Flags().BoolVar(&auditLogJSON, "json", false, "Output events as JSON lines (same as --format json)")
+	auditLogCmd.Flags().BoolVar(&auditLogAll, "all", false, "Show the events of all sandboxes")
+	auditLogCmd.Flags().StringVar(&auditLogSince, "since", "", "Only show events from this time or duration ago on")
+	auditLogCmd.Flags().StringVar(&auditLogUntil, "until", "", "Only show events before this time or duration ago")
+	auditLogCmd.Flags().StringSliceVar(&auditLogTypes, "type", nil, "Only show events of these types (e.g. secret,policy)")
+	auditLogCmd.Flags().BoolVarP(&auditLogFollow, "follow", "f", false, "Keep printing new events")
+	auditLogCmd.Flags().StringVar(&auditLogFormat, "format", "text", "Output format (text, json, syslog, journal)")
+
+	auditLogVerifyCmd.Flags().StringVar(&auditVerifyKeyFile, "key-file", "", "Audit key to check signatures with (default: auditKeyFile of the host config)")
+	auditLogVerifyCmd.Flags().BoolVar(&auditVerifyJSON, "json", false, "Output results as JSON")
+	auditLogCmd.AddCommand(auditLogVerifyCmd)
 	rootCmd.AddCommand(auditLogCmd)
 }
 
+var auditLogVerifyCmd = &cobra.Command{
+	Use:   "verify [name]",
+	Short: "Check audit logs for tampering",
+	Long: `Check the audit logs of a sandbox, or of all sandboxes, for tampering.
+Archived logs are checked too.
+
+Every audit event carries a sequence number and the hash of the event
+before it, and the last event of each log is recorded separately, so
+edited, removed, reordered or truncated entries are detected. With an
+audit key (auditKeyFile in the host config, or --key-file), events are
+also signed, and forged chains are detected as long as the key stays out
+of reach of whoever rewrote the log. The key is readable by the forage
+user, which signs the events, so it does not protect against a process
+running as that user.
+
+Events logged before chaining was introduced are counted but cannot be
+checked. Exits with an error if any problem is found.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runAuditLogVerify,
+}
+
+var (
+	auditVerifyKeyFile string
+	auditVerifyJSON    bool
+)
+
+func runAuditLogVerify(cmd *cobra.Command, args []string) error {
+	var sandboxName string
+	if len(args) == 1 {
+		sandboxName = args[0]
+	}
+
+	auditLog := auditLogger()
+	if auditVerifyKeyFile != "" {
+		key, err := audit.LoadKey(auditVerifyKeyFile)
+		if err != nil {
+			return err
+		}
+		auditLog = audit.NewLogger(paths().StateDir, audit.WithKey(key))
+	}
+
+	results, err := auditLog.Verify(sandboxName)
+	if err != nil {
+		return fmt.Errorf("failed to verify audit logs: %w", err)
+	}
+
+	failed := 0
+	for _, v := range results {
+		if !v.OK() {
+			failed++
+		}
+	}
+
+	if auditVerifyJSON {
+		data, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+	} else {
+		if len(results) == 0 {
+			logInfo("No audit logs found")
+			return nil
+		}
+		for _, v := range results {
+			note := fmt.Sprintf("%d entries", v.Entries)
+			if v.Unchained > 0 {
+				note += fmt.Sprintf(", %d unchained", v.Unchained)
+			}
+			if v.Signed {
+				note += ", signatures checked"
+			}
+			if v.OK() {
+				logSuccess("%s (%s)", v.Path, note)
+				continue
+			}
+			logWarning("%s (%s)", v.Path, note)
+			for _, problem := range v.Problems {
+				if problem.Line > 0 {
+					fmt.Printf("    line %d: %s\n", problem.Line, problem.Message)
+				} else {
+					fmt.Printf("    %s\n", problem.Message)
+				}
+			}
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d audit logs failed verification", failed, len(results))
+	}
+	return nil
+}
+
 func runAuditLog(cmd *cobra.Command, args []string) error {
-	name := args[0]
-	p := paths()
+	if (len(args) == 1) == auditLogAll {
+		return fmt.Errorf("specify a sandbox name or --all")
+	}
+
+	format, err := audit.ParseFormat(auditLogFormat)
+	if err != nil {
+		return err
+	}
+	if auditLogJSON {
+		format = audit.FormatJSON
+	}
+
+	now := time.Now()
+	var filter audit.Filter
+	if len(args) == 1 {
+		filter.Sandbox = args[0]
+	}
+	if filter.Since, err = parseLogTime(auditLogSince, now); err != nil {
+		return fmt.Errorf("invalid --since: %w", err)
+	}
+	if filter.Until, err = parseLogTime(auditLogUntil, now); err != nil {
+		return fmt.Errorf("invalid --until: %w", err)
+	}
+	for _, t := range auditLogTypes {
+		filter.Types = append(filter.Types, audit.EventType(t))
+	}
+
+	auditLog := auditLogger()
+	enc := audit.NewEncoder(os.Stdout, format)
+
+	if auditLogFollow {
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+		// Stop following once the output is gone, e.g. a closed pipe
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		var encErr error
+		err := auditLog.Follow(ctx, filter, true, func(e audit.Event) {
+			if encErr == nil {
+				if encErr = enc.Encode(e); encErr != nil {
+					cancel()
+				}
+			}
+		})
+		if err != nil {
+			return fmt.Errorf("failed to follow audit log: %w", err)
+		}
+		return encErr
+	}
 
-	auditLogger := audit.NewLogger(p.StateDir)
-	events, err := auditLogger.Events(name)
+	events, err := auditLog.Query(filter)
 	if err != nil {
 		return fmt.Errorf("failed to read audit log: %w", err)
 	}
 
 	if len(events) == 0 {
-		logInfo("No events found for sandbox %s", name)
+		if filter.Sandbox != "" {
+			logInfo("No events found for sandbox %s", filter.Sandbox)
+		} else {
+			logInfo("No events found")
+		}
 		return nil
 	}
 
 	for _, e := range events {
-		if auditLogJSON {
-			data, err := json.Marshal(e)
-			if err != nil {
-				return fmt.Errorf("failed to marshal event: %w", err)
-			}
-			fmt.Println(string(data))
-		} else {
-			ts := e.Timestamp.Local().Format("2006-01-02 15:04:05")
-			if e.Details != "" {
-				fmt.Printf("[%s] %-8s %s (%s)\n", ts, e.Type, e.Sandbox, e.Details)
-			} else {
-				fmt.Printf("[%s] %-8s %s\n", ts, e.Type, e.Sandbox)
-			}
+		if err := enc.Encode(e); err != nil {
+			return fmt.Errorf("failed to write event: %w", err)
 		}
 	}
 
@@ -0,0 +1,181 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/config"
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/usage"
+)
+
+var budgetCmd = &cobra.Command{
+	Use:   "budget",
+	Short: "Manage per-sandbox API budgets",
+	Long: `Manage the token and cost budgets the API proxy enforces per sandbox.
+
+A budget is a comma-separated list of limits:
+
+  daily-tokens=N   Tokens per calendar day
+  total-tokens=N   Tokens since the budget was set or last reset
+  daily-cost=USD   Estimated cost per calendar day
+  total-cost=USD   Estimated cost since the budget was set or last reset
+  pause            Stop the sandbox once the budget is exhausted
+
+Tokens count input, output and cache write tokens. Once a limit is reached
+the proxy rejects the sandbox's API requests with a billing error until the
+budget is raised, reset, or (for daily limits) the day ends.`,
+}
+
+var budgetSetCmd = &cobra.Command{
+	Use:   "set <sandbox> <budget>",
+	Short: "Set a sandbox's budget (\"none\" removes it)",
+	Example: `  forage-ctl budget set myproject daily-cost=5,total-cost=50
+  forage-ctl budget set myproject total-tokens=2000000,pause
+  forage-ctl budget set myproject none`,
+	Args: cobra.ExactArgs(2),
+	RunE: runBudgetSet,
+}
+
+var budgetShowCmd = &cobra.Command{
+	Use:   "show [sandbox]",
+	Short: "Show budgets and current spend",
+	Args:  cobra.MaximumNArgs(1),
+	RunE:  runBudgetShow,
+}
+
+var budgetResetCmd = &cobra.Command{
+	Use:   "reset <sandbox>",
+	Short: "Reset a sandbox's total spend to zero",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runBudgetReset,
+}
+
+func init() {
+	budgetCmd.AddCommand(budgetSetCmd)
+	budgetCmd.AddCommand(budgetShowCmd)
+	budgetCmd.AddCommand(budgetResetCmd)
+	rootCmd.AddCommand(budgetCmd)
+}
+
+func runBudgetSet(cmd *cobra.Command, args []string) error {
+	name := args[0]
+	if _, err := loadSandbox(name); err != nil {
+		return err
+	}
+
+	budget, err := config.ParseBudget(args[1])
+	if err != nil {
+		return err
+	}
+
+	p := paths()
+	if budget.IsEmpty() {
+		if err := usage.RemoveBudget(p.StateDir, name); err != nil {
+			return fmt.Errorf("failed to remove budget: %w", err)
+		}
+		logSuccess("Removed budget of %s", name)
+		return nil
+	}
+
+	// Keep counting from the previous reset so that changing a limit does
+	// not forgive spend already made
+	state := &usage.BudgetState{Budget: *budget, ResetAt: time.Now()}
+	if existing, err := usage.LoadBudget(p.StateDir, name); err != nil {
+		return err
+	} else if existing != nil {
+		state.ResetAt = existing.ResetAt
+	}
+	if err := usage.SaveBudget(p.StateDir, name, state); err != nil {
+		return err
+	}
+	logSuccess("Set budget of %s: %s", name, budget)
+	return nil
+}
+
+func runBudgetShow(cmd *cobra.Command, args []string) error {
+	p := paths()
+
+	var names []string
+	if len(args) == 1 {
+		if _, err := loadSandbox(args[0]); err != nil {
+			return err
+		}
+		names = args
+	} else {
+		sandboxes, err := listSandboxes()
+		if err != nil {
+			return err
+		}
+		for _, sb := range sandboxes {
+			names = append(names, sb.Name)
+		}
+	}
+
+	prices := loadPrices(p.ConfigDir)
+	now := time.Now()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SANDBOX\tBUDGET\tTODAY\tTOTAL\tSTATUS")
+	fmt.Fprintln(w, "-------\t------\t-----\t-----\t------")
+
+	shown := 0
+	for _, name := range names {
+		state, err := usage.LoadBudget(p.StateDir, name)
+		if err != nil {
+			return err
+		}
+		if state == nil {
+			if len(args) == 1 {
+				logInfo("Sandbox %s has no budget", name)
+				return nil
+			}
+			continue
+		}
+		daily, total, err := usage.BudgetSpend(usage.Path(p.StateDir), name, state, prices, now)
+		if err != nil {
+			return err
+		}
+		status := "ok"
+		if reason := state.Exceeded(daily, total); reason != "" {
+			status = "exhausted (" + reason + ")"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+			name, state.Budget.String(), formatSpend(daily), formatSpend(total), status)
+		shown++
+	}
+
+	if shown == 0 {
+		logInfo("No sandbox budgets set")
+		return nil
+	}
+	return w.Flush()
+}
+
+func runBudgetReset(cmd *cobra.Command, args []string) error {
+	name := args[0]
+	p := paths()
+
+	state, err := usage.LoadBudget(p.StateDir, name)
+	if err != nil {
+		return err
+	}
+	if state == nil {
+		return fmt.Errorf("sandbox %s has no budget", name)
+	}
+
+	state.ResetAt = time.Now()
+	if err := usage.SaveBudget(p.StateDir, name, state); err != nil {
+		return err
+	}
+	logSuccess("Reset budget spend of %s", name)
+	return nil
+}
+
+// formatSpend renders spend as tokens and estimated cost.
+func formatSpend(s usage.Spend) string {
+	return fmt.Sprintf("%d tok / $%.2f", s.Tokens, s.Cost)
+}
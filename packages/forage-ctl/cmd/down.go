@@ -54,12 +54,13 @@ func runDown(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	// Use unified cleanup function
-	sandbox.Cleanup(metadata, p, sandbox.DefaultCleanupOptions(), rt)
-
-	auditLog := audit.NewLogger(p.StateDir)
+	// Log before cleanup, so the event is archived with the rest
+	auditLog := auditLogger()
 	_ = auditLog.LogEvent(audit.EventDestroy, name, "")
 
+	// Use unified cleanup function
+	sandbox.Cleanup(metadata, p, cleanupOptions(), rt)
+
 	logSuccess("Removed sandbox %s", name)
 	return nil
 }
@@ -122,6 +122,7 @@ func runGC(cmd *cobra.Command, args []string) error {
 //   - <name>.nix (config)
 //   - <name>.skills.md (skills)
 //   - <name>.*-permissions.json (permissions)
+//   - <name>.probes.json (probe states)
 func sandboxNamesFromDisk(sandboxesDir string) (map[string]bool, error) {
 	entries, err := os.ReadDir(sandboxesDir)
 	if err != nil {
@@ -163,6 +164,11 @@ func extractSandboxName(filename string) string {
 		return ""
 	}
 
+	// <name>.probes.json
+	if name, ok := strings.CutSuffix(filename, ".probes.json"); ok {
+		return name
+	}
+
 	// <name>.skills.md
 	if name, ok := strings.CutSuffix(filename, ".skills.md"); ok {
 		return name
@@ -217,7 +223,7 @@ func executeGC(ctx context.Context, result *gcResult, p *config.Paths, rt interf
 
 		// If we have valid metadata, use Cleanup() for proper VCS unwinding
 		if meta, ok := metadataSet[name]; ok {
-			opts := sandbox.DefaultCleanupOptions()
+			opts := cleanupOptions()
 			opts.DestroyContainer = false // container doesn't exist
 			sandbox.Cleanup(meta, p, opts, nil)
 		} else {
@@ -254,6 +260,7 @@ func removeOrphanedFiles(name string, p *config.Paths) {
 		filepath.Join(p.SandboxesDir, name+".json"),
 		filepath.Join(p.SandboxesDir, name+".nix"),
 		filepath.Join(p.SandboxesDir, name+".skills.md"),
+		filepath.Join(p.SandboxesDir, name+".probes.json"),
 	}
 
 	for _, path := range patterns {
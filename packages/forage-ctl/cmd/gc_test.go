@@ -48,6 +48,9 @@ func TestExtractSandboxName(t *testing.T) {
 		{"test.claude-permissions.json", "test"},
 		{"my-sandbox.copilot-permissions.json", "my-sandbox"},
 
+		// Probe states
+		{"test.probes.json", "test"},
+
 		// Dotted JSON (not metadata, not permissions) -- ignored
 		{"some.other.json", ""},
 
@@ -2,9 +2,12 @@ package cmd
 
 import (
 	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/app"
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/audit"
 	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/config"
 	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/errors"
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/logging"
 	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/runtime"
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/sandbox"
 )
 
 // paths returns the default paths configuration.
@@ -53,3 +56,41 @@ func loadRunningSandbox(name string) (*config.SandboxMetadata, error) {
 func listSandboxes() ([]*config.SandboxMetadata, error) {
 	return config.ListSandboxes(paths().SandboxesDir)
 }
+
+// sandboxServices returns the sidecar services a sandbox runs, including
+// the API proxy shim, or nil if its template cannot be loaded.
+func sandboxServices(sb *config.SandboxMetadata) []config.Service {
+	p := paths()
+	template, err := config.LoadTemplate(p.TemplatesDir, sb.Template)
+	if err != nil {
+		return nil
+	}
+	hostConfig, _ := config.LoadHostConfig(p.ConfigDir) // without it, no shim
+	return sandbox.Services(template, hostConfig)
+}
+
+// cleanupOptions returns the options removing a sandbox entirely,
+// archiving its audit log if the host config asks for it.
+func cleanupOptions() sandbox.CleanupOptions {
+	opts := sandbox.DefaultCleanupOptions()
+	if hostConfig, err := config.LoadHostConfig(paths().ConfigDir); err == nil {
+		opts.ArchiveAuditLog = hostConfig.AuditArchive
+	}
+	return opts
+}
+
+// auditLogger returns the host's audit logger, signing events if the host
+// config names an audit key. Without a readable key, events are logged
+// unsigned, which verification reports.
+func auditLogger() *audit.Logger {
+	p := paths()
+	hostConfig, err := config.LoadHostConfig(p.ConfigDir)
+	if err != nil {
+		return audit.NewLogger(p.StateDir)
+	}
+	key, err := audit.LoadKey(hostConfig.AuditKeyFile)
+	if err != nil {
+		logging.Warn("audit events will not be signed", "error", err)
+	}
+	return audit.NewLogger(p.StateDir, audit.WithKey(key))
+}
@@ -8,7 +8,6 @@ import (
 
 	"github.com/spf13/cobra"
 
-	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/audit"
 	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/monitor"
 )
 
@@ -16,7 +15,12 @@ var monitorCmd = &cobra.Command{
 	Use:   "monitor",
 	Short: "Monitor sandbox health in the background",
 	Long: `Periodically checks the health of all sandboxes and optionally
-restarts unhealthy containers. Runs in the foreground until interrupted.
+restarts unhealthy containers. With notifiers in the host config, it
+notifies when an agent starts waiting for input. Sandboxes whose template
+or host sets an idleTimeout are stopped once idle for that long: no pane
+output, attached SSH session, workspace change or proxied API request.
+Each round's statuses are cached for ps and the picker to show at once.
+Runs in the foreground until interrupted.
 
 Can be wrapped in a systemd service for persistent monitoring.`,
 	RunE: runMonitor,
@@ -36,12 +40,13 @@ func init() {
 func runMonitor(cmd *cobra.Command, args []string) error {
 	p := paths()
 	rt := getRuntime()
-	auditLogger := audit.NewLogger(p.StateDir)
+	auditLog := auditLogger()
 
 	interval := time.Duration(monitorInterval) * time.Second
 
 	opts := []monitor.Option{
-		monitor.WithAuditLogger(auditLogger),
+		monitor.WithAuditLogger(auditLog),
+		monitor.WithProxyLog(auditLogPath(p.StateDir)),
 	}
 	if monitorAutoRestart {
 		opts = append(opts, monitor.WithAutoRestart(true))
@@ -28,6 +28,11 @@ Available modes:
   restricted - Only allowed hosts can be accessed (requires template config)
   none       - No network access except SSH for management
 
+Allowed hosts may name host groups such as @github, @pypi, @npm, @crates,
+@go, @nix or @anthropic, plus any groups defined in the host config.
+Entries may be scoped to a port and may be IP addresses or CIDRs, e.g.
+github.com:443, registry.internal:5000 or 10.0.5.0/24:5432.
+
 Note: Changing network mode requires restarting the sandbox.`,
 	Args: cobra.ExactArgs(2),
 	RunE: runNetwork,
@@ -39,7 +44,7 @@ var (
 )
 
 func init() {
-	networkCmd.Flags().StringSliceVar(&networkAllowHosts, "allow", nil, "Additional hosts to allow (restricted mode only)")
+	networkCmd.Flags().StringSliceVar(&networkAllowHosts, "allow", nil, "Additional hosts, host:port, CIDRs or @host-groups to allow (restricted mode only)")
 	networkCmd.Flags().BoolVar(&networkNoRestart, "no-restart", false, "Don't restart sandbox (changes won't take effect)")
 	rootCmd.AddCommand(networkCmd)
 }
@@ -82,24 +87,58 @@ func runNetwork(cmd *cobra.Command, args []string) error {
 		return errors.TemplateNotFound(metadata.Template)
 	}
 
-	// Update template network mode for regeneration
-	template.Network = string(mode)
-
-	// Merge allowed hosts from template and command line
+	// Persist the mode and any extra hosts so later regenerations keep them
+	metadata.NetworkMode = string(mode)
+	metadata.AddAllowedHosts(networkAllowHosts...)
+	metadata.ApplyNetworkOverrides(template)
 	allowedHosts := template.AllowedHosts
-	if len(networkAllowHosts) > 0 {
-		allowedHosts = append(allowedHosts, networkAllowHosts...)
+
+	// Reject unknown host groups before touching the container
+	if _, err := network.ExpandAllowedHosts(allowedHosts, hostConfig.HostGroups); err != nil {
+		return errors.New(errors.ExitGeneralError, err.Error())
 	}
-	template.AllowedHosts = allowedHosts
 
 	// Validate restricted mode has allowed hosts
 	if mode == network.ModeRestricted && len(allowedHosts) == 0 {
 		logWarning("restricted mode with no allowed hosts is equivalent to 'none' mode")
 	}
 
+	if err := applyNetworkConfig(metadata, template, hostConfig, networkNoRestart); err != nil {
+		return err
+	}
+	if networkNoRestart {
+		return nil
+	}
+
+	logSuccess("Network mode changed to %s", mode)
+
+	// Show network info
+	switch mode {
+	case network.ModeFull:
+		fmt.Println("  Full internet access enabled")
+	case network.ModeRestricted:
+		fmt.Println("  Restricted network enabled")
+		fmt.Println("  Allowed hosts:")
+		for _, host := range network.DescribeAllowedHosts(allowedHosts, hostConfig.HostGroups) {
+			fmt.Printf("    - %s\n", host)
+		}
+	case network.ModeNone:
+		fmt.Println("  Network access disabled (SSH only for management)")
+	}
+
+	return nil
+}
+
+// applyNetworkConfig regenerates the container configuration for a sandbox
+// from its template (with network overrides already applied), saves the
+// metadata and, unless noRestart is set, recreates the container.
+func applyNetworkConfig(metadata *config.SandboxMetadata, template *config.Template, hostConfig *config.HostConfig, noRestart bool) error {
+	name := metadata.Name
+	p := paths()
+
 	// Check if sandbox is running
 	wasRunning := isRunning(name)
-	if wasRunning && !networkNoRestart {
+	if wasRunning && !noRestart {
 		logInfo("Stopping sandbox for network reconfiguration...")
 		logging.Debug("stopping container", "name", name)
 		if stopErr := app.Default.Stop(name); stopErr != nil {
@@ -132,7 +171,11 @@ func runNetwork(cmd *cobra.Command, args []string) error {
 		return errors.ContainerFailed("write config", err)
 	}
 
-	if networkNoRestart {
+	if err := config.SaveSandboxMetadata(p.SandboxesDir, metadata); err != nil {
+		return fmt.Errorf("failed to save metadata: %w", err)
+	}
+
+	if noRestart {
 		logWarning("Container configuration updated. Restart the sandbox for changes to take effect.")
 		logInfo("  forage-ctl reset %s", name)
 		return nil
@@ -156,21 +199,5 @@ func runNetwork(cmd *cobra.Command, args []string) error {
 		return errors.ContainerFailed("recreate container", err)
 	}
 
-	logSuccess("Network mode changed to %s", mode)
-
-	// Show network info
-	switch mode {
-	case network.ModeFull:
-		fmt.Println("  Full internet access enabled")
-	case network.ModeRestricted:
-		fmt.Println("  Restricted network enabled")
-		fmt.Println("  Allowed hosts:")
-		for _, host := range allowedHosts {
-			fmt.Printf("    - %s\n", host)
-		}
-	case network.ModeNone:
-		fmt.Println("  Network access disabled (SSH only for management)")
-	}
-
 	return nil
 }
@@ -0,0 +1,196 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/config"
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/errors"
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/logging"
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/network"
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/runtime"
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/system"
+)
+
+var networkBlockedCmd = &cobra.Command{
+	Use:   "blocked <sandbox>",
+	Short: "Show connections blocked by restricted network mode",
+	Long: `Show outbound connections and DNS lookups that were blocked by the
+sandbox's restricted network rules.
+
+Blocked packets are read from the host kernel log (nftables log rules) and
+destination IPs are mapped back to hostnames using the sandbox's dnsmasq
+query log. Hostnames that would unblock the traffic are offered for
+addition to the sandbox allowlist.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runNetworkBlocked,
+}
+
+var (
+	blockedSince     time.Duration
+	blockedAdd       bool
+	blockedNoRestart bool
+)
+
+func init() {
+	networkBlockedCmd.Flags().DurationVar(&blockedSince, "since", 0, "Only show blocks within this duration (e.g. 1h; 0 = all)")
+	networkBlockedCmd.Flags().BoolVar(&blockedAdd, "add", false, "Add all suggested hosts to the allowlist without prompting")
+	networkBlockedCmd.Flags().BoolVar(&blockedNoRestart, "no-restart", false, "Don't restart sandbox after updating the allowlist")
+	networkCmd.AddCommand(networkBlockedCmd)
+}
+
+func runNetworkBlocked(cmd *cobra.Command, args []string) error {
+	name := args[0]
+	p := paths()
+
+	metadata, err := loadSandbox(name)
+	if err != nil {
+		return err
+	}
+
+	hostConfig, err := config.LoadHostConfig(p.ConfigDir)
+	if err != nil {
+		return errors.ConfigError("failed to load host config", err)
+	}
+
+	template, err := config.LoadTemplate(p.TemplatesDir, metadata.Template)
+	if err != nil {
+		return errors.TemplateNotFound(metadata.Template)
+	}
+	metadata.ApplyNetworkOverrides(template)
+
+	if template.Network != string(network.ModeRestricted) {
+		logWarning("Sandbox %s is not in restricted network mode (mode: %s)", name, template.Network)
+	}
+
+	ctx := context.Background()
+	addrs := metadata.Addresses()
+	conns := network.ParseBlockedLog(readBlockedLog(ctx), addrs.ContainerIP, addrs.ContainerIPv6)
+	dns := network.ParseDNSLog(readDNSLog(ctx, name))
+	network.AnnotateHostnames(conns, dns)
+
+	if len(conns) == 0 && len(dns.Refused) == 0 {
+		logInfo("No blocked connections found for sandbox %s", name)
+		return nil
+	}
+
+	if len(conns) > 0 {
+		fmt.Println("Blocked connections:")
+		fmt.Printf("  %-39s %-6s %-6s %-6s %-19s %s\n", "DESTINATION", "PROTO", "PORT", "COUNT", "LAST SEEN", "HOSTNAME")
+		for _, c := range conns {
+			lastSeen := "-"
+			if !c.LastSeen.IsZero() {
+				lastSeen = c.LastSeen.Local().Format("2006-01-02 15:04:05")
+			}
+			hostname := c.Hostname
+			if hostname == "" {
+				hostname = "(unknown)"
+			}
+			fmt.Printf("  %-39s %-6s %-6d %-6d %-19s %s\n", c.DestIP, c.Protocol, c.DestPort, c.Count, lastSeen, hostname)
+		}
+		fmt.Println()
+	}
+
+	if len(dns.Refused) > 0 {
+		fmt.Println("Blocked DNS lookups:")
+		for _, host := range dns.Refused {
+			fmt.Printf("  - %s\n", host)
+		}
+		fmt.Println()
+	}
+
+	allowedHosts, err := network.ExpandAllowedHosts(template.AllowedHosts, hostConfig.HostGroups)
+	if err != nil {
+		logging.Debug("failed to expand allowed hosts", "error", err)
+		allowedHosts = template.AllowedHosts
+	}
+	suggestions := network.SuggestAllowedHosts(conns, dns, allowedHosts)
+	if len(suggestions) == 0 {
+		logInfo("No new hostnames to suggest for the allowlist")
+		return nil
+	}
+
+	fmt.Println("Suggested allowlist additions:")
+	for _, host := range suggestions {
+		fmt.Printf("  + %s\n", host)
+	}
+	fmt.Println()
+
+	if !blockedAdd {
+		if !stdinIsTerminal() {
+			logInfo("Re-run with --add to add these hosts, or use:")
+			logInfo("  forage-ctl network %s restricted --allow %s", name, strings.Join(suggestions, ","))
+			return nil
+		}
+		if !confirm(fmt.Sprintf("Add %d host(s) to the allowlist for %s?", len(suggestions), name)) {
+			return nil
+		}
+	}
+
+	added := metadata.AddAllowedHosts(suggestions...)
+	metadata.NetworkMode = string(network.ModeRestricted)
+	metadata.ApplyNetworkOverrides(template)
+
+	if err := applyNetworkConfig(metadata, template, hostConfig, blockedNoRestart); err != nil {
+		return err
+	}
+
+	logSuccess("Added %d host(s) to the allowlist for %s", len(added), name)
+	return nil
+}
+
+// readBlockedLog returns kernel log lines written by the restricted-mode
+// nftables log rule. Errors are logged and yield empty output, since the
+// journal may be unavailable or empty.
+func readBlockedLog(ctx context.Context) string {
+	args := []string{"-k", "--no-pager", "-o", "short-iso", "--grep", strings.TrimSpace(network.BlockedLogPrefix)}
+	if blockedSince > 0 {
+		args = append(args, "--since", fmt.Sprintf("-%ds", int(blockedSince.Seconds())))
+	}
+	out, err := system.DefaultExecutor().Execute(ctx, "journalctl", args...)
+	if err != nil {
+		logging.Debug("failed to read kernel log", "error", err, "output", string(out))
+	}
+	return string(out)
+}
+
+// readDNSLog returns the dnsmasq query log from inside the sandbox.
+func readDNSLog(ctx context.Context, name string) string {
+	rt := getRuntime()
+	if rt == nil || !isRunning(name) {
+		return ""
+	}
+	command := []string{"journalctl", "-u", "dnsmasq", "--no-pager", "-o", "cat"}
+	if blockedSince > 0 {
+		command = append(command, "--since", fmt.Sprintf("-%ds", int(blockedSince.Seconds())))
+	}
+	result, err := rt.Exec(ctx, name, command, runtime.ExecOptions{})
+	if err != nil {
+		logging.Debug("failed to read dnsmasq log", "sandbox", name, "error", err)
+		return ""
+	}
+	return result.Stdout
+}
+
+// stdinIsTerminal reports whether stdin is an interactive terminal.
+func stdinIsTerminal() bool {
+	info, err := os.Stdin.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// confirm asks a yes/no question on stdin, defaulting to no.
+func confirm(question string) bool {
+	fmt.Printf("%s [y/N] ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
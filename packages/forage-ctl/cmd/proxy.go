@@ -1,16 +1,24 @@
 package cmd
 
 import (
+	"context"
+	"fmt"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
 	"syscall"
+	"text/tabwriter"
 	"time"
 
 	"github.com/spf13/cobra"
 
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/audit"
 	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/config"
 	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/logging"
 	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/proxy"
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/usage"
 )
 
 var proxyCmd = &cobra.Command{
@@ -22,14 +30,65 @@ The proxy reads API keys from the secrets directory and injects them
 into requests from sandboxes. This allows sandboxes to make API calls
 without having direct access to the API keys.
 
-Sandboxes should:
-1. Set ANTHROPIC_BASE_URL to point to this proxy
-2. Include X-Forage-Sandbox header with their sandbox name
+Requests are routed to upstream APIs by path prefix or virtual host. By
+default the proxy serves:
+
+  /             Anthropic   (X-Api-Key from anthropic-api-key)
+  /openai       OpenAI      (Bearer token from openai-api-key)
+  /gemini       Gemini      (X-Goog-Api-Key from gemini-api-key)
+  /openrouter   OpenRouter  (Bearer token from openrouter-api-key)
+
+Use --routes to load a JSON route table instead. Sandboxes using the proxy
+get ANTHROPIC_BASE_URL, OPENAI_BASE_URL, GOOGLE_GEMINI_BASE_URL or
+OPENROUTER_BASE_URL pointing at the matching route.
+
+Each sandbox is issued a random virtual API key at 'up', which its agents
+send in place of a real key. The proxy identifies the sandbox by that key
+and swaps in the real one. Keys are revoked on 'down' and replaced with
+'forage-ctl proxy rotate'. Requests without a key are identified by the
+X-Forage-Sandbox header or source IP, unless --require-token is set.
+
+The proxy also listens on a unix socket per sandbox, mounted into the
+sandbox next to its key. Requests on a socket are identified by it.
+Sandboxes with network "none" reach the proxy this way, through a shim
+forwarding 127.0.0.1:8788 inside the sandbox to the socket.
+
+An admin API, by default on a unix socket in the state directory, serves
+Prometheus metrics at /metrics and backs 'forage-ctl proxy reload',
+'sandboxes' and 'stats'. SIGHUP also reloads API keys and sandbox IPs.
 
 The proxy will:
-- Inject the appropriate API key for the sandbox
+- Inject the appropriate API key for the sandbox and route
 - Apply rate limiting (if configured)
-- Log all requests to the audit log (if configured)
+- Log all requests to the audit log (see 'forage-ctl proxy log')
+- Retry failed upstream requests with backoff, failing over to secondary
+  upstreams or keys when an upstream keeps failing
+- Record token usage per sandbox and model (see 'forage-ctl usage')
+- Enforce per-sandbox token and cost budgets (see 'forage-ctl budget')
+- Enforce the template's request policy: allowed models, max_tokens
+  ceilings, and forbidden tools and beta features
+- Redact secrets from outbound requests or block them (with --redact)
+
+With --cassette record, every request/response pair, including streamed
+responses and their timing, is recorded to a cassette per sandbox. With
+--cassette replay, responses are served from the cassettes without
+contacting upstream, so agent tests run offline and spend no tokens.
+Replayed requests are matched to recordings by exact body, by normalized
+JSON body (ignoring formatting and per-session metadata), or by sequence.
+
+Requests failing with a connection error, 429, 529 or 5xx are retried with
+jittered exponential backoff, honoring Retry-After, as long as no response
+has reached the client. Routes may list failover upstreams or keys, used
+once retries are exhausted. A circuit breaker per upstream stops sending
+requests to an upstream that keeps failing; 'forage-ctl proxy status'
+shows the breakers.
+
+With --redact, request bodies are scanned for the values of the host's
+secrets and of every file in the sandbox's secrets directory, and for AWS
+access keys, GitHub tokens and private keys (add patterns with
+--detectors). Matches are replaced with [REDACTED:<name>] (redact), or the
+request is rejected (block). Either way a secret event is recorded in the
+sandbox's audit log.
 
 IMPORTANT: This only works for API key authentication. For Claude Max/Pro
 plans using OAuth, authentication must be done inside the sandbox via
@@ -38,34 +97,193 @@ for Max plans, but cannot inject authentication.`,
 	RunE: runProxy,
 }
 
+var proxyRotateCmd = &cobra.Command{
+	Use:   "rotate <sandbox>",
+	Short: "Issue a new virtual API key to a sandbox",
+	Long: `Issue a new virtual API key to a sandbox, revoking the old one.
+
+The new key is visible in the sandbox at once; agents pick it up when they
+next start. Agents still running with the old key get authentication errors
+until restarted.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runProxyRotate,
+}
+
+var proxyStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the circuit breaker state of the proxy's upstreams",
+	Args:  cobra.NoArgs,
+	RunE:  runProxyStatus,
+}
+
+var proxyReloadCmd = &cobra.Command{
+	Use:   "reload",
+	Short: "Make the running proxy reload API keys and sandbox IPs",
+	Args:  cobra.NoArgs,
+	RunE:  runProxyReload,
+}
+
+var proxySandboxesCmd = &cobra.Command{
+	Use:   "sandboxes",
+	Short: "List the sandboxes the running proxy knows about",
+	Args:  cobra.NoArgs,
+	RunE:  runProxySandboxes,
+}
+
+var proxyStatsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Show per-sandbox request counters and rate limit state",
+	Args:  cobra.NoArgs,
+	RunE:  runProxyStats,
+}
+
 var (
-	proxyListen     string
-	proxyTarget     string
-	proxyRateLimit  int
-	proxyRateWindow time.Duration
-	proxyAuditLog   string
+	proxyAdmin        string
+	proxyListen       string
+	proxyTarget       string
+	proxyRateLimit    int
+	proxyRateWindow   time.Duration
+	proxyAuditLog     string
+	proxyRoutes       string
+	proxyRequireToken bool
+	proxySockets      bool
+	proxyRedact       string
+	proxyDetectors    string
+	proxyRetries      int
+	proxyRetryBase    time.Duration
+	proxyRetryMax     time.Duration
+	proxyBreakerFails int
+	proxyBreakerCool  time.Duration
+	proxyCassette     string
+	proxyCassettes    string
+	proxyMatch        string
+	proxyReplaySpeed  float64
 )
 
 func init() {
 	proxyCmd.Flags().StringVar(&proxyListen, "listen", ":8080", "Address to listen on")
-	proxyCmd.Flags().StringVar(&proxyTarget, "target", "https://api.anthropic.com", "Upstream API URL")
+	proxyCmd.Flags().StringVar(&proxyTarget, "target", "https://api.anthropic.com", "Upstream URL of the default Anthropic route")
+	proxyCmd.Flags().StringVar(&proxyRoutes, "routes", "", "Path to a JSON route table (replaces the built-in provider routes)")
 	proxyCmd.Flags().IntVar(&proxyRateLimit, "rate-limit", 0, "Max requests per window (0 = unlimited)")
 	proxyCmd.Flags().DurationVar(&proxyRateWindow, "rate-window", time.Minute, "Rate limit window duration")
-	proxyCmd.Flags().StringVar(&proxyAuditLog, "audit-log", "", "Path to audit log file")
+	proxyCmd.Flags().StringVar(&proxyCassette, "cassette", "off", "Record API traffic to cassettes or replay it from them (off, record, replay)")
+	proxyCmd.Flags().StringVar(&proxyCassettes, "cassette-dir", "", "Directory holding one cassette per sandbox (default <stateDir>/cassettes)")
+	proxyCmd.Flags().StringVar(&proxyMatch, "match", "normalized", "How replayed requests match recordings (exact, normalized, sequence)")
+	proxyCmd.Flags().Float64Var(&proxyReplaySpeed, "replay-speed", 0, "Scale recorded stream timing when replaying (1 = as recorded, 0 = no delays)")
+	proxyCmd.Flags().BoolVar(&proxyRequireToken, "require-token", false, "Reject requests without a virtual API key instead of identifying them by header or source IP")
+	proxyCmd.Flags().BoolVar(&proxySockets, "sockets", true, "Also serve each sandbox on a unix socket in its proxy directory")
+	proxyCmd.Flags().StringVar(&proxyRedact, "redact", "off", "Scan outbound requests for secrets and redact them or block the request (off, redact, block)")
+	proxyCmd.Flags().StringVar(&proxyDetectors, "detectors", "", "Path to a JSON list of extra secret detectors ({name, pattern})")
+	proxyCmd.Flags().IntVar(&proxyRetries, "retries", 2, "Retries of upstream requests failing with a connection error, 429, 529 or 5xx")
+	proxyCmd.Flags().DurationVar(&proxyRetryBase, "retry-base", 500*time.Millisecond, "Backoff before the first retry, doubling with each retry")
+	proxyCmd.Flags().DurationVar(&proxyRetryMax, "retry-max", 30*time.Second, "Maximum backoff; longer Retry-After responses fail over instead")
+	proxyCmd.Flags().IntVar(&proxyBreakerFails, "breaker-failures", 5, "Consecutive failures that open an upstream's circuit (0 = no circuit breaker)")
+	proxyCmd.Flags().DurationVar(&proxyBreakerCool, "breaker-cooldown", 30*time.Second, "How long an open circuit rejects requests before a trial request")
+	proxyCmd.PersistentFlags().StringVar(&proxyAuditLog, "audit-log", "", "Request audit log path (default <stateDir>/proxy-audit.log; \"off\" disables)")
+	proxyCmd.PersistentFlags().StringVar(&proxyAdmin, "admin", "", "Admin API address, host:port or unix:<path> (default unix:<stateDir>/proxy-admin.sock; \"off\" disables)")
+	proxyCmd.AddCommand(proxyRotateCmd)
+	proxyCmd.AddCommand(proxyStatusCmd)
+	proxyCmd.AddCommand(proxyReloadCmd)
+	proxyCmd.AddCommand(proxySandboxesCmd)
+	proxyCmd.AddCommand(proxyStatsCmd)
+	proxyCmd.AddCommand(proxyLogCmd)
 	rootCmd.AddCommand(proxyCmd)
 }
 
 func runProxy(cmd *cobra.Command, args []string) error {
 	paths := config.DefaultPaths()
 
+	var routes []proxy.Route
+	if proxyRoutes != "" {
+		var err error
+		if routes, err = proxy.LoadRoutes(proxyRoutes); err != nil {
+			return err
+		}
+	} else {
+		routes = proxy.DefaultRoutes()
+		for i := range routes {
+			if routes[i].Name == "anthropic" {
+				routes[i].Upstream = proxyTarget
+			}
+		}
+	}
+
+	cassetteMode, err := proxy.ParseCassetteMode(proxyCassette)
+	if err != nil {
+		return err
+	}
+	match, err := proxy.ParseMatchMode(proxyMatch)
+	if err != nil {
+		return err
+	}
+	redact, err := proxy.ParseRedactMode(proxyRedact)
+	if err != nil {
+		return err
+	}
+	detectors := proxy.DefaultDetectors()
+	if proxyDetectors != "" {
+		extra, err := proxy.LoadDetectors(proxyDetectors)
+		if err != nil {
+			return err
+		}
+		detectors = append(detectors, extra...)
+	}
+	var hostSecrets map[string]string
+	if redact != proxy.RedactOff {
+		hostConfig, err := config.LoadHostConfig(paths.ConfigDir)
+		if err != nil {
+			logging.Warn("failed to load host config; host secrets will not be redacted", "error", err)
+		} else {
+			hostSecrets = hostConfig.Secrets
+		}
+	}
+	var auditKey []byte
+	if hostConfig, err := config.LoadHostConfig(paths.ConfigDir); err == nil {
+		if auditKey, err = audit.LoadKey(hostConfig.AuditKeyFile); err != nil {
+			logging.Warn("audit events will not be signed", "error", err)
+		}
+	}
+
+	cassetteDir := proxyCassettes
+	if cassetteDir == "" {
+		cassetteDir = filepath.Join(paths.StateDir, "cassettes")
+	}
+
 	cfg := &proxy.Config{
 		ListenAddr:        proxyListen,
+		AdminAddr:         adminAddr(paths.StateDir),
 		SecretsDir:        paths.SecretsDir,
+		SandboxesDir:      paths.SandboxesDir,
+		TemplatesDir:      paths.TemplatesDir,
 		TargetURL:         proxyTarget,
+		Routes:            routes,
 		RateLimitRequests: proxyRateLimit,
 		RateLimitWindow:   proxyRateWindow,
-		AuditLogPath:      proxyAuditLog,
-		Logger:            logging.Logger,
+		AuditLogPath:      auditLogPath(paths.StateDir),
+		UsagePath:         usage.Path(paths.StateDir),
+		StateDir:          paths.StateDir,
+		AuditKey:          auditKey,
+		RequireToken:      proxyRequireToken,
+		Sockets:           proxySockets,
+		Retry: proxy.RetryPolicy{
+			MaxRetries: proxyRetries,
+			BaseDelay:  proxyRetryBase,
+			MaxDelay:   proxyRetryMax,
+		},
+		Breaker: proxy.BreakerPolicy{
+			Failures: proxyBreakerFails,
+			Cooldown: proxyBreakerCool,
+		},
+		Redact:        redact,
+		HostSecrets:   hostSecrets,
+		Detectors:     detectors,
+		Prices:        loadPrices(paths.ConfigDir),
+		PauseSandbox:  pauseSandbox,
+		CassetteMode:  cassetteMode,
+		CassetteDir:   cassetteDir,
+		CassetteMatch: match,
+		ReplaySpeed:   proxyReplaySpeed,
+		Logger:        logging.Logger,
 	}
 
 	server, err := proxy.NewServer(cfg)
@@ -88,7 +306,7 @@ func runProxy(cmd *cobra.Command, args []string) error {
 	signal.Notify(hupCh, syscall.SIGHUP)
 	go func() {
 		for range hupCh {
-			logging.Info("reloading API keys")
+			logging.Info("reloading API keys and sandbox IPs")
 			if err := server.ReloadKeys(); err != nil {
 				logging.Warn("failed to reload keys", "error", err)
 			}
@@ -96,14 +314,214 @@ func runProxy(cmd *cobra.Command, args []string) error {
 	}()
 
 	logInfo("Starting API proxy server on %s", proxyListen)
-	logInfo("Target: %s", proxyTarget)
+	for _, r := range routes {
+		match := r.PathPrefix
+		if match == "" {
+			match = "/"
+		}
+		if r.Host != "" {
+			match = r.Host + match
+		}
+		logInfo("Route %s: %s -> %s", r.Name, match, r.Upstream)
+	}
 	logInfo("Secrets: %s", paths.SecretsDir)
+	if cfg.AdminAddr != "" {
+		logInfo("Admin API and metrics: %s", cfg.AdminAddr)
+	}
 	if proxyRateLimit > 0 {
 		logInfo("Rate limit: %d requests per %s", proxyRateLimit, proxyRateWindow)
 	}
-	if proxyAuditLog != "" {
-		logInfo("Audit log: %s", proxyAuditLog)
+	if cfg.AuditLogPath != "" {
+		logInfo("Audit log: %s", cfg.AuditLogPath)
+	}
+	switch cassetteMode {
+	case proxy.CassetteRecord:
+		logInfo("Recording cassettes to %s", cassetteDir)
+	case proxy.CassetteReplay:
+		logInfo("Replaying cassettes from %s (%s matching)", cassetteDir, match)
 	}
 
 	return server.Start()
 }
+
+// pauseSandbox stops a sandbox whose budget is exhausted.
+func pauseSandbox(name string) error {
+	rt := getRuntime()
+	if rt == nil {
+		return fmt.Errorf("no container runtime available")
+	}
+	if err := config.MarkStopped(paths().SandboxesDir, name, config.StoppedByBudget); err != nil {
+		logging.Warn("failed to record the stop", "sandbox", name, "error", err)
+	}
+	if err := rt.Stop(context.Background(), name); err != nil {
+		return err
+	}
+	_ = auditLogger().LogEvent(audit.EventStop, name, "budget exhausted")
+	logging.Info("paused sandbox", "sandbox", name, "reason", "budget exhausted")
+	return nil
+}
+
+func runProxyRotate(cmd *cobra.Command, args []string) error {
+	name := args[0]
+	if _, err := loadSandbox(name); err != nil {
+		return err
+	}
+
+	p := paths()
+	existing, err := proxy.LoadToken(p.StateDir, name)
+	if err != nil {
+		return err
+	}
+	if existing == "" {
+		return fmt.Errorf("sandbox %s has no virtual API key (its template does not use the proxy)", name)
+	}
+	if _, err := proxy.IssueToken(p.StateDir, name); err != nil {
+		return err
+	}
+	logSuccess("Issued a new virtual API key to %s", name)
+	logInfo("Restart running agents to pick it up")
+	return nil
+}
+
+func runProxyStatus(cmd *cobra.Command, args []string) error {
+	client, err := adminClient()
+	if err != nil {
+		return err
+	}
+	status, err := client.Status()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ROUTE\tUPSTREAM\tKEY\tSTATE\tFAILURES")
+	fmt.Fprintln(w, "-----\t--------\t---\t-----\t--------")
+	for _, u := range status.Upstreams {
+		route := u.Route
+		if u.Failover {
+			route += " (failover)"
+		}
+		state := u.State
+		if u.OpenedAt != nil {
+			state += " since " + u.OpenedAt.Local().Format(time.TimeOnly)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\n", route, u.Upstream, u.SecretFile, state, u.Failures)
+	}
+	return w.Flush()
+}
+
+// adminAddr resolves the --admin flag.
+func adminAddr(stateDir string) string {
+	switch proxyAdmin {
+	case "":
+		return "unix:" + filepath.Join(stateDir, "proxy-admin.sock")
+	case "off":
+		return ""
+	}
+	return proxyAdmin
+}
+
+// auditLogPath returns the proxy's request audit log, or "" if disabled.
+func auditLogPath(stateDir string) string {
+	switch proxyAuditLog {
+	case "":
+		return filepath.Join(stateDir, "proxy-audit.log")
+	case "off":
+		return ""
+	}
+	return proxyAuditLog
+}
+
+// adminClient returns a client for the running proxy's admin API.
+func adminClient() (*proxy.AdminClient, error) {
+	addr := adminAddr(paths().StateDir)
+	if addr == "" {
+		return nil, fmt.Errorf("the admin API is disabled")
+	}
+	return proxy.NewAdminClient(addr), nil
+}
+
+func runProxyReload(cmd *cobra.Command, args []string) error {
+	client, err := adminClient()
+	if err != nil {
+		return err
+	}
+	if err := client.Reload(); err != nil {
+		return err
+	}
+	logSuccess("Proxy reloaded API keys and sandbox IPs")
+	return nil
+}
+
+func runProxySandboxes(cmd *cobra.Command, args []string) error {
+	client, err := adminClient()
+	if err != nil {
+		return err
+	}
+	sandboxes, err := client.Sandboxes()
+	if err != nil {
+		return err
+	}
+	if len(sandboxes) == 0 {
+		logInfo("The proxy knows no sandboxes")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SANDBOX\tIPS\tKEYS\tVIRTUAL KEY")
+	fmt.Fprintln(w, "-------\t---\t----\t-----------")
+	for _, sb := range sandboxes {
+		token := "no"
+		if sb.HasToken {
+			token = "yes"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", sb.Name, orDash(strings.Join(sb.IPs, ",")), orDash(strings.Join(sb.Keys, ",")), token)
+	}
+	return w.Flush()
+}
+
+func runProxyStats(cmd *cobra.Command, args []string) error {
+	client, err := adminClient()
+	if err != nil {
+		return err
+	}
+	stats, err := client.Stats()
+	if err != nil {
+		return err
+	}
+	limits, err := client.RateLimits()
+	if err != nil {
+		return err
+	}
+	limitBySandbox := make(map[string]proxy.RateLimitState, len(limits))
+	for _, l := range limits {
+		limitBySandbox[l.Sandbox] = l
+	}
+
+	if len(stats) == 0 {
+		logInfo("The proxy has served no requests yet")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SANDBOX\tREQUESTS\tSTATUS\tAVG LATENCY\tMAX LATENCY\tRATE LIMIT")
+	fmt.Fprintln(w, "-------\t--------\t------\t-----------\t-----------\t----------")
+	for _, st := range stats {
+		codes := make([]string, 0, len(st.ByStatus))
+		for code := range st.ByStatus {
+			codes = append(codes, code)
+		}
+		sort.Strings(codes)
+		var byStatus []string
+		for _, code := range codes {
+			byStatus = append(byStatus, fmt.Sprintf("%s:%d", code, st.ByStatus[code]))
+		}
+		limit := "-"
+		if l, ok := limitBySandbox[st.Sandbox]; ok {
+			limit = fmt.Sprintf("%d/%d per %s", l.Requests, l.Limit, l.Window)
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%.0fms\t%.0fms\t%s\n",
+			st.Sandbox, st.Requests, strings.Join(byStatus, " "), st.AvgLatencyMs, st.MaxLatencyMs, limit)
+	}
+	return w.Flush()
+}
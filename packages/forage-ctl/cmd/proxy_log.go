@@ -0,0 +1,172 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/proxy"
+)
+
+var proxyLogCmd = &cobra.Command{
+	Use:   "log",
+	Short: "Query the proxy's request audit log",
+	Long: `Show requests from the proxy's audit log, including its rotated files.
+
+Filter by sandbox, time range, status code or class (--status 429,5xx),
+path prefix and duration (--slow 30s). --since and --until accept a
+duration ago (2h) or a time (2026-01-02T15:04:05Z, 2026-01-02 15:04,
+2026-01-02). --follow keeps printing new requests, continuing across log
+rotations.
+
+--summary prints requests, error rates and latency per sandbox, and
+requests per sandbox per hour, instead of the requests themselves.`,
+	Args: cobra.NoArgs,
+	RunE: runProxyLog,
+}
+
+var (
+	proxyLogSandbox string
+	proxyLogSince   string
+	proxyLogUntil   string
+	proxyLogStatus  []string
+	proxyLogPath    string
+	proxyLogSlow    time.Duration
+	proxyLogFollow  bool
+	proxyLogSummary bool
+	proxyLogJSON    bool
+)
+
+func init() {
+	proxyLogCmd.Flags().StringVar(&proxyLogSandbox, "sandbox", "", "Only show requests of this sandbox")
+	proxyLogCmd.Flags().StringVar(&proxyLogSince, "since", "", "Only show requests from this time or duration ago on")
+	proxyLogCmd.Flags().StringVar(&proxyLogUntil, "until", "", "Only show requests before this time or duration ago")
+	proxyLogCmd.Flags().StringSliceVar(&proxyLogStatus, "status", nil, "Only show requests with these status codes or classes (e.g. 429,5xx)")
+	proxyLogCmd.Flags().StringVar(&proxyLogPath, "path", "", "Only show requests whose path starts with this prefix")
+	proxyLogCmd.Flags().DurationVar(&proxyLogSlow, "slow", 0, "Only show requests that took at least this long")
+	proxyLogCmd.Flags().BoolVarP(&proxyLogFollow, "follow", "f", false, "Keep printing new requests")
+	proxyLogCmd.Flags().BoolVar(&proxyLogSummary, "summary", false, "Summarize requests per sandbox and hour")
+	proxyLogCmd.Flags().BoolVar(&proxyLogJSON, "json", false, "Output requests as JSON lines")
+	proxyLogCmd.MarkFlagsMutuallyExclusive("follow", "summary")
+}
+
+func runProxyLog(cmd *cobra.Command, args []string) error {
+	path := auditLogPath(paths().StateDir)
+	if path == "" {
+		return fmt.Errorf("the audit log is disabled")
+	}
+
+	now := time.Now()
+	filter := proxy.LogFilter{
+		Sandbox:     proxyLogSandbox,
+		Status:      proxyLogStatus,
+		PathPrefix:  proxyLogPath,
+		MinDuration: proxyLogSlow,
+	}
+	var err error
+	if filter.Since, err = parseLogTime(proxyLogSince, now); err != nil {
+		return fmt.Errorf("invalid --since: %w", err)
+	}
+	if filter.Until, err = parseLogTime(proxyLogUntil, now); err != nil {
+		return fmt.Errorf("invalid --until: %w", err)
+	}
+	if err := filter.Validate(); err != nil {
+		return err
+	}
+
+	if proxyLogFollow {
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+		return proxy.FollowLog(ctx, path, filter, true, printLogEntry)
+	}
+
+	entries, err := proxy.ReadLog(path, filter)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		logInfo("No requests found in %s", path)
+		return nil
+	}
+	if proxyLogSummary {
+		return printLogSummary(entries)
+	}
+	for _, e := range entries {
+		printLogEntry(e)
+	}
+	return nil
+}
+
+// parseLogTime parses a --since or --until value: a duration before now,
+// or a time. The empty string is the zero time.
+func parseLogTime(s string, now time.Time) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02 15:04", time.DateOnly} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%q is neither a duration nor a time", s)
+}
+
+func printLogEntry(e proxy.LogEntry) {
+	if proxyLogJSON {
+		data, err := json.Marshal(e)
+		if err == nil {
+			fmt.Println(string(data))
+		}
+		return
+	}
+	fmt.Printf("[%s] %d %-20s %-6s %s (%s, %s)\n",
+		e.Timestamp.Local().Format("2006-01-02 15:04:05"), e.StatusCode, orDash(e.Sandbox),
+		e.Method, e.Path, e.Duration.Round(time.Millisecond), orDash(e.Route))
+}
+
+func printLogSummary(entries []proxy.LogEntry) error {
+	summaries, hourly := proxy.SummarizeLog(entries)
+	if proxyLogJSON {
+		data, err := json.MarshalIndent(map[string]any{"sandboxes": summaries, "hourly": hourly}, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SANDBOX\tREQUESTS\t4XX\t5XX\tERROR RATE\tAVG LATENCY\tMAX LATENCY")
+	fmt.Fprintln(w, "-------\t--------\t---\t---\t----------\t-----------\t-----------")
+	for _, s := range summaries {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%.1f%%\t%s\t%s\n",
+			orDash(s.Sandbox), s.Requests, s.ClientErrors, s.ServerErrors, s.ErrorRate()*100,
+			s.AvgDuration.Round(time.Millisecond), s.MaxDuration.Round(time.Millisecond))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Println()
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "HOUR\tSANDBOX\tREQUESTS\tERRORS")
+	fmt.Fprintln(w, "----\t-------\t--------\t------")
+	for _, h := range hourly {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\n",
+			h.Hour.Local().Format("2006-01-02 15:04"), orDash(h.Sandbox), h.Requests, h.Errors)
+	}
+	return w.Flush()
+}
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"text/tabwriter"
@@ -8,16 +9,23 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/health"
-	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/multiplexer"
 )
 
 var psCmd = &cobra.Command{
 	Use:   "ps",
 	Short: "List all sandboxes",
-	RunE:  runPs,
+	Long: `List all sandboxes with their status.
+
+Sandboxes are checked concurrently. Running sandboxes take the status the
+health monitor recorded during its last round, if recent, instead of being
+checked over SSH; use --refresh to check them all.`,
+	RunE: runPs,
 }
 
+var psRefresh bool
+
 func init() {
+	psCmd.Flags().BoolVar(&psRefresh, "refresh", false, "Check every sandbox instead of using the monitor's recent statuses")
 	rootCmd.AddCommand(psCmd)
 }
 
@@ -35,17 +43,25 @@ func runPs(cmd *cobra.Command, args []string) error {
 	}
 
 	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-	fmt.Fprintln(w, "NAME\tTEMPLATE\tIP\tMODE\tWORKSPACE\tSTATUS")
-	fmt.Fprintln(w, "----\t--------\t--\t----\t---------\t------")
+	fmt.Fprintln(w, "NAME\tTEMPLATE\tGROUP\tIP\tMODE\tWORKSPACE\tSTATUS")
+	fmt.Fprintln(w, "----\t--------\t-----\t--\t----\t---------\t------")
+
+	opts := health.CollectOptions{Services: sandboxServices}
+	if !psRefresh {
+		opts.Cache = health.StatusCachePath(paths().StateDir)
+	}
+	statuses := health.Collect(context.Background(), rt, paths(), sandboxes, opts)
 
-	for _, sb := range sandboxes {
+	for i, sb := range sandboxes {
 		mode := sb.WorkspaceMode
-		mux := multiplexer.New(multiplexer.Type(sb.Multiplexer))
-		status := health.GetSummary(sb.Name, sb.ContainerIP(), rt, mux)
-		statusStr := formatStatus(status)
+		statusStr := formatStatus(health.ApplyRestarts(statuses[i].Status, sb))
+		group := sb.Group
+		if group == "" {
+			group = "-"
+		}
 
-		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
-			sb.Name, sb.Template, sb.ContainerIP(), mode, sb.Workspace, statusStr)
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			sb.Name, sb.Template, group, sb.ContainerIP(), mode, sb.Workspace, statusStr)
 	}
 
 	return w.Flush()
@@ -61,6 +77,10 @@ func formatStatus(status health.Status) string {
 		return "○ no-mux"
 	case health.StatusStopped:
 		return "● stopped"
+	case health.StatusDegraded:
+		return "◐ degraded"
+	case health.StatusCrashLoop:
+		return "✗ crash-loop"
 	default:
 		return string(status)
 	}
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"path/filepath"
 	"time"
@@ -11,6 +12,7 @@ import (
 	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/health"
 	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/logging"
 	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/runtime"
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/sandbox"
 )
 
 var resetCmd = &cobra.Command{
@@ -71,6 +73,8 @@ func runReset(cmd *cobra.Command, args []string) error {
 		logWarning("SSH not ready after %d seconds", health.SSHReadyTimeoutSeconds)
 	}
 
+	sandbox.StartServices(context.Background(), getRuntime(), name, sandboxServices(metadata))
+
 	logSuccess("Reset sandbox %s", name)
 	return nil
 }
@@ -1,11 +1,15 @@
 package cmd
 
 import (
+	"context"
+
 	"github.com/spf13/cobra"
 
 	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/app"
 	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/audit"
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/config"
 	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/errors"
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/sandbox"
 )
 
 var startCmd = &cobra.Command{
@@ -22,7 +26,7 @@ func init() {
 func runStart(cmd *cobra.Command, args []string) error {
 	name := args[0]
 
-	_, err := loadSandbox(name)
+	metadata, err := loadSandbox(name)
 	if err != nil {
 		return err
 	}
@@ -35,8 +39,13 @@ func runStart(cmd *cobra.Command, args []string) error {
 	if err := app.Default.Start(name); err != nil {
 		return errors.ContainerFailed("start", err)
 	}
+	if err := config.MarkStarted(paths().SandboxesDir, name); err != nil {
+		logWarning("Failed to record the start: %v", err)
+	}
+
+	sandbox.StartServices(context.Background(), getRuntime(), name, sandboxServices(metadata))
 
-	auditLog := audit.NewLogger(paths().StateDir)
+	auditLog := auditLogger()
 	_ = auditLog.LogEvent(audit.EventStart, name, "")
 
 	logSuccess("Started sandbox %s", name)
@@ -1,11 +1,14 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/config"
 	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/health"
 	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/multiplexer"
 )
@@ -31,10 +34,22 @@ func runStatus(cmd *cobra.Command, args []string) error {
 
 	mux := multiplexer.New(multiplexer.Type(metadata.Multiplexer))
 	result := health.Check(name, metadata.ContainerIP(), getRuntime(), mux)
+	if services := sandboxServices(metadata); result.SSHReachable && len(services) > 0 {
+		result.Services = health.CheckServices(metadata.ContainerIP(), services)
+	}
+	if result.ContainerRunning {
+		result.Probes = health.CheckSandboxProbes(context.Background(), getRuntime(), paths(), metadata)
+	}
 
 	fmt.Printf("Sandbox: %s\n", metadata.Name)
 	fmt.Printf("Template: %s\n", metadata.Template)
 	fmt.Printf("IP: %s\n", metadata.ContainerIP())
+	if ipv6 := metadata.Addresses().ContainerIPv6; ipv6 != "" {
+		fmt.Printf("IPv6: %s\n", ipv6)
+	}
+	if metadata.Group != "" {
+		fmt.Printf("Group: %s\n", metadata.Group)
+	}
 	fmt.Printf("Workspace: %s\n", metadata.Workspace)
 
 	mode := metadata.WorkspaceMode
@@ -69,6 +84,12 @@ func runStatus(cmd *cobra.Command, args []string) error {
 	// Health status
 	fmt.Println("Health Checks:")
 	fmt.Printf("  Container: %s\n", boolStatus(result.ContainerRunning))
+	if !result.ContainerRunning && metadata.StoppedBy != "" {
+		fmt.Printf("  Stopped by: %s\n", metadata.StoppedBy)
+	}
+	if metadata.Restarts != nil {
+		fmt.Printf("  Restarts: %s\n", restartStatus(metadata.Restarts))
+	}
 	if result.ContainerRunning {
 		fmt.Printf("  Uptime: %s\n", result.Uptime)
 		fmt.Printf("  SSH: %s\n", boolStatus(result.SSHReachable))
@@ -76,11 +97,38 @@ func runStatus(cmd *cobra.Command, args []string) error {
 		if len(result.MuxWindows) > 0 {
 			fmt.Printf("  Windows: %s\n", strings.Join(result.MuxWindows, ", "))
 		}
+		for _, svc := range result.Services {
+			fmt.Printf("  Service %s: %s\n", svc.Name, boolStatus(svc.Ready))
+		}
+		for _, probe := range result.Probes {
+			fmt.Printf("  Probe %s: %s\n", probe.Name, probeStatus(probe))
+		}
 	}
 
 	return nil
 }
 
+// probeStatus renders a probe state, with the failure of its last run.
+func probeStatus(probe health.ProbeState) string {
+	switch {
+	case probe.Failures == 0:
+		return "✓"
+	case probe.Healthy:
+		return fmt.Sprintf("✓ (%d failed: %s)", probe.Failures, probe.Message)
+	default:
+		return fmt.Sprintf("✗ (%d failed: %s)", probe.Failures, probe.Message)
+	}
+}
+
+// restartStatus renders the restarts of a sandbox by the health monitor.
+func restartStatus(r *config.RestartState) string {
+	last := r.Last.Local().Format(time.DateTime)
+	if r.CrashLoop {
+		return fmt.Sprintf("✗ crash loop, gave up after %d (last %s)", r.Count, last)
+	}
+	return fmt.Sprintf("%d (last %s)", r.Count, last)
+}
+
 func boolStatus(b bool) string {
 	if b {
 		return "✓"
@@ -7,6 +7,7 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/audit"
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/config"
 	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/errors"
 	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/runtime"
 )
@@ -33,6 +34,11 @@ func runStop(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	// Recorded first, so the monitor does not restart it meanwhile
+	if err := config.MarkStopped(paths().SandboxesDir, name, config.StoppedByUser); err != nil {
+		logWarning("Failed to record the stop, the monitor may restart the sandbox: %v", err)
+	}
+
 	rt := getRuntime()
 	ctx := context.Background()
 
@@ -54,7 +60,7 @@ func runStop(cmd *cobra.Command, args []string) error {
 		return errors.ContainerFailed("stop", stopErr)
 	}
 
-	auditLog := audit.NewLogger(paths().StateDir)
+	auditLog := auditLogger()
 	_ = auditLog.LogEvent(audit.EventStop, name, "")
 
 	logSuccess("Stopped sandbox %s", name)
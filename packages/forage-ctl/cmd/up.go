@@ -30,6 +30,8 @@ var (
 	upGitUser     string
 	upGitEmail    string
 	upSSHKeyPath  string
+	upGroup       string
+	upBudget      string
 )
 
 func init() {
@@ -43,6 +45,8 @@ func init() {
 	upCmd.Flags().StringVar(&upGitUser, "git-user", "", "Git user.name for agent commits")
 	upCmd.Flags().StringVar(&upGitEmail, "git-email", "", "Git user.email for agent commits")
 	upCmd.Flags().StringVar(&upSSHKeyPath, "ssh-key-path", "", "Path to SSH private key for agent push access")
+	upCmd.Flags().StringVar(&upGroup, "group", "", "Join a sandbox group sharing a private network (members resolve each other by name)")
+	upCmd.Flags().StringVar(&upBudget, "budget", "", "API budget enforced by the proxy, overriding the template's (e.g. daily-cost=5,total-tokens=2000000,pause; \"none\" for no budget)")
 	if err := upCmd.MarkFlagRequired("template"); err != nil {
 		panic(err)
 	}
@@ -127,6 +131,13 @@ func parseCreateOptions(name string) (sandbox.CreateOptions, error) {
 		return sandbox.CreateOptions{}, err
 	}
 
+	var budget *config.Budget
+	if upBudget != "" {
+		if budget, err = config.ParseBudget(upBudget); err != nil {
+			return sandbox.CreateOptions{}, err
+		}
+	}
+
 	return sandbox.CreateOptions{
 		Name:        name,
 		Template:    upTemplate,
@@ -138,5 +149,7 @@ func parseCreateOptions(name string) (sandbox.CreateOptions, error) {
 		GitUser:     upGitUser,
 		GitEmail:    upGitEmail,
 		SSHKeyPath:  upSSHKeyPath,
+		Group:       upGroup,
+		Budget:      budget,
 	}, nil
 }
@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/config"
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/logging"
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/usage"
+)
+
+var usageCmd = &cobra.Command{
+	Use:   "usage",
+	Short: "Show API token usage and estimated cost per sandbox",
+	Long: `Show API token usage recorded by the API proxy, per sandbox and model,
+with estimated costs.
+
+Costs are estimated from a built-in table of list prices, which can be
+overridden or extended with modelPrices in the host config. Models missing
+from the table show "?" as their cost.
+
+--since accepts a duration ago (24h) or a time (2026-01-02 15:04,
+RFC 3339).`,
+	Args: cobra.NoArgs,
+	RunE: runUsage,
+}
+
+var (
+	usageSandbox string
+	usageSince   string
+)
+
+func init() {
+	usageCmd.Flags().StringVar(&usageSandbox, "sandbox", "", "Only show usage of this sandbox")
+	usageCmd.Flags().StringVar(&usageSince, "since", "", "Only show usage from this time or duration ago on")
+	rootCmd.AddCommand(usageCmd)
+}
+
+func runUsage(cmd *cobra.Command, args []string) error {
+	p := paths()
+
+	since, err := parseLogTime(usageSince, time.Now())
+	if err != nil {
+		return fmt.Errorf("invalid --since: %w", err)
+	}
+	filter := usage.Filter{Sandbox: usageSandbox, Since: since}
+	records, err := usage.Read(usage.Path(p.StateDir), filter)
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		logInfo("No API usage recorded")
+		return nil
+	}
+
+	totals := usage.Summarize(records, loadPrices(p.ConfigDir))
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SANDBOX\tMODEL\tREQUESTS\tINPUT\tOUTPUT\tCACHE WRITE\tCACHE READ\tCOST")
+	fmt.Fprintln(w, "-------\t-----\t--------\t-----\t------\t-----------\t----------\t----")
+
+	var sum usage.Total
+	unpriced := false
+	for _, t := range totals {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%d\t%d\t%s\n",
+			orDash(t.Sandbox), orDash(t.Model), t.Requests,
+			t.Input, t.Output, t.CacheWrite, t.CacheRead, formatCost(t))
+		sum.Requests += t.Requests
+		sum.Tokens = sum.Tokens.Add(t.Tokens)
+		sum.Cost += t.Cost
+		unpriced = unpriced || !t.Priced
+	}
+	if len(totals) > 1 {
+		sum.Priced = true
+		total := formatCost(sum)
+		if unpriced {
+			total = ">" + total
+		}
+		fmt.Fprintf(w, "TOTAL\t\t%d\t%d\t%d\t%d\t%d\t%s\n",
+			sum.Requests, sum.Input, sum.Output, sum.CacheWrite, sum.CacheRead, total)
+	}
+	return w.Flush()
+}
+
+// loadPrices returns the built-in price table merged with the host
+// config's modelPrices.
+func loadPrices(configDir string) usage.Prices {
+	var overrides map[string]config.ModelPrice
+	if hostConfig, err := config.LoadHostConfig(configDir); err == nil {
+		overrides = hostConfig.ModelPrices
+	} else {
+		logging.Debug("failed to load host config, using built-in prices", "error", err)
+	}
+	return usage.DefaultPrices(overrides)
+}
+
+// formatCost renders an estimated cost, or "?" if the model has no price.
+func formatCost(t usage.Total) string {
+	if !t.Priced {
+		return "?"
+	}
+	return fmt.Sprintf("$%.2f", t.Cost)
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
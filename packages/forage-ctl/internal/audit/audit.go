@@ -1,5 +1,6 @@
 // Package audit provides structured event logging for sandbox lifecycle events.
-// Events are stored as JSON Lines (JSONL) files, one per sandbox.
+// Events are stored as JSON Lines (JSONL) files, one per sandbox, chained
+// by hash so that tampering can be detected (see Verify).
 package audit
 
 import (
@@ -8,6 +9,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"syscall"
 	"time"
 )
 
@@ -22,6 +24,9 @@ const (
 	EventExec    EventType = "exec"
 	EventHealth  EventType = "health"
 	EventError   EventType = "error"
+	EventBudget  EventType = "budget"
+	EventSecret  EventType = "secret"
+	EventPolicy  EventType = "policy"
 )
 
 // Event represents a single audit log entry.
@@ -30,17 +35,29 @@ type Event struct {
 	Type      EventType `json:"type"`
 	Sandbox   string    `json:"sandbox"`
 	Details   string    `json:"details,omitempty"`
+
+	// Seq numbers the events of a log from 1, and PrevHash is the SHA-256
+	// of the log line before, empty for the first. MAC signs the entry if
+	// the log has a key. Entries logged before chaining lack all three.
+	Seq      uint64 `json:"seq,omitempty"`
+	PrevHash string `json:"prevHash,omitempty"`
+	MAC      string `json:"mac,omitempty"` // must stay last, see macSuffix
 }
 
 // Logger writes and reads audit events for sandboxes.
 // Events are stored in {stateDir}/sandboxes/{name}/events.jsonl.
 type Logger struct {
 	stateDir string
+	key      []byte
 }
 
 // NewLogger creates a new audit logger rooted at stateDir.
-func NewLogger(stateDir string) *Logger {
-	return &Logger{stateDir: stateDir}
+func NewLogger(stateDir string, opts ...Option) *Logger {
+	l := &Logger{stateDir: stateDir}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
 }
 
 // eventPath returns the path to the JSONL event log for a sandbox.
@@ -48,7 +65,9 @@ func (l *Logger) eventPath(sandbox string) string {
 	return filepath.Join(l.stateDir, "sandboxes", sandbox+".events.jsonl")
 }
 
-// Log appends an event to the sandbox's audit log.
+// Log appends an event to the sandbox's audit log, chaining it to the
+// event before. The log is locked while appending, as several processes
+// log events of the same sandbox.
 func (l *Logger) Log(event Event) error {
 	if event.Timestamp.IsZero() {
 		event.Timestamp = time.Now()
@@ -59,21 +78,30 @@ func (l *Logger) Log(event Event) error {
 		return fmt.Errorf("failed to create audit log directory: %w", err)
 	}
 
-	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0600)
 	if err != nil {
 		return fmt.Errorf("failed to open audit log: %w", err)
 	}
 	defer func() { _ = f.Close() }()
 
-	data, err := json.Marshal(event)
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		return fmt.Errorf("failed to lock audit log: %w", err)
+	}
+	defer func() { _ = syscall.Flock(int(f.Fd()), syscall.LOCK_UN) }()
+
+	data, seq, err := l.chain(f, event)
 	if err != nil {
-		return fmt.Errorf("failed to marshal event: %w", err)
+		return err
 	}
 
 	if _, err := f.Write(append(data, '\n')); err != nil {
 		return fmt.Errorf("failed to write event: %w", err)
 	}
 
+	if err := l.writeHead(path, seq, data); err != nil {
+		return fmt.Errorf("failed to write audit log head: %w", err)
+	}
+
 	return nil
 }
 
@@ -121,11 +149,41 @@ func (l *Logger) Events(sandbox string) ([]Event, error) {
 	return events, nil
 }
 
+// archiveDir returns the directory holding the audit logs of removed
+// sandboxes.
+func (l *Logger) archiveDir() string {
+	return filepath.Join(l.stateDir, "audit-archive")
+}
+
+// Archive moves the audit log of a sandbox into the archive, so its
+// history outlives the sandbox. Archived logs are named after the sandbox
+// and the time of archiving, as a name may be reused.
+func (l *Logger) Archive(sandbox string) error {
+	path := l.eventPath(sandbox)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+	if err := os.MkdirAll(l.archiveDir(), 0700); err != nil {
+		return fmt.Errorf("failed to create audit archive: %w", err)
+	}
+	name := fmt.Sprintf("%s.%s.events.jsonl", sandbox, time.Now().UTC().Format("20060102T150405.000000000Z"))
+	archived := filepath.Join(l.archiveDir(), name)
+	if err := os.Rename(path, archived); err != nil {
+		return fmt.Errorf("failed to archive audit log: %w", err)
+	}
+	if err := os.Rename(headPath(path), headPath(archived)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to archive audit log head: %w", err)
+	}
+	return nil
+}
+
 // Remove deletes the audit log for a sandbox.
 func (l *Logger) Remove(sandbox string) error {
 	path := l.eventPath(sandbox)
-	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
-		return err
+	for _, p := range []string{path, headPath(path)} {
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			return err
+		}
 	}
 	return nil
 }
@@ -0,0 +1,316 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Audit logs are hash chained: each event carries a sequence number and
+// the hash of the log line before it, so edited, removed or reordered
+// entries break the chain. A head file next to each log records the last
+// sequence number and hash, which exposes entries cut off the end. With a
+// key, events and heads also carry an HMAC, so that whoever can write the
+// log but not read the key cannot rebuild a consistent chain.
+
+// Option configures a Logger.
+type Option func(*Logger)
+
+// WithKey signs events with an HMAC-SHA256 keyed by key.
+func WithKey(key []byte) Option {
+	return func(l *Logger) { l.key = key }
+}
+
+// LoadKey reads an audit signing key. An empty path means no key.
+func LoadKey(path string) ([]byte, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audit key: %w", err)
+	}
+	key := bytes.TrimSpace(data)
+	if len(key) < 16 {
+		return nil, fmt.Errorf("audit key %s is too short (at least 16 bytes)", path)
+	}
+	return key, nil
+}
+
+// head is the last link of a sandbox's audit chain.
+type head struct {
+	Seq  uint64 `json:"seq"`
+	Hash string `json:"hash"`
+	MAC  string `json:"mac,omitempty"`
+}
+
+// headPath returns the head file of an audit log.
+func headPath(logPath string) string {
+	return strings.TrimSuffix(logPath, ".jsonl") + ".head"
+}
+
+// lineHash is the hash the next event links to.
+func lineHash(line []byte) string {
+	sum := sha256.Sum256(line)
+	return hex.EncodeToString(sum[:])
+}
+
+// mac returns the hex HMAC-SHA256 of data.
+func mac(key, data []byte) string {
+	m := hmac.New(sha256.New, key)
+	m.Write(data)
+	return hex.EncodeToString(m.Sum(nil))
+}
+
+// headMAC returns the MAC of a head.
+func headMAC(key []byte, h head) string {
+	return mac(key, fmt.Appendf(nil, "%d:%s", h.Seq, h.Hash))
+}
+
+// macSuffix is how the MAC ends a signed log line. Events are signed
+// without it, with the MAC as their last field.
+func macSuffix(sig string) string {
+	return `,"mac":"` + sig + `"}`
+}
+
+// validMAC reports whether sig signs the log line, which must end with it.
+func validMAC(key, line []byte, sig string) bool {
+	suffix := []byte(macSuffix(sig))
+	if !bytes.HasSuffix(line, suffix) {
+		return false
+	}
+	unsigned := append(bytes.Clone(line[:len(line)-len(suffix)]), '}')
+	return hmac.Equal([]byte(sig), []byte(mac(key, unsigned)))
+}
+
+// chain links an event to the end of the log in f, which must be locked,
+// and returns its line, signed if the logger has a key, and its sequence
+// number.
+func (l *Logger) chain(f *os.File, event Event) ([]byte, uint64, error) {
+	last, err := lastLine(f)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read audit log: %w", err)
+	}
+	event.Seq, event.PrevHash, event.MAC = 1, "", ""
+	if last != nil {
+		var prev Event
+		_ = json.Unmarshal(last, &prev) // unchained or malformed: the chain starts here
+		event.Seq = prev.Seq + 1
+		event.PrevHash = lineHash(last)
+	}
+
+	line, err := json.Marshal(event)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to marshal event: %w", err)
+	}
+	if l.key != nil {
+		sig := mac(l.key, line)
+		line = append(line[:len(line)-1], macSuffix(sig)...)
+	}
+	return line, event.Seq, nil
+}
+
+// writeHead records the event just appended as the head of the log.
+func (l *Logger) writeHead(logPath string, seq uint64, line []byte) error {
+	h := head{Seq: seq, Hash: lineHash(line)}
+	if l.key != nil {
+		h.MAC = headMAC(l.key, h)
+	}
+	data, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+	tmp := headPath(logPath) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, headPath(logPath))
+}
+
+// lastLine returns the last complete line of f without its newline, or nil
+// if there is none.
+func lastLine(f *os.File) ([]byte, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	end := info.Size()
+	const chunk = 4096
+	var tail []byte
+	for pos := end; pos > 0; {
+		n := int64(min(chunk, pos))
+		pos -= n
+		buf := make([]byte, n)
+		if _, err := f.ReadAt(buf, pos); err != nil && err != io.EOF {
+			return nil, err
+		}
+		tail = append(buf, tail...)
+		trimmed := bytes.TrimRight(tail, "\n")
+		if i := bytes.LastIndexByte(trimmed, '\n'); i >= 0 {
+			return trimmed[i+1:], nil
+		}
+		if pos == 0 && len(trimmed) > 0 {
+			return trimmed, nil
+		}
+	}
+	return nil, nil
+}
+
+// Problem is an inconsistency found in an audit log.
+type Problem struct {
+	Line    int    `json:"line"` // 0 for problems with the log as a whole
+	Message string `json:"message"`
+}
+
+// Verification is the result of verifying one audit log.
+type Verification struct {
+	Path      string    `json:"path"`
+	Entries   int       `json:"entries"`
+	Unchained int       `json:"unchained"` // entries logged before chaining, which cannot be verified
+	Signed    bool      `json:"signed"`    // signatures were checked
+	Problems  []Problem `json:"problems,omitempty"`
+}
+
+// OK reports whether the log verified without problems.
+func (v *Verification) OK() bool {
+	return len(v.Problems) == 0
+}
+
+func (v *Verification) problem(line int, format string, args ...any) {
+	v.Problems = append(v.Problems, Problem{Line: line, Message: fmt.Sprintf(format, args...)})
+}
+
+// Verify checks the audit logs of a sandbox, live and archived, or of all
+// sandboxes if sandbox is empty. Signatures are checked if the logger has
+// a key.
+func (l *Logger) Verify(sandbox string) ([]*Verification, error) {
+	filter := Filter{Sandbox: sandbox}
+	archived, err := l.archivedLogs(filter)
+	if err != nil {
+		return nil, err
+	}
+	live, err := l.liveLogs(filter)
+	if err != nil {
+		return nil, err
+	}
+	var results []*Verification
+	for _, path := range append(archived, live...) {
+		v, err := VerifyFile(path, l.key)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, v)
+	}
+	return results, nil
+}
+
+// VerifyFile checks the hash chain of the audit log at path, and with a
+// key, its signatures. Entries written before the log was chained are
+// counted but cannot be verified; once chained, every entry must be.
+func VerifyFile(path string, key []byte) (*Verification, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	v := &Verification{Path: filepath.Clean(path), Signed: key != nil}
+	var prevLine []byte
+	var prevSeq uint64
+	chained := false
+
+	br := bufio.NewReader(f)
+	for n := 1; ; n++ {
+		line, err := br.ReadBytes('\n')
+		if err == io.EOF && len(line) == 0 {
+			break
+		}
+		if err != nil && err != io.EOF {
+			return nil, fmt.Errorf("error reading audit log: %w", err)
+		}
+		line = bytes.TrimRight(line, "\n")
+		if len(line) == 0 {
+			continue
+		}
+		v.Entries++
+
+		var e Event
+		if json.Unmarshal(line, &e) != nil {
+			v.problem(n, "malformed entry")
+			prevLine = line
+			continue
+		}
+
+		switch {
+		case e.Seq == 0 && chained:
+			v.problem(n, "entry is not chained")
+		case e.Seq == 0:
+			v.Unchained++
+		default:
+			switch {
+			case !chained && e.Seq != 1:
+				v.problem(n, "entries 1 to %d are missing", e.Seq-1)
+			case chained && e.Seq <= prevSeq:
+				v.problem(n, "entry %d follows entry %d: entries reordered or duplicated", e.Seq, prevSeq)
+			case chained && e.Seq > prevSeq+1:
+				v.problem(n, "entries %d to %d are missing", prevSeq+1, e.Seq-1)
+			}
+			wantPrev := ""
+			if prevLine != nil {
+				wantPrev = lineHash(prevLine)
+			}
+			if e.PrevHash != wantPrev {
+				v.problem(n, "entry %d does not follow the entry before it: an entry was edited, removed or reordered", e.Seq)
+			}
+			if key != nil {
+				if e.MAC == "" {
+					v.problem(n, "entry %d is not signed", e.Seq)
+				} else if !validMAC(key, line, e.MAC) {
+					v.problem(n, "entry %d has an invalid signature: it was edited or forged", e.Seq)
+				}
+			}
+			chained = true
+			prevSeq = e.Seq
+		}
+		prevLine = line
+	}
+
+	verifyHead(v, path, key, prevSeq, prevLine)
+	return v, nil
+}
+
+// verifyHead checks that the log ends where its head says it does.
+func verifyHead(v *Verification, path string, key []byte, lastSeq uint64, lastLine []byte) {
+	data, err := os.ReadFile(headPath(path))
+	if os.IsNotExist(err) {
+		if lastSeq > 0 {
+			v.problem(0, "head file is missing")
+		}
+		return
+	}
+	var h head
+	if err != nil || json.Unmarshal(data, &h) != nil {
+		v.problem(0, "head file is unreadable")
+		return
+	}
+	if key != nil && !hmac.Equal([]byte(h.MAC), []byte(headMAC(key, h))) {
+		v.problem(0, "head file has an invalid signature")
+		return
+	}
+	switch {
+	case h.Seq > lastSeq:
+		v.problem(0, "log ends at entry %d but its head records entry %d: entries were cut off the end", lastSeq, h.Seq)
+	case h.Seq < lastSeq:
+		v.problem(0, "log continues past its head (entry %d) to entry %d: entries were appended around the logger", h.Seq, lastSeq)
+	case lastLine != nil && h.Hash != lineHash(lastLine):
+		v.problem(0, "last entry does not match the head: it was edited")
+	}
+}
@@ -0,0 +1,252 @@
+package audit
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var testKey = []byte("0123456789abcdef0123456789abcdef")
+
+// writeChain logs n events for sandbox "web" and returns the log's path.
+func writeChain(t *testing.T, logger *Logger, n int) string {
+	t.Helper()
+	start := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	for i := range n {
+		e := Event{Timestamp: start.Add(time.Duration(i) * time.Second), Type: EventExec, Sandbox: "web", Details: "step " + string(rune('a'+i))}
+		if err := logger.Log(e); err != nil {
+			t.Fatalf("Log failed: %v", err)
+		}
+	}
+	return logger.eventPath("web")
+}
+
+// editLines rewrites the lines of the log at path.
+func editLines(t *testing.T, path string, edit func([]string) []string) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := edit(strings.Split(strings.TrimSuffix(string(data), "\n"), "\n"))
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func verify(t *testing.T, path string, key []byte) *Verification {
+	t.Helper()
+	v, err := VerifyFile(path, key)
+	if err != nil {
+		t.Fatalf("VerifyFile failed: %v", err)
+	}
+	return v
+}
+
+func TestLogger_ChainsEvents(t *testing.T) {
+	logger := NewLogger(t.TempDir())
+	writeChain(t, logger, 3)
+
+	events, err := logger.Events("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, e := range events {
+		if e.Seq != uint64(i+1) {
+			t.Errorf("event %d: seq = %d, want %d", i, e.Seq, i+1)
+		}
+		if (e.PrevHash == "") != (i == 0) {
+			t.Errorf("event %d: prevHash = %q", i, e.PrevHash)
+		}
+		if e.MAC != "" {
+			t.Errorf("event %d: unexpected MAC without a key", i)
+		}
+	}
+}
+
+func TestVerifyFile_Intact(t *testing.T) {
+	for _, key := range [][]byte{nil, testKey} {
+		path := writeChain(t, NewLogger(t.TempDir(), WithKey(key)), 4)
+		v := verify(t, path, key)
+		if !v.OK() || v.Entries != 4 || v.Signed != (key != nil) {
+			t.Errorf("key %v: got %+v, want 4 entries without problems", key != nil, v)
+		}
+	}
+}
+
+func TestVerifyFile_DetectsTampering(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func([]string) []string
+		want string
+	}{
+		{"edited entry", func(l []string) []string {
+			l[1] = strings.Replace(l[1], "step b", "step x", 1)
+			return l
+		}, "entry 3 does not follow"},
+		{"edited last entry", func(l []string) []string {
+			l[3] = strings.Replace(l[3], "step d", "step x", 1)
+			return l
+		}, "last entry does not match the head"},
+		{"removed entry", func(l []string) []string {
+			return append(l[:1], l[2:]...)
+		}, "entries 2 to 2 are missing"},
+		{"reordered entries", func(l []string) []string {
+			l[1], l[2] = l[2], l[1]
+			return l
+		}, "entry 2 follows entry 3"},
+		{"truncated start", func(l []string) []string {
+			return l[2:]
+		}, "entries 1 to 2 are missing"},
+		{"truncated end", func(l []string) []string {
+			return l[:2]
+		}, "entries were cut off the end"},
+		{"malformed entry", func(l []string) []string {
+			l[1] = "{"
+			return l
+		}, "malformed entry"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeChain(t, NewLogger(t.TempDir()), 4)
+			editLines(t, path, tt.edit)
+
+			v := verify(t, path, nil)
+			var messages []string
+			for _, p := range v.Problems {
+				messages = append(messages, p.Message)
+			}
+			if !strings.Contains(strings.Join(messages, "\n"), tt.want) {
+				t.Errorf("problems = %q, want one containing %q", messages, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyFile_DetectsForgedChain(t *testing.T) {
+	dir := t.TempDir()
+	path := writeChain(t, NewLogger(dir, WithKey(testKey)), 3)
+
+	// Without the key, a rewritten log can only be chained unsigned or
+	// signed with another key
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	writeChain(t, NewLogger(dir, WithKey([]byte("another key, 16+ bytes"))), 3)
+
+	v := verify(t, path, testKey)
+	if v.OK() {
+		t.Fatal("forged chain verified")
+	}
+	if got := v.Problems[0].Message; !strings.Contains(got, "invalid signature") {
+		t.Errorf("first problem = %q, want an invalid signature", got)
+	}
+	if ok := verify(t, path, nil).OK(); !ok {
+		t.Error("forged chain should still hash correctly without the key")
+	}
+}
+
+func TestVerifyFile_UnchainedPrefix(t *testing.T) {
+	logger := NewLogger(t.TempDir())
+	path := logger.eventPath("web")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	legacy := `{"timestamp":"2026-01-01T00:00:00Z","type":"create","sandbox":"web"}` + "\n"
+	if err := os.WriteFile(path, []byte(legacy), 0600); err != nil {
+		t.Fatal(err)
+	}
+	writeChain(t, logger, 2)
+
+	v := verify(t, path, nil)
+	if !v.OK() || v.Entries != 3 || v.Unchained != 1 {
+		t.Errorf("got %+v, want 3 entries, 1 unchained, no problems", v)
+	}
+
+	// Unchained entries after the chain started are not accepted
+	editLines(t, path, func(l []string) []string {
+		return append(l[:2], strings.TrimSuffix(legacy, "\n"), l[2])
+	})
+	if verify(t, path, nil).OK() {
+		t.Error("unchained entry inside the chain verified")
+	}
+}
+
+func TestLogger_ConcurrentLogKeepsChain(t *testing.T) {
+	logger := NewLogger(t.TempDir(), WithKey(testKey))
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 10 {
+				if err := logger.LogEvent(EventHealth, "web", "ok"); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	v := verify(t, logger.eventPath("web"), testKey)
+	if !v.OK() || v.Entries != 80 {
+		t.Errorf("got %+v, want 80 entries without problems", v)
+	}
+}
+
+func TestLogger_VerifyArchived(t *testing.T) {
+	logger := NewLogger(t.TempDir())
+	writeChain(t, logger, 2)
+	if err := logger.Archive("web"); err != nil {
+		t.Fatal(err)
+	}
+	writeChain(t, logger, 1)
+
+	results, err := logger.Verify("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("got %d results, want the archived and the live log", len(results))
+	}
+	for _, v := range results {
+		if !v.OK() {
+			t.Errorf("%s: %v", v.Path, v.Problems)
+		}
+	}
+}
+
+func TestLastLine(t *testing.T) {
+	long := bytes.Repeat([]byte("x"), 10000)
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{"", ""},
+		{"a\n", "a"},
+		{"a\nb\n", "b"},
+		{"a\nb", "b"},
+		{"a\n" + string(long) + "\n", string(long)},
+	}
+	for _, tt := range tests {
+		f, err := os.CreateTemp(t.TempDir(), "log")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.WriteString(tt.content); err != nil {
+			t.Fatal(err)
+		}
+		got, err := lastLine(f)
+		_ = f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("lastLine(%.10q) = %.10q, want %.10q", tt.content, got, tt.want)
+		}
+	}
+}
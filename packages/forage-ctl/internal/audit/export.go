@@ -0,0 +1,166 @@
+package audit
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Format is an output format for audit events.
+type Format string
+
+const (
+	// FormatText is one human-readable line per event.
+	FormatText Format = "text"
+	// FormatJSON is one JSON object per line, as events are stored.
+	FormatJSON Format = "json"
+	// FormatSyslog is one RFC 5424 syslog message per line.
+	FormatSyslog Format = "syslog"
+	// FormatJournal is the systemd Journal Export Format, as accepted by
+	// systemd-journal-remote.
+	FormatJournal Format = "journal"
+)
+
+// ParseFormat parses an output format name.
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(s); f {
+	case FormatText, FormatJSON, FormatSyslog, FormatJournal:
+		return f, nil
+	}
+	return "", fmt.Errorf("invalid format %q (must be text, json, syslog or journal)", s)
+}
+
+const (
+	// syslogFacility is the "log audit" facility of RFC 5424.
+	syslogFacility = 13
+	// syslogAppName identifies forage events in syslog and the journal.
+	syslogAppName = "forage"
+	// syslogSDID names the structured data element of syslog messages. The
+	// enterprise number is the one RFC 5612 reserves for documentation.
+	syslogSDID = "forage@32473"
+)
+
+// severity returns the syslog severity of an event type.
+func severity(t EventType) int {
+	switch t {
+	case EventError:
+		return 3 // error
+	case EventBudget, EventSecret, EventPolicy:
+		return 4 // warning
+	default:
+		return 6 // informational
+	}
+}
+
+// Encoder writes audit events in a Format.
+type Encoder struct {
+	w        io.Writer
+	format   Format
+	hostname string
+}
+
+// NewEncoder returns an encoder writing events to w.
+func NewEncoder(w io.Writer, format Format) *Encoder {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+	return &Encoder{w: w, format: format, hostname: hostname}
+}
+
+// Encode writes one event.
+func (enc *Encoder) Encode(e Event) error {
+	var err error
+	switch enc.format {
+	case FormatJSON:
+		var data []byte
+		if data, err = json.Marshal(e); err == nil {
+			_, err = fmt.Fprintln(enc.w, string(data))
+		}
+	case FormatSyslog:
+		_, err = io.WriteString(enc.w, enc.syslog(e))
+	case FormatJournal:
+		_, err = enc.w.Write(journalEntry(e))
+	default:
+		ts := e.Timestamp.Local().Format("2006-01-02 15:04:05")
+		if e.Details != "" {
+			_, err = fmt.Fprintf(enc.w, "[%s] %-8s %s (%s)\n", ts, e.Type, e.Sandbox, e.Details)
+		} else {
+			_, err = fmt.Fprintf(enc.w, "[%s] %-8s %s\n", ts, e.Type, e.Sandbox)
+		}
+	}
+	return err
+}
+
+// message is the human-readable summary of an event.
+func message(e Event) string {
+	msg := fmt.Sprintf("sandbox %s: %s", e.Sandbox, e.Type)
+	if e.Details != "" {
+		msg += ": " + e.Details
+	}
+	return msg
+}
+
+// syslog formats an event as an RFC 5424 message, with the sandbox and
+// event type as structured data.
+func (enc *Encoder) syslog(e Event) string {
+	sd := fmt.Sprintf("[%s sandbox=\"%s\" type=\"%s\"]", syslogSDID, sdEscape(e.Sandbox), sdEscape(string(e.Type)))
+	msg := strings.ReplaceAll(message(e), "\n", " ")
+	return fmt.Sprintf("<%d>1 %s %s %s - %s %s %s\n",
+		syslogFacility*8+severity(e.Type),
+		e.Timestamp.UTC().Format("2006-01-02T15:04:05.000000Z07:00"),
+		enc.hostname, syslogAppName, msgID(e.Type), sd, msg)
+}
+
+// sdEscape escapes a structured data parameter value.
+func sdEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(s)
+}
+
+// msgID returns the syslog MSGID of an event type: at most 32 printable
+// ASCII characters.
+func msgID(t EventType) string {
+	id := strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' {
+			return -1
+		}
+		return r
+	}, string(t))
+	if len(id) > 32 {
+		id = id[:32]
+	}
+	if id == "" {
+		return "-"
+	}
+	return id
+}
+
+// journalEntry formats an event as a Journal Export Format entry.
+func journalEntry(e Event) []byte {
+	var b []byte
+	field := func(name, value string) {
+		if !strings.Contains(value, "\n") {
+			b = append(b, name+"="+value+"\n"...)
+			return
+		}
+		// Values with newlines are length-prefixed
+		b = append(b, name+"\n"...)
+		b = binary.LittleEndian.AppendUint64(b, uint64(len(value)))
+		b = append(b, value+"\n"...)
+	}
+	field("__REALTIME_TIMESTAMP", strconv.FormatInt(e.Timestamp.UnixMicro(), 10))
+	field("MESSAGE", message(e))
+	field("PRIORITY", strconv.Itoa(severity(e.Type)))
+	field("SYSLOG_FACILITY", strconv.Itoa(syslogFacility))
+	field("SYSLOG_IDENTIFIER", syslogAppName)
+	field("FORAGE_SANDBOX", e.Sandbox)
+	field("FORAGE_EVENT", string(e.Type))
+	if e.Details != "" {
+		field("FORAGE_DETAILS", e.Details)
+	}
+	return append(b, '\n')
+}
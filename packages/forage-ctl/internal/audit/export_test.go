@@ -0,0 +1,75 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEncoder_Syslog(t *testing.T) {
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf, FormatSyslog)
+	enc.hostname = "host1"
+	err := enc.Encode(Event{
+		Timestamp: time.Date(2026, 3, 1, 10, 0, 0, 500000000, time.UTC),
+		Type:      EventSecret,
+		Sandbox:   "web",
+		Details:   `redacted "aws-access-key"`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<108>1 2026-03-01T10:00:00.500000Z host1 forage - secret [forage@32473 sandbox="web" type="secret"] sandbox web: secret: redacted "aws-access-key"` + "\n"
+	if buf.String() != want {
+		t.Errorf("syslog =\n%q\nwant\n%q", buf.String(), want)
+	}
+}
+
+func TestEncoder_Journal(t *testing.T) {
+	var buf bytes.Buffer
+	err := NewEncoder(&buf, FormatJournal).Encode(Event{
+		Timestamp: time.UnixMicro(1700000000000001),
+		Type:      EventError,
+		Sandbox:   "web",
+		Details:   "line one\nline two",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := buf.Bytes()
+	for _, want := range []string{
+		"__REALTIME_TIMESTAMP=1700000000000001\n",
+		"PRIORITY=3\n",
+		"SYSLOG_IDENTIFIER=forage\n",
+		"FORAGE_SANDBOX=web\n",
+		"FORAGE_EVENT=error\n",
+	} {
+		if !bytes.Contains(out, []byte(want)) {
+			t.Errorf("journal entry missing %q:\n%s", want, out)
+		}
+	}
+	// Multi-line values use the binary encoding
+	i := bytes.Index(out, []byte("FORAGE_DETAILS\n"))
+	if i < 0 {
+		t.Fatalf("no binary FORAGE_DETAILS field:\n%q", out)
+	}
+	rest := out[i+len("FORAGE_DETAILS\n"):]
+	if n := binary.LittleEndian.Uint64(rest); n != uint64(len("line one\nline two")) ||
+		string(rest[8:8+n]) != "line one\nline two" {
+		t.Errorf("binary field = %q", rest)
+	}
+	if !strings.HasSuffix(buf.String(), "\n\n") {
+		t.Error("entry not terminated by a blank line")
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	if f, err := ParseFormat("syslog"); err != nil || f != FormatSyslog {
+		t.Errorf("ParseFormat(syslog) = %q, %v", f, err)
+	}
+	if _, err := ParseFormat("cef"); err == nil {
+		t.Error("ParseFormat(cef) should fail")
+	}
+}
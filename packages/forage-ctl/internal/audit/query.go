@@ -0,0 +1,217 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// followPollInterval is how often followed audit logs are checked for new
+// events.
+const followPollInterval = 500 * time.Millisecond
+
+// Filter selects audit events. Zero fields match everything.
+type Filter struct {
+	Sandbox string
+	Since   time.Time
+	Until   time.Time
+	Types   []EventType
+}
+
+// Match reports whether the event passes the filter.
+func (f Filter) Match(e Event) bool {
+	if f.Sandbox != "" && e.Sandbox != f.Sandbox {
+		return false
+	}
+	if !f.Since.IsZero() && e.Timestamp.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !e.Timestamp.Before(f.Until) {
+		return false
+	}
+	if len(f.Types) == 0 {
+		return true
+	}
+	for _, t := range f.Types {
+		if e.Type == t {
+			return true
+		}
+	}
+	return false
+}
+
+// liveLogs returns the audit logs of existing sandboxes the filter may
+// match.
+func (l *Logger) liveLogs(filter Filter) ([]string, error) {
+	pattern := "*.events.jsonl"
+	if filter.Sandbox != "" {
+		pattern = filter.Sandbox + ".events.jsonl"
+	}
+	return filepath.Glob(filepath.Join(l.stateDir, "sandboxes", pattern))
+}
+
+// archivedLogs returns the archived audit logs the filter may match.
+func (l *Logger) archivedLogs(filter Filter) ([]string, error) {
+	pattern := "*.events.jsonl"
+	if filter.Sandbox != "" {
+		pattern = filter.Sandbox + ".*.events.jsonl"
+	}
+	return filepath.Glob(filepath.Join(l.archiveDir(), pattern))
+}
+
+// Query returns the events matching the filter across all sandboxes,
+// including archived ones, in chronological order.
+func (l *Logger) Query(filter Filter) ([]Event, error) {
+	live, err := l.liveLogs(filter)
+	if err != nil {
+		return nil, err
+	}
+	archived, err := l.archivedLogs(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []Event
+	for _, path := range append(archived, live...) {
+		found, _, err := readEvents(path, 0, filter)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, found...)
+	}
+	sortEvents(events)
+	return events, nil
+}
+
+// Follow passes events matching the filter to fn as sandboxes log them,
+// until ctx is done. Sandboxes created while following are picked up. With
+// history, the events already logged, including archived ones, are passed
+// first.
+func (l *Logger) Follow(ctx context.Context, filter Filter, history bool, fn func(Event)) error {
+	type followed struct {
+		info   os.FileInfo
+		offset int64
+	}
+	logs := make(map[string]*followed)
+
+	// poll reads what was appended to each live log since the last poll,
+	// starting new logs from their beginning once following has begun
+	poll := func(first bool) ([]Event, error) {
+		paths, err := l.liveLogs(filter)
+		if err != nil {
+			return nil, err
+		}
+		seen := make(map[string]bool, len(paths))
+		var events []Event
+		for _, path := range paths {
+			seen[path] = true
+			info, err := os.Stat(path)
+			if err != nil {
+				continue // removed meanwhile
+			}
+			log, ok := logs[path]
+			if !ok || !os.SameFile(log.info, info) {
+				log = &followed{info: info}
+				logs[path] = log
+				if first && !history {
+					log.offset = info.Size()
+				}
+			}
+			found, offset, err := readEvents(path, log.offset, filter)
+			if err != nil {
+				return nil, err
+			}
+			log.offset = offset
+			events = append(events, found...)
+		}
+		for path := range logs {
+			if !seen[path] {
+				delete(logs, path)
+			}
+		}
+		return events, nil
+	}
+
+	events, err := poll(true)
+	if err != nil {
+		return err
+	}
+	if history {
+		archived, err := l.archivedLogs(filter)
+		if err != nil {
+			return err
+		}
+		for _, path := range archived {
+			found, _, err := readEvents(path, 0, filter)
+			if err != nil {
+				return err
+			}
+			events = append(events, found...)
+		}
+	}
+	for {
+		sortEvents(events)
+		for _, e := range events {
+			fn(e)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(followPollInterval):
+		}
+		if events, err = poll(false); err != nil {
+			return err
+		}
+	}
+}
+
+// readEvents reads the events matching the filter from the complete lines
+// of the audit log at path after offset. It returns the offset after the
+// last complete line. Malformed lines are skipped.
+func readEvents(path string, offset int64, filter Filter) ([]Event, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, offset, nil
+		}
+		return nil, offset, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return nil, offset, err
+	}
+
+	var events []Event
+	br := bufio.NewReader(f)
+	for {
+		line, err := br.ReadBytes('\n')
+		if err == io.EOF {
+			return events, offset, nil // an incomplete line is read once finished
+		}
+		if err != nil {
+			return events, offset, fmt.Errorf("error reading audit log: %w", err)
+		}
+		offset += int64(len(line))
+		var e Event
+		if json.Unmarshal(bytes.TrimSpace(line), &e) != nil {
+			continue
+		}
+		if filter.Match(e) {
+			events = append(events, e)
+		}
+	}
+}
+
+// sortEvents orders events chronologically, keeping the order of events
+// logged at the same time.
+func sortEvents(events []Event) {
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Timestamp.Before(events[j].Timestamp) })
+}
@@ -0,0 +1,106 @@
+package audit
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLogger_QueryMergesLiveAndArchived(t *testing.T) {
+	logger := NewLogger(t.TempDir())
+	start := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	for i, e := range []Event{
+		{Type: EventCreate, Sandbox: "old"},
+		{Type: EventCreate, Sandbox: "web"},
+		{Type: EventSecret, Sandbox: "old", Details: "redacted"},
+		{Type: EventDestroy, Sandbox: "old"},
+		{Type: EventPolicy, Sandbox: "web", Details: "blocked"},
+	} {
+		e.Timestamp = start.Add(time.Duration(i) * time.Minute)
+		if err := logger.Log(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := logger.Archive("old"); err != nil {
+		t.Fatal(err)
+	}
+	if events, _ := logger.Events("old"); len(events) != 0 {
+		t.Fatalf("archived sandbox still has a live log: %+v", events)
+	}
+	// A new sandbox reusing the name gets a fresh log
+	if err := logger.Log(Event{Timestamp: start.Add(time.Hour), Type: EventCreate, Sandbox: "old"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   []EventType
+	}{
+		{"all", Filter{}, []EventType{EventCreate, EventCreate, EventSecret, EventDestroy, EventPolicy, EventCreate}},
+		{"sandbox", Filter{Sandbox: "old"}, []EventType{EventCreate, EventSecret, EventDestroy, EventCreate}},
+		{"types", Filter{Types: []EventType{EventSecret, EventPolicy}}, []EventType{EventSecret, EventPolicy}},
+		{"range", Filter{Since: start.Add(2 * time.Minute), Until: start.Add(4 * time.Minute)}, []EventType{EventSecret, EventDestroy}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, err := logger.Query(tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(events) != len(tt.want) {
+				t.Fatalf("got %+v, want types %v", events, tt.want)
+			}
+			for i, e := range events {
+				if e.Type != tt.want[i] {
+					t.Errorf("event %d: type %s, want %s", i, e.Type, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestLogger_Follow(t *testing.T) {
+	logger := NewLogger(t.TempDir())
+	if err := logger.LogEvent(EventCreate, "existing", "before"); err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var got []string
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- logger.Follow(ctx, Filter{Types: []EventType{EventStart}}, false, func(e Event) {
+			mu.Lock()
+			got = append(got, e.Sandbox)
+			mu.Unlock()
+		})
+	}()
+
+	time.Sleep(2 * followPollInterval)
+	_ = logger.LogEvent(EventStart, "existing", "")
+	_ = logger.LogEvent(EventStop, "existing", "")
+	_ = logger.LogEvent(EventStart, "created", "") // a sandbox created while following
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		n := len(got)
+		mu.Unlock()
+		if n >= 2 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(got) != 2 || got[0] != "existing" || got[1] != "created" {
+		t.Errorf("followed events from %v", got)
+	}
+}
@@ -0,0 +1,102 @@
+package config
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Budget caps the API usage of a sandbox. Zero limits are unset. Token
+// limits count input, output and cache write tokens; cache reads only
+// count toward cost. Days are calendar days in the host's local time.
+type Budget struct {
+	DailyTokens int64   `json:"dailyTokens,omitempty"`
+	TotalTokens int64   `json:"totalTokens,omitempty"`
+	DailyCost   float64 `json:"dailyCost,omitempty"` // USD
+	TotalCost   float64 `json:"totalCost,omitempty"` // USD
+	Pause       bool    `json:"pause,omitempty"`     // Stop the sandbox once the budget is exhausted
+}
+
+// IsEmpty reports whether the budget sets no limits.
+func (b *Budget) IsEmpty() bool {
+	return b == nil || (b.DailyTokens == 0 && b.TotalTokens == 0 && b.DailyCost == 0 && b.TotalCost == 0)
+}
+
+// Validate checks that the budget limits are not negative.
+func (b *Budget) Validate() error {
+	if b.DailyTokens < 0 || b.TotalTokens < 0 {
+		return fmt.Errorf("budget token limits must not be negative")
+	}
+	if b.DailyCost < 0 || b.TotalCost < 0 || math.IsNaN(b.DailyCost) || math.IsNaN(b.TotalCost) {
+		return fmt.Errorf("budget cost limits must not be negative")
+	}
+	return nil
+}
+
+// String renders the budget in the form accepted by ParseBudget.
+func (b *Budget) String() string {
+	if b.IsEmpty() {
+		return "none"
+	}
+	var parts []string
+	if b.DailyTokens > 0 {
+		parts = append(parts, fmt.Sprintf("daily-tokens=%d", b.DailyTokens))
+	}
+	if b.TotalTokens > 0 {
+		parts = append(parts, fmt.Sprintf("total-tokens=%d", b.TotalTokens))
+	}
+	if b.DailyCost > 0 {
+		parts = append(parts, "daily-cost="+strconv.FormatFloat(b.DailyCost, 'f', -1, 64))
+	}
+	if b.TotalCost > 0 {
+		parts = append(parts, "total-cost="+strconv.FormatFloat(b.TotalCost, 'f', -1, 64))
+	}
+	if b.Pause {
+		parts = append(parts, "pause")
+	}
+	return strings.Join(parts, ",")
+}
+
+// ParseBudget parses a comma-separated budget specification such as
+// "daily-cost=5,total-tokens=2000000,pause". Keys are daily-tokens,
+// total-tokens, daily-cost and total-cost (USD); the "pause" flag stops the
+// sandbox once the budget is exhausted. "none" yields an empty budget.
+func ParseBudget(spec string) (*Budget, error) {
+	b := &Budget{}
+	spec = strings.TrimSpace(spec)
+	if spec == "" || spec == "none" {
+		return b, nil
+	}
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "pause" {
+			b.Pause = true
+			continue
+		}
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid budget entry %q: expected key=value or \"pause\"", part)
+		}
+		var err error
+		switch key {
+		case "daily-tokens":
+			b.DailyTokens, err = strconv.ParseInt(value, 10, 64)
+		case "total-tokens":
+			b.TotalTokens, err = strconv.ParseInt(value, 10, 64)
+		case "daily-cost":
+			b.DailyCost, err = strconv.ParseFloat(strings.TrimPrefix(value, "$"), 64)
+		case "total-cost":
+			b.TotalCost, err = strconv.ParseFloat(strings.TrimPrefix(value, "$"), 64)
+		default:
+			return nil, fmt.Errorf("unknown budget key %q (want daily-tokens, total-tokens, daily-cost or total-cost)", key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid budget value for %s: %q", key, value)
+		}
+	}
+	if err := b.Validate(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
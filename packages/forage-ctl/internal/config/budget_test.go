@@ -0,0 +1,42 @@
+package config
+
+import "testing"
+
+func TestParseBudget(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    Budget
+		wantErr bool
+	}{
+		{spec: "none", want: Budget{}},
+		{spec: "daily-cost=5,total-tokens=2000000,pause", want: Budget{DailyCost: 5, TotalTokens: 2000000, Pause: true}},
+		{spec: "daily-tokens=100, total-cost=$12.50", want: Budget{DailyTokens: 100, TotalCost: 12.5}},
+		{spec: "daily-cost=-1", wantErr: true},
+		{spec: "weekly-cost=5", wantErr: true},
+		{spec: "daily-tokens=lots", wantErr: true},
+		{spec: "daily-tokens", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := ParseBudget(tt.spec)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseBudget(%q) should fail", tt.spec)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseBudget(%q): %v", tt.spec, err)
+			}
+			if *got != tt.want {
+				t.Errorf("ParseBudget(%q) = %+v, want %+v", tt.spec, *got, tt.want)
+			}
+			// String round-trips
+			again, err := ParseBudget(got.String())
+			if err != nil || *again != *got {
+				t.Errorf("round trip of %q = %+v, %v", got.String(), again, err)
+			}
+		})
+	}
+}
@@ -10,6 +10,9 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
+
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/network"
 )
 
 // IsSandboxMetadataFile returns true if the filename is a valid sandbox metadata file.
@@ -46,6 +49,29 @@ func ValidateSandboxName(name string) error {
 	return nil
 }
 
+// ValidateGroupName checks that a sandbox group name is valid. Group names
+// follow the same rules as sandbox names.
+func ValidateGroupName(name string) error {
+	if name == "" {
+		return fmt.Errorf("group name cannot be empty")
+	}
+
+	if !sandboxNameRegex.MatchString(name) {
+		return fmt.Errorf("invalid group name %q: must start with a lowercase letter or digit, contain only lowercase letters, digits, underscores, or hyphens, and be at most 63 characters", name)
+	}
+
+	return nil
+}
+
+// GroupDir returns the host directory holding a sandbox group's shared
+// state, such as the hosts file members resolve each other from.
+func GroupDir(stateDir, group string) (string, error) {
+	if err := ValidateGroupName(group); err != nil {
+		return "", err
+	}
+	return safePath(filepath.Join(stateDir, "groups"), group, "")
+}
+
 // safePath validates that a constructed path stays within the base directory.
 // This prevents path traversal attacks where names like "../../../etc/passwd"
 // could escape the intended directory. The joined path is cleaned and checked
@@ -193,20 +219,45 @@ func readGitIdentity(repoDir string) *AgentIdentity {
 
 // HostConfig represents the host configuration from config.json
 type HostConfig struct {
-	User               string            `json:"user"`
-	UID                int               `json:"uid"` // Host user's UID
-	GID                int               `json:"gid"` // Host user's GID
-	AuthorizedKeys     []string          `json:"authorizedKeys"`
-	Secrets            map[string]string `json:"secrets"` // Secret name -> file path containing the secret
-	StateDir           string            `json:"stateDir"`
-	ExtraContainerPath string            `json:"extraContainerPath"`
-	NixpkgsPath        string            `json:"nixpkgsPath"`
-	NixpkgsRev         string            `json:"nixpkgsRev"`
-	ProxyURL           string            `json:"proxyUrl,omitempty"`          // URL of the forage-proxy server
-	AgentIdentity      *AgentIdentity    `json:"agentIdentity,omitempty"`     // Host-level default agent identity
-	ContainerUsername  string            `json:"containerUsername,omitempty"` // Container username (default: "agent")
-	WorkspacePath      string            `json:"workspacePath,omitempty"`     // Container workspace path (default: "/workspace")
-	StateVersion       string            `json:"stateVersion,omitempty"`      // NixOS state version (default: "24.11")
+	User               string                `json:"user"`
+	UID                int                   `json:"uid"` // Host user's UID
+	GID                int                   `json:"gid"` // Host user's GID
+	AuthorizedKeys     []string              `json:"authorizedKeys"`
+	Secrets            map[string]string     `json:"secrets"` // Secret name -> file path containing the secret
+	StateDir           string                `json:"stateDir"`
+	ExtraContainerPath string                `json:"extraContainerPath"`
+	NixpkgsPath        string                `json:"nixpkgsPath"`
+	NixpkgsRev         string                `json:"nixpkgsRev"`
+	ProxyURL           string                `json:"proxyUrl,omitempty"`           // URL of the forage-proxy server
+	AgentIdentity      *AgentIdentity        `json:"agentIdentity,omitempty"`      // Host-level default agent identity
+	ContainerUsername  string                `json:"containerUsername,omitempty"`  // Container username (default: "agent")
+	WorkspacePath      string                `json:"workspacePath,omitempty"`      // Container workspace path (default: "/workspace")
+	StateVersion       string                `json:"stateVersion,omitempty"`       // NixOS state version (default: "24.11")
+	HostGroups         map[string][]string   `json:"hostGroups,omitempty"`         // Named allowlist host groups, referenced as "@name"
+	SubnetBase         string                `json:"subnetBase,omitempty"`         // IPv4 prefix sandbox subnets are carved from (default: "10.100.0.0/16")
+	SubnetPrefixLength int                   `json:"subnetPrefixLength,omitempty"` // Prefix length of each sandbox subnet (default: 24)
+	IPv6ULA            string                `json:"ipv6Ula,omitempty"`            // Optional IPv6 ULA prefix; each sandbox gets a /64
+	ModelPrices        map[string]ModelPrice `json:"modelPrices,omitempty"`        // Model (or model prefix) -> token prices, overriding the built-in table
+	AuditArchive       bool                  `json:"auditArchive,omitempty"`       // Keep the audit logs of removed sandboxes in <stateDir>/audit-archive
+	AuditKeyFile       string                `json:"auditKeyFile,omitempty"`       // Secret signing audit log entries with an HMAC
+	IdleTimeout        int                   `json:"idleTimeout,omitempty"`        // Minutes of inactivity after which the monitor stops a sandbox (0 = never)
+	Notifiers          []Notifier            `json:"notifiers,omitempty"`          // Where the monitor notifies agents waiting for input
+	NotifyDebounce     string                `json:"notifyDebounce,omitempty"`     // Minimum time between notifications about a sandbox (default: 5m)
+	Restart            *RestartPolicy        `json:"restart,omitempty"`            // Default policy for restarting failed sandboxes
+}
+
+// ModelPrice is the price of a model's tokens in USD per million tokens,
+// used to estimate API costs from proxy usage records.
+type ModelPrice struct {
+	Input      float64 `json:"input"`
+	Output     float64 `json:"output"`
+	CacheWrite float64 `json:"cacheWrite,omitempty"`
+	CacheRead  float64 `json:"cacheRead,omitempty"`
+}
+
+// AddressPlan returns the sandbox address plan configured for this host.
+func (c *HostConfig) AddressPlan() (*network.AddressPlan, error) {
+	return network.NewAddressPlan(c.SubnetBase, c.SubnetPrefixLength, c.IPv6ULA)
 }
 
 // ResolvedContainerUsername returns the container username, defaulting to "agent".
@@ -270,6 +321,42 @@ func (c *HostConfig) Validate() error {
 		return fmt.Errorf("user is required")
 	}
 
+	if _, err := c.AddressPlan(); err != nil {
+		return err
+	}
+
+	for name, hosts := range c.HostGroups {
+		if err := network.ValidateHostGroupRef(network.HostGroupPrefix + name); err != nil {
+			return fmt.Errorf("hostGroups: %w", err)
+		}
+		if _, err := network.ExpandAllowedHosts(hosts, c.HostGroups); err != nil {
+			return fmt.Errorf("hostGroups %s: %w", name, err)
+		}
+	}
+
+	for model, price := range c.ModelPrices {
+		if model == "" {
+			return fmt.Errorf("modelPrices: model name must not be empty")
+		}
+		if price.Input < 0 || price.Output < 0 || price.CacheWrite < 0 || price.CacheRead < 0 {
+			return fmt.Errorf("modelPrices %s: prices must not be negative", model)
+		}
+	}
+
+	if c.IdleTimeout < 0 {
+		return fmt.Errorf("idleTimeout must not be negative")
+	}
+
+	if err := validateNotify(c); err != nil {
+		return err
+	}
+
+	if c.Restart != nil {
+		if err := c.Restart.Validate(); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -328,6 +415,24 @@ type Template struct {
 	ResourceLimits    *ResourceLimits            `json:"resourceLimits,omitempty"`    // Container resource limits
 	InitCommands      []string                   `json:"initCommands,omitempty"`      // Commands to run after container creation
 	WorkspaceMounts   map[string]*WorkspaceMount `json:"workspaceMounts,omitempty"`   // Composable workspace mounts (keyed by name)
+	Services          []Service                  `json:"services,omitempty"`          // Sidecar services (databases, caches) run in the sandbox
+	Budget            *Budget                    `json:"budget,omitempty"`            // Default API usage budget for sandboxes (enforced by the proxy)
+	Policy            *RequestPolicy             `json:"policy,omitempty"`            // Models, token ceilings and features allowed in API requests (enforced by the proxy)
+	Probes            []Probe                    `json:"probes,omitempty"`            // Extra health checks of sandboxes
+	IdleTimeout       int                        `json:"idleTimeout,omitempty"`       // Minutes of inactivity after which the monitor stops a sandbox (0 = host default)
+	WaitingPatterns   []string                   `json:"waitingPatterns,omitempty"`   // Regexps matching a pane whose agent waits for input (default: DefaultWaitingPatterns)
+	Restart           *RestartPolicy             `json:"restart,omitempty"`           // Policy for restarting failed sandboxes (default: the host's)
+}
+
+// ResolvedIdleTimeout returns how long a sandbox may be idle before the
+// monitor stops it: the template's idle timeout, or else the host's. Zero
+// means never.
+func (t *Template) ResolvedIdleTimeout(host *HostConfig) time.Duration {
+	minutes := t.IdleTimeout
+	if minutes == 0 && host != nil {
+		minutes = host.IdleTimeout
+	}
+	return time.Duration(minutes) * time.Minute
 }
 
 // AgentPermissions controls agent permission settings.
@@ -369,6 +474,53 @@ func (t *Template) Validate() error {
 		return fmt.Errorf("invalid network mode: %s (must be full, restricted, or none)", t.Network)
 	}
 
+	// Group names are checked against host config at generation time
+	for _, host := range t.AllowedHosts {
+		if network.IsHostGroup(host) {
+			if err := network.ValidateHostGroupRef(host); err != nil {
+				return fmt.Errorf("allowedHosts: %w", err)
+			}
+			continue
+		}
+		if _, err := network.ParseAllowRule(host); err != nil {
+			return fmt.Errorf("allowedHosts: %w", err)
+		}
+	}
+
+	if err := validateServices(t.Services); err != nil {
+		return err
+	}
+
+	if err := validateProbes(t.Probes); err != nil {
+		return err
+	}
+
+	if t.IdleTimeout < 0 {
+		return fmt.Errorf("idle timeout must not be negative")
+	}
+
+	if err := validateWaitingPatterns(t.WaitingPatterns); err != nil {
+		return err
+	}
+
+	if t.Restart != nil {
+		if err := t.Restart.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if t.Budget != nil {
+		if err := t.Budget.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if t.Policy != nil {
+		if err := t.Policy.Validate(); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -456,16 +608,87 @@ type SandboxMetadata struct {
 	Multiplexer     string         `json:"multiplexer,omitempty"`     // "tmux" (default) or "wezterm"
 	ContainerName   string         `json:"containerName,omitempty"`   // Short container name (e.g. "f42"); empty for legacy sandboxes
 	Runtime         string         `json:"runtime,omitempty"`         // Runtime backend used (e.g. "nspawn", "docker", "podman")
+	NetworkMode     string         `json:"networkMode,omitempty"`     // Network mode set via `forage-ctl network`; overrides the template
+	AllowedHosts    []string       `json:"allowedHosts,omitempty"`    // Hosts allowed in addition to the template's allowedHosts
+	Subnet          string         `json:"subnet,omitempty"`          // IPv4 subnet of the sandbox link; empty for legacy 10.100.<slot>.0/24
+	SubnetIPv6      string         `json:"subnetIPv6,omitempty"`      // IPv6 subnet of the sandbox link; empty if IPv6 is not configured
+	Group           string         `json:"group,omitempty"`           // Sandbox group sharing a private network with this sandbox
+	StoppedBy       string         `json:"stoppedBy,omitempty"`       // Why the sandbox was stopped on purpose (StoppedByUser, ...); the monitor leaves it stopped
+	Restarts        *RestartState  `json:"restarts,omitempty"`        // Restarts by the health monitor
 
 	// Composable workspace mounts — supersedes Workspace/WorkspaceMode/SourceRepo when present.
 	WorkspaceMounts []WorkspaceMountMeta `json:"workspaceMounts,omitempty"`
 }
 
-// ContainerIP returns the container's IP address based on its network slot.
-// Containers use the 10.100.X.0/24 network where X is the NetworkSlot.
-// The container gets .2 (host gets .1).
+// Addresses returns the IP addresses of the sandbox's private link.
+// Sandboxes record their subnet at creation; legacy metadata without one
+// falls back to the default 10.100.<slot>.0/24 layout.
+func (m *SandboxMetadata) Addresses() network.Addresses {
+	if m.Subnet != "" {
+		if a, err := network.AddressesForSubnets(m.Subnet, m.SubnetIPv6); err == nil {
+			return a
+		}
+	}
+	a, _ := network.DefaultAddressPlan().Addresses(m.NetworkSlot)
+	return a
+}
+
+// SetAddresses records the sandbox's link subnets in the metadata.
+func (m *SandboxMetadata) SetAddresses(a network.Addresses) {
+	m.Subnet = a.Subnet
+	m.SubnetIPv6 = a.SubnetIPv6
+}
+
+// ContainerIP returns the container's IP address on its private link.
+// The container gets the second address of its subnet (host gets the first).
 func (m *SandboxMetadata) ContainerIP() string {
-	return fmt.Sprintf("10.100.%d.2", m.NetworkSlot)
+	return m.Addresses().ContainerIP
+}
+
+// HostIP returns the host-side IP address of the sandbox's private link,
+// which is also the container's default gateway.
+func (m *SandboxMetadata) HostIP() string {
+	return m.Addresses().HostIP
+}
+
+// ApplyNetworkOverrides applies the sandbox's persisted network mode and
+// extra allowed hosts to the template, so regenerated configs keep changes
+// made with `forage-ctl network` after creation.
+func (m *SandboxMetadata) ApplyNetworkOverrides(t *Template) {
+	if m.NetworkMode != "" {
+		t.Network = m.NetworkMode
+	}
+	if len(m.AllowedHosts) == 0 {
+		return
+	}
+	seen := make(map[string]bool, len(t.AllowedHosts))
+	merged := make([]string, 0, len(t.AllowedHosts)+len(m.AllowedHosts))
+	for _, host := range append(append([]string{}, t.AllowedHosts...), m.AllowedHosts...) {
+		if !seen[host] {
+			seen[host] = true
+			merged = append(merged, host)
+		}
+	}
+	t.AllowedHosts = merged
+}
+
+// AddAllowedHosts records extra allowed hosts in the metadata, skipping
+// duplicates. Returns the hosts that were newly added.
+func (m *SandboxMetadata) AddAllowedHosts(hosts ...string) []string {
+	seen := make(map[string]bool, len(m.AllowedHosts))
+	for _, host := range m.AllowedHosts {
+		seen[host] = true
+	}
+	var added []string
+	for _, host := range hosts {
+		if host == "" || seen[host] {
+			continue
+		}
+		seen[host] = true
+		m.AllowedHosts = append(m.AllowedHosts, host)
+		added = append(added, host)
+	}
+	return added
 }
 
 // Validate checks that the SandboxMetadata is valid.
@@ -476,8 +699,21 @@ func (m *SandboxMetadata) Validate() error {
 	if m.Template == "" {
 		return fmt.Errorf("template is required")
 	}
-	if m.NetworkSlot < 1 || m.NetworkSlot > 254 {
-		return fmt.Errorf("networkSlot must be between 1 and 254 (got %d)", m.NetworkSlot)
+	if m.Subnet != "" {
+		if m.NetworkSlot < 1 {
+			return fmt.Errorf("networkSlot must be at least 1 (got %d)", m.NetworkSlot)
+		}
+		if _, err := network.AddressesForSubnets(m.Subnet, m.SubnetIPv6); err != nil {
+			return err
+		}
+	} else if m.NetworkSlot < 1 || m.NetworkSlot > network.DefaultAddressPlan().MaxSlot() {
+		return fmt.Errorf("networkSlot must be between 1 and %d (got %d)", network.DefaultAddressPlan().MaxSlot(), m.NetworkSlot)
+	}
+
+	if m.Group != "" {
+		if err := ValidateGroupName(m.Group); err != nil {
+			return err
+		}
 	}
 
 	// Allow either legacy Workspace field or new WorkspaceMounts
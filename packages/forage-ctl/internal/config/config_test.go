@@ -7,6 +7,9 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/network"
 )
 
 func TestDefaultPaths(t *testing.T) {
@@ -84,6 +87,27 @@ func TestResolvedContainerName(t *testing.T) {
 	}
 }
 
+func TestResolvedIdleTimeout(t *testing.T) {
+	host := &HostConfig{IdleTimeout: 120}
+	tests := []struct {
+		template int
+		host     *HostConfig
+		want     time.Duration
+	}{
+		{0, nil, 0},
+		{0, &HostConfig{}, 0},
+		{0, host, 2 * time.Hour},
+		{30, host, 30 * time.Minute},
+		{30, nil, 30 * time.Minute},
+	}
+	for _, tt := range tests {
+		tmpl := &Template{IdleTimeout: tt.template}
+		if got := tmpl.ResolvedIdleTimeout(tt.host); got != tt.want {
+			t.Errorf("ResolvedIdleTimeout(template %d, host %+v) = %v, want %v", tt.template, tt.host, got, tt.want)
+		}
+	}
+}
+
 func TestLoadHostConfig(t *testing.T) {
 	// Create a temporary directory
 	tmpDir := t.TempDir()
@@ -1301,6 +1325,40 @@ func TestValidateSandboxName(t *testing.T) {
 	}
 }
 
+func TestGroupDir(t *testing.T) {
+	dir, err := GroupDir("/var/lib/firefly-forage", "web")
+	if err != nil {
+		t.Fatalf("GroupDir() error: %v", err)
+	}
+	if dir != "/var/lib/firefly-forage/groups/web" {
+		t.Errorf("GroupDir() = %q, want %q", dir, "/var/lib/firefly-forage/groups/web")
+	}
+
+	for _, name := range []string{"", "../escape", "Web"} {
+		if _, err := GroupDir("/var/lib/firefly-forage", name); err == nil {
+			t.Errorf("GroupDir(%q) should fail", name)
+		}
+	}
+}
+
+func TestSandboxMetadata_ValidateGroup(t *testing.T) {
+	meta := &SandboxMetadata{
+		Name:        "api",
+		Template:    "claude",
+		NetworkSlot: 1,
+		Workspace:   "/workspace",
+		Group:       "web",
+	}
+	if err := meta.Validate(); err != nil {
+		t.Errorf("Validate() error: %v", err)
+	}
+
+	meta.Group = "bad group"
+	if err := meta.Validate(); err == nil {
+		t.Error("Validate() should reject an invalid group name")
+	}
+}
+
 func TestWorkspaceMountMeta_RoundTrip(t *testing.T) {
 	tmpDir := t.TempDir()
 
@@ -1477,3 +1535,210 @@ func TestSandboxMetadata_BackwardCompat_NoWorkspaceMounts(t *testing.T) {
 		t.Errorf("legacy metadata should validate, got: %v", err)
 	}
 }
+
+func TestSandboxMetadata_ApplyNetworkOverrides(t *testing.T) {
+	tmpl := &Template{
+		Network:      "full",
+		AllowedHosts: []string{"github.com", "pypi.org"},
+	}
+	metadata := &SandboxMetadata{Name: "net-test"}
+
+	if added := metadata.AddAllowedHosts("pypi.org", "crates.io", "crates.io", ""); len(added) != 2 {
+		t.Errorf("AddAllowedHosts added %v, want [pypi.org crates.io]", added)
+	}
+	if added := metadata.AddAllowedHosts("crates.io"); len(added) != 0 {
+		t.Errorf("AddAllowedHosts re-added %v", added)
+	}
+
+	metadata.ApplyNetworkOverrides(tmpl)
+	if tmpl.Network != "full" {
+		t.Errorf("Network = %q, want unchanged without override", tmpl.Network)
+	}
+
+	metadata.NetworkMode = "restricted"
+	metadata.ApplyNetworkOverrides(tmpl)
+	if tmpl.Network != "restricted" {
+		t.Errorf("Network = %q, want %q", tmpl.Network, "restricted")
+	}
+	want := []string{"github.com", "pypi.org", "crates.io"}
+	if strings.Join(tmpl.AllowedHosts, ",") != strings.Join(want, ",") {
+		t.Errorf("AllowedHosts = %v, want %v", tmpl.AllowedHosts, want)
+	}
+}
+
+func TestTemplate_Validate_HostGroupRefs(t *testing.T) {
+	base := func(hosts ...string) *Template {
+		return &Template{
+			Name:         "test",
+			Network:      "restricted",
+			AllowedHosts: hosts,
+			Agents: map[string]AgentConfig{
+				"claude": {PackagePath: "claude", SecretName: "anthropic", AuthEnvVar: "ANTHROPIC_API_KEY"},
+			},
+		}
+	}
+
+	if err := base("@github", "@my-group", "example.com").Validate(); err != nil {
+		t.Errorf("Validate() unexpected error: %v", err)
+	}
+	if err := base("@Bad!").Validate(); err == nil {
+		t.Error("Validate() expected error for malformed host group reference")
+	}
+}
+
+func TestTemplate_Validate_PortRules(t *testing.T) {
+	base := func(hosts ...string) *Template {
+		return &Template{
+			Name:         "test",
+			Network:      "restricted",
+			AllowedHosts: hosts,
+			Agents: map[string]AgentConfig{
+				"claude": {PackagePath: "claude", SecretName: "anthropic", AuthEnvVar: "ANTHROPIC_API_KEY"},
+			},
+		}
+	}
+
+	valid := []string{"github.com:443", "10.0.5.0/24:5432", "registry.internal:5000", "[fd00::/64]:5432", "10.0.0.1"}
+	if err := base(valid...).Validate(); err != nil {
+		t.Errorf("Validate() unexpected error: %v", err)
+	}
+
+	for _, entry := range []string{"github.com:0", "github.com:70000", "10.0.5.0/24:db", "fd00::1:443x", "bad host"} {
+		if err := base(entry).Validate(); err == nil {
+			t.Errorf("Validate() expected error for %q", entry)
+		}
+	}
+}
+
+func TestHostConfig_Validate_HostGroups(t *testing.T) {
+	cfg := &HostConfig{
+		User:       "test",
+		HostGroups: map[string][]string{"internal": {"git.corp.example", "@github"}},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate() unexpected error: %v", err)
+	}
+
+	cfg.HostGroups["broken"] = []string{"@does-not-exist"}
+	if err := cfg.Validate(); err == nil {
+		t.Error("Validate() expected error for unknown nested host group")
+	}
+}
+
+func TestSandboxMetadata_Addresses(t *testing.T) {
+	// Legacy metadata has no recorded subnet and uses 10.100.<slot>.0/24
+	legacy := &SandboxMetadata{Name: "legacy", NetworkSlot: 12}
+	if got := legacy.ContainerIP(); got != "10.100.12.2" {
+		t.Errorf("legacy ContainerIP() = %q, want 10.100.12.2", got)
+	}
+	if got := legacy.HostIP(); got != "10.100.12.1" {
+		t.Errorf("legacy HostIP() = %q, want 10.100.12.1", got)
+	}
+
+	plan, err := network.NewAddressPlan("172.30.0.0/16", 28, "fd42:f0::/48")
+	if err != nil {
+		t.Fatalf("NewAddressPlan failed: %v", err)
+	}
+	addrs, err := plan.Addresses(300)
+	if err != nil {
+		t.Fatalf("Addresses failed: %v", err)
+	}
+
+	m := &SandboxMetadata{Name: "new", Template: "claude", Workspace: "/ws", NetworkSlot: 300}
+	m.SetAddresses(addrs)
+	if m.Addresses() != addrs {
+		t.Errorf("Addresses() = %+v, want %+v", m.Addresses(), addrs)
+	}
+	if got := m.ContainerIP(); got != "172.30.18.194" {
+		t.Errorf("ContainerIP() = %q, want 172.30.18.194", got)
+	}
+	if err := m.Validate(); err != nil {
+		t.Errorf("Validate() unexpected error for slot above 254 with recorded subnet: %v", err)
+	}
+
+	m.Subnet = "bogus"
+	if err := m.Validate(); err == nil {
+		t.Error("Validate() expected error for invalid subnet")
+	}
+}
+
+func TestHostConfig_AddressPlan(t *testing.T) {
+	cfg := &HostConfig{User: "test"}
+	plan, err := cfg.AddressPlan()
+	if err != nil {
+		t.Fatalf("AddressPlan() unexpected error: %v", err)
+	}
+	if plan.MaxSlot() != 254 {
+		t.Errorf("default MaxSlot() = %d, want 254", plan.MaxSlot())
+	}
+
+	cfg.SubnetBase = "10.200.0.0/16"
+	cfg.SubnetPrefixLength = 28
+	plan, err = cfg.AddressPlan()
+	if err != nil {
+		t.Fatalf("AddressPlan() unexpected error: %v", err)
+	}
+	if plan.MaxSlot() != 4094 {
+		t.Errorf("MaxSlot() = %d, want 4094", plan.MaxSlot())
+	}
+
+	cfg.SubnetBase = "10.200.0.0"
+	if err := cfg.Validate(); err == nil {
+		t.Error("Validate() expected error for invalid subnet base")
+	}
+}
+
+func TestTemplate_Validate_Services(t *testing.T) {
+	base := func(services ...Service) *Template {
+		return &Template{
+			Name:    "test",
+			Network: "full",
+			Agents: map[string]AgentConfig{
+				"claude": {PackagePath: "claude", SecretName: "anthropic", AuthEnvVar: "ANTHROPIC_API_KEY"},
+			},
+			Services: services,
+		}
+	}
+	postgres := Service{Name: "postgres", Package: "postgresql_16", Command: "postgres -D $FORAGE_SERVICE_DATA", Ports: []int{5432}, Storage: ServiceStoragePersist}
+	redis := Service{Name: "redis", Package: "redis", Command: "redis-server", Ports: []int{6379}, Env: map[string]string{"REDIS_ARGS": "--save ''"}}
+
+	if err := base(postgres, redis).Validate(); err != nil {
+		t.Errorf("Validate() unexpected error: %v", err)
+	}
+
+	invalid := map[string][]Service{
+		"bad name":       {{Name: "Postgres", Package: "postgresql", Command: "postgres"}},
+		"no package":     {{Name: "db", Command: "postgres"}},
+		"bad package":    {{Name: "db", Package: "postgresql; rm", Command: "postgres"}},
+		"no command":     {{Name: "db", Package: "postgresql"}},
+		"bad port":       {{Name: "db", Package: "postgresql", Command: "postgres", Ports: []int{70000}}},
+		"bad env":        {{Name: "db", Package: "postgresql", Command: "postgres", Env: map[string]string{"BAD-NAME": "x"}}},
+		"bad storage":    {{Name: "db", Package: "postgresql", Command: "postgres", Storage: "disk"}},
+		"duplicate name": {postgres, postgres},
+		"duplicate port": {postgres, {Name: "other", Package: "postgresql", Command: "postgres", Ports: []int{5432}}},
+	}
+	for name, services := range invalid {
+		if err := base(services...).Validate(); err == nil {
+			t.Errorf("Validate() expected error for %s", name)
+		}
+	}
+}
+
+func TestService_DataDir(t *testing.T) {
+	svc := Service{Name: "redis"}
+	if got := svc.DataDir(); got != "/run/forage-services/redis" {
+		t.Errorf("DataDir() = %q, want tmpfs path", got)
+	}
+	svc.Storage = ServiceStoragePersist
+	if got := svc.DataDir(); got != "/var/lib/forage-services/redis" {
+		t.Errorf("DataDir() = %q, want persisted path", got)
+	}
+
+	dir, err := ServiceDataDir("/var/lib/forage", "my-sandbox", "redis")
+	if err != nil || dir != "/var/lib/forage/services/my-sandbox/redis" {
+		t.Errorf("ServiceDataDir() = %q, %v", dir, err)
+	}
+	if _, err := ServiceDataDir("/var/lib/forage", "../etc", "redis"); err == nil {
+		t.Error("ServiceDataDir() expected error for path traversal")
+	}
+}
@@ -0,0 +1,109 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+// DefaultNotifyDebounce is the minimum time between two notifications
+// about the same sandbox.
+const DefaultNotifyDebounce = 5 * time.Minute
+
+// DefaultWaitingPatterns match the last lines of a pane when an agent
+// waits for input: permission prompts and yes/no questions.
+var DefaultWaitingPatterns = []string{
+	`(?i)do you want to `,
+	`(?i)\((y/n|yes/no)\)`,
+	`\[(Y/n|y/N)\]`,
+	`(?i)press enter to continue`,
+	`(?i)waiting for (your )?input`,
+}
+
+// Notifier is where the health monitor sends notifications, e.g. when an
+// agent waits for input. Exactly one of Command, Webhook and FIFO is set.
+type Notifier struct {
+	Command []string `json:"command,omitempty"` // Run on the host with the notification as JSON on stdin
+	Webhook string   `json:"webhook,omitempty"` // URL the notification is POSTed to as JSON
+	FIFO    string   `json:"fifo,omitempty"`    // Named pipe the notification is written to as a JSON line
+}
+
+// Validate checks that the Notifier is valid.
+func (n *Notifier) Validate() error {
+	kinds := 0
+	if len(n.Command) > 0 {
+		kinds++
+	}
+	if n.Webhook != "" {
+		kinds++
+		u, err := url.Parse(n.Webhook)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid webhook URL %q", n.Webhook)
+		}
+	}
+	if n.FIFO != "" {
+		kinds++
+		if !filepath.IsAbs(n.FIFO) {
+			return fmt.Errorf("fifo must be an absolute path (got %q)", n.FIFO)
+		}
+	}
+	if kinds != 1 {
+		return fmt.Errorf("exactly one of command, webhook and fifo is required")
+	}
+	return nil
+}
+
+// ResolvedNotifyDebounce returns the minimum time between two
+// notifications about the same sandbox.
+func (c *HostConfig) ResolvedNotifyDebounce() time.Duration {
+	if c == nil {
+		return DefaultNotifyDebounce
+	}
+	if d, err := time.ParseDuration(c.NotifyDebounce); err == nil && d >= 0 {
+		return d
+	}
+	return DefaultNotifyDebounce
+}
+
+// validateNotify validates the host's notifiers and debounce.
+func validateNotify(c *HostConfig) error {
+	for i := range c.Notifiers {
+		if err := c.Notifiers[i].Validate(); err != nil {
+			return fmt.Errorf("notifiers[%d]: %w", i, err)
+		}
+	}
+	if c.NotifyDebounce != "" {
+		if d, err := time.ParseDuration(c.NotifyDebounce); err != nil || d < 0 {
+			return fmt.Errorf("invalid notifyDebounce %q", c.NotifyDebounce)
+		}
+	}
+	return nil
+}
+
+// CompiledWaitingPatterns returns the template's waiting patterns, or the
+// default ones if it has none.
+func (t *Template) CompiledWaitingPatterns() []*regexp.Regexp {
+	patterns := t.WaitingPatterns
+	if len(patterns) == 0 {
+		patterns = DefaultWaitingPatterns
+	}
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		if re, err := regexp.Compile(p); err == nil {
+			compiled = append(compiled, re)
+		}
+	}
+	return compiled
+}
+
+// validateWaitingPatterns checks that a template's waiting patterns compile.
+func validateWaitingPatterns(patterns []string) error {
+	for _, p := range patterns {
+		if _, err := regexp.Compile(p); err != nil {
+			return fmt.Errorf("invalid waiting pattern %q: %w", p, err)
+		}
+	}
+	return nil
+}
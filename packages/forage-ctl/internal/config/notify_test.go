@@ -0,0 +1,72 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNotifier_Validate(t *testing.T) {
+	tests := []struct {
+		name     string
+		notifier Notifier
+		wantErr  bool
+	}{
+		{"command", Notifier{Command: []string{"notify-send", "forage"}}, false},
+		{"webhook", Notifier{Webhook: "https://hooks.example.com/forage"}, false},
+		{"fifo", Notifier{FIFO: "/run/forage/notify"}, false},
+		{"none", Notifier{}, true},
+		{"two", Notifier{Webhook: "https://hooks.example.com/forage", FIFO: "/run/forage/notify"}, true},
+		{"bad scheme", Notifier{Webhook: "ftp://example.com"}, true},
+		{"no host", Notifier{Webhook: "https:///forage"}, true},
+		{"relative fifo", Notifier{FIFO: "notify"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.notifier.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHostConfig_ResolvedNotifyDebounce(t *testing.T) {
+	tests := []struct {
+		config *HostConfig
+		want   time.Duration
+	}{
+		{nil, DefaultNotifyDebounce},
+		{&HostConfig{}, DefaultNotifyDebounce},
+		{&HostConfig{NotifyDebounce: "30s"}, 30 * time.Second},
+		{&HostConfig{NotifyDebounce: "0s"}, 0},
+	}
+	for _, tt := range tests {
+		if got := tt.config.ResolvedNotifyDebounce(); got != tt.want {
+			t.Errorf("ResolvedNotifyDebounce(%+v) = %v, want %v", tt.config, got, tt.want)
+		}
+	}
+}
+
+func TestTemplate_WaitingPatterns(t *testing.T) {
+	tmpl := Template{
+		Name:            "test",
+		Agents:          map[string]AgentConfig{"claude": {PackagePath: "/nix/store/claude", SecretName: "anthropic", AuthEnvVar: "ANTHROPIC_API_KEY"}},
+		WaitingPatterns: []string{"("},
+	}
+	if err := tmpl.Validate(); err == nil {
+		t.Error("invalid waiting pattern should be rejected")
+	}
+
+	tmpl.WaitingPatterns = []string{`^READY>`}
+	if err := tmpl.Validate(); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+	if got := tmpl.CompiledWaitingPatterns(); len(got) != 1 || !got[0].MatchString("READY> ") {
+		t.Errorf("CompiledWaitingPatterns() = %v", got)
+	}
+
+	tmpl.WaitingPatterns = nil
+	if got := tmpl.CompiledWaitingPatterns(); len(got) != len(DefaultWaitingPatterns) {
+		t.Errorf("got %d patterns, want the %d defaults", len(got), len(DefaultWaitingPatterns))
+	}
+}
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RequestPolicy restricts the API requests the proxy forwards for a
+// sandbox. Empty fields impose no restriction. Patterns match exactly, or
+// by prefix when they end in "*".
+type RequestPolicy struct {
+	AllowedModels  []string `json:"allowedModels,omitempty"`  // Model patterns requests may use
+	DefaultModel   string   `json:"defaultModel,omitempty"`   // Disallowed models are rewritten to this one instead of rejected
+	MaxTokens      int      `json:"maxTokens,omitempty"`      // Ceiling on requested output tokens; larger or missing limits are set to it
+	ForbiddenTools []string `json:"forbiddenTools,omitempty"` // Tool name or type patterns requests may not declare
+	ForbiddenBetas []string `json:"forbiddenBetas,omitempty"` // anthropic-beta feature patterns requests may not enable
+}
+
+// IsEmpty reports whether the policy restricts nothing.
+func (p *RequestPolicy) IsEmpty() bool {
+	return p == nil || (len(p.AllowedModels) == 0 && p.MaxTokens == 0 &&
+		len(p.ForbiddenTools) == 0 && len(p.ForbiddenBetas) == 0)
+}
+
+// Validate checks that the policy is consistent.
+func (p *RequestPolicy) Validate() error {
+	if p.MaxTokens < 0 {
+		return fmt.Errorf("policy maxTokens must not be negative")
+	}
+	if p.DefaultModel != "" {
+		if len(p.AllowedModels) == 0 {
+			return fmt.Errorf("policy defaultModel requires allowedModels")
+		}
+		if strings.HasSuffix(p.DefaultModel, "*") {
+			return fmt.Errorf("policy defaultModel must be a model name, not a pattern")
+		}
+		if !p.AllowsModel(p.DefaultModel) {
+			return fmt.Errorf("policy defaultModel %q is not in allowedModels", p.DefaultModel)
+		}
+	}
+	for _, patterns := range [][]string{p.AllowedModels, p.ForbiddenTools, p.ForbiddenBetas} {
+		for _, pattern := range patterns {
+			if pattern == "" {
+				return fmt.Errorf("empty policy pattern")
+			}
+			if strings.Contains(strings.TrimSuffix(pattern, "*"), "*") {
+				return fmt.Errorf("invalid policy pattern %q: only a trailing * is supported", pattern)
+			}
+		}
+	}
+	return nil
+}
+
+// AllowsModel reports whether requests may use model.
+func (p *RequestPolicy) AllowsModel(model string) bool {
+	return len(p.AllowedModels) == 0 || matchesAny(p.AllowedModels, model)
+}
+
+// ForbidsTool reports whether requests may not declare a tool with the
+// given name or type.
+func (p *RequestPolicy) ForbidsTool(nameOrType string) bool {
+	return matchesAny(p.ForbiddenTools, nameOrType)
+}
+
+// ForbidsBeta reports whether requests may not enable an anthropic-beta
+// feature.
+func (p *RequestPolicy) ForbidsBeta(beta string) bool {
+	return matchesAny(p.ForbiddenBetas, beta)
+}
+
+// matchesAny reports whether s matches one of the patterns.
+func matchesAny(patterns []string, s string) bool {
+	for _, pattern := range patterns {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(s, prefix) {
+				return true
+			}
+		} else if pattern == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,58 @@
+package config
+
+import "testing"
+
+func TestRequestPolicy_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  RequestPolicy
+		wantErr bool
+	}{
+		{"empty", RequestPolicy{}, false},
+		{"models with default", RequestPolicy{AllowedModels: []string{"claude-sonnet-*"}, DefaultModel: "claude-sonnet-4-5"}, false},
+		{"default without allowlist", RequestPolicy{DefaultModel: "claude-sonnet-4-5"}, true},
+		{"default not allowed", RequestPolicy{AllowedModels: []string{"claude-haiku-*"}, DefaultModel: "claude-sonnet-4-5"}, true},
+		{"default is a pattern", RequestPolicy{AllowedModels: []string{"claude-*"}, DefaultModel: "claude-*"}, true},
+		{"negative max tokens", RequestPolicy{MaxTokens: -1}, true},
+		{"inner wildcard", RequestPolicy{ForbiddenTools: []string{"web_*_tool"}}, true},
+		{"empty pattern", RequestPolicy{ForbiddenBetas: []string{""}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRequestPolicy_Matching(t *testing.T) {
+	p := &RequestPolicy{
+		AllowedModels:  []string{"claude-sonnet-*", "claude-haiku-4-5"},
+		ForbiddenTools: []string{"web_search*", "bash"},
+		ForbiddenBetas: []string{"computer-use-*"},
+	}
+	for model, want := range map[string]bool{
+		"claude-sonnet-4-5":   true,
+		"claude-haiku-4-5":    true,
+		"claude-haiku-4-5-v2": false,
+		"claude-opus-4-1":     false,
+	} {
+		if got := p.AllowsModel(model); got != want {
+			t.Errorf("AllowsModel(%q) = %v, want %v", model, got, want)
+		}
+	}
+	if !p.ForbidsTool("web_search_20250305") || !p.ForbidsTool("bash") || p.ForbidsTool("bash_20250124") {
+		t.Error("ForbidsTool() matched wrongly")
+	}
+	if !p.ForbidsBeta("computer-use-2025-01-24") || p.ForbidsBeta("prompt-caching-2024-07-31") {
+		t.Error("ForbidsBeta() matched wrongly")
+	}
+	if (&RequestPolicy{}).AllowsModel("anything") != true {
+		t.Error("an empty allowlist should allow every model")
+	}
+	if !(*RequestPolicy)(nil).IsEmpty() || p.IsEmpty() {
+		t.Error("IsEmpty() wrong")
+	}
+}
@@ -0,0 +1,115 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// Probe defaults.
+const (
+	DefaultProbeInterval         = 30 * time.Second
+	DefaultProbeTimeout          = 5 * time.Second
+	DefaultProbeFailureThreshold = 3
+)
+
+// Probe is a template-defined health check of a sandbox, run in addition
+// to the built-in container, SSH and multiplexer checks. Exactly one of
+// Command, HTTP and Process is set.
+type Probe struct {
+	Name             string     `json:"name"`
+	Command          []string   `json:"command,omitempty"`          // Run in the container; healthy when it exits with ExitCode
+	ExitCode         int        `json:"exitCode,omitempty"`         // Expected exit code of Command (default: 0)
+	HTTP             *HTTPProbe `json:"http,omitempty"`             // GET against the container IP
+	Process          string     `json:"process,omitempty"`          // Healthy while a process of this name runs in the container
+	Interval         string     `json:"interval,omitempty"`         // Minimum time between runs (default: 30s)
+	Timeout          string     `json:"timeout,omitempty"`          // Time a run may take (default: 5s)
+	FailureThreshold int        `json:"failureThreshold,omitempty"` // Consecutive failures before the sandbox is unhealthy (default: 3)
+}
+
+// HTTPProbe checks an HTTP endpoint served by the sandbox.
+type HTTPProbe struct {
+	Port   int    `json:"port"`
+	Path   string `json:"path,omitempty"`   // Request path (default: "/")
+	Status int    `json:"status,omitempty"` // Expected status code (default: any 2xx or 3xx)
+}
+
+// Validate checks that the Probe is valid.
+func (p *Probe) Validate() error {
+	if !serviceNameRegex.MatchString(p.Name) {
+		return fmt.Errorf("invalid probe name %q: must start with a lowercase letter, contain only lowercase letters, digits, or hyphens, and be at most 32 characters", p.Name)
+	}
+	kinds := 0
+	if len(p.Command) > 0 {
+		kinds++
+	}
+	if p.HTTP != nil {
+		kinds++
+		if p.HTTP.Port < 1 || p.HTTP.Port > 65535 {
+			return fmt.Errorf("probe %s: port must be between 1 and 65535 (got %d)", p.Name, p.HTTP.Port)
+		}
+		if p.HTTP.Status != 0 && (p.HTTP.Status < 100 || p.HTTP.Status > 599) {
+			return fmt.Errorf("probe %s: invalid status %d", p.Name, p.HTTP.Status)
+		}
+	}
+	if p.Process != "" {
+		kinds++
+	}
+	if kinds != 1 {
+		return fmt.Errorf("probe %s: exactly one of command, http and process is required", p.Name)
+	}
+	for field, value := range map[string]string{"interval": p.Interval, "timeout": p.Timeout} {
+		if value == "" {
+			continue
+		}
+		if d, err := time.ParseDuration(value); err != nil || d <= 0 {
+			return fmt.Errorf("probe %s: invalid %s %q", p.Name, field, value)
+		}
+	}
+	if p.FailureThreshold < 0 {
+		return fmt.Errorf("probe %s: failure threshold must not be negative", p.Name)
+	}
+	return nil
+}
+
+// IntervalDuration returns the minimum time between runs of the probe.
+func (p *Probe) IntervalDuration() time.Duration {
+	return parseProbeDuration(p.Interval, DefaultProbeInterval)
+}
+
+// TimeoutDuration returns the time a run of the probe may take.
+func (p *Probe) TimeoutDuration() time.Duration {
+	return parseProbeDuration(p.Timeout, DefaultProbeTimeout)
+}
+
+// Threshold returns the number of consecutive failures after which the
+// probe makes the sandbox unhealthy.
+func (p *Probe) Threshold() int {
+	if p.FailureThreshold > 0 {
+		return p.FailureThreshold
+	}
+	return DefaultProbeFailureThreshold
+}
+
+func parseProbeDuration(s string, def time.Duration) time.Duration {
+	if d, err := time.ParseDuration(s); err == nil && d > 0 {
+		return d
+	}
+	return def
+}
+
+// validateProbes validates a template's probes and checks that their
+// names are unique.
+func validateProbes(probes []Probe) error {
+	names := make(map[string]bool, len(probes))
+	for i := range probes {
+		probe := &probes[i]
+		if err := probe.Validate(); err != nil {
+			return fmt.Errorf("probes: %w", err)
+		}
+		if names[probe.Name] {
+			return fmt.Errorf("probes: duplicate probe name %q", probe.Name)
+		}
+		names[probe.Name] = true
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestProbe_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		probe   Probe
+		wantErr bool
+	}{
+		{"command", Probe{Name: "db", Command: []string{"pg_isready"}}, false},
+		{"http", Probe{Name: "web", HTTP: &HTTPProbe{Port: 8080, Path: "/health", Status: 204}}, false},
+		{"process", Probe{Name: "agent", Process: "claude", Interval: "1m", Timeout: "10s", FailureThreshold: 5}, false},
+		{"bad name", Probe{Name: "Web", Process: "x"}, true},
+		{"no check", Probe{Name: "none"}, true},
+		{"two checks", Probe{Name: "two", Process: "x", Command: []string{"true"}}, true},
+		{"bad port", Probe{Name: "web", HTTP: &HTTPProbe{Port: 0}}, true},
+		{"bad status", Probe{Name: "web", HTTP: &HTTPProbe{Port: 80, Status: 42}}, true},
+		{"bad interval", Probe{Name: "x", Process: "x", Interval: "often"}, true},
+		{"zero timeout", Probe{Name: "x", Process: "x", Timeout: "0s"}, true},
+		{"negative threshold", Probe{Name: "x", Process: "x", FailureThreshold: -1}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.probe.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestProbe_Defaults(t *testing.T) {
+	p := Probe{Name: "x", Process: "x"}
+	if p.IntervalDuration() != DefaultProbeInterval || p.TimeoutDuration() != DefaultProbeTimeout || p.Threshold() != DefaultProbeFailureThreshold {
+		t.Errorf("defaults = %v, %v, %d", p.IntervalDuration(), p.TimeoutDuration(), p.Threshold())
+	}
+	p = Probe{Name: "x", Process: "x", Interval: "2m", Timeout: "1s", FailureThreshold: 1}
+	if p.IntervalDuration() != 2*time.Minute || p.TimeoutDuration() != time.Second || p.Threshold() != 1 {
+		t.Errorf("got %v, %v, %d", p.IntervalDuration(), p.TimeoutDuration(), p.Threshold())
+	}
+}
+
+func TestTemplate_ValidateProbes(t *testing.T) {
+	tmpl := Template{
+		Name:   "test",
+		Agents: map[string]AgentConfig{"claude": {PackagePath: "/nix/store/claude", SecretName: "anthropic", AuthEnvVar: "ANTHROPIC_API_KEY"}},
+		Probes: []Probe{{Name: "db", Process: "postgres"}, {Name: "db", Process: "postgres"}},
+	}
+	if err := tmpl.Validate(); err == nil {
+		t.Error("duplicate probe names should be rejected")
+	}
+	tmpl.Probes = tmpl.Probes[:1]
+	if err := tmpl.Validate(); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+}
@@ -0,0 +1,147 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// Restart policies: when the health monitor restarts a sandbox. None of
+// them restarts a sandbox that was stopped on purpose (see StoppedBy).
+const (
+	RestartNever     = "never"      // never restart
+	RestartOnFailure = "on-failure" // restart crashed and unhealthy sandboxes
+	RestartAlways    = "always"     // also restart sandboxes whose multiplexer session ended
+)
+
+// Restart policy defaults.
+const (
+	DefaultRestartMaxRetries = 5
+	DefaultRestartBackoff    = 10 * time.Second
+	MaxRestartBackoff        = 10 * time.Minute
+
+	// RestartResetAfter is how long a restarted sandbox must stay healthy
+	// before its restarts are forgotten and it gets all its retries back.
+	RestartResetAfter = 10 * time.Minute
+)
+
+// Reasons a sandbox was stopped on purpose.
+const (
+	StoppedByUser   = "user"   // forage-ctl stop
+	StoppedByIdle   = "idle"   // idle timeout
+	StoppedByBudget = "budget" // budget exhausted
+)
+
+// RestartPolicy configures how the health monitor restarts failed
+// sandboxes. Unset fields fall back to the host's policy, then to the
+// defaults.
+type RestartPolicy struct {
+	Policy     string `json:"policy,omitempty"`     // never, on-failure or always
+	MaxRetries int    `json:"maxRetries,omitempty"` // Restarts before giving up and reporting a crash loop (default: 5)
+	Backoff    string `json:"backoff,omitempty"`    // Delay before the second restart, doubling for each one after (default: 10s)
+}
+
+// Validate checks that the RestartPolicy is valid.
+func (r *RestartPolicy) Validate() error {
+	switch r.Policy {
+	case "", RestartNever, RestartOnFailure, RestartAlways:
+	default:
+		return fmt.Errorf("invalid restart policy %q (must be never, on-failure or always)", r.Policy)
+	}
+	if r.MaxRetries < 0 {
+		return fmt.Errorf("restart maxRetries must not be negative")
+	}
+	if r.Backoff != "" {
+		if d, err := time.ParseDuration(r.Backoff); err != nil || d <= 0 {
+			return fmt.Errorf("invalid restart backoff %q", r.Backoff)
+		}
+	}
+	return nil
+}
+
+// ResolveRestartPolicy returns the restart policy of a sandbox: the
+// template's, else the host's, else the defaults with the fallback policy.
+// The result has every field set.
+func ResolveRestartPolicy(template *Template, host *HostConfig, fallback string) RestartPolicy {
+	var layers []*RestartPolicy
+	if template != nil && template.Restart != nil {
+		layers = append(layers, template.Restart)
+	}
+	if host != nil && host.Restart != nil {
+		layers = append(layers, host.Restart)
+	}
+	layers = append(layers, &RestartPolicy{
+		Policy:     fallback,
+		MaxRetries: DefaultRestartMaxRetries,
+		Backoff:    DefaultRestartBackoff.String(),
+	})
+
+	var r RestartPolicy
+	for _, l := range layers {
+		if r.Policy == "" {
+			r.Policy = l.Policy
+		}
+		if r.MaxRetries == 0 {
+			r.MaxRetries = l.MaxRetries
+		}
+		if r.Backoff == "" {
+			r.Backoff = l.Backoff
+		}
+	}
+	if r.Policy == "" {
+		r.Policy = RestartNever
+	}
+	return r
+}
+
+// Delay returns how long to wait after a sandbox's last restart before
+// restarting it again, given how many restarts it had: none before the
+// first, then the backoff, doubling up to MaxRestartBackoff.
+func (r RestartPolicy) Delay(restarts int) time.Duration {
+	if restarts <= 0 {
+		return 0
+	}
+	delay, err := time.ParseDuration(r.Backoff)
+	if err != nil || delay <= 0 {
+		delay = DefaultRestartBackoff
+	}
+	for i := 1; i < restarts && delay < MaxRestartBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, MaxRestartBackoff)
+}
+
+// RestartState is what the health monitor records about restarting a
+// sandbox.
+type RestartState struct {
+	Count     int       `json:"count"`               // Restarts since the sandbox was last healthy for RestartResetAfter
+	Last      time.Time `json:"last"`                // Time of the last restart
+	CrashLoop bool      `json:"crashLoop,omitempty"` // The monitor ran out of retries and gave up
+}
+
+// UpdateSandboxMetadata loads a sandbox's metadata, applies update to it and
+// saves it.
+func UpdateSandboxMetadata(sandboxesDir, name string, update func(*SandboxMetadata)) error {
+	metadata, err := LoadSandboxMetadata(sandboxesDir, name)
+	if err != nil {
+		return err
+	}
+	update(metadata)
+	return SaveSandboxMetadata(sandboxesDir, metadata)
+}
+
+// MarkStopped records that a sandbox was stopped on purpose, and why, so
+// that the health monitor leaves it stopped.
+func MarkStopped(sandboxesDir, name, reason string) error {
+	return UpdateSandboxMetadata(sandboxesDir, name, func(m *SandboxMetadata) {
+		m.StoppedBy = reason
+	})
+}
+
+// MarkStarted records that a sandbox was started on purpose: it is no
+// longer stopped on purpose, and its restarts start over.
+func MarkStarted(sandboxesDir, name string) error {
+	return UpdateSandboxMetadata(sandboxesDir, name, func(m *SandboxMetadata) {
+		m.StoppedBy = ""
+		m.Restarts = nil
+	})
+}
@@ -0,0 +1,102 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRestartPolicy_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  RestartPolicy
+		wantErr bool
+	}{
+		{"empty", RestartPolicy{}, false},
+		{"on-failure", RestartPolicy{Policy: RestartOnFailure, MaxRetries: 3, Backoff: "30s"}, false},
+		{"unknown", RestartPolicy{Policy: "sometimes"}, true},
+		{"negative retries", RestartPolicy{MaxRetries: -1}, true},
+		{"bad backoff", RestartPolicy{Backoff: "soon"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestResolveRestartPolicy(t *testing.T) {
+	host := &HostConfig{Restart: &RestartPolicy{Policy: RestartAlways, MaxRetries: 2}}
+	template := &Template{Restart: &RestartPolicy{Policy: RestartOnFailure, Backoff: "1m"}}
+
+	got := ResolveRestartPolicy(template, host, RestartNever)
+	want := RestartPolicy{Policy: RestartOnFailure, MaxRetries: 2, Backoff: "1m"}
+	if got != want {
+		t.Errorf("template and host: got %+v, want %+v", got, want)
+	}
+
+	got = ResolveRestartPolicy(&Template{}, nil, RestartOnFailure)
+	want = RestartPolicy{Policy: RestartOnFailure, MaxRetries: DefaultRestartMaxRetries, Backoff: DefaultRestartBackoff.String()}
+	if got != want {
+		t.Errorf("fallback: got %+v, want %+v", got, want)
+	}
+
+	if got := ResolveRestartPolicy(nil, nil, "").Policy; got != RestartNever {
+		t.Errorf("no policy: got %q, want %q", got, RestartNever)
+	}
+}
+
+func TestRestartPolicy_Delay(t *testing.T) {
+	r := RestartPolicy{Backoff: "10s"}
+	tests := []struct {
+		restarts int
+		want     time.Duration
+	}{
+		{0, 0},
+		{1, 10 * time.Second},
+		{2, 20 * time.Second},
+		{4, 80 * time.Second},
+		{20, MaxRestartBackoff},
+	}
+	for _, tt := range tests {
+		if got := r.Delay(tt.restarts); got != tt.want {
+			t.Errorf("Delay(%d) = %v, want %v", tt.restarts, got, tt.want)
+		}
+	}
+}
+
+func TestMarkStoppedAndStarted(t *testing.T) {
+	dir := t.TempDir()
+	meta := &SandboxMetadata{Name: "web", Restarts: &RestartState{Count: 5, CrashLoop: true}}
+	if err := SaveSandboxMetadata(dir, meta); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := MarkStopped(dir, "web", StoppedByUser); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadSandboxMetadata(dir, "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.StoppedBy != StoppedByUser {
+		t.Errorf("StoppedBy = %q, want %q", loaded.StoppedBy, StoppedByUser)
+	}
+
+	if err := MarkStarted(dir, "web"); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err = LoadSandboxMetadata(dir, "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.StoppedBy != "" || loaded.Restarts != nil {
+		t.Errorf("after start: StoppedBy = %q, Restarts = %+v, want both cleared", loaded.StoppedBy, loaded.Restarts)
+	}
+
+	if err := MarkStopped(dir, "missing", StoppedByUser); err == nil {
+		t.Error("marked a sandbox without metadata")
+	}
+}
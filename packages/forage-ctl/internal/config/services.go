@@ -0,0 +1,132 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+)
+
+// Service storage modes.
+const (
+	ServiceStorageTmpfs   = "tmpfs"   // data lives in /run and is lost when the container stops
+	ServiceStoragePersist = "persist" // data is bind-mounted from the host and kept until the sandbox is removed
+)
+
+// ServiceUnitPrefix prefixes the systemd unit name of every sidecar service.
+const ServiceUnitPrefix = "forage-service-"
+
+var (
+	// serviceNameRegex keeps service names usable in unit names, paths and
+	// shell commands.
+	serviceNameRegex = regexp.MustCompile(`^[a-z][a-z0-9-]{0,31}$`)
+
+	// nixAttrRegex validates nixpkgs attribute paths such as "postgresql_16"
+	// or "python3Packages.celery".
+	nixAttrRegex = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_-]*(\.[a-zA-Z_][a-zA-Z0-9_'-]*)*$`)
+
+	// envNameRegex validates environment variable names.
+	envNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// Service is a sidecar process, such as a database or cache, that runs next
+// to the agent inside the sandbox. On NixOS runtimes each service becomes a
+// systemd unit; other runtimes launch it as a background process.
+type Service struct {
+	Name    string            `json:"name"`
+	Package string            `json:"package"`           // nixpkgs attribute providing the service (e.g. "postgresql_16")
+	Command string            `json:"command"`           // Foreground command; $FORAGE_SERVICE_DATA holds the data directory
+	Ports   []int             `json:"ports,omitempty"`   // TCP ports the service listens on, used for readiness checks
+	Env     map[string]string `json:"env,omitempty"`     // Extra environment variables for the service
+	Storage string            `json:"storage,omitempty"` // "tmpfs" (default) or "persist"
+}
+
+// Validate checks that the Service is valid.
+func (s *Service) Validate() error {
+	if !serviceNameRegex.MatchString(s.Name) {
+		return fmt.Errorf("invalid service name %q: must start with a lowercase letter, contain only lowercase letters, digits, or hyphens, and be at most 32 characters", s.Name)
+	}
+	if s.Package == "" {
+		return fmt.Errorf("service %s: package is required", s.Name)
+	}
+	if !nixAttrRegex.MatchString(s.Package) {
+		return fmt.Errorf("service %s: invalid package %q: must be a nixpkgs attribute path", s.Name, s.Package)
+	}
+	if s.Command == "" {
+		return fmt.Errorf("service %s: command is required", s.Name)
+	}
+	for _, port := range s.Ports {
+		if port < 1 || port > 65535 {
+			return fmt.Errorf("service %s: port must be between 1 and 65535 (got %d)", s.Name, port)
+		}
+	}
+	for name := range s.Env {
+		if !envNameRegex.MatchString(name) {
+			return fmt.Errorf("service %s: invalid environment variable name %q", s.Name, name)
+		}
+	}
+	switch s.Storage {
+	case "", ServiceStorageTmpfs, ServiceStoragePersist:
+	default:
+		return fmt.Errorf("service %s: invalid storage %q (must be %s or %s)", s.Name, s.Storage, ServiceStorageTmpfs, ServiceStoragePersist)
+	}
+	return nil
+}
+
+// UnitName returns the systemd unit name of the service.
+func (s *Service) UnitName() string {
+	return ServiceUnitPrefix + s.Name
+}
+
+// Persistent reports whether the service keeps its data on the host.
+func (s *Service) Persistent() bool {
+	return s.Storage == ServiceStoragePersist
+}
+
+// DataDir returns the service's data directory inside the container.
+// Ephemeral data lives under /run, which is a tmpfs.
+func (s *Service) DataDir() string {
+	if s.Persistent() {
+		return "/var/lib/forage-services/" + s.Name
+	}
+	return "/run/forage-services/" + s.Name
+}
+
+// LogPath returns where the service writes its output inside the container
+// when it runs as a background process rather than a systemd unit.
+func (s *Service) LogPath() string {
+	return "/tmp/" + s.UnitName() + ".log"
+}
+
+// ServiceDataDir returns the host directory backing a persisted service's
+// data directory.
+func ServiceDataDir(stateDir, sandboxName, service string) (string, error) {
+	dir, err := safePath(filepath.Join(stateDir, "services"), sandboxName, "")
+	if err != nil {
+		return "", err
+	}
+	return safePath(dir, service, "")
+}
+
+// validateServices checks a template's services and rejects duplicate
+// names or ports.
+func validateServices(services []Service) error {
+	names := make(map[string]bool, len(services))
+	ports := make(map[int]string)
+	for i := range services {
+		svc := &services[i]
+		if err := svc.Validate(); err != nil {
+			return fmt.Errorf("services: %w", err)
+		}
+		if names[svc.Name] {
+			return fmt.Errorf("services: duplicate service name %q", svc.Name)
+		}
+		names[svc.Name] = true
+		for _, port := range svc.Ports {
+			if other, ok := ports[port]; ok {
+				return fmt.Errorf("services: port %d used by both %s and %s", port, other, svc.Name)
+			}
+			ports[port] = svc.Name
+		}
+	}
+	return nil
+}
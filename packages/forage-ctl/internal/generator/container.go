@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strings"
 
@@ -36,6 +37,20 @@ type ContainerConfig struct {
 	// ResourceLimits are optional cgroup limits for the container.
 	ResourceLimits *config.ResourceLimits
 
+	// Addresses of the sandbox's private link, from the host's address
+	// plan. When unset, addresses are derived from NetworkSlot using the
+	// default 10.100.X.0/24 plan.
+	Addresses network.Addresses
+
+	// HostGroups are custom allowlist host groups from host config,
+	// used to expand "@name" entries in the template's allowed hosts.
+	HostGroups map[string][]string
+
+	// Group is the sandbox group the container belongs to, if any.
+	// GroupNetworks are the prefixes peer sandboxes are addressed from.
+	Group         string
+	GroupNetworks []string
+
 	// Contributions from the injection collector (required).
 	// Contains all mounts, packages, env vars, and tmpfiles rules.
 	Contributions *injection.Contributions
@@ -50,8 +65,12 @@ func (c *ContainerConfig) Validate() error {
 	if c.Name == "" {
 		return fmt.Errorf("container name is required")
 	}
-	if c.NetworkSlot < 1 || c.NetworkSlot > 254 {
-		return fmt.Errorf("invalid network slot: %d (must be 1-254)", c.NetworkSlot)
+	if c.Addresses.HostIP == "" {
+		if _, err := network.DefaultAddressPlan().Addresses(c.NetworkSlot); err != nil {
+			return fmt.Errorf("invalid network slot: %w", err)
+		}
+	} else if c.NetworkSlot < 1 {
+		return fmt.Errorf("invalid network slot: %d (must be at least 1)", c.NetworkSlot)
 	}
 	if len(c.AuthorizedKeys) == 0 {
 		return fmt.Errorf("at least one authorized key is required")
@@ -62,6 +81,9 @@ func (c *ContainerConfig) Validate() error {
 	if err := c.Template.Validate(); err != nil {
 		return fmt.Errorf("invalid template: %w", err)
 	}
+	if _, err := network.ExpandAllowedHosts(c.Template.AllowedHosts, c.HostGroups); err != nil {
+		return fmt.Errorf("invalid allowed hosts: %w", err)
+	}
 	if c.Contributions == nil {
 		return fmt.Errorf("contributions is required")
 	}
@@ -104,22 +126,35 @@ func buildTemplateData(cfg *ContainerConfig) *TemplateData {
 		stateVersion = "24.11"
 	}
 
+	addrs := cfg.Addresses
+	if addrs.HostIP == "" {
+		addrs, _ = network.DefaultAddressPlan().Addresses(cfg.NetworkSlot)
+	}
+
 	data := &TemplateData{
 		ContainerName:  config.ContainerNameForSlot(cfg.NetworkSlot),
 		Hostname:       cfg.Name,
 		NetworkSlot:    cfg.NetworkSlot,
+		HostAddress:    addrs.HostIP,
+		LocalAddress:   addrs.ContainerIP,
+		HostAddress6:   addrs.HostIPv6,
+		LocalAddress6:  addrs.ContainerIPv6,
 		StateVersion:   stateVersion,
 		Username:       username,
 		HomeDir:        "/home/" + username,
 		WorkspaceDir:   workspaceDir,
 		AuthorizedKeys: cfg.AuthorizedKeys,
-		NetworkConfig:  buildNetworkConfig(cfg.Template.Network, cfg.Template.AllowedHosts, cfg.NetworkSlot),
+		NetworkConfig:  buildNetworkConfig(cfg, addrs),
 		UID:            cfg.UID,
 		GID:            cfg.GID,
 		SandboxName:    cfg.Name,
 		Runtime:        cfg.Runtime,
 	}
 
+	for _, svc := range cfg.Template.Services {
+		data.Services = append(data.Services, buildServiceData(svc))
+	}
+
 	// Set resource limits if configured
 	if cfg.ResourceLimits != nil && !cfg.ResourceLimits.IsEmpty() {
 		data.ResourceLimits = cfg.ResourceLimits
@@ -169,11 +204,16 @@ func buildTemplateData(cfg *ContainerConfig) *TemplateData {
 	return data
 }
 
-func buildNetworkConfig(networkMode string, allowedHosts []string, slot int) string {
+func buildNetworkConfig(container *ContainerConfig, addrs network.Addresses) string {
 	cfg := &network.Config{
-		Mode:         network.Mode(networkMode),
-		AllowedHosts: allowedHosts,
-		NetworkSlot:  slot,
+		Mode:          network.Mode(container.Template.Network),
+		AllowedHosts:  container.Template.AllowedHosts,
+		NetworkSlot:   container.NetworkSlot,
+		HostGroups:    container.HostGroups,
+		Addresses:     addrs,
+		Group:         container.Group,
+		GroupNetworks: container.GroupNetworks,
+		OpenTCPPorts:  probePorts(container.Template.Probes),
 	}
 
 	// Default to full if not specified
@@ -184,6 +224,48 @@ func buildNetworkConfig(networkMode string, allowedHosts []string, slot int) str
 	return network.GenerateNixNetworkConfig(cfg)
 }
 
+// probePorts returns the ports HTTP probes reach the sandbox on, which the
+// container firewall must let the host through to.
+func probePorts(probes []config.Probe) []int {
+	var ports []int
+	for _, p := range probes {
+		if p.HTTP != nil && !slices.Contains(ports, p.HTTP.Port) {
+			ports = append(ports, p.HTTP.Port)
+		}
+	}
+	sort.Ints(ports)
+	return ports
+}
+
+// buildServiceData prepares a sidecar service for rendering. Single-line
+// commands are exec'd so the unit's main process is the service itself.
+func buildServiceData(svc config.Service) ServiceData {
+	names := make([]string, 0, len(svc.Env))
+	for name := range svc.Env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	env := make([]EnvVar, 0, len(names))
+	for _, name := range names {
+		env = append(env, EnvVar{Name: name, Value: svc.Env[name]})
+	}
+
+	command := strings.TrimSpace(svc.Command)
+	if !strings.Contains(command, "\n") {
+		command = "exec " + command
+	}
+	lines := strings.Split(nixEscapeIndented(command), "\n")
+
+	return ServiceData{
+		Name:    svc.Name,
+		Unit:    svc.UnitName(),
+		Package: svc.Package,
+		DataDir: svc.DataDir(),
+		Env:     env,
+		Script:  strings.Join(lines, "\n              "),
+	}
+}
+
 // resolveClaudeWrapper detects whether a system-prompt.md mount exists and, if
 // the template includes a "claude" agent, configures a shell-script wrapper
 // that passes --append-system-prompt. The raw Claude package is removed from
@@ -25,7 +25,8 @@
 // # Generated Features
 //
 // The generated configuration includes:
-//   - Private networking with NAT (10.100.X.0/24 subnets)
+//   - Private networking with NAT (per-sandbox subnets from the host address
+//     plan; 10.100.X.0/24 by default)
 //   - SSH access with key authentication
 //   - Workspace bind mount at /workspace
 //   - Nix store shared read-only from host
@@ -9,6 +9,7 @@ import (
 	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/config"
 	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/injection"
 	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/multiplexer"
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/network"
 	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/reproducibility"
 	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/skills"
 )
@@ -316,6 +317,33 @@ func TestGenerateNixConfig_NetworkModes(t *testing.T) {
 	}
 }
 
+func TestGenerateNixConfig_ProbePorts(t *testing.T) {
+	cfg := validTestConfig()
+	cfg.Template.Probes = []config.Probe{
+		{Name: "api", HTTP: &config.HTTPProbe{Port: 8080, Path: "/health"}},
+		{Name: "admin", HTTP: &config.HTTPProbe{Port: 9090}},
+		{Name: "ready", HTTP: &config.HTTPProbe{Port: 8080, Path: "/ready"}},
+		{Name: "worker", Process: "worker"},
+	}
+
+	result, err := GenerateNixConfig(cfg)
+	if err != nil {
+		t.Fatalf("GenerateNixConfig failed: %v", err)
+	}
+	if !strings.Contains(result, "networking.firewall.allowedTCPPorts = [ 22 8080 9090 ];") {
+		t.Errorf("firewall should open SSH and the HTTP probe ports, got:\n%s", result)
+	}
+
+	cfg.Group = "web"
+	result, err = GenerateNixConfig(cfg)
+	if err != nil {
+		t.Fatalf("GenerateNixConfig failed: %v", err)
+	}
+	if !strings.Contains(result, "networking.firewall.allowedTCPPorts = [ 22 8080 9090 ];") {
+		t.Errorf("grouped sandbox firewall should open the HTTP probe ports, got:\n%s", result)
+	}
+}
+
 func TestGenerateNixConfig_ProxyMode(t *testing.T) {
 	cfg := validTestConfig()
 	// Add proxy env vars via contributions
@@ -400,6 +428,14 @@ func TestContainerConfig_Validate(t *testing.T) {
 			modify:  func(c *ContainerConfig) { c.NetworkSlot = 300 },
 			wantErr: "invalid network slot",
 		},
+		{
+			name: "high network slot with plan addresses",
+			modify: func(c *ContainerConfig) {
+				c.NetworkSlot = 300
+				c.Addresses, _ = network.AddressesForSubnets("10.100.18.192/28", "")
+			},
+			wantErr: "",
+		},
 		{
 			name:    "missing contributions",
 			modify:  func(c *ContainerConfig) { c.Contributions = nil },
@@ -461,7 +497,7 @@ func TestGenerateSystemPrompt(t *testing.T) {
 		},
 	}
 
-	result := skills.GenerateSystemPrompt(metadata, tmpl)
+	result := skills.GenerateSystemPrompt(metadata, tmpl, nil)
 
 	if !strings.Contains(result, "test-sandbox") {
 		t.Error("System prompt should contain sandbox name")
@@ -490,7 +526,7 @@ func TestGenerateSystemPrompt_JJMode(t *testing.T) {
 		Network: "full",
 	}
 
-	result := skills.GenerateSystemPrompt(metadata, tmpl)
+	result := skills.GenerateSystemPrompt(metadata, tmpl, nil)
 
 	if !strings.Contains(result, "jj workspace") {
 		t.Error("System prompt should mention jj workspace mode")
@@ -520,7 +556,7 @@ func TestGenerateSystemPrompt_NetworkModes(t *testing.T) {
 				Network: tt.network,
 			}
 
-			result := skills.GenerateSystemPrompt(metadata, tmpl)
+			result := skills.GenerateSystemPrompt(metadata, tmpl, nil)
 
 			if !strings.Contains(result, tt.shouldHave) {
 				t.Errorf("System prompt for network %q should contain %q\nGot:\n%s", tt.network, tt.shouldHave, result)
@@ -539,7 +575,7 @@ func TestGenerateSystemPrompt_RestrictedHosts(t *testing.T) {
 		AllowedHosts: []string{"api.anthropic.com", "github.com"},
 	}
 
-	result := skills.GenerateSystemPrompt(metadata, tmpl)
+	result := skills.GenerateSystemPrompt(metadata, tmpl, nil)
 
 	if !strings.Contains(result, "api.anthropic.com") {
 		t.Error("System prompt should list allowed hosts")
@@ -563,7 +599,7 @@ func TestGenerateSystemPrompt_Identity(t *testing.T) {
 		Network: "full",
 	}
 
-	result := skills.GenerateSystemPrompt(metadata, tmpl)
+	result := skills.GenerateSystemPrompt(metadata, tmpl, nil)
 
 	if !strings.Contains(result, "Identity") {
 		t.Error("System prompt should have identity info")
@@ -591,7 +627,7 @@ func TestGenerateSystemPrompt_IdentityGitOnly(t *testing.T) {
 		Network: "full",
 	}
 
-	result := skills.GenerateSystemPrompt(metadata, tmpl)
+	result := skills.GenerateSystemPrompt(metadata, tmpl, nil)
 
 	if !strings.Contains(result, "Identity") {
 		t.Error("System prompt should have identity info")
@@ -610,7 +646,7 @@ func TestGenerateSystemPrompt_NoIdentity(t *testing.T) {
 		Network: "full",
 	}
 
-	result := skills.GenerateSystemPrompt(metadata, tmpl)
+	result := skills.GenerateSystemPrompt(metadata, tmpl, nil)
 
 	if strings.Contains(result, "Identity") {
 		t.Error("System prompt should not have identity info when none configured")
@@ -634,7 +670,7 @@ func TestGenerateSystemPrompt_WithAgents(t *testing.T) {
 		},
 	}
 
-	result := skills.GenerateSystemPrompt(metadata, tmpl)
+	result := skills.GenerateSystemPrompt(metadata, tmpl, nil)
 
 	if !strings.Contains(result, "Agents") {
 		t.Error("System prompt should have agents info")
@@ -782,6 +818,47 @@ func readGoldenFile(t *testing.T, name string) string {
 	return string(data)
 }
 
+func TestGenerateNixConfig_Addresses(t *testing.T) {
+	cfg := validTestConfig()
+	cfg.NetworkSlot = 300
+	cfg.Addresses, _ = network.AddressesForSubnets("10.100.18.192/28", "fd42:f0:0:12c::/64")
+
+	result, err := GenerateNixConfig(cfg)
+	if err != nil {
+		t.Fatalf("GenerateNixConfig failed: %v", err)
+	}
+
+	for _, s := range []string{
+		"containers.f300",
+		`hostAddress = "10.100.18.193";`,
+		`localAddress = "10.100.18.194";`,
+		`hostAddress6 = "fd42:f0:0:12c::1";`,
+		`localAddress6 = "fd42:f0:0:12c::2";`,
+		`networking.defaultGateway = "10.100.18.193";`,
+	} {
+		if !strings.Contains(result, s) {
+			t.Errorf("config should contain %q", s)
+		}
+	}
+}
+
+func TestGenerateNixConfig_DefaultAddresses(t *testing.T) {
+	cfg := validTestConfig()
+	cfg.NetworkSlot = 7
+
+	result, err := GenerateNixConfig(cfg)
+	if err != nil {
+		t.Fatalf("GenerateNixConfig failed: %v", err)
+	}
+
+	if !strings.Contains(result, `hostAddress = "10.100.7.1";`) || !strings.Contains(result, `localAddress = "10.100.7.2";`) {
+		t.Error("config should use the default 10.100.X.0/24 plan without explicit addresses")
+	}
+	if strings.Contains(result, "hostAddress6") {
+		t.Error("config should not set IPv6 addresses without an IPv6 subnet")
+	}
+}
+
 func TestGenerateNixConfig_Golden(t *testing.T) {
 	tests := []struct {
 		name       string
@@ -1050,6 +1127,7 @@ func TestNixEscapeIndented(t *testing.T) {
 		{"nix interpolation", "x${y}z", "x''${y}z"},
 		{"no double quote escape needed", `say "hi"`, `say "hi"`},
 		{"multiple interpolations", "${a}${b}", "''${a}''${b}"},
+		{"empty single-quoted string", "psql -c ''", "psql -c '''"},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -1545,3 +1623,55 @@ func TestGenerateNixConfig_RestrictedNetwork(t *testing.T) {
 		}
 	}
 }
+
+func TestGenerateNixConfig_Services(t *testing.T) {
+	cfg := validTestConfig()
+	cfg.Template.Services = []config.Service{
+		{
+			Name:    "postgres",
+			Package: "postgresql_16",
+			Command: `postgres -D "$FORAGE_SERVICE_DATA" -k ''`,
+			Ports:   []int{5432},
+			Env:     map[string]string{"PGUSER": "agent", "PGPASSWORD": "pa\"ss"},
+		},
+		{
+			Name:    "redis",
+			Package: "redis",
+			Command: "redis-server --dir \"$FORAGE_SERVICE_DATA\"",
+			Storage: config.ServiceStoragePersist,
+		},
+	}
+
+	result, err := GenerateNixConfig(cfg)
+	if err != nil {
+		t.Fatalf("GenerateNixConfig failed: %v", err)
+	}
+
+	for _, s := range []string{
+		"systemd.services.forage-service-postgres = {",
+		"path = [ pkgs.postgresql_16 pkgs.coreutils pkgs.bash ];",
+		`FORAGE_SERVICE_DATA = "/run/forage-services/postgres";`,
+		`PGPASSWORD = "pa\"ss";`,
+		`WorkingDirectory = "/run/forage-services/postgres";`,
+		`exec postgres -D "$FORAGE_SERVICE_DATA" -k '''`,
+		"systemd.services.forage-service-redis = {",
+		`FORAGE_SERVICE_DATA = "/var/lib/forage-services/redis";`,
+	} {
+		if !strings.Contains(result, s) {
+			t.Errorf("Config should contain %q, got:\n%s", s, result)
+		}
+	}
+	if strings.Index(result, "PGPASSWORD") > strings.Index(result, "PGUSER") {
+		t.Error("Service environment should be sorted by name")
+	}
+}
+
+func TestGenerateNixConfig_NoServices(t *testing.T) {
+	result, err := GenerateNixConfig(validTestConfig())
+	if err != nil {
+		t.Fatalf("GenerateNixConfig failed: %v", err)
+	}
+	if strings.Contains(result, "forage-service-") {
+		t.Error("Config should not contain service units when the template has none")
+	}
+}
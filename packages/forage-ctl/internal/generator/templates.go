@@ -14,6 +14,10 @@ type TemplateData struct {
 	ContainerName      string
 	Hostname           string // Hostname inside the container (the sandbox name)
 	NetworkSlot        int
+	HostAddress        string // Host side of the container's private link
+	LocalAddress       string // Container side of the private link
+	HostAddress6       string // IPv6 host address (empty if IPv6 is not configured)
+	LocalAddress6      string // IPv6 container address (empty if IPv6 is not configured)
 	StateVersion       string
 	Username           string // Container username (e.g. "agent")
 	HomeDir            string // Container home directory (e.g. "/home/agent")
@@ -36,6 +40,17 @@ type TemplateData struct {
 	SandboxName        string                 // Sandbox name (for in-container metadata)
 	Runtime            string                 // Runtime backend name (for in-container metadata)
 	ResourceLimits     *config.ResourceLimits // Optional resource limits for systemd
+	Services           []ServiceData          // Sidecar services rendered as systemd units
+}
+
+// ServiceData represents a sidecar service unit in the Nix config.
+type ServiceData struct {
+	Name    string
+	Unit    string   // systemd unit name
+	Package string   // nixpkgs attribute
+	DataDir string   // container data directory, exported as FORAGE_SERVICE_DATA
+	Env     []EnvVar // raw values, escaped when rendered
+	Script  string   // service command, escaped for an indented string
 }
 
 // BindMount represents a bind mount entry in the Nix config.
@@ -69,9 +84,13 @@ func nixEscape(s string) string {
 }
 
 // nixEscapeIndented escapes a string for safe inclusion inside a Nix indented
-// string literal (”...”). The only interpolation sequence in indented strings
-// is ${...}, which is escaped as ”${...}.
+// string literal. Two single quotes would end the string, and ${ would start
+// an interpolation, so both are escaped:
+//
+//	''      ->  '''
+//	${...}  ->  ''${...}
 func nixEscapeIndented(s string) string {
+	s = strings.ReplaceAll(s, "''", "'''")
 	return strings.ReplaceAll(s, "${", "''${")
 }
 
@@ -82,8 +101,12 @@ const containerTemplateText = `{ pkgs, ... }:
     autoStart = true;
     ephemeral = true;
     privateNetwork = true;
-    hostAddress = "10.100.{{.NetworkSlot}}.1";
-    localAddress = "10.100.{{.NetworkSlot}}.2";
+    hostAddress = "{{.HostAddress}}";
+    localAddress = "{{.LocalAddress}}";
+{{- if .HostAddress6}}
+    hostAddress6 = "{{.HostAddress6}}";
+    localAddress6 = "{{.LocalAddress6}}";
+{{- end}}
 
     bindMounts = {
 {{- range .BindMounts}}
@@ -196,6 +219,29 @@ const containerTemplateText = `{ pkgs, ... }:
             ''}";
           };
         };
+{{- range .Services}}
+        systemd.services.{{.Unit}} = {
+          description = "Forage sidecar service {{.Name}}";
+          wantedBy = [ "multi-user.target" ];
+          after = [ "network.target" "systemd-tmpfiles-setup.service" ];
+          path = [ pkgs.{{.Package}} pkgs.coreutils pkgs.bash ];
+          environment = {
+            FORAGE_SERVICE_DATA = "{{.DataDir}}";
+{{- range .Env}}
+            {{.Name}} = "{{.Value | nixEscape}}";
+{{- end}}
+          };
+          serviceConfig = {
+            User = "{{$.Username}}";
+            WorkingDirectory = "{{.DataDir}}";
+            Restart = "on-failure";
+            RestartSec = 2;
+            ExecStart = "${pkgs.writeShellScript "{{.Unit}}" ''
+              {{.Script}}
+            ''}";
+          };
+        };
+{{- end}}
 {{- if .ResourceLimits}}
         systemd.services.forage-resources = {
           description = "Forage Resource Limits (no-op anchor for resource control)";
@@ -54,6 +54,7 @@
                 ct state established,related accept
 
                 # Reject everything else
+                meta nfproto ipv6 reject with icmpv6 type admin-prohibited
                 reject with icmp type admin-prohibited
               }
             }
@@ -0,0 +1,171 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/config"
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/multiplexer"
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/runtime"
+)
+
+// Status collection defaults.
+const (
+	DefaultCollectWorkers = 8
+
+	// DefaultCollectTimeout bounds the checks of one sandbox. A sandbox
+	// that does not answer in time is unhealthy.
+	DefaultCollectTimeout = 10 * time.Second
+)
+
+// SandboxStatus is the collected status of a sandbox.
+type SandboxStatus struct {
+	Name      string          `json:"name"`
+	Status    Status          `json:"status"`
+	Uptime    string          `json:"-"` // read from the runtime, never cached
+	Probes    []ProbeState    `json:"probes,omitempty"`
+	Services  []ServiceStatus `json:"services,omitempty"`
+	CheckedAt time.Time       `json:"checkedAt"`
+}
+
+// Failing returns the names of the sandbox's failing probes.
+func (s *SandboxStatus) Failing() []string {
+	return FailingProbes(s.Probes)
+}
+
+// CollectOptions configures Collect.
+type CollectOptions struct {
+	Workers int           // Sandboxes checked at once (default: DefaultCollectWorkers)
+	Timeout time.Duration // Deadline for the checks of one sandbox (default: DefaultCollectTimeout)
+	Cache   string        // Status cache to take fresh statuses from, see SaveStatusCache
+
+	// Services returns the sidecar services of a sandbox. If set, a
+	// healthy sandbox with a service that is not ready is degraded.
+	Services func(*config.SandboxMetadata) []config.Service
+
+	// Check returns the status of a running sandbox (default: checking
+	// SSH and the multiplexer session).
+	Check func(ctx context.Context, host string, mux multiplexer.Multiplexer) Status
+}
+
+// Collect returns the status of each sandbox, in order, checking up to
+// opts.Workers sandboxes at once. A running sandbox with a fresh entry in
+// the cache gets the cached status without any SSH round trip; whether a
+// sandbox runs is always asked of the runtime, so starting or stopping it
+// shows at once. The rt parameter is optional; if nil, all sandboxes are
+// stopped.
+func Collect(ctx context.Context, rt runtime.Runtime, paths *config.Paths, sandboxes []*config.SandboxMetadata, opts CollectOptions) []SandboxStatus {
+	if opts.Workers <= 0 {
+		opts.Workers = DefaultCollectWorkers
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultCollectTimeout
+	}
+	if opts.Check == nil {
+		opts.Check = runningSummary
+	}
+	var cached map[string]SandboxStatus
+	if opts.Cache != "" {
+		cached = loadStatusCache(opts.Cache, time.Now())
+	}
+
+	statuses := make([]SandboxStatus, len(sandboxes))
+	slots := make(chan struct{}, opts.Workers)
+	var wg sync.WaitGroup
+	for i, sb := range sandboxes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			statuses[i] = collectOne(ctx, rt, paths, sb, cached, opts)
+		}()
+	}
+	wg.Wait()
+	return statuses
+}
+
+// collectOne checks one sandbox within opts.Timeout.
+func collectOne(ctx context.Context, rt runtime.Runtime, paths *config.Paths, sb *config.SandboxMetadata, cached map[string]SandboxStatus, opts CollectOptions) SandboxStatus {
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	status := SandboxStatus{Name: sb.Name, Status: StatusStopped, CheckedAt: time.Now()}
+	if rt == nil {
+		return status
+	}
+	if running, _ := rt.IsRunning(ctx, sb.Name); !running {
+		return status
+	}
+	uptime := getUptime(ctx, sb.Name, rt)
+	if c, ok := cached[sb.Name]; ok {
+		c.Uptime = uptime
+		return c
+	}
+
+	status.Uptime = uptime
+	mux := multiplexer.New(multiplexer.Type(sb.Multiplexer))
+	status.Status = opts.Check(ctx, sb.ContainerIP(), mux)
+	status.Probes = CheckSandboxProbes(ctx, rt, paths, sb)
+	status.Status = ApplyProbes(status.Status, status.Probes)
+	if opts.Services != nil && status.Status == StatusHealthy {
+		if services := opts.Services(sb); len(services) > 0 {
+			status.Services = checkServices(ctx, sb.ContainerIP(), services)
+			if !ServicesReady(status.Services) {
+				status.Status = StatusDegraded
+			}
+		}
+	}
+	return status
+}
+
+// statusCache is the file the health monitor records sandbox statuses in.
+type statusCache struct {
+	Expires   time.Time       `json:"expires"`
+	Sandboxes []SandboxStatus `json:"sandboxes"`
+}
+
+// StatusCachePath returns the status cache under the state directory.
+func StatusCachePath(stateDir string) string {
+	return filepath.Join(stateDir, "status-cache.json")
+}
+
+// SaveStatusCache records statuses for Collect to use during the next ttl.
+func SaveStatusCache(path string, statuses []SandboxStatus, ttl time.Duration) error {
+	data, err := json.MarshalIndent(statusCache{
+		Expires:   time.Now().Add(ttl),
+		Sandboxes: statuses,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// loadStatusCache returns the cached statuses of running sandboxes by
+// name, or nil if the cache is missing, unreadable or expired at now.
+func loadStatusCache(path string, now time.Time) map[string]SandboxStatus {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var cache statusCache
+	if json.Unmarshal(data, &cache) != nil || !now.Before(cache.Expires) {
+		return nil
+	}
+	statuses := make(map[string]SandboxStatus, len(cache.Sandboxes))
+	for _, s := range cache.Sandboxes {
+		if s.Status != StatusStopped { // it was started since
+			statuses[s.Name] = s
+		}
+	}
+	return statuses
+}
@@ -0,0 +1,97 @@
+package health
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/config"
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/multiplexer"
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/runtime"
+)
+
+func collectSandboxes(names ...string) []*config.SandboxMetadata {
+	var sandboxes []*config.SandboxMetadata
+	for i, name := range names {
+		sandboxes = append(sandboxes, &config.SandboxMetadata{Name: name, NetworkSlot: i + 1})
+	}
+	return sandboxes
+}
+
+func TestCollect_Stopped(t *testing.T) {
+	rt := runtime.NewMockRuntime()
+	sandboxes := collectSandboxes("a", "b", "c", "d", "e")
+	for _, sb := range sandboxes {
+		rt.AddContainer(sb.Name, runtime.StatusStopped)
+	}
+
+	statuses := Collect(context.Background(), rt, nil, sandboxes, CollectOptions{Workers: 2})
+	if len(statuses) != len(sandboxes) {
+		t.Fatalf("got %d statuses, want %d", len(statuses), len(sandboxes))
+	}
+	for i, s := range statuses {
+		if s.Name != sandboxes[i].Name || s.Status != StatusStopped {
+			t.Errorf("statuses[%d] = %s %s, want %s stopped", i, s.Name, s.Status, sandboxes[i].Name)
+		}
+	}
+
+	if statuses := Collect(context.Background(), nil, nil, sandboxes, CollectOptions{}); statuses[0].Status != StatusStopped {
+		t.Errorf("status without a runtime = %s, want stopped", statuses[0].Status)
+	}
+}
+
+func TestCollect_Cache(t *testing.T) {
+	rt := runtime.NewMockRuntime()
+	rt.AddContainer("web", runtime.StatusRunning)
+	rt.AddContainer("db", runtime.StatusStopped)
+	sandboxes := collectSandboxes("web", "db")
+	cache := filepath.Join(t.TempDir(), "status-cache.json")
+	opts := CollectOptions{Cache: cache, Timeout: 100 * time.Millisecond}
+
+	cached := []SandboxStatus{
+		{Name: "web", Status: StatusHealthy, Probes: []ProbeState{{Name: "http", Healthy: false}}},
+		{Name: "db", Status: StatusHealthy},
+	}
+	if err := SaveStatusCache(cache, cached, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	statuses := Collect(context.Background(), rt, nil, sandboxes, opts)
+	if statuses[0].Status != StatusHealthy || len(statuses[0].Failing()) != 1 {
+		t.Errorf("web = %+v, want the cached status", statuses[0])
+	}
+	if statuses[1].Status != StatusStopped {
+		t.Errorf("db = %s, want stopped since it was cached", statuses[1].Status)
+	}
+
+	// Expired, web is checked again, and cut short by the deadline
+	if err := SaveStatusCache(cache, cached, -time.Second); err != nil {
+		t.Fatal(err)
+	}
+	opts.Check = func(ctx context.Context, _ string, _ multiplexer.Multiplexer) Status {
+		<-ctx.Done()
+		return StatusUnhealthy
+	}
+	start := time.Now()
+	statuses = Collect(context.Background(), rt, nil, sandboxes, opts)
+	if statuses[0].Status != StatusUnhealthy {
+		t.Errorf("web = %s, want unhealthy", statuses[0].Status)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("collecting took %v, want it cut short by the deadline", elapsed)
+	}
+}
+
+func TestLoadStatusCache_Invalid(t *testing.T) {
+	dir := t.TempDir()
+	if got := loadStatusCache(filepath.Join(dir, "missing.json"), time.Now()); got != nil {
+		t.Errorf("missing cache = %v, want nil", got)
+	}
+	path := StatusCachePath(dir)
+	if err := SaveStatusCache(path, []SandboxStatus{{Name: "web", Status: StatusHealthy}}, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if got := loadStatusCache(path, time.Now().Add(2*time.Minute)); got != nil {
+		t.Errorf("expired cache = %v, want nil", got)
+	}
+}
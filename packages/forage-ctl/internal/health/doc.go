@@ -8,7 +8,7 @@
 // Sandbox health is represented by Status:
 //
 //	StatusHealthy   - Container running, SSH reachable, mux active
-//	StatusUnhealthy - Container running but SSH unreachable
+//	StatusUnhealthy - Container running but SSH unreachable, or a probe failing
 //	StatusNoMux     - SSH reachable but multiplexer session not found
 //	StatusStopped   - Container not running
 //
@@ -28,6 +28,27 @@
 //	status := health.GetSummary(sandboxName, host, rt, mux)
 //	// Returns StatusHealthy, StatusUnhealthy, etc.
 //
+// # Template Probes
+//
+// Templates can declare probes (a command, an HTTP GET or a running
+// process). CheckProbes runs those that are due and records their states
+// next to the sandbox metadata, so failures accumulate across commands
+// until a probe's failure threshold makes the sandbox unhealthy:
+//
+//	states := health.CheckSandboxProbes(ctx, rt, paths, sb)
+//	status = health.ApplyProbes(status, states)
+//
+// # Collecting Statuses
+//
+// Collect checks many sandboxes concurrently, with a deadline per sandbox,
+// and returns their statuses in order. The health monitor records each
+// round with SaveStatusCache; interactive commands pass the cache to
+// Collect so running sandboxes take their recent status without SSH:
+//
+//	statuses := health.Collect(ctx, rt, paths, sandboxes, health.CollectOptions{
+//		Cache: health.StatusCachePath(paths.StateDir),
+//	})
+//
 // # Constants
 //
 // SSHReadyTimeoutSeconds defines the default timeout when waiting for
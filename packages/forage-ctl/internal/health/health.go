@@ -3,8 +3,12 @@ package health
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
+	shellquote "github.com/kballard/go-shellquote"
+
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/config"
 	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/multiplexer"
 	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/runtime"
 	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/ssh"
@@ -23,6 +27,8 @@ const (
 	StatusUnhealthy Status = "unhealthy"
 	StatusNoMux     Status = "no-mux"
 	StatusStopped   Status = "stopped"
+	StatusDegraded  Status = "degraded"   // Healthy, but a sidecar service is not ready
+	StatusCrashLoop Status = "crash-loop" // Failed, and the monitor gave up restarting it
 
 	// SSHReadyTimeoutSeconds is the default timeout waiting for SSH to become ready.
 	SSHReadyTimeoutSeconds = 30
@@ -35,6 +41,14 @@ type CheckResult struct {
 	MuxActive        bool
 	Uptime           string
 	MuxWindows       []string
+	Services         []ServiceStatus
+	Probes           []ProbeState
+}
+
+// ServiceStatus is the readiness of one sidecar service.
+type ServiceStatus struct {
+	Name  string
+	Ready bool
 }
 
 // CheckSSH checks if SSH is reachable
@@ -44,8 +58,12 @@ func CheckSSH(host string) bool {
 
 // CheckMux checks if the multiplexer session exists
 func CheckMux(host string, mux multiplexer.Multiplexer) bool {
+	return checkMux(context.Background(), host, mux)
+}
+
+func checkMux(ctx context.Context, host string, mux multiplexer.Multiplexer) bool {
 	args := mux.CheckSessionArgs()
-	_, err := ssh.ExecWithOutput(host, args...)
+	_, err := ssh.ExecWithOutputContext(ctx, host, args...)
 	return err == nil
 }
 
@@ -59,14 +77,79 @@ func GetMuxWindows(host string, mux multiplexer.Multiplexer) []string {
 	return mux.ParseWindowList(output)
 }
 
+// CheckServices reports the readiness of the sandbox's sidecar services
+// with a single SSH round trip. A service with ports is ready once every
+// port accepts connections on localhost; one without ports is ready while
+// its systemd unit is active. Services are reported not ready if the check
+// itself fails.
+func CheckServices(host string, services []config.Service) []ServiceStatus {
+	return checkServices(context.Background(), host, services)
+}
+
+func checkServices(ctx context.Context, host string, services []config.Service) []ServiceStatus {
+	if len(services) == 0 {
+		return nil
+	}
+	output, _ := ssh.ExecWithOutputContext(ctx, host, "bash", "-c", shellquote.Join(serviceReadinessScript(services)))
+	return parseServiceReadiness(output, services)
+}
+
+// ServicesReady reports whether every status is ready.
+func ServicesReady(statuses []ServiceStatus) bool {
+	for _, s := range statuses {
+		if !s.Ready {
+			return false
+		}
+	}
+	return true
+}
+
+// serviceReadinessScript builds a bash script printing "<name> ready" or
+// "<name> down" for each service.
+func serviceReadinessScript(services []config.Service) string {
+	var b strings.Builder
+	for _, svc := range services {
+		var checks []string
+		for _, port := range svc.Ports {
+			checks = append(checks, fmt.Sprintf("(: </dev/tcp/127.0.0.1/%d) 2>/dev/null", port))
+		}
+		if len(checks) == 0 {
+			checks = append(checks, "systemctl is-active --quiet "+svc.UnitName())
+		}
+		fmt.Fprintf(&b, "if %s; then echo %s ready; else echo %s down; fi\n",
+			strings.Join(checks, " && "), svc.Name, svc.Name)
+	}
+	return b.String()
+}
+
+// parseServiceReadiness maps script output back to the services, in
+// template order. Services missing from the output are not ready.
+func parseServiceReadiness(output string, services []config.Service) []ServiceStatus {
+	ready := make(map[string]bool)
+	for _, line := range strings.Split(output, "\n") {
+		if name, state, ok := strings.Cut(strings.TrimSpace(line), " "); ok {
+			ready[name] = state == "ready"
+		}
+	}
+	statuses := make([]ServiceStatus, 0, len(services))
+	for _, svc := range services {
+		statuses = append(statuses, ServiceStatus{Name: svc.Name, Ready: ready[svc.Name]})
+	}
+	return statuses
+}
+
 // GetUptime returns the container uptime in human-readable format.
 // Uses the runtime-agnostic Status method to get container start time.
 func GetUptime(sandboxName string, rt runtime.Runtime) string {
+	return getUptime(context.Background(), sandboxName, rt)
+}
+
+func getUptime(ctx context.Context, sandboxName string, rt runtime.Runtime) string {
 	if rt == nil {
 		return "unknown"
 	}
 
-	info, err := rt.Status(context.Background(), sandboxName)
+	info, err := rt.Status(ctx, sandboxName)
 	if err != nil || info == nil {
 		return "unknown"
 	}
@@ -156,11 +239,26 @@ func GetSummary(sandboxName string, host string, rt runtime.Runtime, mux multipl
 	if !running {
 		return StatusStopped
 	}
-	if !CheckSSH(host) {
+	return runningSummary(context.Background(), host, mux)
+}
+
+// runningSummary returns the summary status of a running sandbox.
+func runningSummary(ctx context.Context, host string, mux multiplexer.Multiplexer) Status {
+	if !ssh.CheckConnectionContext(ctx, host) {
 		return StatusUnhealthy
 	}
-	if !CheckMux(host, mux) {
+	if !checkMux(ctx, host, mux) {
 		return StatusNoMux
 	}
 	return StatusHealthy
 }
+
+// ApplyRestarts returns the status of a sandbox given its restart state: a
+// sandbox the monitor gave up restarting is in a crash loop until it is
+// healthy again.
+func ApplyRestarts(status Status, sb *config.SandboxMetadata) Status {
+	if sb.Restarts != nil && sb.Restarts.CrashLoop && status != StatusHealthy && status != StatusDegraded {
+		return StatusCrashLoop
+	}
+	return status
+}
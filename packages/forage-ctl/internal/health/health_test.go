@@ -1,6 +1,7 @@
 package health
 
 import (
+	"strings"
 	"testing"
 	"time"
 
@@ -18,6 +19,7 @@ func TestStatusConstants(t *testing.T) {
 		{StatusUnhealthy, "unhealthy"},
 		{StatusNoMux, "no-mux"},
 		{StatusStopped, "stopped"},
+		{StatusDegraded, "degraded"},
 	}
 
 	for _, tt := range tests {
@@ -114,3 +116,43 @@ func TestGetMuxWindows_NoConnection(t *testing.T) {
 		t.Error("GetMuxWindows should return nil for unreachable host")
 	}
 }
+
+func TestServiceReadiness(t *testing.T) {
+	services := []config.Service{
+		{Name: "postgres", Ports: []int{5432}},
+		{Name: "worker"},
+		{Name: "redis", Ports: []int{6379, 6380}},
+	}
+
+	script := serviceReadinessScript(services)
+	for _, s := range []string{
+		"(: </dev/tcp/127.0.0.1/5432) 2>/dev/null",
+		"systemctl is-active --quiet forage-service-worker",
+		"(: </dev/tcp/127.0.0.1/6379) 2>/dev/null && (: </dev/tcp/127.0.0.1/6380) 2>/dev/null",
+	} {
+		if !strings.Contains(script, s) {
+			t.Errorf("script should contain %q, got:\n%s", s, script)
+		}
+	}
+
+	statuses := parseServiceReadiness("postgres ready\nworker down\n", services)
+	want := []ServiceStatus{
+		{Name: "postgres", Ready: true},
+		{Name: "worker", Ready: false},
+		{Name: "redis", Ready: false}, // missing from output
+	}
+	if len(statuses) != len(want) {
+		t.Fatalf("got %d statuses, want %d", len(statuses), len(want))
+	}
+	for i := range want {
+		if statuses[i] != want[i] {
+			t.Errorf("statuses[%d] = %+v, want %+v", i, statuses[i], want[i])
+		}
+	}
+	if ServicesReady(statuses) {
+		t.Error("ServicesReady should be false when a service is down")
+	}
+	if !ServicesReady(statuses[:1]) {
+		t.Error("ServicesReady should be true when all services are ready")
+	}
+}
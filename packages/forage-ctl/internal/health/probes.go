@@ -0,0 +1,251 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/config"
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/runtime"
+)
+
+// ProbeState is the last known result of a template probe.
+type ProbeState struct {
+	Name     string    `json:"name"`
+	Healthy  bool      `json:"healthy"`           // fewer consecutive failures than the probe's threshold
+	Failures int       `json:"failures"`          // consecutive failed runs
+	Message  string    `json:"message,omitempty"` // why the last run failed
+	LastRun  time.Time `json:"lastRun"`
+}
+
+// probeStatePath returns the file recording a sandbox's probe states.
+func probeStatePath(sandboxesDir, sandbox string) string {
+	return filepath.Join(sandboxesDir, sandbox+".probes.json")
+}
+
+// LoadProbeStates returns the recorded probe states of a sandbox, or nil
+// if none were recorded.
+func LoadProbeStates(sandboxesDir, sandbox string) []ProbeState {
+	data, err := os.ReadFile(probeStatePath(sandboxesDir, sandbox))
+	if err != nil {
+		return nil
+	}
+	var states []ProbeState
+	if json.Unmarshal(data, &states) != nil {
+		return nil
+	}
+	return states
+}
+
+// saveProbeStates records the probe states of a sandbox.
+func saveProbeStates(sandboxesDir, sandbox string, states []ProbeState) error {
+	data, err := json.MarshalIndent(states, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := probeStatePath(sandboxesDir, sandbox)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// RemoveProbeStates deletes the recorded probe states of a sandbox.
+func RemoveProbeStates(sandboxesDir, sandbox string) error {
+	if err := os.Remove(probeStatePath(sandboxesDir, sandbox)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// CheckProbes runs the probes of a running sandbox that are due and returns
+// the state of every probe. States are recorded next to the sandbox
+// metadata, so a probe runs at most once per interval however many
+// commands check it, and failures accumulate across them.
+func CheckProbes(ctx context.Context, rt runtime.Runtime, sandboxesDir, sandbox, host string, probes []config.Probe) []ProbeState {
+	if len(probes) == 0 {
+		return nil
+	}
+	previous := make(map[string]ProbeState)
+	for _, s := range LoadProbeStates(sandboxesDir, sandbox) {
+		previous[s.Name] = s
+	}
+
+	states := make([]ProbeState, 0, len(probes))
+	ran := false
+	for _, probe := range probes {
+		state, ok := previous[probe.Name]
+		if !ok {
+			state = ProbeState{Name: probe.Name, Healthy: true}
+		}
+		now := time.Now()
+		if now.Sub(state.LastRun) >= probe.IntervalDuration() {
+			state = nextProbeState(state, probe, RunProbe(ctx, rt, sandbox, host, probe), now)
+			ran = true
+		}
+		states = append(states, state)
+	}
+	if ran {
+		_ = saveProbeStates(sandboxesDir, sandbox, states) // if unrecorded, they just run again
+	}
+	return states
+}
+
+// CheckSandboxProbes runs the due probes of a sandbox's template, see
+// CheckProbes. It returns nil if the template has no probes or cannot be
+// loaded.
+func CheckSandboxProbes(ctx context.Context, rt runtime.Runtime, paths *config.Paths, sb *config.SandboxMetadata) []ProbeState {
+	if paths == nil {
+		return nil
+	}
+	template, err := config.LoadTemplate(paths.TemplatesDir, sb.Template)
+	if err != nil {
+		return nil
+	}
+	return CheckProbes(ctx, rt, paths.SandboxesDir, sb.Name, sb.ContainerIP(), template.Probes)
+}
+
+// nextProbeState returns a probe's state after a run that failed with err,
+// or succeeded if err is nil.
+func nextProbeState(state ProbeState, probe config.Probe, err error, now time.Time) ProbeState {
+	state.LastRun = now
+	if err == nil {
+		state.Failures = 0
+		state.Message = ""
+	} else {
+		state.Failures++
+		state.Message = err.Error()
+	}
+	state.Healthy = state.Failures < probe.Threshold()
+	return state
+}
+
+// ProbesHealthy reports whether every probe state is healthy.
+func ProbesHealthy(states []ProbeState) bool {
+	for _, s := range states {
+		if !s.Healthy {
+			return false
+		}
+	}
+	return true
+}
+
+// FailingProbes returns the names of the unhealthy probes.
+func FailingProbes(states []ProbeState) []string {
+	var names []string
+	for _, s := range states {
+		if !s.Healthy {
+			names = append(names, s.Name)
+		}
+	}
+	return names
+}
+
+// ApplyProbes returns the status of a sandbox given its probe states: a
+// running sandbox with an unhealthy probe is unhealthy.
+func ApplyProbes(status Status, states []ProbeState) Status {
+	if status != StatusStopped && !ProbesHealthy(states) {
+		return StatusUnhealthy
+	}
+	return status
+}
+
+// RunProbe runs a probe once against a sandbox, returning why it failed,
+// or nil if it succeeded.
+func RunProbe(ctx context.Context, rt runtime.Runtime, sandbox, host string, probe config.Probe) error {
+	ctx, cancel := context.WithTimeout(ctx, probe.TimeoutDuration())
+	defer cancel()
+
+	switch {
+	case probe.HTTP != nil:
+		return runHTTPProbe(ctx, host, probe.HTTP)
+	case probe.Process != "":
+		result, err := execProbe(ctx, rt, sandbox, []string{"pgrep", "-x", probe.Process})
+		if err != nil {
+			return err
+		}
+		if result.ExitCode != 0 {
+			return fmt.Errorf("process %s is not running", probe.Process)
+		}
+		return nil
+	default:
+		result, err := execProbe(ctx, rt, sandbox, probe.Command)
+		if err != nil {
+			return err
+		}
+		if result.ExitCode != probe.ExitCode {
+			out := lastLine(result.Stderr)
+			if out == "" {
+				out = lastLine(result.Stdout)
+			}
+			if out != "" {
+				return fmt.Errorf("exited with %d, want %d: %s", result.ExitCode, probe.ExitCode, out)
+			}
+			return fmt.Errorf("exited with %d, want %d", result.ExitCode, probe.ExitCode)
+		}
+		return nil
+	}
+}
+
+// execProbe runs a probe command in the container.
+func execProbe(ctx context.Context, rt runtime.Runtime, sandbox string, command []string) (*runtime.ExecResult, error) {
+	if rt == nil {
+		return nil, fmt.Errorf("no container runtime")
+	}
+	result, err := rt.Exec(ctx, sandbox, command, runtime.ExecOptions{})
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, fmt.Errorf("timed out")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// runHTTPProbe sends a GET to the sandbox and checks the response status.
+// Redirects are not followed.
+func runHTTPProbe(ctx context.Context, host string, probe *config.HTTPProbe) error {
+	path := probe.Path
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	url := "http://" + net.JoinHostPort(host, strconv.Itoa(probe.Port)) + path
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return fmt.Errorf("GET %s timed out", path)
+		}
+		return fmt.Errorf("GET %s failed: %w", path, err)
+	}
+	_ = resp.Body.Close()
+
+	if probe.Status != 0 {
+		if resp.StatusCode != probe.Status {
+			return fmt.Errorf("GET %s returned %d, want %d", path, resp.StatusCode, probe.Status)
+		}
+	} else if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+		return fmt.Errorf("GET %s returned %d", path, resp.StatusCode)
+	}
+	return nil
+}
+
+// lastLine returns the last non-empty line of s.
+func lastLine(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
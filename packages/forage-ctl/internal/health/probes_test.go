@@ -0,0 +1,142 @@
+package health
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/config"
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/runtime"
+)
+
+func TestRunProbe_Command(t *testing.T) {
+	rt := runtime.NewMockRuntime()
+	probe := config.Probe{Name: "db", Command: []string{"pg_isready"}}
+
+	if err := RunProbe(context.Background(), rt, "web", "10.100.1.2", probe); err != nil {
+		t.Errorf("RunProbe() = %v, want success", err)
+	}
+
+	rt.SetExecResult("web", &runtime.ExecResult{ExitCode: 2, Stderr: "starting\nno response\n"})
+	err := RunProbe(context.Background(), rt, "web", "10.100.1.2", probe)
+	if err == nil || err.Error() != "exited with 2, want 0: no response" {
+		t.Errorf("RunProbe() = %v, want the exit code and last stderr line", err)
+	}
+
+	probe.ExitCode = 2
+	if err := RunProbe(context.Background(), rt, "web", "10.100.1.2", probe); err != nil {
+		t.Errorf("RunProbe() = %v, want success with the expected exit code", err)
+	}
+}
+
+func TestRunProbe_Process(t *testing.T) {
+	rt := runtime.NewMockRuntime()
+	rt.SetExecResult("web", &runtime.ExecResult{ExitCode: 1})
+
+	err := RunProbe(context.Background(), rt, "web", "10.100.1.2", config.Probe{Name: "agent", Process: "claude"})
+	if err == nil || !strings.Contains(err.Error(), "not running") {
+		t.Errorf("RunProbe() = %v, want process not running", err)
+	}
+	calls := rt.GetCalls()
+	if cmd := calls[len(calls)-1].Args[1].([]string); strings.Join(cmd, " ") != "pgrep -x claude" {
+		t.Errorf("probe ran %q", cmd)
+	}
+}
+
+func TestRunProbe_HTTP(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ok":
+			w.WriteHeader(http.StatusOK)
+		case "/moved":
+			http.Redirect(w, r, "/gone", http.StatusFound)
+		default:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+	host, portStr, _ := net.SplitHostPort(strings.TrimPrefix(srv.URL, "http://"))
+	port, _ := strconv.Atoi(portStr)
+
+	tests := []struct {
+		path    string
+		status  int
+		wantErr bool
+	}{
+		{"/ok", 0, false},
+		{"ok", 200, false},
+		{"/moved", 0, false}, // redirects are not followed
+		{"/moved", 200, true},
+		{"/down", 0, true},
+		{"/down", 503, false},
+	}
+	for _, tt := range tests {
+		probe := config.Probe{Name: "web", HTTP: &config.HTTPProbe{Port: port, Path: tt.path, Status: tt.status}}
+		err := RunProbe(context.Background(), nil, "web", host, probe)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("GET %s (want status %d): err = %v, wantErr %v", tt.path, tt.status, err, tt.wantErr)
+		}
+	}
+}
+
+func TestCheckProbes_Threshold(t *testing.T) {
+	dir := t.TempDir()
+	rt := runtime.NewMockRuntime()
+	rt.SetExecResult("web", &runtime.ExecResult{ExitCode: 1})
+	// Interval 1ns: every check is due
+	probes := []config.Probe{{Name: "db", Command: []string{"pg_isready"}, Interval: "1ns", FailureThreshold: 2}}
+
+	states := CheckProbes(context.Background(), rt, dir, "web", "10.100.1.2", probes)
+	if !ProbesHealthy(states) || states[0].Failures != 1 {
+		t.Fatalf("after one failure: %+v, want healthy with 1 failure", states)
+	}
+	states = CheckProbes(context.Background(), rt, dir, "web", "10.100.1.2", probes)
+	if ProbesHealthy(states) || states[0].Message == "" {
+		t.Fatalf("after two failures: %+v, want unhealthy", states)
+	}
+	if got := ApplyProbes(StatusHealthy, states); got != StatusUnhealthy {
+		t.Errorf("ApplyProbes() = %q, want unhealthy", got)
+	}
+	if got := FailingProbes(states); len(got) != 1 || got[0] != "db" {
+		t.Errorf("FailingProbes() = %v", got)
+	}
+
+	rt.SetExecResult("web", &runtime.ExecResult{ExitCode: 0})
+	states = CheckProbes(context.Background(), rt, dir, "web", "10.100.1.2", probes)
+	if !ProbesHealthy(states) || states[0].Failures != 0 {
+		t.Errorf("after a success: %+v, want healthy", states)
+	}
+
+	if err := RemoveProbeStates(dir, "web"); err != nil || LoadProbeStates(dir, "web") != nil {
+		t.Errorf("RemoveProbeStates() = %v, states left", err)
+	}
+}
+
+func TestCheckProbes_Interval(t *testing.T) {
+	dir := t.TempDir()
+	rt := runtime.NewMockRuntime()
+	probes := []config.Probe{{Name: "db", Command: []string{"pg_isready"}, Interval: "1h"}}
+
+	CheckProbes(context.Background(), rt, dir, "web", "10.100.1.2", probes)
+	CheckProbes(context.Background(), rt, dir, "web", "10.100.1.2", probes)
+	if n := len(rt.GetCalls()); n != 1 {
+		t.Errorf("probe ran %d times within its interval, want 1", n)
+	}
+	if states := LoadProbeStates(dir, "web"); len(states) != 1 || states[0].LastRun.IsZero() {
+		t.Errorf("recorded states = %+v", states)
+	}
+}
+
+func TestApplyProbes_Stopped(t *testing.T) {
+	failing := []ProbeState{{Name: "db", Healthy: false}}
+	if got := ApplyProbes(StatusStopped, failing); got != StatusStopped {
+		t.Errorf("ApplyProbes() = %q, want stopped", got)
+	}
+	if got := ApplyProbes(StatusHealthy, nil); got != StatusHealthy {
+		t.Errorf("ApplyProbes() = %q, want healthy", got)
+	}
+}
@@ -0,0 +1,36 @@
+package injection
+
+import (
+	"context"
+)
+
+// GroupContributor mounts a sandbox group's shared directory, which holds
+// the hosts file members resolve each other from.
+type GroupContributor struct {
+	GroupDir      string // Host path to the group directory
+	ContainerPath string // Mount point inside the container
+}
+
+// NewGroupContributor creates a new group contributor.
+func NewGroupContributor(groupDir, containerPath string) *GroupContributor {
+	return &GroupContributor{
+		GroupDir:      groupDir,
+		ContainerPath: containerPath,
+	}
+}
+
+// ContributeMounts returns the read-only group directory mount.
+func (g *GroupContributor) ContributeMounts(ctx context.Context, req *MountRequest) ([]Mount, error) {
+	if g.GroupDir == "" {
+		return nil, nil
+	}
+
+	return []Mount{{
+		HostPath:      g.GroupDir,
+		ContainerPath: g.ContainerPath,
+		ReadOnly:      true,
+	}}, nil
+}
+
+// Ensure GroupContributor implements MountContributor
+var _ MountContributor = (*GroupContributor)(nil)
@@ -3,22 +3,45 @@ package injection
 import (
 	"context"
 	"fmt"
+	"sort"
+
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/proxy"
 )
 
-// ProxyContributor provides proxy-related environment variables.
+// ProxyContributor provides proxy-related environment variables and the
+// mount holding the sandbox's virtual API key.
 type ProxyContributor struct {
 	ProxyURL    string
 	SandboxName string
+	AuthEnvVars []string // Auth env vars of the template's agents, used to pick provider routes
+	TokenDir    string   // Host directory holding the sandbox's virtual API key (optional)
 }
 
 // NewProxyContributor creates a new proxy contributor.
-func NewProxyContributor(proxyURL, sandboxName string) *ProxyContributor {
+func NewProxyContributor(proxyURL, sandboxName string, authEnvVars []string, tokenDir string) *ProxyContributor {
 	return &ProxyContributor{
 		ProxyURL:    proxyURL,
 		SandboxName: sandboxName,
+		AuthEnvVars: authEnvVars,
+		TokenDir:    tokenDir,
 	}
 }
 
+// ContributeMounts returns the read-only mount of the token directory.
+// Mounting the directory rather than the file lets rotated tokens show up
+// inside the running sandbox.
+func (p *ProxyContributor) ContributeMounts(ctx context.Context, req *MountRequest) ([]Mount, error) {
+	if p.ProxyURL == "" || p.TokenDir == "" {
+		return nil, nil
+	}
+
+	return []Mount{{
+		HostPath:      p.TokenDir,
+		ContainerPath: proxy.TokenContainerDir,
+		ReadOnly:      true,
+	}}, nil
+}
+
 // ContributeEnvVars returns proxy environment variables.
 func (p *ProxyContributor) ContributeEnvVars(ctx context.Context, req *EnvVarRequest) ([]EnvVar, error) {
 	proxyURL := p.ProxyURL
@@ -38,16 +61,51 @@ func (p *ProxyContributor) ContributeEnvVars(ctx context.Context, req *EnvVarReq
 		return nil, nil
 	}
 
-	return []EnvVar{
+	vars := []EnvVar{
 		{
 			Name:  "ANTHROPIC_BASE_URL",
 			Value: fmt.Sprintf("%q", proxyURL),
 		},
-		{
+	}
+	if p.TokenDir == "" {
+		// Without a virtual key, identify the sandbox by header
+		vars = append(vars, EnvVar{
 			Name:  "ANTHROPIC_CUSTOM_HEADERS",
 			Value: fmt.Sprintf(`"X-Forage-Sandbox: %s"`, sandboxName),
-		},
-	}, nil
+		})
+	}
+
+	// Point every other agent's provider at its route on the proxy, and
+	// hand each agent the virtual key in place of its real API key. Clients
+	// without a key are identified by source IP.
+	seen := map[string]bool{"ANTHROPIC_BASE_URL": true}
+	var extra []EnvVar
+	for _, authEnvVar := range p.AuthEnvVars {
+		provider, ok := proxy.ProviderForAuthEnvVar(authEnvVar)
+		if !ok {
+			continue
+		}
+		if p.TokenDir != "" && !seen[authEnvVar] {
+			seen[authEnvVar] = true
+			extra = append(extra, EnvVar{
+				Name:  authEnvVar,
+				Value: fmt.Sprintf(`"$(cat %s 2>/dev/null || echo '')"`, proxy.TokenContainerPath),
+			})
+		}
+		for _, name := range provider.BaseURLEnvVars {
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			extra = append(extra, EnvVar{
+				Name:  name,
+				Value: fmt.Sprintf("%q", provider.BaseURL(proxyURL)),
+			})
+		}
+	}
+	sort.Slice(extra, func(i, j int) bool { return extra[i].Name < extra[j].Name })
+
+	return append(vars, extra...), nil
 }
 
 // ContributePromptFragments returns proxy information for prompts.
@@ -66,7 +124,8 @@ func (p *ProxyContributor) ContributePromptFragments(ctx context.Context) ([]Pro
 const proxyPromptInstructions = `This sandbox uses an API proxy for authentication. API keys are not stored in this container - they are injected by the proxy on the host.
 
 How it works:
-- ANTHROPIC_BASE_URL points to the host proxy
+- ANTHROPIC_BASE_URL (and OPENAI_BASE_URL, GOOGLE_GEMINI_BASE_URL or OPENROUTER_BASE_URL for other agents) points to the host proxy
+- The agent's API key variable holds a sandbox-specific virtual key (from /run/forage-proxy/token), which the proxy swaps for the real key
 - Requests are forwarded with API key injection
 - Rate limiting and audit logging are applied
 
@@ -77,5 +136,6 @@ Limitations:
 // Ensure ProxyContributor implements interfaces
 var (
 	_ EnvVarContributor = (*ProxyContributor)(nil)
+	_ MountContributor  = (*ProxyContributor)(nil)
 	_ PromptContributor = (*ProxyContributor)(nil)
 )
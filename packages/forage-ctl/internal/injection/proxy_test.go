@@ -0,0 +1,78 @@
+package injection
+
+import (
+	"context"
+	"testing"
+)
+
+func TestProxyContributor_BaseURLs(t *testing.T) {
+	p := NewProxyContributor("http://10.100.0.1:8080", "my-sandbox",
+		[]string{"OPENAI_API_KEY", "ANTHROPIC_API_KEY", "GEMINI_API_KEY", "OPENAI_API_KEY", "CUSTOM_KEY"}, "")
+
+	vars, err := p.ContributeEnvVars(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(map[string]string, len(vars))
+	for _, v := range vars {
+		if _, dup := got[v.Name]; dup {
+			t.Errorf("duplicate env var %s", v.Name)
+		}
+		got[v.Name] = v.Value
+	}
+	want := map[string]string{
+		"ANTHROPIC_BASE_URL":       `"http://10.100.0.1:8080"`,
+		"ANTHROPIC_CUSTOM_HEADERS": `"X-Forage-Sandbox: my-sandbox"`,
+		"OPENAI_BASE_URL":          `"http://10.100.0.1:8080/openai/v1"`,
+		"GOOGLE_GEMINI_BASE_URL":   `"http://10.100.0.1:8080/gemini"`,
+	}
+	if len(got) != len(want) {
+		t.Errorf("got env vars %v, want %v", got, want)
+	}
+	for name, value := range want {
+		if got[name] != value {
+			t.Errorf("%s = %s, want %s", name, got[name], value)
+		}
+	}
+}
+
+func TestProxyContributor_NoProxy(t *testing.T) {
+	vars, err := NewProxyContributor("", "my-sandbox", []string{"OPENAI_API_KEY"}, "/var/lib/forage/proxy-tokens/my-sandbox").ContributeEnvVars(context.Background(), nil)
+	if err != nil || vars != nil {
+		t.Errorf("ContributeEnvVars() = %v, %v; want nil", vars, err)
+	}
+}
+
+func TestProxyContributor_VirtualKey(t *testing.T) {
+	tokenDir := "/var/lib/forage/proxy-tokens/my-sandbox"
+	p := NewProxyContributor("http://10.100.0.1:8080", "my-sandbox",
+		[]string{"ANTHROPIC_API_KEY", "OPENAI_API_KEY", "CUSTOM_KEY"}, tokenDir)
+
+	vars, err := p.ContributeEnvVars(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]string, len(vars))
+	for _, v := range vars {
+		got[v.Name] = v.Value
+	}
+	readToken := `"$(cat /run/forage-proxy/token 2>/dev/null || echo '')"`
+	if got["ANTHROPIC_API_KEY"] != readToken || got["OPENAI_API_KEY"] != readToken {
+		t.Errorf("agent API keys should read the virtual key, got %v", got)
+	}
+	if _, ok := got["CUSTOM_KEY"]; ok {
+		t.Error("keys of providers without a proxy route should be left alone")
+	}
+	if _, ok := got["ANTHROPIC_CUSTOM_HEADERS"]; ok {
+		t.Error("sandbox header is not needed with a virtual key")
+	}
+
+	mounts, err := p.ContributeMounts(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mounts) != 1 || mounts[0].HostPath != tokenDir || mounts[0].ContainerPath != "/run/forage-proxy" || !mounts[0].ReadOnly {
+		t.Errorf("unexpected mounts: %+v", mounts)
+	}
+}
@@ -0,0 +1,51 @@
+package integration
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/proxy"
+)
+
+// TestCassetteProxy_ReplaysOffline records an agent's API conversation
+// through the proxy, then replays it with the upstream gone.
+func TestCassetteProxy_ReplaysOffline(t *testing.T) {
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"model":"claude-sonnet-4-5","content":[{"type":"text","text":"hello"}],"usage":{"input_tokens":3,"output_tokens":1}}`)
+	}))
+
+	dir := t.TempDir()
+	cfg := func(mode proxy.CassetteMode) *proxy.Config {
+		return &proxy.Config{
+			SecretsDir:   t.TempDir(),
+			TargetURL:    upstream.URL,
+			CassetteMode: mode,
+			CassetteDir:  dir,
+			Transport:    upstream.Client().Transport,
+		}
+	}
+	post := func(url string) string {
+		t.Helper()
+		resp, err := http.Post(url+"/v1/messages", "application/json", strings.NewReader(`{"messages":[{"role":"user","content":"hi"}]}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("status %d: %s", resp.StatusCode, body)
+		}
+		return string(body)
+	}
+
+	recorded := post(StartProxy(t, "127.0.0.1", cfg(proxy.CassetteRecord)))
+	upstream.Close()
+
+	if replayed := post(StartProxy(t, "127.0.0.1", cfg(proxy.CassetteReplay))); replayed != recorded {
+		t.Errorf("replayed %q, want %q", replayed, recorded)
+	}
+}
@@ -30,6 +30,10 @@
 //   - SSH readiness waiting (WaitForSSH)
 //   - Sandbox tracking for cleanup (TrackSandbox)
 //   - Access to paths, host config, and runtime
+//   - An API proxy replaying recorded cassettes (CassetteProxy), listening
+//     on a sandbox's gateway address, so agent tests run offline; set
+//     FORAGE_RECORD_CASSETTES=1 to re-record them. Cassettes live in
+//     testdata/cassettes.
 //
 // # Running Integration Tests
 //
@@ -12,6 +12,9 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"testing"
@@ -19,6 +22,7 @@ import (
 
 	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/config"
 	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/health"
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/proxy"
 	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/runtime"
 )
 
@@ -206,6 +210,68 @@ func (h *TestHarness) Cleanup() {
 	}
 }
 
+// CassetteProxy starts an API proxy for a running sandbox that replays
+// the cassettes in dir, so agent tests run offline without spending
+// tokens. With FORAGE_RECORD_CASSETTES set, it records the cassettes from
+// the real upstream APIs instead, using the keys in the test secrets
+// directory. The proxy listens on the host side of the sandbox's link, its
+// gateway, and the returned URL is the one the sandbox reaches it at.
+func (h *TestHarness) CassetteProxy(dir string, sb *config.SandboxMetadata) string {
+	h.t.Helper()
+	return StartCassetteProxy(h.t, h.paths, dir, sb.HostIP())
+}
+
+// StartCassetteProxy runs an API proxy on host that replays the cassettes
+// in dir, or records them with FORAGE_RECORD_CASSETTES set, and returns
+// its URL.
+func StartCassetteProxy(t *testing.T, paths *config.Paths, dir, host string) string {
+	t.Helper()
+
+	mode := proxy.CassetteReplay
+	if os.Getenv("FORAGE_RECORD_CASSETTES") != "" {
+		mode = proxy.CassetteRecord
+	}
+	return StartProxy(t, host, &proxy.Config{
+		SecretsDir:    paths.SecretsDir,
+		SandboxesDir:  paths.SandboxesDir,
+		Routes:        proxy.DefaultRoutes(),
+		CassetteMode:  mode,
+		CassetteDir:   dir,
+		CassetteMatch: proxy.MatchNormalized,
+	})
+}
+
+// StartProxy runs an API proxy on host for the rest of the test and
+// returns its URL. The host must be a specific address: the proxy injects
+// real API keys, so it never listens on all interfaces.
+func StartProxy(t *testing.T, host string, cfg *proxy.Config) string {
+	t.Helper()
+
+	if ip := net.ParseIP(host); ip == nil || ip.IsUnspecified() {
+		t.Fatalf("Proxy needs a specific address to listen on, got %q", host)
+	}
+	p, err := proxy.New(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create proxy: %v", err)
+	}
+	if err := p.LoadAPIKeys(); err != nil {
+		t.Fatalf("Failed to load API keys: %v", err)
+	}
+
+	listener, err := net.Listen("tcp", net.JoinHostPort(host, "0"))
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	srv := &httptest.Server{Listener: listener, Config: &http.Server{Handler: p}}
+	srv.Start()
+	t.Cleanup(func() {
+		srv.Close()
+		_ = p.Close()
+	})
+
+	return "http://" + listener.Addr().String()
+}
+
 // RequireRunning skips the test if the named container is not running.
 func (h *TestHarness) RequireRunning(name string) {
 	h.t.Helper()
@@ -13,8 +13,11 @@ package integration
 import (
 	"context"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"testing"
 
@@ -438,7 +441,7 @@ func TestWorkflow_SkillsGeneration(t *testing.T) {
 		},
 	}
 
-	prompt := skills.GenerateSystemPrompt(metadata, template)
+	prompt := skills.GenerateSystemPrompt(metadata, template, nil)
 
 	// Verify skills content
 	if !strings.Contains(prompt, "test-sandbox") {
@@ -551,3 +554,60 @@ func TestWorkflow_ProxyModeConfig(t *testing.T) {
 		t.Error("proxy mode should not read secrets directly")
 	}
 }
+
+// TestWorkflow_AgentReplaysCassette runs an agent's API conversation
+// through the proxy it is configured with, replayed offline from the
+// cassette in testdata.
+func TestWorkflow_AgentReplaysCassette(t *testing.T) {
+	dir := t.TempDir()
+	paths := &config.Paths{
+		SecretsDir:   filepath.Join(dir, "secrets"),
+		SandboxesDir: filepath.Join(dir, "sandboxes"),
+	}
+	proxyURL := StartCassetteProxy(t, paths, filepath.Join("testdata", "cassettes"), "127.0.0.1")
+
+	// The environment the agent gets in a proxied sandbox
+	contributor := injection.NewProxyContributor(proxyURL, "agent-test", []string{"ANTHROPIC_API_KEY"}, "")
+	vars, err := contributor.ContributeEnvVars(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("ContributeEnvVars failed: %v", err)
+	}
+	env := make(map[string]string)
+	for _, v := range vars {
+		value, err := strconv.Unquote(v.Value)
+		if err != nil {
+			t.Fatalf("%s: bad value %s", v.Name, v.Value)
+		}
+		env[v.Name] = value
+	}
+
+	// Send the agent's request the way Claude Code does
+	body := `{"model": "claude-sonnet-4-5", "max_tokens": 1024, "stream": true,
+		"messages": [{"role": "user", "content": "Add a README to the workspace"}],
+		"metadata": {"user_id": "session-1234"}}`
+	req, err := http.NewRequest(http.MethodPost, env["ANTHROPIC_BASE_URL"]+"/v1/messages", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Api-Key", "unused")
+	if name, value, ok := strings.Cut(env["ANTHROPIC_CUSTOM_HEADERS"], ": "); ok {
+		req.Header.Set(name, value)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	stream, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d: %s", resp.StatusCode, stream)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content-Type = %q, want the recorded event stream", ct)
+	}
+	if !strings.Contains(string(stream), "Created README.md.") || !strings.HasSuffix(string(stream), "event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n") {
+		t.Errorf("replayed stream = %q, want the recorded conversation", stream)
+	}
+}
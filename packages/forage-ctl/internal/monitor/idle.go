@@ -0,0 +1,233 @@
+package monitor
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	shellquote "github.com/kballard/go-shellquote"
+
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/config"
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/logging"
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/multiplexer"
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/ssh"
+)
+
+// workspaceScanLimit bounds the entries looked at when scanning a
+// workspace for changes, so huge workspaces don't stall the monitor.
+const workspaceScanLimit = 50000
+
+// workspaceSkipDirs are not scanned for changes: they are large and
+// change without the agent doing anything of note.
+var workspaceSkipDirs = map[string]bool{"node_modules": true, ".direnv": true}
+
+// paneSnapshot is what a sandbox's terminal looked like.
+type paneSnapshot struct {
+	Sessions int      // interactive SSH sessions attached
+	Hash     string   // hash of the content of every pane
+	Panes    []string // visible content of each pane, without trailing blank lines
+}
+
+// captureFunc captures a sandbox's panes and attached sessions.
+type captureFunc func(host string, mux multiplexer.Multiplexer) (paneSnapshot, error)
+
+// capturePanes captures a sandbox's panes and counts its interactive SSH
+// sessions with a single SSH round trip. The monitor's own session has no
+// terminal, so it is not counted.
+func capturePanes(host string, mux multiplexer.Multiplexer) (paneSnapshot, error) {
+	// [s]shd keeps pgrep from matching the shell running this script. Like
+	// every multiplexer command, the capture args are quoted for the remote
+	// shell already.
+	script := "pgrep -fc '[s]shd.*@pts/'; " + strings.Join(mux.CapturePanesArgs(), " ")
+	output, err := ssh.ExecWithOutput(host, "bash", "-c", shellquote.Join(script))
+	count, panes, _ := strings.Cut(output, "\n")
+	sessions, convErr := strconv.Atoi(strings.TrimSpace(count))
+	if convErr != nil {
+		if err == nil {
+			err = fmt.Errorf("unexpected output %q", count)
+		}
+		return paneSnapshot{}, err
+	}
+	// A failed capture still counts sessions (pgrep exits 1 if none)
+	return parsePanes(sessions, panes), nil
+}
+
+// parsePanes builds a snapshot from the output of a pane capture.
+func parsePanes(sessions int, output string) paneSnapshot {
+	sum := sha256.Sum256([]byte(output))
+	snap := paneSnapshot{Sessions: sessions, Hash: fmt.Sprintf("%x", sum)}
+	for _, pane := range strings.Split(output, multiplexer.PaneSeparator+"\n")[1:] {
+		snap.Panes = append(snap.Panes, strings.TrimRight(pane, " \t\n"))
+	}
+	return snap
+}
+
+// activity is what the monitor knows about a sandbox's recent activity.
+type activity struct {
+	lastActive time.Time
+	paneHash   string
+}
+
+// idleTracker tracks the activity of running sandboxes: changing pane
+// content, attached SSH sessions, workspace changes and API traffic
+// through the proxy.
+type idleTracker struct {
+	proxyLog  *proxyLogTail
+	sandboxes map[string]*activity
+}
+
+func newIdleTracker(proxyLogPath string) *idleTracker {
+	t := &idleTracker{sandboxes: make(map[string]*activity)}
+	if proxyLogPath != "" {
+		t.proxyLog = &proxyLogTail{path: proxyLogPath, last: make(map[string]time.Time)}
+	}
+	return t
+}
+
+// poll reads the API traffic logged since the last poll. It is called once
+// per round of checks.
+func (t *idleTracker) poll() {
+	if t.proxyLog != nil {
+		if err := t.proxyLog.poll(); err != nil {
+			logging.Debug("failed to read proxy log", "path", t.proxyLog.path, "error", err)
+		}
+	}
+}
+
+// observe records the current activity of a running sandbox, given its
+// panes or nil if they could not be captured, and returns how long it has
+// been idle. A sandbox seen for the first time counts as active now.
+func (t *idleTracker) observe(sb *config.SandboxMetadata, snap *paneSnapshot, now time.Time) time.Duration {
+	a, ok := t.sandboxes[sb.Name]
+	if !ok {
+		a = &activity{lastActive: now}
+		t.sandboxes[sb.Name] = a
+	}
+	active := func(at time.Time) {
+		if at.After(a.lastActive) {
+			a.lastActive = at
+		}
+	}
+
+	if snap != nil {
+		if snap.Sessions > 0 || (a.paneHash != "" && snap.Hash != a.paneHash) {
+			active(now)
+		}
+		a.paneHash = snap.Hash
+	}
+
+	if changed, ok := workspaceChangedSince(sb.Workspace, a.lastActive); ok {
+		active(changed)
+	}
+
+	if t.proxyLog != nil {
+		active(t.proxyLog.last[sb.Name])
+	}
+
+	return now.Sub(a.lastActive)
+}
+
+// forget drops what is known about a sandbox, so its activity is tracked
+// afresh once it runs again.
+func (t *idleTracker) forget(name string) {
+	delete(t.sandboxes, name)
+}
+
+// workspaceChangedSince returns the modification time of a file or
+// directory in the workspace changed after since, if there is one. The
+// scan stops at the first.
+func workspaceChangedSince(dir string, since time.Time) (time.Time, bool) {
+	if dir == "" {
+		return time.Time{}, false
+	}
+	var changed time.Time
+	seen := 0
+	errFound := errors.New("found")
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil // unreadable entries are skipped
+		}
+		if seen++; seen > workspaceScanLimit {
+			return filepath.SkipAll
+		}
+		if d.IsDir() && path != dir && workspaceSkipDirs[d.Name()] {
+			return filepath.SkipDir
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if info.ModTime().After(since) {
+			changed = info.ModTime()
+			return errFound
+		}
+		return nil
+	})
+	return changed, err == errFound
+}
+
+// proxyLogTail follows the proxy's request log for the time of each
+// sandbox's latest API request.
+type proxyLogTail struct {
+	path   string
+	info   os.FileInfo
+	offset int64
+	last   map[string]time.Time // sandbox -> time of its latest request
+}
+
+// poll reads the requests logged since the last poll. A rotated log is
+// read from its beginning; requests logged just before rotation may be
+// missed, which at worst makes a sandbox look idle a little early.
+func (p *proxyLogTail) poll() error {
+	f, err := os.Open(p.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if p.info == nil || !os.SameFile(p.info, info) || info.Size() < p.offset {
+		p.offset = 0
+	}
+	p.info = info
+	if _, err := f.Seek(p.offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	br := bufio.NewReader(f)
+	for {
+		line, err := br.ReadBytes('\n')
+		if err == io.EOF {
+			return nil // an incomplete line is read once finished
+		}
+		if err != nil {
+			return err
+		}
+		p.offset += int64(len(line))
+		var entry struct {
+			Timestamp time.Time `json:"timestamp"`
+			Sandbox   string    `json:"sandbox"`
+		}
+		if json.Unmarshal(line, &entry) != nil || entry.Sandbox == "" {
+			continue
+		}
+		if entry.Timestamp.After(p.last[entry.Sandbox]) {
+			p.last[entry.Sandbox] = entry.Timestamp
+		}
+	}
+}
@@ -0,0 +1,288 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/audit"
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/config"
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/health"
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/multiplexer"
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/runtime"
+)
+
+// writeTemplate writes a template named claude with the given extra fields.
+func writeTemplate(t *testing.T, dir, fields string) {
+	t.Helper()
+	data := `{"agents": {"claude": {"packagePath": "/nix/store/abc", "secretName": "anthropic", "authEnvVar": "ANTHROPIC_API_KEY"}}` + fields + `}`
+	if err := os.WriteFile(filepath.Join(dir, "claude.json"), []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// fakeCapture returns a captureFunc reporting *snap, or failing if it is nil.
+func fakeCapture(snap **paneSnapshot) captureFunc {
+	return func(string, multiplexer.Multiplexer) (paneSnapshot, error) {
+		if *snap == nil {
+			return paneSnapshot{}, errors.New("unreachable")
+		}
+		return **snap, nil
+	}
+}
+
+func TestIdleTracker_Panes(t *testing.T) {
+	tracker := newIdleTracker("")
+	sb := &config.SandboxMetadata{Name: "web"}
+	start := time.Now()
+
+	if idle := tracker.observe(sb, &paneSnapshot{Hash: "a"}, start); idle != 0 {
+		t.Errorf("first observation: idle = %v, want 0", idle)
+	}
+	if idle := tracker.observe(sb, &paneSnapshot{Hash: "a"}, start.Add(10*time.Minute)); idle != 10*time.Minute {
+		t.Errorf("unchanged panes: idle = %v, want 10m", idle)
+	}
+	if idle := tracker.observe(sb, &paneSnapshot{Hash: "b"}, start.Add(20*time.Minute)); idle != 0 {
+		t.Errorf("changed panes: idle = %v, want 0", idle)
+	}
+	if idle := tracker.observe(sb, &paneSnapshot{Hash: "b", Sessions: 1}, start.Add(30*time.Minute)); idle != 0 {
+		t.Errorf("attached session: idle = %v, want 0", idle)
+	}
+	if idle := tracker.observe(sb, nil, start.Add(40*time.Minute)); idle != 10*time.Minute {
+		t.Errorf("failed capture: idle = %v, want 10m", idle)
+	}
+
+	tracker.forget("web")
+	if idle := tracker.observe(sb, &paneSnapshot{Hash: "b"}, start.Add(50*time.Minute)); idle != 0 {
+		t.Errorf("after forget: idle = %v, want 0", idle)
+	}
+}
+
+func TestIdleTracker_Workspace(t *testing.T) {
+	tracker := newIdleTracker("")
+	workspace := t.TempDir()
+	sb := &config.SandboxMetadata{Name: "web", Workspace: workspace}
+
+	start := time.Now().Add(-time.Hour)
+	old := start.Add(-time.Hour)
+	if err := os.Chtimes(workspace, old, old); err != nil {
+		t.Fatal(err)
+	}
+	tracker.observe(sb, nil, start)
+
+	file := filepath.Join(workspace, "main.go")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	changed := start.Add(30 * time.Minute)
+	if err := os.Chtimes(file, changed, changed); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(workspace, old, old); err != nil {
+		t.Fatal(err)
+	}
+	if idle := tracker.observe(sb, nil, start.Add(time.Hour)); idle != 30*time.Minute {
+		t.Errorf("idle = %v, want 30m since the file changed", idle)
+	}
+}
+
+func TestParsePanes(t *testing.T) {
+	snap := parsePanes(2, "\x1e\nfirst pane\n\n\n\x1e\nsecond\npane\n")
+	if snap.Sessions != 2 || snap.Hash == "" {
+		t.Errorf("got %+v", snap)
+	}
+	want := []string{"first pane", "second\npane"}
+	if strings.Join(snap.Panes, "|") != strings.Join(want, "|") {
+		t.Errorf("Panes = %q, want %q", snap.Panes, want)
+	}
+	if panes := parsePanes(0, "").Panes; len(panes) != 0 {
+		t.Errorf("no output: Panes = %q", panes)
+	}
+}
+
+func TestWorkspaceChangedSince_SkipsDirs(t *testing.T) {
+	workspace := t.TempDir()
+	since := time.Now().Add(-time.Hour)
+	old := since.Add(-time.Hour)
+
+	deps := filepath.Join(workspace, "node_modules")
+	if err := os.Mkdir(deps, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(deps, "index.js"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{deps, workspace} {
+		if err := os.Chtimes(path, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, ok := workspaceChangedSince(workspace, since); ok {
+		t.Error("change in node_modules counted as activity")
+	}
+	if _, ok := workspaceChangedSince("", since); ok {
+		t.Error("no workspace counted as activity")
+	}
+}
+
+func TestProxyLogTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "proxy-audit.log")
+	tail := &proxyLogTail{path: path, last: make(map[string]time.Time)}
+
+	if err := tail.poll(); err != nil {
+		t.Fatalf("poll of a missing log: %v", err)
+	}
+
+	appendLog := func(lines ...string) {
+		t.Helper()
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = f.Close() }()
+		if _, err := f.WriteString(strings.Join(lines, "")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	appendLog(
+		`{"timestamp":"2026-03-01T10:00:00Z","sandbox":"web"}`+"\n",
+		`{"timestamp":"2026-03-01T10:05:00Z","sandbox":"api"}`+"\n",
+		"not json\n",
+		`{"timestamp":"2026-03-01T10:10:00Z","sandbox":"web"}`, // still being written
+	)
+	if err := tail.poll(); err != nil {
+		t.Fatal(err)
+	}
+	want := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	if got := tail.last["web"]; !got.Equal(want) {
+		t.Errorf("web = %v, want %v", got, want)
+	}
+
+	appendLog("\n")
+	if err := tail.poll(); err != nil {
+		t.Fatal(err)
+	}
+	want = time.Date(2026, 3, 1, 10, 10, 0, 0, time.UTC)
+	if got := tail.last["web"]; !got.Equal(want) {
+		t.Errorf("web after the line was finished = %v, want %v", got, want)
+	}
+
+	// Rotation: a new, shorter log is read from its start
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	appendLog(`{"timestamp":"2026-03-01T11:00:00Z","sandbox":"api"}` + "\n")
+	if err := tail.poll(); err != nil {
+		t.Fatal(err)
+	}
+	want = time.Date(2026, 3, 1, 11, 0, 0, 0, time.UTC)
+	if got := tail.last["api"]; !got.Equal(want) {
+		t.Errorf("api after rotation = %v, want %v", got, want)
+	}
+}
+
+func TestMonitor_WatchStopsIdle(t *testing.T) {
+	rt := runtime.NewMockRuntime()
+	rt.AddContainer("web", runtime.StatusRunning)
+	paths := &config.Paths{
+		SandboxesDir: t.TempDir(),
+		StateDir:     t.TempDir(),
+		TemplatesDir: t.TempDir(),
+	}
+	writeTemplate(t, paths.TemplatesDir, `, "idleTimeout": 30`)
+	auditLog := audit.NewLogger(paths.StateDir)
+	m := New(time.Minute, rt, paths, WithAuditLogger(auditLog))
+	snap := &paneSnapshot{Hash: "a"}
+	m.capture = fakeCapture(&snap)
+	sb := &config.SandboxMetadata{Name: "web", Template: "claude"}
+	if err := config.SaveSandboxMetadata(paths.SandboxesDir, sb); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if m.watch(ctx, sb, nil, nil) {
+		t.Fatal("stopped a sandbox seen for the first time")
+	}
+	m.idle.sandboxes["web"].lastActive = time.Now().Add(-45 * time.Minute)
+	if !m.watch(ctx, sb, nil, nil) {
+		t.Fatal("idle sandbox was not stopped")
+	}
+
+	if len(rt.GetCallsFor("Stop")) != 1 {
+		t.Errorf("Stop calls = %d, want 1", len(rt.GetCallsFor("Stop")))
+	}
+	if meta, err := config.LoadSandboxMetadata(paths.SandboxesDir, "web"); err != nil || meta.StoppedBy != config.StoppedByIdle {
+		t.Errorf("metadata = %+v, %v, want the sandbox stopped for being idle", meta, err)
+	}
+	events, err := auditLog.Events("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Type != audit.EventStop || !strings.Contains(events[0].Details, "idle for 45m") {
+		t.Errorf("events = %+v, want a stop event with the idle time", events)
+	}
+}
+
+func TestMonitor_IdleStopNotRestarted(t *testing.T) {
+	rt := runtime.NewMockRuntime()
+	rt.AddContainer("web", runtime.StatusRunning)
+	paths := &config.Paths{
+		SandboxesDir: t.TempDir(),
+		StateDir:     t.TempDir(),
+		TemplatesDir: t.TempDir(),
+	}
+	writeTemplate(t, paths.TemplatesDir, `, "idleTimeout": 30`)
+	m := New(time.Minute, rt, paths, WithAutoRestart(true))
+	snap := &paneSnapshot{Hash: "a"}
+	m.capture = fakeCapture(&snap)
+	m.check = func(context.Context, string, multiplexer.Multiplexer) health.Status {
+		return health.StatusHealthy
+	}
+	if err := config.SaveSandboxMetadata(paths.SandboxesDir, &config.SandboxMetadata{Name: "web", Template: "claude", NetworkSlot: 1}); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	m.checkAll(ctx)
+	m.idle.sandboxes["web"].lastActive = time.Now().Add(-45 * time.Minute)
+	results := m.checkAll(ctx)
+
+	if len(results) != 1 || results[0].Status != health.StatusStopped {
+		t.Errorf("results = %+v, want web stopped", results)
+	}
+	if stops := len(rt.GetCallsFor("Stop")); stops != 1 {
+		t.Errorf("Stop calls = %d, want 1", stops)
+	}
+	if starts := len(rt.GetCallsFor("Start")); starts != 0 {
+		t.Errorf("Start calls = %d, want the idle sandbox left stopped", starts)
+	}
+	if meta, err := config.LoadSandboxMetadata(paths.SandboxesDir, "web"); err != nil || meta.StoppedBy != config.StoppedByIdle || meta.Restarts != nil {
+		t.Errorf("metadata = %+v, %v, want stopped for being idle without restarts", meta, err)
+	}
+}
+
+func TestMonitor_WatchNothingToDo(t *testing.T) {
+	rt := runtime.NewMockRuntime()
+	paths := &config.Paths{
+		SandboxesDir: t.TempDir(),
+		StateDir:     t.TempDir(),
+		TemplatesDir: t.TempDir(),
+	}
+	writeTemplate(t, paths.TemplatesDir, "")
+	m := New(time.Minute, rt, paths)
+	m.capture = func(string, multiplexer.Multiplexer) (paneSnapshot, error) {
+		t.Error("panes captured without an idle timeout or notifiers")
+		return paneSnapshot{}, nil
+	}
+	sb := &config.SandboxMetadata{Name: "web", Template: "claude"}
+
+	if m.watch(context.Background(), sb, &config.HostConfig{}, nil) {
+		t.Error("stopped a sandbox without an idle timeout")
+	}
+}
@@ -3,6 +3,9 @@ package monitor
 
 import (
 	"context"
+	"fmt"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/audit"
@@ -10,7 +13,9 @@ import (
 	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/health"
 	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/logging"
 	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/multiplexer"
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/notify"
 	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/runtime"
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/sandbox"
 )
 
 // CheckResult holds the result of a single sandbox health check.
@@ -18,21 +23,30 @@ type CheckResult struct {
 	Sandbox string
 	Status  health.Status
 	Health  *health.CheckResult
+	Probes  []health.ProbeState
 }
 
-// Monitor periodically checks the health of all sandboxes.
+// Monitor periodically checks the health of all sandboxes, notifies when
+// an agent waits for input, and stops sandboxes that stay idle longer than
+// their idle timeout.
 type Monitor struct {
-	interval    time.Duration
-	rt          runtime.Runtime
-	paths       *config.Paths
-	autoRestart bool
-	auditLog    *audit.Logger
+	interval     time.Duration
+	rt           runtime.Runtime
+	paths        *config.Paths
+	autoRestart  bool
+	auditLog     *audit.Logger
+	proxyLogPath string
+	capture      captureFunc
+	check        func(ctx context.Context, host string, mux multiplexer.Multiplexer) health.Status // nil checks over SSH
+	idle         *idleTracker
+	waiting      *waitTracker
 }
 
 // Option configures a Monitor.
 type Option func(*Monitor)
 
-// WithAutoRestart enables automatic restart of unhealthy sandboxes.
+// WithAutoRestart makes on-failure the restart policy of sandboxes whose
+// template and host set none.
 func WithAutoRestart(enabled bool) Option {
 	return func(m *Monitor) {
 		m.autoRestart = enabled
@@ -46,6 +60,14 @@ func WithAuditLogger(logger *audit.Logger) Option {
 	}
 }
 
+// WithProxyLog sets the proxy's request log, whose API traffic counts as
+// sandbox activity.
+func WithProxyLog(path string) Option {
+	return func(m *Monitor) {
+		m.proxyLogPath = path
+	}
+}
+
 // New creates a new Monitor.
 func New(interval time.Duration, rt runtime.Runtime, paths *config.Paths, opts ...Option) *Monitor {
 	m := &Monitor{
@@ -56,6 +78,9 @@ func New(interval time.Duration, rt runtime.Runtime, paths *config.Paths, opts .
 	for _, opt := range opts {
 		opt(m)
 	}
+	m.capture = capturePanes
+	m.idle = newIdleTracker(m.proxyLogPath)
+	m.waiting = newWaitTracker()
 	return m
 }
 
@@ -88,17 +113,40 @@ func (m *Monitor) checkAll(ctx context.Context) []CheckResult {
 		return nil
 	}
 
+	hostConfig, _ := config.LoadHostConfig(m.paths.ConfigDir) // without it, no host defaults
+	notifiers := notify.All(hostConfig)
+	m.idle.poll()
+
+	statuses := health.Collect(ctx, m.rt, m.paths, sandboxes, health.CollectOptions{
+		Services: func(sb *config.SandboxMetadata) []config.Service {
+			return m.services(sb, hostConfig)
+		},
+		Check: m.check,
+	})
+
 	var results []CheckResult
-	for _, sb := range sandboxes {
+	for i, sb := range sandboxes {
 		if ctx.Err() != nil {
 			break
 		}
 
-		mux := multiplexer.New(multiplexer.Type(sb.Multiplexer))
-		status := health.GetSummary(sb.Name, sb.ContainerIP(), m.rt, mux)
+		status := statuses[i].Status
+		probes := statuses[i].Probes
+		failing := statuses[i].Failing()
+		if status == health.StatusStopped {
+			m.idle.forget(sb.Name)
+			m.waiting.forget(sb.Name)
+		} else {
+			if m.watch(ctx, sb, hostConfig, notifiers) {
+				status = health.StatusStopped
+				statuses[i].Status = status
+				sb.StoppedBy = config.StoppedByIdle // recorded by stopIfIdle; not a crash to restart
+			}
+		}
 		result := CheckResult{
 			Sandbox: sb.Name,
 			Status:  status,
+			Probes:  probes,
 		}
 		results = append(results, result)
 
@@ -110,29 +158,128 @@ func (m *Monitor) checkAll(ctx context.Context) []CheckResult {
 				details = "healthy"
 			case health.StatusUnhealthy:
 				details = "unhealthy"
+				if len(failing) > 0 {
+					details += ": failing probes " + strings.Join(failing, ", ")
+				}
 			case health.StatusNoMux:
 				details = "no-mux"
+			case health.StatusDegraded:
+				details = "degraded"
 			case health.StatusStopped:
 				details = "stopped"
 			}
 			_ = m.auditLog.LogEvent(audit.EventHealth, sb.Name, details)
 		}
 
-		// Auto-restart unhealthy or stopped containers
-		if m.autoRestart && (status == health.StatusStopped || status == health.StatusUnhealthy) {
-			logging.UserInfo("Auto-restarting sandbox %s (status: %s)", sb.Name, status)
-			if err := m.rt.Start(ctx, sb.Name); err != nil {
-				logging.Warn("auto-restart failed", "sandbox", sb.Name, "error", err)
-				if m.auditLog != nil {
-					_ = m.auditLog.LogEvent(audit.EventError, sb.Name, "auto-restart failed: "+err.Error())
-				}
-			} else {
-				if m.auditLog != nil {
-					_ = m.auditLog.LogEvent(audit.EventStart, sb.Name, "auto-restart")
-				}
-			}
-		}
+		m.applyRestartPolicy(ctx, sb, status, hostConfig)
 	}
 
+	m.saveStatuses(statuses)
 	return results
 }
+
+// services returns the sidecar services of a sandbox, or nil if its
+// template cannot be loaded.
+func (m *Monitor) services(sb *config.SandboxMetadata, hostConfig *config.HostConfig) []config.Service {
+	if m.paths.TemplatesDir == "" {
+		return nil
+	}
+	template, err := config.LoadTemplate(m.paths.TemplatesDir, sb.Template)
+	if err != nil {
+		return nil
+	}
+	return sandbox.Services(template, hostConfig)
+}
+
+// saveStatuses records the statuses of a round in the status cache, for
+// interactive commands to show without checking the sandboxes themselves.
+// They stay fresh until a round is overdue.
+func (m *Monitor) saveStatuses(statuses []health.SandboxStatus) {
+	if m.paths.StateDir == "" {
+		return
+	}
+	if err := health.SaveStatusCache(health.StatusCachePath(m.paths.StateDir), statuses, 2*m.interval); err != nil {
+		logging.Warn("failed to save the status cache", "error", err)
+	}
+}
+
+// watch captures the panes of a running sandbox, if the host has
+// notifiers or its template an idle timeout, to notify when its agent
+// waits for input and to stop it once idle. It reports whether the
+// sandbox was stopped.
+func (m *Monitor) watch(ctx context.Context, sb *config.SandboxMetadata, hostConfig *config.HostConfig, notifiers []notify.Notifier) bool {
+	if m.paths.TemplatesDir == "" {
+		return false
+	}
+	template, err := config.LoadTemplate(m.paths.TemplatesDir, sb.Template)
+	if err != nil {
+		return false
+	}
+	timeout := template.ResolvedIdleTimeout(hostConfig)
+	if timeout <= 0 && len(notifiers) == 0 {
+		return false
+	}
+
+	var snap *paneSnapshot
+	mux := multiplexer.New(multiplexer.Type(sb.Multiplexer))
+	if s, err := m.capture(sb.ContainerIP(), mux); err != nil {
+		logging.Debug("failed to capture panes", "sandbox", sb.Name, "error", err)
+	} else {
+		snap = &s
+	}
+	now := time.Now()
+
+	if len(notifiers) > 0 && snap != nil {
+		m.notifyIfWaiting(ctx, sb.Name, snap.Panes, template.CompiledWaitingPatterns(), notifiers, hostConfig.ResolvedNotifyDebounce(), now)
+	}
+	if timeout > 0 {
+		return m.stopIfIdle(ctx, sb.Name, m.idle.observe(sb, snap, now), timeout)
+	}
+	return false
+}
+
+// notifyIfWaiting notifies when the agent of a sandbox starts waiting for
+// input, at most once per debounce time.
+func (m *Monitor) notifyIfWaiting(ctx context.Context, name string, panes []string, patterns []*regexp.Regexp, notifiers []notify.Notifier, debounce time.Duration, now time.Time) {
+	lines, waiting := waitingPane(panes, patterns)
+	if !m.waiting.observe(name, waiting, debounce, now) {
+		return
+	}
+	logging.UserInfo("Sandbox %s is waiting for input", name)
+	n := notify.Notification{
+		Timestamp: now,
+		Event:     notify.EventWaiting,
+		Sandbox:   name,
+		Message:   fmt.Sprintf("Sandbox %s is waiting for input", name),
+		Lines:     lines,
+	}
+	if err := notify.Send(ctx, notifiers, n); err != nil {
+		logging.Warn("failed to notify", "sandbox", name, "error", err)
+	}
+}
+
+// stopIfIdle stops a running sandbox that has been idle for at least its
+// idle timeout, and reports whether it did.
+func (m *Monitor) stopIfIdle(ctx context.Context, name string, idle, timeout time.Duration) bool {
+	if idle < timeout {
+		return false
+	}
+
+	logging.UserInfo("Stopping sandbox %s (idle for %s)", name, idle.Round(time.Minute))
+	if err := config.MarkStopped(m.paths.SandboxesDir, name, config.StoppedByIdle); err != nil {
+		logging.Warn("failed to record the idle stop", "sandbox", name, "error", err)
+	}
+	if err := m.rt.Stop(ctx, name); err != nil {
+		logging.Warn("failed to stop idle sandbox", "sandbox", name, "error", err)
+		if m.auditLog != nil {
+			_ = m.auditLog.LogEvent(audit.EventError, name, "idle stop failed: "+err.Error())
+		}
+		return false
+	}
+	if m.auditLog != nil {
+		details := fmt.Sprintf("idle for %s (idle timeout %s)", idle.Round(time.Minute), timeout)
+		_ = m.auditLog.LogEvent(audit.EventStop, name, details)
+	}
+	m.idle.forget(name)
+	return true
+}
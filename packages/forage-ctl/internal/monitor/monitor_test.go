@@ -2,11 +2,14 @@ package monitor
 
 import (
 	"context"
+	"os"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/audit"
 	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/config"
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/health"
 	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/runtime"
 )
 
@@ -109,6 +112,15 @@ func TestMonitor_CheckAllWithSandbox(t *testing.T) {
 	if events[0].Type != audit.EventHealth {
 		t.Errorf("event type = %q, want %q", events[0].Type, audit.EventHealth)
 	}
+
+	// The round is cached for interactive commands
+	data, err := os.ReadFile(health.StatusCachePath(stateDir))
+	if err != nil {
+		t.Fatalf("status cache not written: %v", err)
+	}
+	if !strings.Contains(string(data), `"test-sandbox"`) {
+		t.Errorf("status cache = %s, want test-sandbox", data)
+	}
 }
 
 func TestMonitor_RunCancellation(t *testing.T) {
@@ -0,0 +1,134 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/audit"
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/config"
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/health"
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/logging"
+)
+
+// restartAction is what the restart policy says to do about a sandbox.
+type restartAction int
+
+const (
+	restartNone   restartAction = iota // leave it as it is
+	restartNow                         // restart it
+	restartGiveUp                      // out of retries: report a crash loop
+	restartReset                       // healthy again: forget its restarts
+)
+
+// failed reports whether a sandbox with the given status failed under the
+// restart policy.
+func failed(policy string, status health.Status) bool {
+	switch policy {
+	case config.RestartOnFailure:
+		return status == health.StatusStopped || status == health.StatusUnhealthy
+	case config.RestartAlways:
+		return status == health.StatusStopped || status == health.StatusUnhealthy || status == health.StatusNoMux
+	}
+	return false
+}
+
+// nextRestart decides what to do about a sandbox given its status, restart
+// policy and restart state. Sandboxes stopped on purpose are never
+// restarted.
+func nextRestart(sb *config.SandboxMetadata, status health.Status, policy config.RestartPolicy, now time.Time) restartAction {
+	state := sb.Restarts
+	if status == health.StatusHealthy || status == health.StatusDegraded {
+		if state != nil && (state.CrashLoop || now.Sub(state.Last) >= config.RestartResetAfter) {
+			return restartReset
+		}
+		return restartNone
+	}
+	if sb.StoppedBy != "" || !failed(policy.Policy, status) {
+		return restartNone
+	}
+	if state == nil {
+		return restartNow
+	}
+	switch {
+	case state.CrashLoop:
+		return restartNone
+	case state.Count >= policy.MaxRetries:
+		return restartGiveUp
+	case now.Sub(state.Last) < policy.Delay(state.Count):
+		return restartNone // backing off
+	}
+	return restartNow
+}
+
+// applyRestartPolicy restarts a failed sandbox, unless it is backing off or
+// out of retries, and records its restarts in its metadata.
+func (m *Monitor) applyRestartPolicy(ctx context.Context, sb *config.SandboxMetadata, status health.Status, hostConfig *config.HostConfig) {
+	var template *config.Template
+	if m.paths.TemplatesDir != "" {
+		template, _ = config.LoadTemplate(m.paths.TemplatesDir, sb.Template) // without it, the host's policy
+	}
+	fallback := config.RestartNever
+	if m.autoRestart {
+		fallback = config.RestartOnFailure
+	}
+	policy := config.ResolveRestartPolicy(template, hostConfig, fallback)
+	now := time.Now()
+
+	switch nextRestart(sb, status, policy, now) {
+	case restartReset:
+		m.saveRestarts(sb.Name, nil)
+
+	case restartGiveUp:
+		state := *sb.Restarts
+		state.CrashLoop = true
+		m.saveRestarts(sb.Name, &state)
+		logging.UserWarning("Sandbox %s is crash looping, giving up after %d restarts", sb.Name, state.Count)
+		if m.auditLog != nil {
+			_ = m.auditLog.LogEvent(audit.EventError, sb.Name, fmt.Sprintf("crash loop: gave up after %d restarts", state.Count))
+		}
+
+	case restartNow:
+		state := config.RestartState{}
+		if sb.Restarts != nil {
+			state = *sb.Restarts
+		}
+		state.Count++
+		state.Last = now
+		m.saveRestarts(sb.Name, &state)
+
+		logging.UserInfo("Restarting sandbox %s (status: %s, restart %d of %d)", sb.Name, status, state.Count, policy.MaxRetries)
+		if err := m.restart(ctx, sb.Name, status != health.StatusStopped); err != nil {
+			logging.Warn("auto-restart failed", "sandbox", sb.Name, "error", err)
+			if m.auditLog != nil {
+				_ = m.auditLog.LogEvent(audit.EventError, sb.Name, "auto-restart failed: "+err.Error())
+			}
+		} else if m.auditLog != nil {
+			_ = m.auditLog.LogEvent(audit.EventStart, sb.Name, fmt.Sprintf("auto-restart %d of %d (%s)", state.Count, policy.MaxRetries, status))
+		}
+	}
+}
+
+// saveRestarts records the restart state of a sandbox.
+func (m *Monitor) saveRestarts(name string, state *config.RestartState) {
+	err := config.UpdateSandboxMetadata(m.paths.SandboxesDir, name, func(meta *config.SandboxMetadata) {
+		meta.Restarts = state
+	})
+	if err != nil {
+		logging.Warn("failed to record restarts", "sandbox", name, "error", err)
+	}
+}
+
+// restart starts a sandbox again. A sandbox that is still running, but
+// failing, is stopped first, and its probes start over.
+func (m *Monitor) restart(ctx context.Context, name string, running bool) error {
+	if running {
+		if err := m.rt.Stop(ctx, name); err != nil {
+			return err
+		}
+		if err := health.RemoveProbeStates(m.paths.SandboxesDir, name); err != nil {
+			logging.Warn("failed to reset probe states", "sandbox", name, "error", err)
+		}
+	}
+	return m.rt.Start(ctx, name)
+}
@@ -0,0 +1,161 @@
+package monitor
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/audit"
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/config"
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/health"
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/runtime"
+)
+
+func TestNextRestart(t *testing.T) {
+	now := time.Now()
+	onFailure := config.ResolveRestartPolicy(nil, nil, config.RestartOnFailure)
+	always := config.ResolveRestartPolicy(nil, nil, config.RestartAlways)
+	never := config.ResolveRestartPolicy(nil, nil, config.RestartNever)
+	restarted := func(count int, ago time.Duration) *config.RestartState {
+		return &config.RestartState{Count: count, Last: now.Add(-ago)}
+	}
+
+	tests := []struct {
+		name   string
+		sb     config.SandboxMetadata
+		status health.Status
+		policy config.RestartPolicy
+		want   restartAction
+	}{
+		{"crashed", config.SandboxMetadata{}, health.StatusStopped, onFailure, restartNow},
+		{"unhealthy", config.SandboxMetadata{}, health.StatusUnhealthy, onFailure, restartNow},
+		{"never", config.SandboxMetadata{}, health.StatusStopped, never, restartNone},
+		{"session ended, on-failure", config.SandboxMetadata{}, health.StatusNoMux, onFailure, restartNone},
+		{"session ended, always", config.SandboxMetadata{}, health.StatusNoMux, always, restartNow},
+		{"stopped by user", config.SandboxMetadata{StoppedBy: config.StoppedByUser}, health.StatusStopped, always, restartNone},
+		{"stopped when idle", config.SandboxMetadata{StoppedBy: config.StoppedByIdle}, health.StatusStopped, always, restartNone},
+		{"backing off", config.SandboxMetadata{Restarts: restarted(2, 15*time.Second)}, health.StatusStopped, onFailure, restartNone},
+		{"backed off", config.SandboxMetadata{Restarts: restarted(2, 20*time.Second)}, health.StatusStopped, onFailure, restartNow},
+		{"out of retries", config.SandboxMetadata{Restarts: restarted(5, time.Hour)}, health.StatusStopped, onFailure, restartGiveUp},
+		{"crash loop", config.SandboxMetadata{Restarts: &config.RestartState{Count: 5, CrashLoop: true}}, health.StatusStopped, onFailure, restartNone},
+		{"recovering", config.SandboxMetadata{Restarts: restarted(2, time.Minute)}, health.StatusHealthy, onFailure, restartNone},
+		{"recovered", config.SandboxMetadata{Restarts: restarted(2, config.RestartResetAfter)}, health.StatusHealthy, onFailure, restartReset},
+		{"recovered, degraded", config.SandboxMetadata{Restarts: restarted(2, config.RestartResetAfter)}, health.StatusDegraded, onFailure, restartReset},
+		{"out of crash loop", config.SandboxMetadata{Restarts: &config.RestartState{Count: 5, Last: now, CrashLoop: true}}, health.StatusHealthy, onFailure, restartReset},
+		{"healthy", config.SandboxMetadata{}, health.StatusHealthy, onFailure, restartNone},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := nextRestart(&tt.sb, tt.status, tt.policy, now); got != tt.want {
+				t.Errorf("nextRestart() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// newRestartMonitor returns a monitor restarting on failure that watches
+// sb, whose container is stopped.
+func newRestartMonitor(t *testing.T, sb *config.SandboxMetadata) (*Monitor, *runtime.MockRuntime, *audit.Logger) {
+	t.Helper()
+	rt := runtime.NewMockRuntime()
+	rt.AddContainer(sb.Name, runtime.StatusStopped)
+	paths := &config.Paths{
+		SandboxesDir: t.TempDir(),
+		StateDir:     t.TempDir(),
+	}
+	if err := config.SaveSandboxMetadata(paths.SandboxesDir, sb); err != nil {
+		t.Fatal(err)
+	}
+	auditLog := audit.NewLogger(paths.StateDir)
+	return New(time.Second, rt, paths, WithAutoRestart(true), WithAuditLogger(auditLog)), rt, auditLog
+}
+
+func TestMonitor_RestartsCrashedSandbox(t *testing.T) {
+	m, rt, _ := newRestartMonitor(t, &config.SandboxMetadata{Name: "web", NetworkSlot: 1})
+
+	m.checkAll(context.Background())
+
+	if starts := len(rt.GetCallsFor("Start")); starts != 1 {
+		t.Fatalf("Start calls = %d, want 1", starts)
+	}
+	meta, err := config.LoadSandboxMetadata(m.paths.SandboxesDir, "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Restarts == nil || meta.Restarts.Count != 1 {
+		t.Errorf("restarts = %+v, want 1 recorded", meta.Restarts)
+	}
+
+	// The next check comes within the backoff
+	_ = rt.Stop(context.Background(), "web")
+	m.checkAll(context.Background())
+	if starts := len(rt.GetCallsFor("Start")); starts != 1 {
+		t.Errorf("Start calls = %d, want no restart while backing off", starts)
+	}
+}
+
+func TestMonitor_LeavesStoppedSandbox(t *testing.T) {
+	m, rt, _ := newRestartMonitor(t, &config.SandboxMetadata{Name: "web", NetworkSlot: 1, StoppedBy: config.StoppedByUser})
+
+	m.checkAll(context.Background())
+
+	if starts := len(rt.GetCallsFor("Start")); starts != 0 {
+		t.Errorf("Start calls = %d, want a sandbox stopped by its user left alone", starts)
+	}
+}
+
+func TestMonitor_GivesUpOnCrashLoop(t *testing.T) {
+	sb := &config.SandboxMetadata{
+		Name:        "web",
+		NetworkSlot: 1,
+		Restarts:    &config.RestartState{Count: config.DefaultRestartMaxRetries, Last: time.Now().Add(-time.Hour)},
+	}
+	m, rt, auditLog := newRestartMonitor(t, sb)
+
+	m.checkAll(context.Background())
+	m.checkAll(context.Background())
+
+	if starts := len(rt.GetCallsFor("Start")); starts != 0 {
+		t.Errorf("Start calls = %d, want none after the retries ran out", starts)
+	}
+	meta, err := config.LoadSandboxMetadata(m.paths.SandboxesDir, "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Restarts == nil || !meta.Restarts.CrashLoop {
+		t.Errorf("restarts = %+v, want a crash loop", meta.Restarts)
+	}
+	if got := health.ApplyRestarts(health.StatusStopped, meta); got != health.StatusCrashLoop {
+		t.Errorf("status = %s, want %s", got, health.StatusCrashLoop)
+	}
+
+	events, err := auditLog.Events("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	crashLoops := 0
+	for _, e := range events {
+		if e.Type == audit.EventError && strings.Contains(e.Details, "crash loop") {
+			crashLoops++
+		}
+	}
+	if crashLoops != 1 {
+		t.Errorf("got %d crash loop events, want 1", crashLoops)
+	}
+}
+
+func TestMonitor_NoPolicyNoRestart(t *testing.T) {
+	rt := runtime.NewMockRuntime()
+	rt.AddContainer("web", runtime.StatusStopped)
+	paths := &config.Paths{SandboxesDir: t.TempDir(), StateDir: t.TempDir()}
+	if err := config.SaveSandboxMetadata(paths.SandboxesDir, &config.SandboxMetadata{Name: "web", NetworkSlot: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	New(time.Second, rt, paths).checkAll(context.Background())
+
+	if starts := len(rt.GetCallsFor("Start")); starts != 0 {
+		t.Errorf("Start calls = %d, want none without a restart policy", starts)
+	}
+}
@@ -0,0 +1,87 @@
+package monitor
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+// tailLines is how many of the last lines of a pane are matched against
+// the waiting patterns and sent with notifications.
+const tailLines = 15
+
+// waitState is what the monitor knows about whether a sandbox's agent
+// waits for input.
+type waitState struct {
+	waiting  bool
+	pending  bool // started waiting within the debounce time, not notified yet
+	notified time.Time
+}
+
+// waitTracker tracks which sandboxes wait for input, to notify each time
+// one starts waiting.
+type waitTracker struct {
+	sandboxes map[string]*waitState
+}
+
+func newWaitTracker() *waitTracker {
+	return &waitTracker{sandboxes: make(map[string]*waitState)}
+}
+
+// observe records whether a sandbox waits for input and reports whether
+// to notify: it started waiting and was not notified of it yet, and was
+// not notified within the debounce time. A wait that starts within the
+// debounce time is notified once it has passed, if still waiting.
+func (t *waitTracker) observe(name string, waiting bool, debounce time.Duration, now time.Time) bool {
+	s, ok := t.sandboxes[name]
+	if !ok {
+		s = &waitState{}
+		t.sandboxes[name] = s
+	}
+	if waiting && !s.waiting {
+		s.pending = true
+	}
+	s.waiting = waiting
+	if !waiting {
+		s.pending = false
+	}
+	if !s.pending || (!s.notified.IsZero() && now.Sub(s.notified) < debounce) {
+		return false
+	}
+	s.pending = false
+	s.notified = now
+	return true
+}
+
+// forget drops what is known about a sandbox.
+func (t *waitTracker) forget(name string) {
+	delete(t.sandboxes, name)
+}
+
+// waitingPane returns the last lines of the first pane whose last lines
+// match one of the patterns, if there is one.
+func waitingPane(panes []string, patterns []*regexp.Regexp) ([]string, bool) {
+	for _, pane := range panes {
+		lines := lastLines(pane, tailLines)
+		for _, line := range lines {
+			for _, re := range patterns {
+				if re.MatchString(line) {
+					return lines, true
+				}
+			}
+		}
+	}
+	return nil, false
+}
+
+// lastLines returns the last n lines of s.
+func lastLines(s string, n int) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.Split(s, "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return lines
+}
@@ -0,0 +1,121 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/config"
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/notify"
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/runtime"
+)
+
+const permissionPrompt = `● Bash(rm -rf build)
+
+ Do you want to proceed?
+ ❯ 1. Yes
+   2. No, and tell Claude what to do differently (esc)`
+
+func TestWaitingPane(t *testing.T) {
+	defaults := (&config.Template{}).CompiledWaitingPatterns()
+	tests := []struct {
+		name     string
+		panes    []string
+		patterns []*regexp.Regexp
+		want     bool
+	}{
+		{"permission prompt", []string{"$ ls", permissionPrompt}, defaults, true},
+		{"yes/no question", []string{"Overwrite config? [y/N]"}, defaults, true},
+		{"working", []string{"● Reading files…\n  ⎿ main.go"}, defaults, false},
+		{"no panes", nil, defaults, false},
+		{"prompt scrolled away", []string{permissionPrompt + strings.Repeat("\nbuilding…", tailLines)}, defaults, false},
+		{"custom pattern", []string{"READY>"}, []*regexp.Regexp{regexp.MustCompile(`^READY>$`)}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines, got := waitingPane(tt.panes, tt.patterns)
+			if got != tt.want {
+				t.Fatalf("waitingPane() = %v, want %v", got, tt.want)
+			}
+			if got && len(lines) == 0 {
+				t.Error("no lines returned with a waiting pane")
+			}
+		})
+	}
+}
+
+func TestWaitTracker_Debounce(t *testing.T) {
+	tracker := newWaitTracker()
+	start := time.Now()
+	debounce := 5 * time.Minute
+
+	steps := []struct {
+		at      time.Duration
+		waiting bool
+		want    bool
+	}{
+		{0, false, false},
+		{time.Minute, true, true},        // started waiting
+		{2 * time.Minute, true, false},   // still waiting
+		{3 * time.Minute, false, false},  // answered
+		{4 * time.Minute, true, false},   // waiting again, within debounce
+		{5 * time.Minute, false, false},  // answered
+		{7 * time.Minute, true, true},    // waiting again, after debounce
+		{30 * time.Minute, true, false},  // still waiting, however long
+		{31 * time.Minute, false, false}, // answered
+		{32 * time.Minute, true, true},   // waiting again, after debounce
+		{33 * time.Minute, false, false}, // answered
+		{34 * time.Minute, true, false},  // waiting again, within debounce
+		{36 * time.Minute, true, false},  // still within debounce
+		{37 * time.Minute, true, true},   // still waiting once the debounce passed
+		{40 * time.Minute, true, false},  // notified once
+	}
+	for i, s := range steps {
+		if got := tracker.observe("web", s.waiting, debounce, start.Add(s.at)); got != s.want {
+			t.Errorf("step %d (%v, waiting %v): notify = %v, want %v", i, s.at, s.waiting, got, s.want)
+		}
+	}
+
+	tracker.forget("web")
+	if !tracker.observe("web", true, debounce, start.Add(41*time.Minute)) {
+		t.Error("no notification after forget")
+	}
+}
+
+func TestMonitor_NotifyIfWaiting(t *testing.T) {
+	received := make(chan notify.Notification, 4)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n notify.Notification
+		if err := json.NewDecoder(r.Body).Decode(&n); err != nil {
+			t.Errorf("bad notification: %v", err)
+		}
+		received <- n
+	}))
+	defer server.Close()
+
+	m := New(time.Minute, runtime.NewMockRuntime(), &config.Paths{SandboxesDir: t.TempDir()})
+	notifiers := []notify.Notifier{&notify.Webhook{URL: server.URL}}
+	patterns := (&config.Template{}).CompiledWaitingPatterns()
+	ctx := context.Background()
+	now := time.Now()
+
+	m.notifyIfWaiting(ctx, "web", []string{"● Reading files…"}, patterns, notifiers, time.Minute, now)
+	m.notifyIfWaiting(ctx, "web", []string{permissionPrompt}, patterns, notifiers, time.Minute, now.Add(time.Second))
+	m.notifyIfWaiting(ctx, "web", []string{permissionPrompt}, patterns, notifiers, time.Minute, now.Add(2*time.Second))
+
+	if len(received) != 1 {
+		t.Fatalf("got %d notifications, want 1", len(received))
+	}
+	n := <-received
+	if n.Event != notify.EventWaiting || n.Sandbox != "web" {
+		t.Errorf("got %+v, want a waiting notification for web", n)
+	}
+	if !strings.Contains(strings.Join(n.Lines, "\n"), "Do you want to proceed?") {
+		t.Errorf("lines = %q, want the prompt", n.Lines)
+	}
+}
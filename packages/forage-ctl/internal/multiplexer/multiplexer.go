@@ -10,6 +10,10 @@ const (
 	TypeWezterm Type = "wezterm"
 )
 
+// PaneSeparator is the line printed before each pane by the command of
+// CapturePanesArgs (the ASCII record separator, \036 to printf).
+const PaneSeparator = "\x1e"
+
 // Window describes a multiplexer window/tab to create at sandbox start.
 type Window struct {
 	Name    string
@@ -51,6 +55,11 @@ type Multiplexer interface {
 	// a slice of human-readable window descriptions.
 	ParseWindowList(output string) []string
 
+	// CapturePanesArgs returns the SSH command+args printing the visible
+	// content of every pane, each preceded by a PaneSeparator line, used to
+	// tell whether an agent is active or waiting for input.
+	CapturePanesArgs() []string
+
 	// HostConfigMounts returns bind mounts for the user's multiplexer
 	// configuration on the host.
 	HostConfigMounts(homeDir string) []ConfigMount
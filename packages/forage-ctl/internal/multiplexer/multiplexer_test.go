@@ -5,6 +5,8 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+
+	shellquote "github.com/kballard/go-shellquote"
 )
 
 func TestNewDefault(t *testing.T) {
@@ -226,6 +228,26 @@ func TestWeztermAttachCommand(t *testing.T) {
 	}
 }
 
+func TestCapturePanesArgs(t *testing.T) {
+	for _, tt := range []struct {
+		mux  Multiplexer
+		want string
+	}{
+		{&Tmux{}, "tmux capture-pane -p"},
+		{&Wezterm{}, "wezterm cli get-text"},
+	} {
+		// The args are run by the remote shell, so they must split back
+		// into a single bash script
+		args, err := shellquote.Split(strings.Join(tt.mux.CapturePanesArgs(), " "))
+		if err != nil {
+			t.Fatalf("%T: %v", tt.mux, err)
+		}
+		if len(args) != 3 || args[0] != "bash" || !strings.Contains(args[2], tt.want) {
+			t.Errorf("%T: CapturePanesArgs() runs %q, want a bash script with %q", tt.mux, args, tt.want)
+		}
+	}
+}
+
 func TestWeztermCheckSessionArgs(t *testing.T) {
 	mux := &Wezterm{}
 	args := mux.CheckSessionArgs()
@@ -72,6 +72,11 @@ func (t *Tmux) ListWindowsArgs() []string {
 	return []string{"tmux", "list-windows", "-t", SessionName, "-F", "#{window_index}:#{window_name}"}
 }
 
+func (t *Tmux) CapturePanesArgs() []string {
+	script := fmt.Sprintf(`for p in $(tmux list-panes -s -t %s -F '#{pane_id}'); do printf '\036\n'; tmux capture-pane -p -t "$p"; done`, SessionName)
+	return []string{"bash", "-c", shellquote.Join(script)}
+}
+
 func (t *Tmux) ParseWindowList(output string) []string {
 	lines := strings.Split(strings.TrimSpace(output), "\n")
 	var windows []string
@@ -50,6 +50,11 @@ func (w *Wezterm) ListWindowsArgs() []string {
 	return []string{"wezterm", "cli", "list", "--format", "json"}
 }
 
+func (w *Wezterm) CapturePanesArgs() []string {
+	script := `for p in $(wezterm cli list | awk 'NR > 1 { print $3 }'); do printf '\036\n'; wezterm cli get-text --pane-id "$p"; done`
+	return []string{"bash", "-c", shellquote.Join(script)}
+}
+
 func (w *Wezterm) ParseWindowList(output string) []string {
 	// wezterm cli list outputs tab-separated rows; parse window titles.
 	// With --format json we get JSON but for simplicity parse lines.
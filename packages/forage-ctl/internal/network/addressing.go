@@ -0,0 +1,193 @@
+package network
+
+import (
+	"fmt"
+	"math/big"
+	"net/netip"
+)
+
+// Default address plan. Sandbox N gets 10.100.N.0/24, with the host side
+// of the link at .1 and the container at .2.
+const (
+	DefaultSubnetBase         = "10.100.0.0/16"
+	DefaultSubnetPrefixLength = 24
+
+	// ipv6SubnetPrefixLength is the size of each sandbox's IPv6 subnet.
+	ipv6SubnetPrefixLength = 64
+)
+
+// AddressPlan divides a base prefix into equally sized per-sandbox subnets.
+// Slot N maps to the N-th subnet of the base. The first and last subnets
+// are never handed out, so the default plan keeps the historical
+// 10.100.N.0/24 layout with slots 1-254.
+type AddressPlan struct {
+	base         netip.Prefix
+	prefixLength int
+	ipv6Base     netip.Prefix // invalid when IPv6 is disabled
+}
+
+// Addresses are the IP addresses of one sandbox's host/container link.
+// The IPv6 fields are empty unless the address plan has an IPv6 ULA prefix.
+type Addresses struct {
+	Subnet        string // sandbox IPv4 subnet in CIDR form
+	HostIP        string // host side of the link; the sandbox's gateway
+	ContainerIP   string
+	SubnetIPv6    string
+	HostIPv6      string
+	ContainerIPv6 string
+}
+
+// DefaultAddressPlan returns the plan used when the host config does not
+// configure one.
+func DefaultAddressPlan() *AddressPlan {
+	plan, _ := NewAddressPlan(DefaultSubnetBase, DefaultSubnetPrefixLength, "")
+	return plan
+}
+
+// NewAddressPlan builds an address plan from an IPv4 base prefix, the
+// prefix length of each sandbox subnet and an optional IPv6 ULA prefix.
+// Empty or zero arguments select the defaults.
+func NewAddressPlan(base string, prefixLength int, ipv6ULA string) (*AddressPlan, error) {
+	if base == "" {
+		base = DefaultSubnetBase
+	}
+	if prefixLength == 0 {
+		prefixLength = DefaultSubnetPrefixLength
+	}
+
+	prefix, err := netip.ParsePrefix(base)
+	if err != nil {
+		return nil, fmt.Errorf("invalid subnet base %q: %w", base, err)
+	}
+	if !prefix.Addr().Is4() {
+		return nil, fmt.Errorf("invalid subnet base %q: must be an IPv4 prefix", base)
+	}
+	if prefix.Masked() != prefix {
+		return nil, fmt.Errorf("invalid subnet base %q: host bits set (did you mean %s?)", base, prefix.Masked())
+	}
+	// Each subnet needs a network address, host, container and broadcast
+	if prefixLength > 30 {
+		return nil, fmt.Errorf("invalid subnet prefix length /%d: must be /30 or larger", prefixLength)
+	}
+	if prefixLength < prefix.Bits()+2 {
+		return nil, fmt.Errorf("invalid subnet prefix length /%d: must be at least 2 bits longer than the base prefix /%d", prefixLength, prefix.Bits())
+	}
+
+	plan := &AddressPlan{base: prefix, prefixLength: prefixLength}
+
+	if ipv6ULA != "" {
+		v6, err := netip.ParsePrefix(ipv6ULA)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IPv6 ULA prefix %q: %w", ipv6ULA, err)
+		}
+		if !v6.Addr().Is6() || v6.Addr().Is4In6() {
+			return nil, fmt.Errorf("invalid IPv6 ULA prefix %q: must be an IPv6 prefix", ipv6ULA)
+		}
+		if !netip.MustParsePrefix("fc00::/7").Contains(v6.Addr()) {
+			return nil, fmt.Errorf("invalid IPv6 ULA prefix %q: must be within fc00::/7", ipv6ULA)
+		}
+		if v6.Masked() != v6 {
+			return nil, fmt.Errorf("invalid IPv6 ULA prefix %q: host bits set (did you mean %s?)", ipv6ULA, v6.Masked())
+		}
+		if ipv6SubnetPrefixLength-v6.Bits() < prefixLength-prefix.Bits() {
+			return nil, fmt.Errorf("IPv6 ULA prefix %q is too long to give each of the %d sandboxes a /%d", ipv6ULA, plan.MaxSlot(), ipv6SubnetPrefixLength)
+		}
+		plan.ipv6Base = v6
+	}
+
+	return plan, nil
+}
+
+// MaxSlot returns the highest slot the plan can address.
+func (p *AddressPlan) MaxSlot() int {
+	return 1<<(p.prefixLength-p.base.Bits()) - 2
+}
+
+// HasIPv6 reports whether the plan assigns IPv6 addresses.
+func (p *AddressPlan) HasIPv6() bool {
+	return p.ipv6Base.IsValid()
+}
+
+// Networks returns the prefixes sandbox subnets are carved from: the IPv4
+// base and, when configured, the IPv6 ULA prefix.
+func (p *AddressPlan) Networks() []string {
+	networks := []string{p.base.String()}
+	if p.HasIPv6() {
+		networks = append(networks, p.ipv6Base.String())
+	}
+	return networks
+}
+
+// Subnet returns the IPv4 subnet for slot.
+func (p *AddressPlan) Subnet(slot int) (netip.Prefix, error) {
+	if slot < 1 || slot > p.MaxSlot() {
+		return netip.Prefix{}, fmt.Errorf("network slot %d out of range (must be 1-%d)", slot, p.MaxSlot())
+	}
+	return nthSubnet(p.base, p.prefixLength, slot), nil
+}
+
+// Addresses returns the link addresses for slot.
+func (p *AddressPlan) Addresses(slot int) (Addresses, error) {
+	subnet, err := p.Subnet(slot)
+	if err != nil {
+		return Addresses{}, err
+	}
+	var subnet6 netip.Prefix
+	if p.HasIPv6() {
+		subnet6 = nthSubnet(p.ipv6Base, ipv6SubnetPrefixLength, slot)
+	}
+	return addressesFor(subnet, subnet6), nil
+}
+
+// AddressesForSubnets derives link addresses from recorded subnets, as
+// stored in sandbox metadata. subnetIPv6 may be empty.
+func AddressesForSubnets(subnet, subnetIPv6 string) (Addresses, error) {
+	v4, err := netip.ParsePrefix(subnet)
+	if err != nil || !v4.Addr().Is4() || v4.Bits() > 30 {
+		return Addresses{}, fmt.Errorf("invalid sandbox subnet %q", subnet)
+	}
+	var v6 netip.Prefix
+	if subnetIPv6 != "" {
+		v6, err = netip.ParsePrefix(subnetIPv6)
+		if err != nil || !v6.Addr().Is6() {
+			return Addresses{}, fmt.Errorf("invalid sandbox IPv6 subnet %q", subnetIPv6)
+		}
+	}
+	return addressesFor(v4.Masked(), v6.Masked()), nil
+}
+
+// Overlaps reports whether the slot's IPv4 subnet overlaps prefix.
+func (p *AddressPlan) Overlaps(slot int, prefix netip.Prefix) bool {
+	subnet, err := p.Subnet(slot)
+	return err == nil && subnet.Overlaps(prefix)
+}
+
+func addressesFor(subnet, subnet6 netip.Prefix) Addresses {
+	host := subnet.Addr().Next()
+	a := Addresses{
+		Subnet:      subnet.String(),
+		HostIP:      host.String(),
+		ContainerIP: host.Next().String(),
+	}
+	if subnet6.IsValid() {
+		host6 := subnet6.Addr().Next()
+		a.SubnetIPv6 = subnet6.String()
+		a.HostIPv6 = host6.String()
+		a.ContainerIPv6 = host6.Next().String()
+	}
+	return a
+}
+
+// nthSubnet returns the n-th subnet of the given length within base.
+func nthSubnet(base netip.Prefix, length, n int) netip.Prefix {
+	addr := base.Addr().AsSlice()
+	total := len(addr) * 8
+
+	v := new(big.Int).SetBytes(addr)
+	v.Add(v, new(big.Int).Lsh(big.NewInt(int64(n)), uint(total-length)))
+
+	buf := make([]byte, len(addr))
+	v.FillBytes(buf)
+	next, _ := netip.AddrFromSlice(buf)
+	return netip.PrefixFrom(next, length)
+}
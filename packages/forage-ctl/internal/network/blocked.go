@@ -0,0 +1,242 @@
+package network
+
+import (
+	"bufio"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BlockedLogPrefix is the nftables log prefix attached to packets dropped
+// by the restricted-mode output chain. Kernel log lines carrying this
+// prefix are collected by ParseBlockedLog.
+const BlockedLogPrefix = "forage-blocked: "
+
+// BlockedConnection summarizes outbound connection attempts to a single
+// destination that were rejected by the restricted-mode firewall.
+type BlockedConnection struct {
+	DestIP   string
+	DestPort int
+	Protocol string
+	Hostname string // reverse-mapped from DNS logs; empty if unknown
+	Count    int
+	LastSeen time.Time
+}
+
+// DNSLog holds the information extracted from dnsmasq query logs.
+type DNSLog struct {
+	// Hosts maps resolved IP addresses to the hostname that produced them.
+	Hosts map[string]string
+
+	// Refused lists hostnames whose queries were answered locally with
+	// NXDOMAIN because they are not on the allowlist.
+	Refused []string
+}
+
+// ParseBlockedLog extracts blocked connection attempts from kernel log
+// output (e.g. `journalctl -k -o short-iso`). Only lines carrying
+// BlockedLogPrefix whose source address is one of srcIPs are considered,
+// so a dual-stack sandbox passes both its IPv4 and IPv6 address; empty
+// srcIPs match every source. Attempts are aggregated per destination,
+// protocol and port, and returned most frequent first.
+func ParseBlockedLog(output string, srcIPs ...string) []BlockedConnection {
+	sources := make(map[string]bool, len(srcIPs))
+	for _, ip := range srcIPs {
+		if addr, err := netip.ParseAddr(ip); err == nil {
+			sources[addr.String()] = true
+		}
+	}
+
+	type key struct {
+		ip    string
+		port  int
+		proto string
+	}
+	byKey := make(map[key]*BlockedConnection)
+	var order []key
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+		idx := strings.Index(line, BlockedLogPrefix)
+		if idx < 0 {
+			continue
+		}
+
+		fields := parseLogFields(line[idx+len(BlockedLogPrefix):])
+		if len(sources) > 0 && !sources[canonicalIP(fields["SRC"])] {
+			continue
+		}
+		dst := canonicalIP(fields["DST"])
+		if dst == "" {
+			continue
+		}
+		dport, _ := strconv.Atoi(fields["DPT"])
+
+		k := key{ip: dst, port: dport, proto: fields["PROTO"]}
+		bc, ok := byKey[k]
+		if !ok {
+			bc = &BlockedConnection{DestIP: dst, DestPort: dport, Protocol: fields["PROTO"]}
+			byKey[k] = bc
+			order = append(order, k)
+		}
+		bc.Count++
+		if ts, ok := parseLogTimestamp(line[:idx]); ok && ts.After(bc.LastSeen) {
+			bc.LastSeen = ts
+		}
+	}
+
+	result := make([]BlockedConnection, 0, len(order))
+	for _, k := range order {
+		result = append(result, *byKey[k])
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Count > result[j].Count
+	})
+	return result
+}
+
+// canonicalIP returns ip in canonical text form, or "" if it does not
+// parse. The kernel logs IPv6 addresses fully expanded.
+func canonicalIP(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ""
+	}
+	return addr.String()
+}
+
+// parseLogFields splits the KEY=VALUE tokens of a netfilter log line.
+// Flag tokens without a value (e.g. "SYN", "DF") are ignored.
+func parseLogFields(s string) map[string]string {
+	fields := make(map[string]string)
+	for _, tok := range strings.Fields(s) {
+		k, v, ok := strings.Cut(tok, "=")
+		if !ok {
+			continue
+		}
+		fields[k] = v
+	}
+	return fields
+}
+
+// parseLogTimestamp parses the leading ISO 8601 timestamp written by
+// `journalctl -o short-iso`. Returns false if the line has no such prefix.
+func parseLogTimestamp(prefix string) (time.Time, bool) {
+	fields := strings.Fields(prefix)
+	if len(fields) == 0 {
+		return time.Time{}, false
+	}
+	for _, layout := range []string{"2006-01-02T15:04:05-0700", time.RFC3339} {
+		if ts, err := time.Parse(layout, fields[0]); err == nil {
+			return ts, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// ParseDNSLog extracts IP-to-hostname mappings and refused queries from
+// dnsmasq output produced with log-queries enabled. Both the raw syslog
+// format ("dnsmasq[42]: reply ...") and `journalctl -o cat` output are
+// accepted.
+func ParseDNSLog(output string) *DNSLog {
+	dns := &DNSLog{Hosts: make(map[string]string)}
+	refused := make(map[string]bool)
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if _, rest, ok := strings.Cut(line, "]: "); ok {
+			line = rest
+		}
+
+		// Lines of interest: "<verb> <name> is <answer>"
+		fields := strings.Fields(line)
+		if len(fields) != 4 || fields[2] != "is" {
+			continue
+		}
+		verb, name, answer := fields[0], fields[1], fields[3]
+
+		switch verb {
+		case "reply", "cached":
+			if ip := canonicalIP(answer); ip != "" {
+				dns.Hosts[ip] = name
+			}
+		case "config":
+			if answer == "NXDOMAIN" && !refused[name] {
+				refused[name] = true
+				dns.Refused = append(dns.Refused, name)
+			}
+		}
+	}
+
+	return dns
+}
+
+// AnnotateHostnames fills in BlockedConnection.Hostname from the DNS log.
+func AnnotateHostnames(conns []BlockedConnection, dns *DNSLog) {
+	if dns == nil {
+		return
+	}
+	for i := range conns {
+		if name, ok := dns.Hosts[conns[i].DestIP]; ok {
+			conns[i].Hostname = name
+		}
+	}
+}
+
+// SuggestAllowedHosts returns allowlist entries that would unblock the
+// observed traffic and are not already covered by allowedHosts. Hostnames
+// come from reverse-mapped blocked connections and refused DNS queries; bare
+// IPs are never suggested. A hostname that is already allowed on other ports
+// is suggested as "host:port" for the blocked port.
+func SuggestAllowedHosts(conns []BlockedConnection, dns *DNSLog, allowedHosts []string) []string {
+	rules := make([]AllowRule, 0, len(allowedHosts))
+	for _, entry := range allowedHosts {
+		if rule, err := ParseAllowRule(entry); err == nil {
+			rules = append(rules, rule)
+		}
+	}
+
+	seen := make(map[string]bool)
+	var suggestions []string
+
+	add := func(host string, port int) {
+		host = strings.TrimSuffix(host, ".")
+		if host == "" || hostAllowed(host, port, rules) {
+			return
+		}
+		entry := host
+		if port != 0 && hostAllowed(host, 0, rules) {
+			entry = AllowRule{Host: host, Port: port}.String()
+		}
+		if !seen[entry] {
+			seen[entry] = true
+			suggestions = append(suggestions, entry)
+		}
+	}
+
+	for _, c := range conns {
+		add(c.Hostname, c.DestPort)
+	}
+	if dns != nil {
+		for _, host := range dns.Refused {
+			add(host, 0)
+		}
+	}
+
+	return suggestions
+}
+
+// hostAllowed reports whether host is covered by a rule on port, honoring
+// "*.domain" wildcards. A port of 0 matches rules for any port.
+func hostAllowed(host string, port int, rules []AllowRule) bool {
+	for _, r := range rules {
+		if r.Matches(host, port) {
+			return true
+		}
+	}
+	return false
+}
@@ -18,6 +18,11 @@
 //  2. Generates nftables rules permitting only those destinations
 //  3. Blocks all other outbound traffic
 //
+// Allowlist entries may be hostnames, "*.domain" wildcards, IP addresses or
+// CIDRs, each optionally scoped to a port ("github.com:443",
+// "10.0.5.0/24:5432"). Port-scoped entries are emitted as concatenated
+// address . port nftables sets; see ParseAllowRule.
+//
 // Usage:
 //
 //	cfg := &network.Config{
@@ -27,6 +32,25 @@
 //	}
 //	nixConfig := network.GenerateNixNetworkConfig(cfg)
 //
+// Dropped packets are logged with BlockedLogPrefix and dnsmasq logs every
+// query. ParseBlockedLog and ParseDNSLog turn those logs into blocked
+// destinations with reverse-mapped hostnames, and SuggestAllowedHosts
+// proposes allowlist additions:
+//
+//	conns := network.ParseBlockedLog(kernelLog, containerIP)
+//	dns := network.ParseDNSLog(dnsmasqLog)
+//	network.AnnotateHostnames(conns, dns)
+//	hosts := network.SuggestAllowedHosts(conns, dns, allowedHosts)
+//
+// # Addressing
+//
+// AddressPlan carves per-sandbox subnets out of a base prefix (10.100.0.0/16
+// in /24s by default). Slot N's host-side address is the subnet's first
+// address and the container's the second:
+//
+//	plan, err := network.NewAddressPlan("172.30.0.0/16", 28, "fd42::/48")
+//	addrs, err := plan.Addresses(slot)
+//
 // # Host Resolution
 //
 // ResolveHosts resolves hostnames to IP addresses for firewall rules:
@@ -0,0 +1,145 @@
+package network
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Sandbox groups put several sandboxes on a shared private network. Each
+// member keeps its own host/container link; the host forwards traffic
+// between members of the same group and drops traffic between a member and
+// sandboxes outside its group. Traffic between ungrouped sandboxes is left
+// alone. Members resolve each other by sandbox name through a hosts file
+// that the host keeps up to date and bind-mounts into every member.
+const (
+	// GroupHostsDir is the directory inside a grouped sandbox holding the
+	// group's hosts file. The sandbox's dnsmasq watches it for changes.
+	GroupHostsDir = "/etc/forage-group"
+
+	// GroupHostsFile is the name of the hosts file within a group directory.
+	GroupHostsFile = "hosts"
+
+	// GroupTable is the host nftables table holding the inter-sandbox
+	// forwarding rules.
+	GroupTable = "forage_groups"
+)
+
+// GroupMember is a sandbox that belongs to a group.
+type GroupMember struct {
+	Name      string
+	Addresses Addresses
+}
+
+// GenerateGroupHosts renders the hosts file shared by a group's members,
+// mapping each member's container addresses to its sandbox name.
+func GenerateGroupHosts(members []GroupMember) string {
+	var b strings.Builder
+	b.WriteString("# Generated by forage-ctl; members of this sandbox group\n")
+	for _, m := range sortedMembers(members) {
+		fmt.Fprintf(&b, "%s %s\n", m.Addresses.ContainerIP, m.Name)
+		if m.Addresses.ContainerIPv6 != "" {
+			fmt.Fprintf(&b, "%s %s\n", m.Addresses.ContainerIPv6, m.Name)
+		}
+	}
+	return b.String()
+}
+
+// GenerateGroupForwardRules renders the host nftables ruleset for sandbox
+// groups. Traffic between members of the same group is accepted; traffic
+// between a group member and any other sandbox is dropped. sandboxes lists
+// the links of every sandbox on the host, grouped or not.
+//
+// The ruleset replaces any previous version of the table atomically when
+// loaded with "nft -f". Without groups it just removes the table.
+func GenerateGroupForwardRules(groups map[string][]GroupMember, sandboxes []Addresses) string {
+	var b strings.Builder
+	// Declaring the table first makes the delete succeed when it does not exist yet
+	fmt.Fprintf(&b, "table inet %s\ndelete table inet %s\n", GroupTable, GroupTable)
+
+	if len(groups) == 0 {
+		return b.String()
+	}
+
+	var subnets, subnets6 []string
+	for _, a := range sandboxes {
+		if a.Subnet != "" {
+			subnets = appendUnique(subnets, a.Subnet)
+		}
+		if a.SubnetIPv6 != "" {
+			subnets6 = appendUnique(subnets6, a.SubnetIPv6)
+		}
+	}
+
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var sets, rules strings.Builder
+	writeSet := func(name, typ string, elems []string, interval bool) {
+		fmt.Fprintf(&sets, "\tset %s {\n\t\ttype %s\n", name, typ)
+		if interval {
+			sets.WriteString("\t\tflags interval\n")
+		}
+		fmt.Fprintf(&sets, "\t\telements = { %s }\n\t}\n\n", strings.Join(elems, ", "))
+	}
+
+	// Group names may contain hyphens, so sets are numbered instead of named
+	var grouped, grouped6 []string
+	for i, name := range names {
+		var ips, ips6 []string
+		for _, m := range groups[name] {
+			if m.Addresses.ContainerIP != "" {
+				ips = appendUnique(ips, m.Addresses.ContainerIP)
+			}
+			if m.Addresses.ContainerIPv6 != "" {
+				ips6 = appendUnique(ips6, m.Addresses.ContainerIPv6)
+			}
+		}
+		fmt.Fprintf(&rules, "\t\t# group %s\n", name)
+		if len(ips) > 0 {
+			set := fmt.Sprintf("group_%d_ipv4", i)
+			writeSet(set, "ipv4_addr", ips, false)
+			fmt.Fprintf(&rules, "\t\tip saddr @%s ip daddr @%s accept\n", set, set)
+			grouped = append(grouped, ips...)
+		}
+		if len(ips6) > 0 {
+			set := fmt.Sprintf("group_%d_ipv6", i)
+			writeSet(set, "ipv6_addr", ips6, false)
+			fmt.Fprintf(&rules, "\t\tip6 saddr @%s ip6 daddr @%s accept\n", set, set)
+			grouped6 = append(grouped6, ips6...)
+		}
+	}
+
+	rules.WriteString("\n\t\t# Keep group members private from other sandboxes\n")
+	if len(grouped) > 0 && len(subnets) > 0 {
+		writeSet("grouped_ipv4", "ipv4_addr", grouped, false)
+		writeSet("sandbox_ipv4", "ipv4_addr", subnets, true)
+		rules.WriteString("\t\tip saddr @grouped_ipv4 ip daddr @sandbox_ipv4 drop\n")
+		rules.WriteString("\t\tip saddr @sandbox_ipv4 ip daddr @grouped_ipv4 drop\n")
+	}
+	if len(grouped6) > 0 && len(subnets6) > 0 {
+		writeSet("grouped_ipv6", "ipv6_addr", grouped6, false)
+		writeSet("sandbox_ipv6", "ipv6_addr", subnets6, true)
+		rules.WriteString("\t\tip6 saddr @grouped_ipv6 ip6 daddr @sandbox_ipv6 drop\n")
+		rules.WriteString("\t\tip6 saddr @sandbox_ipv6 ip6 daddr @grouped_ipv6 drop\n")
+	}
+
+	fmt.Fprintf(&b, "table inet %s {\n", GroupTable)
+	b.WriteString(sets.String())
+	b.WriteString("\tchain forward {\n")
+	// Run before the NixOS firewall and NAT forward chains
+	b.WriteString("\t\ttype filter hook forward priority filter - 10; policy accept;\n\n")
+	b.WriteString(rules.String())
+	b.WriteString("\t}\n}\n")
+	return b.String()
+}
+
+// sortedMembers returns members ordered by name.
+func sortedMembers(members []GroupMember) []GroupMember {
+	sorted := append([]GroupMember(nil), members...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+	return sorted
+}
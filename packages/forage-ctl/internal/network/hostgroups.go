@@ -0,0 +1,166 @@
+package network
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// HostGroupPrefix marks an allowlist entry as a reference to a named host
+// group (e.g. "@github") rather than a literal hostname.
+const HostGroupPrefix = "@"
+
+// BuiltinHostGroups are the host groups available on every host. Host
+// configuration may add groups or override these by name.
+var BuiltinHostGroups = map[string][]string{
+	"anthropic": {
+		"api.anthropic.com",
+		"statsig.anthropic.com",
+	},
+	"crates": {
+		"crates.io",
+		"index.crates.io",
+		"static.crates.io",
+	},
+	"github": {
+		"github.com",
+		"api.github.com",
+		"codeload.github.com",
+		"objects.githubusercontent.com",
+		"raw.githubusercontent.com",
+		"release-assets.githubusercontent.com",
+	},
+	"go": {
+		"proxy.golang.org",
+		"sum.golang.org",
+		"index.golang.org",
+	},
+	"nix": {
+		"cache.nixos.org",
+		"channels.nixos.org",
+	},
+	"npm": {
+		"registry.npmjs.org",
+		"registry.yarnpkg.com",
+	},
+	"pypi": {
+		"pypi.org",
+		"files.pythonhosted.org",
+	},
+}
+
+// hostGroupNameRegex validates host group names (without the prefix).
+var hostGroupNameRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// IsHostGroup reports whether an allowlist entry references a host group.
+func IsHostGroup(entry string) bool {
+	return strings.HasPrefix(entry, HostGroupPrefix)
+}
+
+// ValidateHostGroupRef checks the syntax of a host group reference such as
+// "@github". It does not check that the group exists.
+func ValidateHostGroupRef(entry string) error {
+	name := strings.TrimPrefix(entry, HostGroupPrefix)
+	if !IsHostGroup(entry) || !hostGroupNameRegex.MatchString(name) {
+		return fmt.Errorf("invalid host group %q: must be @ followed by lowercase letters, digits, underscores, or hyphens", entry)
+	}
+	return nil
+}
+
+// HostGroups merges the built-in host groups with custom groups from host
+// configuration. Custom groups replace built-in groups of the same name.
+func HostGroups(custom map[string][]string) map[string][]string {
+	groups := make(map[string][]string, len(BuiltinHostGroups)+len(custom))
+	for name, hosts := range BuiltinHostGroups {
+		groups[name] = hosts
+	}
+	for name, hosts := range custom {
+		groups[name] = hosts
+	}
+	return groups
+}
+
+// HostGroupNames returns the sorted names of all available host groups.
+func HostGroupNames(custom map[string][]string) []string {
+	groups := HostGroups(custom)
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ExpandAllowedHosts replaces host group references in entries with the
+// hosts they contain, using the built-in groups merged with custom. Groups
+// may reference other groups. The result preserves first-seen order and
+// contains no duplicates. Unknown groups, reference cycles and entries that
+// are not valid allow rules (see ParseAllowRule) are errors.
+func ExpandAllowedHosts(entries []string, custom map[string][]string) ([]string, error) {
+	groups := HostGroups(custom)
+	seen := make(map[string]bool)
+	var expanded []string
+
+	var expand func(entry string, stack []string) error
+	expand = func(entry string, stack []string) error {
+		if !IsHostGroup(entry) {
+			if _, err := ParseAllowRule(entry); err != nil {
+				return err
+			}
+			if !seen[entry] {
+				seen[entry] = true
+				expanded = append(expanded, entry)
+			}
+			return nil
+		}
+
+		if err := ValidateHostGroupRef(entry); err != nil {
+			return err
+		}
+		name := strings.TrimPrefix(entry, HostGroupPrefix)
+		for _, s := range stack {
+			if s == name {
+				return fmt.Errorf("host group cycle: %s", strings.Join(append(stack, name), " -> "))
+			}
+		}
+		hosts, ok := groups[name]
+		if !ok {
+			return fmt.Errorf("unknown host group %q (available: %s)", entry, strings.Join(HostGroupNames(custom), ", "))
+		}
+		next := append(append([]string{}, stack...), name)
+		for _, h := range hosts {
+			if err := expand(h, next); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, entry := range entries {
+		if err := expand(entry, nil); err != nil {
+			return nil, err
+		}
+	}
+	return expanded, nil
+}
+
+// DescribeAllowedHosts renders allowlist entries for display, spelling out
+// the hosts behind each group reference, e.g. "@pypi (pypi.org,
+// files.pythonhosted.org)". Unknown groups are shown as-is.
+func DescribeAllowedHosts(entries []string, custom map[string][]string) []string {
+	described := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if !IsHostGroup(entry) {
+			described = append(described, entry)
+			continue
+		}
+		hosts, err := ExpandAllowedHosts([]string{entry}, custom)
+		if err != nil {
+			described = append(described, entry)
+			continue
+		}
+		described = append(described, fmt.Sprintf("%s (%s)", entry, strings.Join(hosts, ", ")))
+	}
+	return described
+}
@@ -19,8 +19,73 @@ const (
 // Config holds network configuration for a sandbox
 type Config struct {
 	Mode         Mode
-	AllowedHosts []string
+	AllowedHosts []string // hostnames or host group references (e.g. "@github")
 	NetworkSlot  int
+	HostGroups   map[string][]string // custom host groups, merged with BuiltinHostGroups
+
+	// Addresses of the sandbox link. When unset, addresses are derived
+	// from NetworkSlot using DefaultAddressPlan.
+	Addresses Addresses
+
+	// Group is the sandbox group the sandbox belongs to, if any. Grouped
+	// sandboxes resolve peer names from GroupHostsDir and may reach
+	// GroupNetworks, the prefixes peer sandboxes are addressed from.
+	Group         string
+	GroupNetworks []string
+
+	// OpenTCPPorts are the ports, besides SSH, the container firewall lets
+	// the host reach in full mode, such as those of HTTP health probes.
+	OpenTCPPorts []int
+}
+
+// nixTCPPorts renders the ports the container firewall accepts: SSH and
+// OpenTCPPorts.
+func (c *Config) nixTCPPorts() string {
+	ports := []string{"22"}
+	for _, port := range c.OpenTCPPorts {
+		if port != 22 {
+			ports = append(ports, fmt.Sprint(port))
+		}
+	}
+	return strings.Join(ports, " ")
+}
+
+// addresses returns the sandbox link addresses.
+func (c *Config) addresses() Addresses {
+	if c.Addresses.HostIP != "" {
+		return c.Addresses
+	}
+	a, _ := DefaultAddressPlan().Addresses(c.NetworkSlot)
+	return a
+}
+
+// expandedHosts returns AllowedHosts with host group references expanded.
+// Entries that fail to expand (unknown groups, cycles, invalid syntax) are
+// dropped; callers that need to report them should validate with
+// ExpandAllowedHosts first.
+func (c *Config) expandedHosts() []string {
+	seen := make(map[string]bool)
+	var hosts []string
+	for _, entry := range c.AllowedHosts {
+		expanded, err := ExpandAllowedHosts([]string{entry}, c.HostGroups)
+		if err != nil {
+			continue
+		}
+		for _, h := range expanded {
+			if !seen[h] {
+				seen[h] = true
+				hosts = append(hosts, h)
+			}
+		}
+	}
+	return hosts
+}
+
+// allowRules returns the parsed rules for the expanded allowlist.
+func (c *Config) allowRules() []AllowRule {
+	// expandedHosts only returns entries that parse
+	rules, _ := ParseAllowRules(c.expandedHosts())
+	return rules
 }
 
 // ResolvedHost contains a hostname and its resolved IPs
@@ -66,59 +131,50 @@ func ResolveHosts(hosts []string) ([]ResolvedHost, error) {
 	return resolved, nil
 }
 
-// GenerateNftablesRules generates nftables rules for restricted mode
+// GenerateNftablesRules generates nftables rules for restricted mode.
+// Rules without a port populate the allowed_ipv4/allowed_ipv6 address sets;
+// port-scoped rules populate concatenated address . port sets matched
+// against the TCP/UDP destination port.
 func GenerateNftablesRules(cfg *Config) string {
-	if cfg.Mode != ModeRestricted || len(cfg.AllowedHosts) == 0 {
+	rules := cfg.allowRules()
+	if cfg.Mode != ModeRestricted || len(rules) == 0 {
 		return ""
 	}
 
-	// Resolve hosts to IPs
-	resolved, _ := ResolveHosts(cfg.AllowedHosts)
-
-	// Build IP sets
-	var ipv4Addrs []string
-	var ipv6Addrs []string
-
-	for _, h := range resolved {
-		for _, ip := range h.IPs {
-			parsed := net.ParseIP(ip)
-			if parsed == nil {
-				continue
-			}
-			if parsed.To4() != nil {
-				ipv4Addrs = append(ipv4Addrs, ip)
-			} else {
-				ipv6Addrs = append(ipv6Addrs, ip)
-			}
-		}
-	}
+	elems := resolveRules(rules)
 
-	gatewayIP := fmt.Sprintf("10.100.%d.1", cfg.NetworkSlot)
-	ipv4Set := append([]string{gatewayIP}, ipv4Addrs...)
+	gatewayIP := cfg.addresses().HostIP
+	ipv4Set := append([]string{gatewayIP}, elems.ipv4...)
 	ipv4Set = append(ipv4Set, "127.0.0.1")
 
 	ipv6Set := []string{"::1"}
-	ipv6Set = append(ipv6Set, ipv6Addrs...)
+	if gatewayIPv6 := cfg.addresses().HostIPv6; gatewayIPv6 != "" {
+		ipv6Set = append(ipv6Set, gatewayIPv6)
+	}
+	ipv6Set = append(ipv6Set, elems.ipv6...)
 
 	var buf strings.Builder
 	_ = nftablesTmpl.Execute(&buf, nftablesData{
 		IPv4Addrs: strings.Join(ipv4Set, ", "),
 		IPv6Addrs: strings.Join(ipv6Set, ", "),
+		IPv4Ports: strings.Join(elems.ipv4Ports, ", "),
+		IPv6Ports: strings.Join(elems.ipv6Ports, ", "),
 	})
 	return buf.String()
 }
 
-// GenerateDnsmasqConfig generates dnsmasq configuration for DNS filtering
+// GenerateDnsmasqConfig generates dnsmasq configuration for DNS filtering.
+// Ports are ignored and address entries need no DNS forwarding.
 func GenerateDnsmasqConfig(allowedHosts []string) string {
 	var serverLines strings.Builder
-	for _, host := range allowedHosts {
-		if strings.HasPrefix(host, "*.") {
-			domain := strings.TrimPrefix(host, "*.")
+	for _, entry := range allowedHosts {
+		rule, err := ParseAllowRule(entry)
+		if err != nil {
+			continue
+		}
+		if domain := rule.Domain(); domain != "" {
 			fmt.Fprintf(&serverLines, "server=/%s/1.1.1.1\n", domain)
 			fmt.Fprintf(&serverLines, "server=/%s/8.8.8.8\n", domain)
-		} else {
-			fmt.Fprintf(&serverLines, "server=/%s/1.1.1.1\n", host)
-			fmt.Fprintf(&serverLines, "server=/%s/8.8.8.8\n", host)
 		}
 	}
 
@@ -137,7 +193,7 @@ func GenerateNixNetworkConfig(cfg *Config) string {
 	case ModeRestricted:
 		return generateRestrictedConfig(cfg)
 	default: // ModeFull
-		return generateFullConfig(cfg.NetworkSlot)
+		return generateFullConfig(cfg)
 	}
 }
 
@@ -168,6 +224,7 @@ func generateNoneConfig() string {
                 ct state established,related accept
 
                 # Reject everything else
+                meta nfproto ipv6 reject with icmpv6 type admin-prohibited
                 reject with icmp type admin-prohibited
               }
             }
@@ -179,48 +236,41 @@ func generateNoneConfig() string {
 }
 
 func generateRestrictedConfig(cfg *Config) string {
-	if len(cfg.AllowedHosts) == 0 {
+	rules := cfg.allowRules()
+	if len(rules) == 0 && cfg.Group == "" {
 		return generateNoneConfig()
 	}
 
-	// Build the list of allowed hosts for nftables
-	var allowedIPv4 []string
-	var allowedIPv6 []string
-
 	// Always allow gateway
-	gatewayIP := fmt.Sprintf("10.100.%d.1", cfg.NetworkSlot)
-	allowedIPv4 = append(allowedIPv4, gatewayIP, "127.0.0.1")
-	allowedIPv6 = append(allowedIPv6, "::1")
-
-	// Resolve hosts
-	resolved, _ := ResolveHosts(cfg.AllowedHosts)
-	for _, h := range resolved {
-		for _, ip := range h.IPs {
-			parsed := net.ParseIP(ip)
-			if parsed == nil {
-				continue
-			}
-			if parsed.To4() != nil {
-				allowedIPv4 = append(allowedIPv4, ip)
+	addrs := cfg.addresses()
+	gatewayIP := addrs.HostIP
+	elems := resolveRules(rules)
+	allowedIPv4 := append([]string{gatewayIP, "127.0.0.1"}, elems.ipv4...)
+	allowedIPv6 := []string{"::1"}
+	if addrs.HostIPv6 != "" {
+		allowedIPv6 = append(allowedIPv6, addrs.HostIPv6)
+	}
+	allowedIPv6 = append(allowedIPv6, elems.ipv6...)
+
+	// Group peers; the host only forwards traffic between members
+	if cfg.Group != "" {
+		for _, prefix := range cfg.GroupNetworks {
+			if isIPv6Address(prefix) {
+				allowedIPv6 = appendUnique(allowedIPv6, prefix)
 			} else {
-				allowedIPv6 = append(allowedIPv6, ip)
+				allowedIPv4 = appendUnique(allowedIPv4, prefix)
 			}
 		}
 	}
 
 	// Build dnsmasq server lines
 	var dnsServers []string
-	for _, host := range cfg.AllowedHosts {
-		if strings.HasPrefix(host, "*.") {
-			domain := strings.TrimPrefix(host, "*.")
-			dnsServers = append(dnsServers, fmt.Sprintf("server=/%s/1.1.1.1", domain))
-		} else {
-			dnsServers = append(dnsServers, fmt.Sprintf("server=/%s/1.1.1.1", host))
-		}
+	for _, domain := range dnsDomains(rules) {
+		dnsServers = append(dnsServers, fmt.Sprintf("server=/%s/1.1.1.1", domain))
 	}
 
 	return fmt.Sprintf(`# Restricted network - only allowed hosts
-        networking.defaultGateway = "%s";
+        networking.defaultGateway = "%s";%s
         networking.nameservers = [ "127.0.0.1" ]; # Use local DNS filter
 
         # DNS filtering with dnsmasq
@@ -241,10 +291,13 @@ func generateRestrictedConfig(cfg *Config) string {
 
             # Block all other queries
             address = "/#/";
-
+%s
             # Cache settings
             cache-size = 1000;
 
+            # Log queries so blocked lookups can be mapped back to hostnames
+            log-queries = true;
+
             # Security
             domain-needed = true;
             bogus-priv = true;
@@ -267,7 +320,7 @@ func generateRestrictedConfig(cfg *Config) string {
                 flags interval
                 elements = { %s }
               }
-
+%s
               chain input {
                 type filter hook input priority 0; policy accept;
               }
@@ -296,8 +349,10 @@ func generateRestrictedConfig(cfg *Config) string {
                 # Allow connections to allowed hosts
                 ip daddr @allowed_ipv4 accept
                 ip6 daddr @allowed_ipv6 accept
-
-                # Reject everything else
+%s
+                # Log and reject everything else
+                log prefix "%s" level info
+                meta nfproto ipv6 reject with icmpv6 type admin-prohibited
                 reject with icmp type admin-prohibited
               }
             }
@@ -307,20 +362,147 @@ func generateRestrictedConfig(cfg *Config) string {
         # Disable iptables (using nftables instead)
         networking.firewall.enable = false;`,
 		gatewayIP,
+		nixGateway6(addrs),
 		formatNixList(dnsServers),
+		nixGroupHostsDir(cfg),
 		strings.Join(allowedIPv4, ", "),
 		strings.Join(allowedIPv6, ", "),
+		nixPortSets(elems),
+		nixPortRules(elems),
+		BlockedLogPrefix,
 	)
 }
 
-func generateFullConfig(slot int) string {
-	return fmt.Sprintf(`# Full network access
-        networking.defaultGateway = "10.100.%d.1";
+// nixPortSets renders the concatenated address . port sets for port-scoped
+// rules, indented for the restricted-mode ruleset. Empty sets are omitted.
+func nixPortSets(elems nftElements) string {
+	var b strings.Builder
+	if len(elems.ipv4Ports) > 0 {
+		fmt.Fprintf(&b, `
+              set allowed_ipv4_ports {
+                type ipv4_addr . inet_service
+                flags interval
+                elements = { %s }
+              }
+`, strings.Join(elems.ipv4Ports, ", "))
+	}
+	if len(elems.ipv6Ports) > 0 {
+		fmt.Fprintf(&b, `
+              set allowed_ipv6_ports {
+                type ipv6_addr . inet_service
+                flags interval
+                elements = { %s }
+              }
+`, strings.Join(elems.ipv6Ports, ", "))
+	}
+	return b.String()
+}
+
+// nixPortRules renders the accept rules matching nixPortSets.
+func nixPortRules(elems nftElements) string {
+	var b strings.Builder
+	if len(elems.ipv4Ports) > 0 {
+		b.WriteString(`
+                # Allow port-scoped IPv4 destinations
+                meta l4proto { tcp, udp } ip daddr . th dport @allowed_ipv4_ports accept
+`)
+	}
+	if len(elems.ipv6Ports) > 0 {
+		b.WriteString(`
+                # Allow port-scoped IPv6 destinations
+                meta l4proto { tcp, udp } ip6 daddr . th dport @allowed_ipv6_ports accept
+`)
+	}
+	return b.String()
+}
+
+func generateFullConfig(cfg *Config) string {
+	addrs := cfg.addresses()
+	if cfg.Group != "" {
+		return generateFullGroupConfig(cfg, addrs)
+	}
+
+	if addrs.HostIPv6 == "" {
+		return fmt.Sprintf(`# Full network access
+        networking.defaultGateway = "%s";
         networking.nameservers = [
           "1.1.1.1"
           "8.8.8.8"
         ];
-        networking.firewall.allowedTCPPorts = [ 22 ];`, slot)
+        networking.firewall.allowedTCPPorts = [ %s ];`, addrs.HostIP, cfg.nixTCPPorts())
+	}
+
+	return fmt.Sprintf(`# Full network access (dual-stack)
+        networking.defaultGateway = "%s";%s
+        networking.nameservers = [
+          "1.1.1.1"
+          "8.8.8.8"
+          "2606:4700:4700::1111"
+          "2001:4860:4860::8888"
+        ];
+        networking.firewall.allowedTCPPorts = [ %s ];`, addrs.HostIP, nixGateway6(addrs), cfg.nixTCPPorts())
+}
+
+// generateFullGroupConfig is full network access for a grouped sandbox. A
+// local dnsmasq answers peer names from the group hosts file and forwards
+// everything else upstream. The container firewall trusts its link because
+// the host only forwards peer traffic from members of the same group.
+func generateFullGroupConfig(cfg *Config, addrs Addresses) string {
+	upstream := []string{"1.1.1.1", "8.8.8.8"}
+	if addrs.HostIPv6 != "" {
+		upstream = append(upstream, "2606:4700:4700::1111", "2001:4860:4860::8888")
+	}
+
+	return fmt.Sprintf(`# Full network access (sandbox group %s)
+        networking.defaultGateway = "%s";%s
+        networking.nameservers = [ "127.0.0.1" ]; # Local resolver for group peers
+
+        services.dnsmasq = {
+          enable = true;
+          settings = {
+            no-resolv = true;
+            listen-address = "127.0.0.1";
+            bind-interfaces = true;
+            server = [
+              %s
+            ];
+%s            cache-size = 1000;
+            domain-needed = true;
+          };
+        };
+
+        networking.firewall.allowedTCPPorts = [ %s ];
+        networking.firewall.trustedInterfaces = [ "eth0" ];`,
+		cfg.Group,
+		addrs.HostIP,
+		nixGateway6(addrs),
+		formatNixList(upstream),
+		nixGroupHostsDir(cfg),
+		cfg.nixTCPPorts(),
+	)
+}
+
+// nixGroupHostsDir renders the dnsmasq hostsdir setting that serves group
+// peer names, or nothing for sandboxes outside a group.
+func nixGroupHostsDir(cfg *Config) string {
+	if cfg.Group == "" {
+		return ""
+	}
+	return fmt.Sprintf(`
+            # Resolve sandbox group peers by name
+            hostsdir = "%s";
+`, GroupHostsDir)
+}
+
+// nixGateway6 renders the IPv6 default gateway setting, or nothing when the
+// sandbox has no IPv6 address. The leading newline lets callers append it
+// directly after the IPv4 gateway line.
+func nixGateway6(addrs Addresses) string {
+	if addrs.HostIPv6 == "" {
+		return ""
+	}
+	return fmt.Sprintf(`
+        networking.defaultGateway6 = "%s";`, addrs.HostIPv6)
 }
 
 func formatNixList(items []string) string {
@@ -3,6 +3,7 @@ package network
 import (
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestResolveHosts(t *testing.T) {
@@ -245,3 +246,583 @@ func TestMode_String(t *testing.T) {
 		}
 	}
 }
+
+func TestGenerateNixNetworkConfig_RestrictedLogsBlocked(t *testing.T) {
+	cfg := &Config{
+		Mode:         ModeRestricted,
+		AllowedHosts: []string{"github.com"},
+		NetworkSlot:  4,
+	}
+
+	config := GenerateNixNetworkConfig(cfg)
+
+	for _, expected := range []string{
+		`log prefix "forage-blocked: " level info`,
+		"log-queries = true",
+	} {
+		if !strings.Contains(config, expected) {
+			t.Errorf("expected config to contain %q", expected)
+		}
+	}
+}
+
+func TestParseBlockedLog(t *testing.T) {
+	output := `2026-10-18T10:00:00+0000 host kernel: forage-blocked: IN= OUT=eth0 SRC=10.100.4.2 DST=140.82.112.3 LEN=60 TOS=0x00 PREC=0x00 TTL=64 ID=1 DF PROTO=TCP SPT=40000 DPT=443 WINDOW=64240 RES=0x00 SYN URGP=0
+2026-10-18T10:00:05+0000 host kernel: forage-blocked: IN= OUT=eth0 SRC=10.100.4.2 DST=140.82.112.3 LEN=60 TOS=0x00 PREC=0x00 TTL=64 ID=2 DF PROTO=TCP SPT=40002 DPT=443 WINDOW=64240 RES=0x00 SYN URGP=0
+2026-10-18T10:00:06+0000 host kernel: forage-blocked: IN= OUT=eth0 SRC=10.100.4.2 DST=9.9.9.9 LEN=60 PROTO=UDP SPT=5000 DPT=123 LEN=40
+2026-10-18T10:00:07+0000 host kernel: forage-blocked: IN= OUT=eth0 SRC=10.100.9.2 DST=1.2.3.4 LEN=60 PROTO=TCP SPT=5000 DPT=80
+2026-10-18T10:00:08+0000 host kernel: unrelated message
+`
+
+	conns := ParseBlockedLog(output, "10.100.4.2")
+	if len(conns) != 2 {
+		t.Fatalf("expected 2 blocked destinations, got %d: %+v", len(conns), conns)
+	}
+
+	first := conns[0]
+	if first.DestIP != "140.82.112.3" || first.DestPort != 443 || first.Protocol != "TCP" {
+		t.Errorf("unexpected first entry: %+v", first)
+	}
+	if first.Count != 2 {
+		t.Errorf("expected count 2, got %d", first.Count)
+	}
+	want := time.Date(2026, 10, 18, 10, 0, 5, 0, time.UTC)
+	if !first.LastSeen.Equal(want) {
+		t.Errorf("expected last seen %v, got %v", want, first.LastSeen)
+	}
+
+	if conns[1].DestIP != "9.9.9.9" || conns[1].Protocol != "UDP" || conns[1].DestPort != 123 {
+		t.Errorf("unexpected second entry: %+v", conns[1])
+	}
+
+	if all := ParseBlockedLog(output, ""); len(all) != 3 {
+		t.Errorf("expected 3 destinations without source filter, got %d", len(all))
+	}
+}
+
+func TestParseDNSLog(t *testing.T) {
+	output := `query[A] objects.githubusercontent.com from 127.0.0.1
+forwarded objects.githubusercontent.com to 1.1.1.1
+reply objects.githubusercontent.com is 185.199.108.133
+dnsmasq[42]: cached github.com is 140.82.112.3
+config pypi.org is NXDOMAIN
+config pypi.org is NXDOMAIN
+reply cdn.example.com is <CNAME>
+`
+
+	dns := ParseDNSLog(output)
+
+	if got := dns.Hosts["185.199.108.133"]; got != "objects.githubusercontent.com" {
+		t.Errorf("expected reply mapping, got %q", got)
+	}
+	if got := dns.Hosts["140.82.112.3"]; got != "github.com" {
+		t.Errorf("expected cached mapping, got %q", got)
+	}
+	if len(dns.Hosts) != 2 {
+		t.Errorf("expected 2 host mappings, got %d", len(dns.Hosts))
+	}
+	if len(dns.Refused) != 1 || dns.Refused[0] != "pypi.org" {
+		t.Errorf("expected refused [pypi.org], got %v", dns.Refused)
+	}
+}
+
+func TestSuggestAllowedHosts(t *testing.T) {
+	conns := []BlockedConnection{
+		{DestIP: "185.199.108.133", DestPort: 443, Protocol: "TCP"},
+		{DestIP: "140.82.112.3", DestPort: 443, Protocol: "TCP"},
+		{DestIP: "9.9.9.9", DestPort: 53, Protocol: "UDP"},
+	}
+	dns := &DNSLog{
+		Hosts: map[string]string{
+			"185.199.108.133": "objects.githubusercontent.com",
+			"140.82.112.3":    "api.github.com",
+		},
+		Refused: []string{"pypi.org", "files.pythonhosted.org"},
+	}
+
+	AnnotateHostnames(conns, dns)
+	if conns[0].Hostname != "objects.githubusercontent.com" {
+		t.Errorf("expected hostname to be annotated, got %q", conns[0].Hostname)
+	}
+	if conns[2].Hostname != "" {
+		t.Errorf("expected unknown hostname for unmapped IP, got %q", conns[2].Hostname)
+	}
+
+	got := SuggestAllowedHosts(conns, dns, []string{"*.github.com", "files.pythonhosted.org"})
+	want := []string{"objects.githubusercontent.com", "pypi.org"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("expected suggestions %v, got %v", want, got)
+	}
+}
+
+func TestExpandAllowedHosts(t *testing.T) {
+	custom := map[string][]string{
+		"internal": {"git.corp.example", "@pypi"},
+		"github":   {"github.example"}, // overrides built-in
+	}
+
+	got, err := ExpandAllowedHosts([]string{"@internal", "pypi.org", "@github", "api.example.com"}, custom)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{"git.corp.example", "pypi.org", "files.pythonhosted.org", "github.example", "api.example.com"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestExpandAllowedHosts_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []string
+		custom  map[string][]string
+		wantErr string
+	}{
+		{"unknown group", []string{"@nope"}, nil, "unknown host group"},
+		{"invalid name", []string{"@Bad Name"}, nil, "invalid host group"},
+		{"cycle", []string{"@a"}, map[string][]string{"a": {"@b"}, "b": {"@a"}}, "cycle"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ExpandAllowedHosts(tt.entries, tt.custom)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestDescribeAllowedHosts(t *testing.T) {
+	got := DescribeAllowedHosts([]string{"@pypi", "example.com", "@missing"}, nil)
+	want := []string{"@pypi (pypi.org, files.pythonhosted.org)", "example.com", "@missing"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestGenerateNixNetworkConfig_RestrictedHostGroups(t *testing.T) {
+	cfg := &Config{
+		Mode:         ModeRestricted,
+		AllowedHosts: []string{"@pypi", "@internal"},
+		NetworkSlot:  4,
+		HostGroups:   map[string][]string{"internal": {"registry.corp.example"}},
+	}
+
+	config := GenerateNixNetworkConfig(cfg)
+
+	for _, expected := range []string{
+		"server=/pypi.org/",
+		"server=/files.pythonhosted.org/",
+		"server=/registry.corp.example/",
+	} {
+		if !strings.Contains(config, expected) {
+			t.Errorf("expected config to contain %q", expected)
+		}
+	}
+	if strings.Contains(config, "@pypi") {
+		t.Error("host group reference should be expanded, not emitted")
+	}
+}
+
+func TestParseAllowRule(t *testing.T) {
+	tests := []struct {
+		entry   string
+		want    AllowRule
+		wantErr bool
+	}{
+		{entry: "github.com", want: AllowRule{Host: "github.com"}},
+		{entry: "*.example.com", want: AllowRule{Host: "*.example.com"}},
+		{entry: "github.com:443", want: AllowRule{Host: "github.com", Port: 443}},
+		{entry: "registry.internal:5000", want: AllowRule{Host: "registry.internal", Port: 5000}},
+		{entry: "10.0.5.7", want: AllowRule{Host: "10.0.5.7"}},
+		{entry: "10.0.5.0/24:5432", want: AllowRule{Host: "10.0.5.0/24", Port: 5432}},
+		{entry: "fd00::1", want: AllowRule{Host: "fd00::1"}},
+		{entry: "[fd00::/64]:5432", want: AllowRule{Host: "fd00::/64", Port: 5432}},
+		{entry: "[fd00::1]", want: AllowRule{Host: "fd00::1"}},
+		{entry: "", wantErr: true},
+		{entry: "@github", wantErr: true},
+		{entry: "github.com:0", wantErr: true},
+		{entry: "github.com:65536", wantErr: true},
+		{entry: "github.com:https", wantErr: true},
+		{entry: "github.com:", wantErr: true},
+		{entry: "bad host", wantErr: true},
+		{entry: "fd00::1:443x", wantErr: true},
+		{entry: "[github.com]:443", wantErr: true},
+		{entry: "[fd00::1", wantErr: true},
+		{entry: "[fd00::1]443", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.entry, func(t *testing.T) {
+			got, err := ParseAllowRule(tt.entry)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+			if got.String() != tt.entry && tt.entry != "[fd00::1]" {
+				t.Errorf("String() = %q, want %q", got.String(), tt.entry)
+			}
+		})
+	}
+}
+
+func TestExpandAllowedHosts_InvalidRule(t *testing.T) {
+	if _, err := ExpandAllowedHosts([]string{"github.com:99999"}, nil); err == nil {
+		t.Error("expected error for invalid port")
+	}
+	custom := map[string][]string{"db": {"10.0.5.0/24:5432", "not a host"}}
+	if _, err := ExpandAllowedHosts([]string{"@db"}, custom); err == nil {
+		t.Error("expected error for invalid entry inside host group")
+	}
+}
+
+func TestGenerateNftablesRules_PortRules(t *testing.T) {
+	cfg := &Config{
+		Mode:         ModeRestricted,
+		AllowedHosts: []string{"10.0.5.0/24:5432", "192.0.2.10", "[fd00::/64]:5432"},
+		NetworkSlot:  5,
+	}
+
+	rules := GenerateNftablesRules(cfg)
+
+	expected := []string{
+		"set allowed_ipv4_ports",
+		"type ipv4_addr . inet_service",
+		"elements = { 10.0.5.0/24 . 5432 }",
+		"set allowed_ipv6_ports",
+		"elements = { fd00::/64 . 5432 }",
+		"ip daddr . th dport @allowed_ipv4_ports accept",
+		"ip6 daddr . th dport @allowed_ipv6_ports accept",
+		"10.100.5.1, 192.0.2.10, 127.0.0.1",
+	}
+	for _, s := range expected {
+		if !strings.Contains(rules, s) {
+			t.Errorf("expected rules to contain %q\nGot:\n%s", s, rules)
+		}
+	}
+	if strings.Contains(rules, "10.0.5.0/24, ") {
+		t.Error("port-scoped CIDR should not be in the all-ports set")
+	}
+}
+
+func TestGenerateNftablesRules_NoPortRules(t *testing.T) {
+	cfg := &Config{
+		Mode:         ModeRestricted,
+		AllowedHosts: []string{"192.0.2.10"},
+		NetworkSlot:  5,
+	}
+
+	rules := GenerateNftablesRules(cfg)
+	if strings.Contains(rules, "_ports") {
+		t.Errorf("expected no port sets without port-scoped rules\nGot:\n%s", rules)
+	}
+}
+
+func TestGenerateNixNetworkConfig_RestrictedPortRules(t *testing.T) {
+	cfg := &Config{
+		Mode:         ModeRestricted,
+		AllowedHosts: []string{"10.0.5.0/24:5432", "registry.internal:5000"},
+		NetworkSlot:  3,
+	}
+
+	config := GenerateNixNetworkConfig(cfg)
+
+	expected := []string{
+		"set allowed_ipv4_ports",
+		"elements = { 10.0.5.0/24 . 5432 }",
+		"meta l4proto { tcp, udp } ip daddr . th dport @allowed_ipv4_ports accept",
+		`"server=/registry.internal/1.1.1.1"`,
+	}
+	for _, s := range expected {
+		if !strings.Contains(config, s) {
+			t.Errorf("expected config to contain %q\nGot:\n%s", s, config)
+		}
+	}
+	if strings.Contains(config, "server=/10.0.5.0") {
+		t.Error("address rules should not get DNS forwarding")
+	}
+	if strings.Contains(config, "allowed_ipv6_ports") {
+		t.Error("expected no IPv6 port set without IPv6 port rules")
+	}
+}
+
+func TestGenerateDnsmasqConfig_PortRules(t *testing.T) {
+	config := GenerateDnsmasqConfig([]string{"github.com:443", "10.0.5.0/24:5432"})
+
+	if !strings.Contains(config, "server=/github.com/1.1.1.1") {
+		t.Error("expected port to be stripped from DNS forwarding")
+	}
+	if strings.Contains(config, "5432") || strings.Contains(config, ":443") {
+		t.Errorf("expected no ports or addresses in dnsmasq config\nGot:\n%s", config)
+	}
+}
+
+func TestSuggestAllowedHosts_PortScoped(t *testing.T) {
+	conns := []BlockedConnection{
+		{DestIP: "140.82.112.3", DestPort: 22, Protocol: "TCP", Hostname: "github.com"},
+		{DestIP: "140.82.112.3", DestPort: 443, Protocol: "TCP", Hostname: "github.com"},
+	}
+
+	got := SuggestAllowedHosts(conns, nil, []string{"github.com:443"})
+	want := []string{"github.com:22"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("expected suggestions %v, got %v", want, got)
+	}
+}
+
+func TestDefaultAddressPlan(t *testing.T) {
+	plan := DefaultAddressPlan()
+	if plan.MaxSlot() != 254 {
+		t.Errorf("MaxSlot() = %d, want 254", plan.MaxSlot())
+	}
+	if plan.HasIPv6() {
+		t.Error("default plan should not assign IPv6")
+	}
+
+	a, err := plan.Addresses(42)
+	if err != nil {
+		t.Fatalf("Addresses failed: %v", err)
+	}
+	want := Addresses{Subnet: "10.100.42.0/24", HostIP: "10.100.42.1", ContainerIP: "10.100.42.2"}
+	if a != want {
+		t.Errorf("Addresses(42) = %+v, want %+v", a, want)
+	}
+
+	for _, slot := range []int{0, 255} {
+		if _, err := plan.Addresses(slot); err == nil {
+			t.Errorf("Addresses(%d) expected error", slot)
+		}
+	}
+}
+
+func TestNewAddressPlan_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		base    string
+		length  int
+		ipv6ULA string
+	}{
+		{"not a prefix", "10.100.0.0", 24, ""},
+		{"ipv6 base", "fd00::/48", 64, ""},
+		{"host bits set", "10.100.1.0/16", 24, ""},
+		{"subnet too small", "10.100.0.0/16", 31, ""},
+		{"subnet not longer than base", "10.100.0.0/24", 24, ""},
+		{"ula not ipv6", "10.100.0.0/16", 24, "10.0.0.0/8"},
+		{"ula outside fc00::/7", "10.100.0.0/16", 24, "2001:db8::/48"},
+		{"ula too long", "10.0.0.0/8", 30, "fd00::/48"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewAddressPlan(tt.base, tt.length, tt.ipv6ULA); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestAddressesForSubnets(t *testing.T) {
+	a, err := AddressesForSubnets("192.168.64.16/28", "fd42:0:0:10::/64")
+	if err != nil {
+		t.Fatalf("AddressesForSubnets failed: %v", err)
+	}
+	if a.HostIP != "192.168.64.17" || a.ContainerIP != "192.168.64.18" {
+		t.Errorf("unexpected IPv4 addresses: %+v", a)
+	}
+	if a.HostIPv6 != "fd42:0:0:10::1" || a.ContainerIPv6 != "fd42:0:0:10::2" {
+		t.Errorf("unexpected IPv6 addresses: %+v", a)
+	}
+
+	if _, err := AddressesForSubnets("not-a-subnet", ""); err == nil {
+		t.Error("expected error for invalid subnet")
+	}
+}
+
+func TestGenerateNixNetworkConfig_CustomAddresses(t *testing.T) {
+	addrs, _ := AddressesForSubnets("172.30.0.32/28", "")
+	for _, mode := range []Mode{ModeFull, ModeRestricted} {
+		cfg := &Config{
+			Mode:         mode,
+			AllowedHosts: []string{"192.0.2.10"},
+			NetworkSlot:  2,
+			Addresses:    addrs,
+		}
+		config := GenerateNixNetworkConfig(cfg)
+		if !strings.Contains(config, `networking.defaultGateway = "172.30.0.33"`) {
+			t.Errorf("%s: expected custom gateway\nGot:\n%s", mode, config)
+		}
+		if strings.Contains(config, "10.100.") {
+			t.Errorf("%s: expected no default-plan addresses", mode)
+		}
+	}
+}
+
+func TestParseBlockedLog_DualStack(t *testing.T) {
+	output := `2026-10-18T10:00:00+0000 host kernel: forage-blocked: IN= OUT=eth0 SRC=10.100.4.2 DST=140.82.112.3 LEN=60 PROTO=TCP SPT=40000 DPT=443
+2026-10-18T10:00:01+0000 host kernel: forage-blocked: IN= OUT=eth0 SRC=fd42:0000:0000:0004:0000:0000:0000:0002 DST=2606:50c0:8000:0000:0000:0000:0000:0154 LEN=80 TC=0 HOPLIMIT=64 FLOWLBL=0 PROTO=TCP SPT=40001 DPT=443
+2026-10-18T10:00:02+0000 host kernel: forage-blocked: IN= OUT=eth0 SRC=fd42:0000:0000:0009:0000:0000:0000:0002 DST=2606:50c0:8000:0000:0000:0000:0000:0155 LEN=80 PROTO=TCP SPT=40001 DPT=443
+`
+	dns := ParseDNSLog("dnsmasq[7]: reply objects.githubusercontent.com is 2606:50c0:8000::154\n")
+
+	conns := ParseBlockedLog(output, "10.100.4.2", "fd42:0:0:4::2")
+	AnnotateHostnames(conns, dns)
+	if len(conns) != 2 {
+		t.Fatalf("expected 2 blocked destinations, got %d: %+v", len(conns), conns)
+	}
+	if conns[1].DestIP != "2606:50c0:8000::154" {
+		t.Errorf("expected canonical IPv6 destination, got %q", conns[1].DestIP)
+	}
+	if conns[1].Hostname != "objects.githubusercontent.com" {
+		t.Errorf("expected IPv6 destination to be annotated, got %q", conns[1].Hostname)
+	}
+}
+
+func TestGenerateNixNetworkConfig_DualStack(t *testing.T) {
+	addrs, _ := AddressesForSubnets("10.100.3.0/24", "fd42:0:0:3::/64")
+
+	full := GenerateNixNetworkConfig(&Config{Mode: ModeFull, NetworkSlot: 3, Addresses: addrs})
+	for _, s := range []string{
+		`networking.defaultGateway = "10.100.3.1";`,
+		`networking.defaultGateway6 = "fd42:0:0:3::1";`,
+		`"2606:4700:4700::1111"`,
+	} {
+		if !strings.Contains(full, s) {
+			t.Errorf("full config should contain %q\nGot:\n%s", s, full)
+		}
+	}
+
+	restricted := GenerateNixNetworkConfig(&Config{
+		Mode:         ModeRestricted,
+		AllowedHosts: []string{"2001:db8::10", "[2001:db8:1::/48]:5432"},
+		NetworkSlot:  3,
+		Addresses:    addrs,
+	})
+	for _, s := range []string{
+		`networking.defaultGateway6 = "fd42:0:0:3::1";`,
+		"elements = { ::1, fd42:0:0:3::1, 2001:db8::10 }",
+		"elements = { 2001:db8:1::/48 . 5432 }",
+		"meta nfproto ipv6 reject with icmpv6 type admin-prohibited",
+	} {
+		if !strings.Contains(restricted, s) {
+			t.Errorf("restricted config should contain %q\nGot:\n%s", s, restricted)
+		}
+	}
+}
+
+func TestGenerateNixNetworkConfig_IPv4Only(t *testing.T) {
+	config := GenerateNixNetworkConfig(&Config{Mode: ModeFull, NetworkSlot: 3})
+	if strings.Contains(config, "defaultGateway6") || strings.Contains(config, "2606:4700") {
+		t.Errorf("IPv4-only sandbox should not get IPv6 settings\nGot:\n%s", config)
+	}
+}
+
+func TestGenerateNixNetworkConfig_Group(t *testing.T) {
+	addrs, _ := AddressesForSubnets("10.100.3.0/24", "fd42:0:0:3::/64")
+	networks := []string{"10.100.0.0/16", "fd42::/48"}
+
+	full := GenerateNixNetworkConfig(&Config{
+		Mode:          ModeFull,
+		NetworkSlot:   3,
+		Addresses:     addrs,
+		Group:         "web",
+		GroupNetworks: networks,
+	})
+	for _, s := range []string{
+		`networking.nameservers = [ "127.0.0.1" ];`,
+		`hostsdir = "/etc/forage-group";`,
+		`"2606:4700:4700::1111"`,
+		`networking.firewall.trustedInterfaces = [ "eth0" ];`,
+	} {
+		if !strings.Contains(full, s) {
+			t.Errorf("grouped full config should contain %q\nGot:\n%s", s, full)
+		}
+	}
+
+	// An empty allowlist still lets group members reach each other
+	restricted := GenerateNixNetworkConfig(&Config{
+		Mode:          ModeRestricted,
+		NetworkSlot:   3,
+		Addresses:     addrs,
+		Group:         "web",
+		GroupNetworks: networks,
+	})
+	for _, s := range []string{
+		`hostsdir = "/etc/forage-group";`,
+		"elements = { 10.100.3.1, 127.0.0.1, 10.100.0.0/16 }",
+		"elements = { ::1, fd42:0:0:3::1, fd42::/48 }",
+	} {
+		if !strings.Contains(restricted, s) {
+			t.Errorf("grouped restricted config should contain %q\nGot:\n%s", s, restricted)
+		}
+	}
+
+	ungrouped := GenerateNixNetworkConfig(&Config{Mode: ModeFull, NetworkSlot: 3, Addresses: addrs})
+	if strings.Contains(ungrouped, "hostsdir") {
+		t.Errorf("ungrouped sandbox should not get a group resolver\nGot:\n%s", ungrouped)
+	}
+}
+
+func TestGenerateGroupHosts(t *testing.T) {
+	api, _ := AddressesForSubnets("10.100.2.0/24", "fd42:0:0:2::/64")
+	db, _ := AddressesForSubnets("10.100.1.0/24", "")
+
+	got := GenerateGroupHosts([]GroupMember{
+		{Name: "api", Addresses: api},
+		{Name: "db", Addresses: db},
+	})
+	want := "# Generated by forage-ctl; members of this sandbox group\n" +
+		"10.100.2.2 api\n" +
+		"fd42:0:0:2::2 api\n" +
+		"10.100.1.2 db\n"
+	if got != want {
+		t.Errorf("GenerateGroupHosts() =\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestGenerateGroupForwardRules(t *testing.T) {
+	a, _ := DefaultAddressPlan().Addresses(1)
+	b, _ := DefaultAddressPlan().Addresses(2)
+	c, _ := DefaultAddressPlan().Addresses(3)
+
+	t.Run("no groups removes the table", func(t *testing.T) {
+		got := GenerateGroupForwardRules(nil, []Addresses{a, b})
+		want := "table inet forage_groups\ndelete table inet forage_groups\n"
+		if got != want {
+			t.Errorf("GenerateGroupForwardRules() = %q, want %q", got, want)
+		}
+	})
+
+	t.Run("members accepted, outsiders dropped", func(t *testing.T) {
+		got := GenerateGroupForwardRules(map[string][]GroupMember{
+			"web": {{Name: "api", Addresses: a}, {Name: "db", Addresses: b}},
+		}, []Addresses{a, b, c})
+
+		for _, s := range []string{
+			"# group web",
+			"elements = { 10.100.1.2, 10.100.2.2 }",
+			"ip saddr @group_0_ipv4 ip daddr @group_0_ipv4 accept",
+			"elements = { 10.100.1.0/24, 10.100.2.0/24, 10.100.3.0/24 }",
+			"ip saddr @grouped_ipv4 ip daddr @sandbox_ipv4 drop",
+			"ip saddr @sandbox_ipv4 ip daddr @grouped_ipv4 drop",
+		} {
+			if !strings.Contains(got, s) {
+				t.Errorf("rules should contain %q\nGot:\n%s", s, got)
+			}
+		}
+		if strings.Contains(got, "ipv6") {
+			t.Errorf("IPv4-only sandboxes should not get IPv6 sets\nGot:\n%s", got)
+		}
+		if strings.Index(got, "accept") > strings.Index(got, "drop") {
+			t.Errorf("group accepts must come before the isolation drops\nGot:\n%s", got)
+		}
+	})
+}
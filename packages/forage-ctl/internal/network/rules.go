@@ -0,0 +1,239 @@
+package network
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// hostnameRegex validates allowlist hostnames, optionally with a leading
+// "*." wildcard label.
+var hostnameRegex = regexp.MustCompile(`^(\*\.)?([a-zA-Z0-9_]([a-zA-Z0-9_-]*[a-zA-Z0-9])?\.)*[a-zA-Z0-9_]([a-zA-Z0-9_-]*[a-zA-Z0-9])?\.?$`)
+
+// AllowRule is a parsed allowlist entry. Entries take the forms:
+//
+//	github.com            hostname, all ports
+//	*.example.com         wildcard domain, all ports
+//	github.com:443        hostname, single port
+//	10.0.5.0/24:5432      IPv4 address or CIDR, optionally with a port
+//	[fd00::/64]:5432      IPv6 address or CIDR with a port (brackets required)
+//	fd00::1               IPv6 address or CIDR without a port
+type AllowRule struct {
+	Host string // hostname, "*.domain", IP address or CIDR
+	Port int    // 0 allows every port
+}
+
+// ParseAllowRule parses and validates a single allowlist entry. Host group
+// references must be expanded before parsing.
+func ParseAllowRule(entry string) (AllowRule, error) {
+	if entry == "" {
+		return AllowRule{}, fmt.Errorf("empty allowlist entry")
+	}
+	if IsHostGroup(entry) {
+		return AllowRule{}, fmt.Errorf("invalid allowlist entry %q: host group references cannot be used here", entry)
+	}
+
+	host, portStr, err := splitHostPort(entry)
+	if err != nil {
+		return AllowRule{}, fmt.Errorf("invalid allowlist entry %q: %w", entry, err)
+	}
+
+	rule := AllowRule{Host: host}
+	if portStr != "" {
+		port, err := strconv.Atoi(portStr)
+		if err != nil || port < 1 || port > 65535 {
+			return AllowRule{}, fmt.Errorf("invalid allowlist entry %q: port must be between 1 and 65535", entry)
+		}
+		rule.Port = port
+	}
+
+	if !rule.IsAddress() && !hostnameRegex.MatchString(host) {
+		return AllowRule{}, fmt.Errorf("invalid allowlist entry %q: not a hostname, IP address, or CIDR", entry)
+	}
+	return rule, nil
+}
+
+// splitHostPort separates an optional ":port" suffix from an allowlist
+// entry. IPv6 addresses need brackets to carry a port.
+func splitHostPort(entry string) (host, port string, err error) {
+	if rest, ok := strings.CutPrefix(entry, "["); ok {
+		host, after, ok := strings.Cut(rest, "]")
+		if !ok {
+			return "", "", fmt.Errorf("missing closing bracket")
+		}
+		if !isIPv6Address(host) {
+			return "", "", fmt.Errorf("brackets may only enclose an IPv6 address or CIDR")
+		}
+		if after == "" {
+			return host, "", nil
+		}
+		port, ok := strings.CutPrefix(after, ":")
+		if !ok || port == "" {
+			return "", "", fmt.Errorf("unexpected %q after closing bracket", after)
+		}
+		return host, port, nil
+	}
+
+	switch strings.Count(entry, ":") {
+	case 0:
+		return entry, "", nil
+	case 1:
+		host, port, _ := strings.Cut(entry, ":")
+		if port == "" {
+			return "", "", fmt.Errorf("missing port after ':'")
+		}
+		return host, port, nil
+	default:
+		if isIPv6Address(entry) {
+			return entry, "", nil
+		}
+		return "", "", fmt.Errorf("IPv6 addresses with a port must be written as [addr]:port")
+	}
+}
+
+// isIPv6Address reports whether s is an IPv6 address or CIDR.
+func isIPv6Address(s string) bool {
+	if ip := net.ParseIP(s); ip != nil {
+		return ip.To4() == nil
+	}
+	if ip, _, err := net.ParseCIDR(s); err == nil {
+		return ip.To4() == nil
+	}
+	return false
+}
+
+// IsAddress reports whether the rule targets an IP address or CIDR rather
+// than a hostname. Address rules bypass DNS resolution.
+func (r AllowRule) IsAddress() bool {
+	if net.ParseIP(r.Host) != nil {
+		return true
+	}
+	_, _, err := net.ParseCIDR(r.Host)
+	return err == nil
+}
+
+// IsWildcard reports whether the rule is a "*.domain" wildcard.
+func (r AllowRule) IsWildcard() bool {
+	return strings.HasPrefix(r.Host, "*.")
+}
+
+// Domain returns the hostname used for DNS forwarding, without any
+// wildcard prefix. It is empty for address rules.
+func (r AllowRule) Domain() string {
+	if r.IsAddress() {
+		return ""
+	}
+	return strings.TrimPrefix(r.Host, "*.")
+}
+
+// Matches reports whether the rule covers host on port. A port of 0 asks
+// whether the host is covered on any port.
+func (r AllowRule) Matches(host string, port int) bool {
+	if r.Port != 0 && port != 0 && r.Port != port {
+		return false
+	}
+	if domain, ok := strings.CutPrefix(r.Host, "*."); ok {
+		return host == domain || strings.HasSuffix(host, "."+domain)
+	}
+	return host == r.Host
+}
+
+// String formats the rule in allowlist syntax.
+func (r AllowRule) String() string {
+	if r.Port == 0 {
+		return r.Host
+	}
+	if isIPv6Address(r.Host) {
+		return fmt.Sprintf("[%s]:%d", r.Host, r.Port)
+	}
+	return fmt.Sprintf("%s:%d", r.Host, r.Port)
+}
+
+// ParseAllowRules parses a list of expanded allowlist entries.
+func ParseAllowRules(entries []string) ([]AllowRule, error) {
+	rules := make([]AllowRule, 0, len(entries))
+	for _, entry := range entries {
+		rule, err := ParseAllowRule(entry)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// nftElements holds resolved nftables set elements for an allowlist.
+type nftElements struct {
+	ipv4      []string // "addr" or "cidr"
+	ipv6      []string
+	ipv4Ports []string // "addr . port" concatenations
+	ipv6Ports []string
+}
+
+// add records an address (or CIDR) for the given port, 0 meaning all ports.
+func (e *nftElements) add(addr string, port int) {
+	v4 := !isIPv6Address(addr)
+	switch {
+	case port == 0 && v4:
+		e.ipv4 = appendUnique(e.ipv4, addr)
+	case port == 0:
+		e.ipv6 = appendUnique(e.ipv6, addr)
+	case v4:
+		e.ipv4Ports = appendUnique(e.ipv4Ports, fmt.Sprintf("%s . %d", addr, port))
+	default:
+		e.ipv6Ports = appendUnique(e.ipv6Ports, fmt.Sprintf("%s . %d", addr, port))
+	}
+}
+
+// resolveRules resolves hostname rules and collects set elements for all
+// rules. Unresolvable hostnames contribute no elements.
+func resolveRules(rules []AllowRule) nftElements {
+	var elems nftElements
+
+	var hostnames []string
+	for _, r := range rules {
+		if !r.IsAddress() && !r.IsWildcard() {
+			hostnames = appendUnique(hostnames, r.Host)
+		}
+	}
+	resolved, _ := ResolveHosts(hostnames)
+	ips := make(map[string][]string, len(resolved))
+	for _, h := range resolved {
+		ips[h.Hostname] = h.IPs
+	}
+
+	for _, r := range rules {
+		if r.IsAddress() {
+			elems.add(r.Host, r.Port)
+			continue
+		}
+		for _, ip := range ips[r.Host] {
+			if net.ParseIP(ip) != nil {
+				elems.add(ip, r.Port)
+			}
+		}
+	}
+	return elems
+}
+
+// dnsDomains returns the domains that dnsmasq should forward upstream.
+func dnsDomains(rules []AllowRule) []string {
+	var domains []string
+	for _, r := range rules {
+		if d := r.Domain(); d != "" {
+			domains = appendUnique(domains, d)
+		}
+	}
+	return domains
+}
+
+func appendUnique(list []string, s string) []string {
+	for _, existing := range list {
+		if existing == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
@@ -8,6 +8,8 @@ import (
 type nftablesData struct {
 	IPv4Addrs string // comma-separated list of allowed IPv4 addresses
 	IPv6Addrs string // comma-separated list of allowed IPv6 addresses
+	IPv4Ports string // comma-separated "addr . port" elements; empty if none
+	IPv6Ports string // comma-separated "addr . port" elements; empty if none
 }
 
 // dnsmasqData holds data for the dnsmasq template.
@@ -34,6 +36,24 @@ table inet filter {
     flags interval
     elements = { {{.IPv6Addrs}} }
   }
+{{- if .IPv4Ports}}
+
+  # Set of allowed IPv4 address . port pairs
+  set allowed_ipv4_ports {
+    type ipv4_addr . inet_service
+    flags interval
+    elements = { {{.IPv4Ports}} }
+  }
+{{- end}}
+{{- if .IPv6Ports}}
+
+  # Set of allowed IPv6 address . port pairs
+  set allowed_ipv6_ports {
+    type ipv6_addr . inet_service
+    flags interval
+    elements = { {{.IPv6Ports}} }
+  }
+{{- end}}
 
   chain input {
     type filter hook input priority 0; policy accept;
@@ -65,9 +85,20 @@ table inet filter {
 
     # Allow connections to allowed IPv6 addresses
     ip6 daddr @allowed_ipv6 accept
+{{- if .IPv4Ports}}
+
+    # Allow port-scoped IPv4 destinations
+    meta l4proto { tcp, udp } ip daddr . th dport @allowed_ipv4_ports accept
+{{- end}}
+{{- if .IPv6Ports}}
+
+    # Allow port-scoped IPv6 destinations
+    meta l4proto { tcp, udp } ip6 daddr . th dport @allowed_ipv6_ports accept
+{{- end}}
 
     # Log and reject everything else
     log prefix "forage-blocked: " level info
+    meta nfproto ipv6 reject with icmpv6 type admin-prohibited
     reject with icmp type admin-prohibited
   }
 }
@@ -97,8 +128,8 @@ address=/#/
 # Cache settings
 cache-size=1000
 
-# Log queries (optional, useful for debugging)
-# log-queries
+# Log queries so blocked lookups can be mapped back to hostnames
+log-queries
 
 # Don't forward plain names (without dots)
 domain-needed
@@ -0,0 +1,175 @@
+// Package notify sends notifications about sandboxes, such as an agent
+// waiting for input, to a host command, a webhook or a named pipe.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/config"
+)
+
+// Timeout bounds the time a notifier may take to deliver a notification.
+const Timeout = 10 * time.Second
+
+// EventType classifies a notification.
+type EventType string
+
+const (
+	// EventWaiting is sent when an agent waits for input: a permission
+	// prompt, a question, or the end of its task.
+	EventWaiting EventType = "waiting"
+)
+
+// Notification is what notifiers deliver, as JSON.
+type Notification struct {
+	Timestamp time.Time `json:"timestamp"`
+	Event     EventType `json:"event"`
+	Sandbox   string    `json:"sandbox"`
+	Message   string    `json:"message"`
+	Lines     []string  `json:"lines,omitempty"` // last lines of the agent's pane
+}
+
+// Notifier delivers notifications.
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+}
+
+// New returns the notifier configured by c.
+func New(c config.Notifier) Notifier {
+	switch {
+	case c.Webhook != "":
+		return &Webhook{URL: c.Webhook}
+	case c.FIFO != "":
+		return &FIFO{Path: c.FIFO}
+	default:
+		return &Command{Args: c.Command}
+	}
+}
+
+// All returns the notifiers configured by the host.
+func All(host *config.HostConfig) []Notifier {
+	if host == nil {
+		return nil
+	}
+	notifiers := make([]Notifier, 0, len(host.Notifiers))
+	for _, c := range host.Notifiers {
+		notifiers = append(notifiers, New(c))
+	}
+	return notifiers
+}
+
+// Send delivers a notification with every notifier, returning their
+// errors joined.
+func Send(ctx context.Context, notifiers []Notifier, n Notification) error {
+	var errs []error
+	for _, notifier := range notifiers {
+		if err := notifier.Notify(ctx, n); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Command runs a host command with the notification as JSON on stdin, and
+// its main fields in FORAGE_EVENT, FORAGE_SANDBOX and FORAGE_MESSAGE.
+type Command struct {
+	Args []string
+}
+
+// Notify implements Notifier.
+func (c *Command) Notify(ctx context.Context, n Notification) error {
+	if len(c.Args) == 0 {
+		return fmt.Errorf("notify command is empty")
+	}
+	data, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, Timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, c.Args[0], c.Args[1:]...)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Env = append(os.Environ(),
+		"FORAGE_EVENT="+string(n.Event),
+		"FORAGE_SANDBOX="+n.Sandbox,
+		"FORAGE_MESSAGE="+n.Message,
+	)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return fmt.Errorf("notify command %s failed: %w: %s", c.Args[0], err, msg)
+		}
+		return fmt.Errorf("notify command %s failed: %w", c.Args[0], err)
+	}
+	return nil
+}
+
+// Webhook POSTs the notification as JSON to a URL.
+type Webhook struct {
+	URL string
+}
+
+// Notify implements Notifier.
+func (w *Webhook) Notify(ctx context.Context, n Notification) error {
+	data, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook failed: %w", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// FIFO writes the notification as a JSON line to a named pipe. Nothing is
+// written, and no error returned, while no reader has the pipe open: the
+// monitor must not block on it.
+type FIFO struct {
+	Path string
+}
+
+// Notify implements Notifier.
+func (f *FIFO) Notify(ctx context.Context, n Notification) error {
+	data, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(f.Path, os.O_WRONLY|syscall.O_NONBLOCK, 0)
+	if errors.Is(err, syscall.ENXIO) {
+		return nil // no reader
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open fifo: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+	if info, err := file.Stat(); err != nil || info.Mode()&os.ModeNamedPipe == 0 {
+		return fmt.Errorf("%s is not a fifo", f.Path)
+	}
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write to fifo: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/config"
+)
+
+func testNotification() Notification {
+	return Notification{
+		Timestamp: time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC),
+		Event:     EventWaiting,
+		Sandbox:   "web",
+		Message:   "Sandbox web is waiting for input",
+		Lines:     []string{"Do you want to proceed?", "❯ 1. Yes"},
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		config config.Notifier
+		want   Notifier
+	}{
+		{config.Notifier{Command: []string{"notify-send"}}, &Command{Args: []string{"notify-send"}}},
+		{config.Notifier{Webhook: "https://hooks.example.com/x"}, &Webhook{URL: "https://hooks.example.com/x"}},
+		{config.Notifier{FIFO: "/run/forage/notify"}, &FIFO{Path: "/run/forage/notify"}},
+	}
+	for _, tt := range tests {
+		got := New(tt.config)
+		gotJSON, _ := json.Marshal(got)
+		wantJSON, _ := json.Marshal(tt.want)
+		if string(gotJSON) != string(wantJSON) {
+			t.Errorf("New(%+v) = %s, want %s", tt.config, gotJSON, wantJSON)
+		}
+	}
+}
+
+func TestCommand_Notify(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out")
+	c := &Command{Args: []string{"sh", "-c", `echo "$FORAGE_EVENT $FORAGE_SANDBOX" > "$0"; cat >> "$0"`, out}}
+
+	if err := c.Notify(context.Background(), testNotification()); err != nil {
+		t.Fatalf("Notify failed: %v", err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env, payload, _ := strings.Cut(string(data), "\n")
+	if env != "waiting web" {
+		t.Errorf("environment = %q, want %q", env, "waiting web")
+	}
+	var n Notification
+	if err := json.Unmarshal([]byte(payload), &n); err != nil || n.Sandbox != "web" || len(n.Lines) != 2 {
+		t.Errorf("stdin = %q, want the notification as JSON", payload)
+	}
+}
+
+func TestCommand_NotifyFails(t *testing.T) {
+	c := &Command{Args: []string{"sh", "-c", "echo no display >&2; exit 1"}}
+	err := c.Notify(context.Background(), testNotification())
+	if err == nil || !strings.Contains(err.Error(), "no display") {
+		t.Errorf("err = %v, want the command's output", err)
+	}
+}
+
+func TestWebhook_Notify(t *testing.T) {
+	var got Notification
+	var contentType string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		if r.Method != http.MethodPost {
+			t.Errorf("method = %s, want POST", r.Method)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("bad body: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	if err := (&Webhook{URL: server.URL}).Notify(context.Background(), testNotification()); err != nil {
+		t.Fatalf("Notify failed: %v", err)
+	}
+	if contentType != "application/json" {
+		t.Errorf("Content-Type = %q", contentType)
+	}
+	if got.Sandbox != "web" || got.Event != EventWaiting || len(got.Lines) != 2 {
+		t.Errorf("received %+v", got)
+	}
+}
+
+func TestWebhook_NotifyFails(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	err := (&Webhook{URL: server.URL}).Notify(context.Background(), testNotification())
+	if err == nil || !strings.Contains(err.Error(), "502") {
+		t.Errorf("err = %v, want the status", err)
+	}
+}
+
+func TestFIFO_Notify(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notify")
+	if err := syscall.Mkfifo(path, 0600); err != nil {
+		t.Skipf("mkfifo: %v", err)
+	}
+	f := &FIFO{Path: path}
+
+	// Without a reader, nothing is written and nothing blocks
+	if err := f.Notify(context.Background(), testNotification()); err != nil {
+		t.Fatalf("Notify without a reader: %v", err)
+	}
+
+	reader, err := os.OpenFile(path, os.O_RDONLY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = reader.Close() }()
+	if err := f.Notify(context.Background(), testNotification()); err != nil {
+		t.Fatalf("Notify failed: %v", err)
+	}
+	line, err := bufio.NewReader(reader).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	var n Notification
+	if err := json.Unmarshal([]byte(line), &n); err != nil || n.Sandbox != "web" {
+		t.Errorf("read %q, want the notification as a JSON line", line)
+	}
+}
+
+func TestFIFO_NotAFIFO(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notify")
+	if err := os.WriteFile(path, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := (&FIFO{Path: path}).Notify(context.Background(), testNotification()); err == nil {
+		t.Error("wrote to a regular file")
+	}
+}
+
+func TestSend_JoinsErrors(t *testing.T) {
+	ok := &Command{Args: []string{"true"}}
+	failing := &Command{Args: []string{"false"}}
+	if err := Send(context.Background(), []Notifier{ok, ok}, testNotification()); err != nil {
+		t.Errorf("Send = %v, want nil", err)
+	}
+	if err := Send(context.Background(), []Notifier{failing, ok, failing}, testNotification()); err == nil || strings.Count(err.Error(), "failed") != 2 {
+		t.Errorf("Send = %v, want both failures", err)
+	}
+}
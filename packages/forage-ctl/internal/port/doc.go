@@ -4,18 +4,16 @@
 // manages allocation by scanning existing sandbox metadata to find unused
 // resources.
 //
-// # Port Allocation
-//
-// Ports are allocated from the range configured in HostConfig:
-//
-//	port, slot, err := port.Allocate(hostConfig, existingSandboxes)
-//
 // # Network Slots
 //
-// Network slots determine container IP addresses in the 10.100.X.0/24 range.
-// Slot 1 gives 10.100.1.0/24, slot 2 gives 10.100.2.0/24, etc.
+// Network slots index the per-sandbox subnets of the host's address plan
+// (see network.AddressPlan). With the default plan, slot 1 gives
+// 10.100.1.0/24, slot 2 gives 10.100.2.0/24, etc.:
+//
+//	plan, err := hostConfig.AddressPlan()
+//	slot, addrs, err := port.AllocateNetwork(plan, existingSandboxes)
 //
-// Constants:
+// Constants for the default plan:
 //
 //	NetworkSlotMin = 1   // First usable slot
 //	NetworkSlotMax = 254 // Last usable slot (255 is broadcast)
@@ -2,38 +2,68 @@ package port
 
 import (
 	"fmt"
+	"net/netip"
 
 	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/config"
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/network"
 )
 
-// Network slot range for container IP allocation (10.100.X.0/24).
+// Network slot range of the default address plan (10.100.X.0/24).
 const (
 	NetworkSlotMin = 1
 	NetworkSlotMax = 254 // 255 is broadcast, 0 is network address
 )
 
-// AllocateSlot finds the next available network slot.
-// Each sandbox gets a unique network slot for its private network (10.100.X.0/24).
+// AllocateSlot finds the next available network slot in the default
+// address plan (10.100.X.0/24).
 func AllocateSlot(sandboxes []*config.SandboxMetadata) (slot int, err error) {
-	usedSlots := make(map[int]bool)
+	slot, _, err = AllocateNetwork(network.DefaultAddressPlan(), sandboxes)
+	return slot, err
+}
+
+// AllocateNetwork finds the next available network slot in plan and
+// returns it with the sandbox's link addresses. A slot is available when
+// no existing sandbox uses it and its subnet does not overlap any existing
+// sandbox's recorded subnet, so changing the host's address plan never
+// hands out addresses still held by older sandboxes.
+func AllocateNetwork(plan *network.AddressPlan, sandboxes []*config.SandboxMetadata) (int, network.Addresses, error) {
+	usedSlots := make(map[int]bool, len(sandboxes))
+	var usedSubnets []netip.Prefix
 
 	for _, sb := range sandboxes {
 		usedSlots[sb.NetworkSlot] = true
+		if subnet, err := netip.ParsePrefix(sb.Addresses().Subnet); err == nil {
+			usedSubnets = append(usedSubnets, subnet)
+		}
 	}
 
 	// Find available network slot
-	for s := NetworkSlotMin; s <= NetworkSlotMax; s++ {
-		if !usedSlots[s] {
-			return s, nil
+	for s := NetworkSlotMin; s <= plan.MaxSlot(); s++ {
+		if usedSlots[s] || overlapsAny(plan, s, usedSubnets) {
+			continue
+		}
+		addrs, err := plan.Addresses(s)
+		if err != nil {
+			return 0, network.Addresses{}, err
 		}
+		return s, addrs, nil
 	}
 
-	return 0, fmt.Errorf("no available network slots (max %d sandboxes)", NetworkSlotMax)
+	return 0, network.Addresses{}, fmt.Errorf("no available network slots (max %d sandboxes)", plan.MaxSlot())
+}
+
+func overlapsAny(plan *network.AddressPlan, slot int, subnets []netip.Prefix) bool {
+	for _, subnet := range subnets {
+		if plan.Overlaps(slot, subnet) {
+			return true
+		}
+	}
+	return false
 }
 
-// ContainerIP returns the container IP address for a given network slot.
-// Containers use the 10.100.X.0/24 network where X is the slot.
-// The container gets .2 (host gets .1).
+// ContainerIP returns the container IP address for a given network slot
+// in the default address plan. The container gets .2 (host gets .1).
 func ContainerIP(slot int) string {
-	return fmt.Sprintf("10.100.%d.2", slot)
+	addrs, _ := network.DefaultAddressPlan().Addresses(slot)
+	return addrs.ContainerIP
 }
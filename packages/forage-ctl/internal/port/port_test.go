@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/config"
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/network"
 )
 
 func TestAllocateSlot_Empty(t *testing.T) {
@@ -105,3 +106,77 @@ func TestContainerIP(t *testing.T) {
 		}
 	}
 }
+
+func TestAllocateNetwork_CustomPlan(t *testing.T) {
+	plan, err := network.NewAddressPlan("172.30.0.0/16", 28, "fd42:f0::/48")
+	if err != nil {
+		t.Fatalf("NewAddressPlan failed: %v", err)
+	}
+
+	slot, addrs, err := AllocateNetwork(plan, []*config.SandboxMetadata{{NetworkSlot: 1, Subnet: "172.30.0.16/28"}})
+	if err != nil {
+		t.Fatalf("AllocateNetwork failed: %v", err)
+	}
+	if slot != 2 {
+		t.Errorf("slot = %d, want 2", slot)
+	}
+	want := network.Addresses{
+		Subnet:        "172.30.0.32/28",
+		HostIP:        "172.30.0.33",
+		ContainerIP:   "172.30.0.34",
+		SubnetIPv6:    "fd42:f0:0:2::/64",
+		HostIPv6:      "fd42:f0:0:2::1",
+		ContainerIPv6: "fd42:f0:0:2::2",
+	}
+	if addrs != want {
+		t.Errorf("addresses = %+v, want %+v", addrs, want)
+	}
+}
+
+func TestAllocateNetwork_MoreThan254(t *testing.T) {
+	plan, err := network.NewAddressPlan("10.100.0.0/16", 28, "")
+	if err != nil {
+		t.Fatalf("NewAddressPlan failed: %v", err)
+	}
+
+	existing := make([]*config.SandboxMetadata, 300)
+	for i := range existing {
+		addrs, _ := plan.Addresses(i + 1)
+		existing[i] = &config.SandboxMetadata{NetworkSlot: i + 1, Subnet: addrs.Subnet}
+	}
+
+	slot, addrs, err := AllocateNetwork(plan, existing)
+	if err != nil {
+		t.Fatalf("AllocateNetwork failed: %v", err)
+	}
+	if slot != 301 {
+		t.Errorf("slot = %d, want 301", slot)
+	}
+	if addrs.ContainerIP != "10.100.18.210" {
+		t.Errorf("ContainerIP = %q, want 10.100.18.210", addrs.ContainerIP)
+	}
+}
+
+func TestAllocateNetwork_SkipsLegacySubnets(t *testing.T) {
+	// Legacy sandboxes (no recorded subnet) occupy 10.100.<slot>.0/24.
+	// A finer-grained plan over the same range must not reuse them.
+	plan, err := network.NewAddressPlan("10.100.0.0/16", 25, "")
+	if err != nil {
+		t.Fatalf("NewAddressPlan failed: %v", err)
+	}
+
+	existing := []*config.SandboxMetadata{{NetworkSlot: 1}}
+
+	slot, addrs, err := AllocateNetwork(plan, existing)
+	if err != nil {
+		t.Fatalf("AllocateNetwork failed: %v", err)
+	}
+	// Slots 2 and 3 are 10.100.1.0/25 and 10.100.1.128/25, inside the
+	// legacy sandbox's 10.100.1.0/24.
+	if slot != 4 {
+		t.Errorf("slot = %d, want 4", slot)
+	}
+	if addrs.Subnet != "10.100.2.0/25" {
+		t.Errorf("Subnet = %q, want 10.100.2.0/25", addrs.Subnet)
+	}
+}
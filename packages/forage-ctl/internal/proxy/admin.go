@@ -0,0 +1,252 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// adminUnixPrefix marks admin addresses that are unix socket paths.
+const adminUnixPrefix = "unix:"
+
+// RateLimitState is a sandbox's standing against the rate limit.
+type RateLimitState struct {
+	Sandbox  string    `json:"sandbox"`
+	Requests int       `json:"requests"` // requests in the current window
+	Limit    int       `json:"limit"`
+	Window   string    `json:"window"`
+	ResetAt  time.Time `json:"resetAt"` // when the oldest counted request leaves the window
+}
+
+// SandboxInfo is what the proxy knows about a sandbox.
+type SandboxInfo struct {
+	Name     string   `json:"name"`
+	IPs      []string `json:"ips,omitempty"`
+	Keys     []string `json:"keys,omitempty"` // secret files with a loaded API key
+	HasToken bool     `json:"hasToken"`       // a virtual API key is issued
+}
+
+// RateLimits returns the rate limit state of every sandbox with requests in
+// the current window, or nil if rate limiting is off.
+func (p *Proxy) RateLimits() []RateLimitState {
+	if p.rateLimiter == nil {
+		return nil
+	}
+	rl := p.rateLimiter
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	windowStart := time.Now().Add(-rl.window)
+	var states []RateLimitState
+	for sandbox, reqs := range rl.requests {
+		st := RateLimitState{Sandbox: sandbox, Limit: rl.maxRequests, Window: rl.window.String()}
+		for _, t := range reqs {
+			if !t.After(windowStart) {
+				continue
+			}
+			if st.Requests == 0 || t.Add(rl.window).Before(st.ResetAt) {
+				st.ResetAt = t.Add(rl.window)
+			}
+			st.Requests++
+		}
+		if st.Requests > 0 {
+			states = append(states, st)
+		}
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Sandbox < states[j].Sandbox })
+	return states
+}
+
+// Sandboxes returns the sandboxes the proxy has API keys, IP mappings or
+// virtual API keys for.
+func (p *Proxy) Sandboxes() []SandboxInfo {
+	byName := make(map[string]*SandboxInfo)
+	get := func(name string) *SandboxInfo {
+		if info, ok := byName[name]; ok {
+			return info
+		}
+		info := &SandboxInfo{Name: name}
+		byName[name] = info
+		return info
+	}
+
+	p.keysMu.RLock()
+	for name, keys := range p.apiKeys {
+		info := get(name)
+		for file := range keys {
+			info.Keys = append(info.Keys, file)
+		}
+	}
+	for ip, name := range p.ipToSandbox {
+		info := get(name)
+		info.IPs = append(info.IPs, ip)
+	}
+	p.keysMu.RUnlock()
+
+	if p.config.StateDir != "" {
+		if entries, err := os.ReadDir(tokensDir(p.config.StateDir)); err == nil {
+			for _, entry := range entries {
+				if token, err := LoadToken(p.config.StateDir, entry.Name()); err == nil && token != "" {
+					get(entry.Name()).HasToken = true
+				}
+			}
+		}
+	}
+
+	sandboxes := make([]SandboxInfo, 0, len(byName))
+	for _, info := range byName {
+		sort.Strings(info.Keys)
+		sort.Strings(info.IPs)
+		sandboxes = append(sandboxes, *info)
+	}
+	sort.Slice(sandboxes, func(i, j int) bool { return sandboxes[i].Name < sandboxes[j].Name })
+	return sandboxes
+}
+
+// AdminHandler returns the handler of the admin API. It must only be
+// served to the host, never to sandboxes.
+func (p *Proxy) AdminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /reload", func(w http.ResponseWriter, r *http.Request) {
+		if err := p.LoadAPIKeys(); err != nil {
+			p.config.Logger.Warn("failed to reload keys", "error", err)
+			writeAdminJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		p.config.Logger.Info("reloaded API keys via admin API")
+		writeAdminJSON(w, http.StatusOK, map[string]string{"status": "reloaded"})
+	})
+	mux.HandleFunc("GET /sandboxes", func(w http.ResponseWriter, r *http.Request) {
+		writeAdminJSON(w, http.StatusOK, p.Sandboxes())
+	})
+	mux.HandleFunc("GET /ratelimits", func(w http.ResponseWriter, r *http.Request) {
+		writeAdminJSON(w, http.StatusOK, p.RateLimits())
+	})
+	mux.HandleFunc("GET /stats", func(w http.ResponseWriter, r *http.Request) {
+		writeAdminJSON(w, http.StatusOK, p.metrics.stats())
+	})
+	mux.HandleFunc("GET /status", func(w http.ResponseWriter, r *http.Request) {
+		writeAdminJSON(w, http.StatusOK, p.Status())
+	})
+	mux.HandleFunc("GET /metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		p.writeMetrics(w)
+	})
+	return mux
+}
+
+func writeAdminJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// listenAdmin opens the admin listener: a TCP address, or a unix socket
+// path prefixed with "unix:" that only the proxy's user can connect to.
+func listenAdmin(addr string) (net.Listener, error) {
+	path, ok := strings.CutPrefix(addr, adminUnixPrefix)
+	if !ok {
+		return net.Listen("tcp", addr)
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		_ = l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// AdminClient talks to a running proxy's admin API.
+type AdminClient struct {
+	baseURL string
+	client  *http.Client
+}
+
+// NewAdminClient returns a client for the admin API at addr, a TCP address
+// or "unix:<path>".
+func NewAdminClient(addr string) *AdminClient {
+	transport := &http.Transport{}
+	baseURL := "http://" + addr
+	if path, ok := strings.CutPrefix(addr, adminUnixPrefix); ok {
+		baseURL = "http://proxy-admin"
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		}
+	}
+	return &AdminClient{baseURL: baseURL, client: &http.Client{Transport: transport, Timeout: 10 * time.Second}}
+}
+
+// Reload makes the proxy reload API keys and IP mappings.
+func (c *AdminClient) Reload() error {
+	return c.do(http.MethodPost, "/reload", nil)
+}
+
+// Status returns the circuit breaker state of the proxy's upstreams.
+func (c *AdminClient) Status() (Status, error) {
+	var v Status
+	return v, c.do(http.MethodGet, "/status", &v)
+}
+
+// Sandboxes lists the sandboxes the proxy knows about.
+func (c *AdminClient) Sandboxes() ([]SandboxInfo, error) {
+	var v []SandboxInfo
+	return v, c.do(http.MethodGet, "/sandboxes", &v)
+}
+
+// RateLimits returns the rate limit state of active sandboxes.
+func (c *AdminClient) RateLimits() ([]RateLimitState, error) {
+	var v []RateLimitState
+	return v, c.do(http.MethodGet, "/ratelimits", &v)
+}
+
+// Stats returns the request counters of every sandbox.
+func (c *AdminClient) Stats() ([]SandboxStats, error) {
+	var v []SandboxStats
+	return v, c.do(http.MethodGet, "/stats", &v)
+}
+
+func (c *AdminClient) do(method, path string, out any) error {
+	req, err := http.NewRequest(method, c.baseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		var opErr *net.OpError
+		if errors.As(err, &opErr) {
+			return fmt.Errorf("proxy admin API not reachable (is the proxy running?): %w", err)
+		}
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		var e struct {
+			Error string `json:"error"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&e)
+		if e.Error == "" {
+			e.Error = resp.Status
+		}
+		return fmt.Errorf("proxy admin API: %s", e.Error)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to parse proxy admin response: %w", err)
+	}
+	return nil
+}
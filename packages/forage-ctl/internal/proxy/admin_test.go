@@ -0,0 +1,128 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProxy_AdminAPI(t *testing.T) {
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Api-Key") == "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		io.WriteString(w, "{}")
+	}))
+	defer upstream.Close()
+
+	tmpDir := t.TempDir()
+	secretsDir := filepath.Join(tmpDir, "secrets")
+	stateDir := filepath.Join(tmpDir, "state")
+	os.MkdirAll(filepath.Join(secretsDir, "alpha"), 0700)
+	os.WriteFile(filepath.Join(secretsDir, "alpha", "anthropic-api-key"), []byte("sk-alpha"), 0600)
+	if _, err := IssueToken(stateDir, "alpha"); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := New(&Config{
+		SecretsDir:        secretsDir,
+		StateDir:          stateDir,
+		TargetURL:         upstream.URL,
+		RateLimitRequests: 10,
+		RateLimitWindow:   time.Minute,
+		Transport:         upstream.Client().Transport,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	if err := p.LoadAPIKeys(); err != nil {
+		t.Fatal(err)
+	}
+	send := func(sandbox string) {
+		req := httptest.NewRequest("POST", "/v1/messages", strings.NewReader("{}"))
+		req.Header.Set("X-Forage-Sandbox", sandbox)
+		p.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	send("alpha")
+	send("alpha")
+	send("beta") // no key loaded yet: upstream rejects it
+
+	// Serve the admin API on a unix socket, as forage-ctl proxy does
+	sock := filepath.Join(tmpDir, "admin.sock")
+	l, err := listenAdmin(adminUnixPrefix + sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin := &http.Server{Handler: p.AdminHandler()}
+	go admin.Serve(l)
+	defer admin.Close()
+	client := NewAdminClient(adminUnixPrefix + sock)
+
+	stats, err := client.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 2 || stats[0].Sandbox != "alpha" || stats[0].Requests != 2 || stats[0].ByStatus["200"] != 2 ||
+		stats[1].ByStatus["401"] != 1 || stats[0].ByRoute["default"] != 2 {
+		t.Errorf("stats = %+v", stats)
+	}
+
+	limits, err := client.RateLimits()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(limits) != 2 || limits[0].Requests != 2 || limits[0].Limit != 10 {
+		t.Errorf("rate limits = %+v", limits)
+	}
+
+	sandboxes, err := client.Sandboxes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sandboxes) != 1 || sandboxes[0].Name != "alpha" || !sandboxes[0].HasToken ||
+		strings.Join(sandboxes[0].Keys, ",") != "anthropic-api-key" {
+		t.Errorf("sandboxes = %+v", sandboxes)
+	}
+
+	// Reloading picks up keys added since start
+	os.MkdirAll(filepath.Join(secretsDir, "beta"), 0700)
+	os.WriteFile(filepath.Join(secretsDir, "beta", "anthropic-api-key"), []byte("sk-beta"), 0600)
+	if err := client.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if sandboxes, _ := client.Sandboxes(); len(sandboxes) != 2 {
+		t.Errorf("after reload: sandboxes = %+v", sandboxes)
+	}
+
+	resp, err := client.client.Get(client.baseURL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	for _, want := range []string{
+		`forage_proxy_requests_total{sandbox="alpha",route="default",code="200"} 2`,
+		`forage_proxy_requests_total{sandbox="beta",route="default",code="401"} 1`,
+		`forage_proxy_request_duration_seconds_count{sandbox="alpha"} 2`,
+		`forage_proxy_request_duration_seconds_bucket{sandbox="alpha",le="+Inf"} 2`,
+		`forage_proxy_rate_limit_requests{sandbox="alpha"} 2`,
+		`forage_proxy_upstream_circuit_open{route="default"`,
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("metrics missing %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestPromLabel(t *testing.T) {
+	if got := promLabel("a\"b\\c\nd"); got != `"a\"b\\c\nd"` {
+		t.Errorf("promLabel() = %s", got)
+	}
+}
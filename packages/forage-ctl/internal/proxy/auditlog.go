@@ -0,0 +1,342 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// followPollInterval is how often a followed audit log is checked for new
+// entries and rotation.
+const followPollInterval = 250 * time.Millisecond
+
+// LogFilter selects audit log entries. Zero fields match everything.
+type LogFilter struct {
+	Sandbox     string
+	Since       time.Time
+	Until       time.Time
+	Status      []string // status codes ("429") or classes ("5xx")
+	PathPrefix  string
+	MinDuration time.Duration // only requests at least this slow
+}
+
+// Validate checks the status filters.
+func (f LogFilter) Validate() error {
+	for _, status := range f.Status {
+		if _, _, err := parseStatusFilter(status); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseStatusFilter parses a status code, or a class such as "5xx"
+// (reported as class 5).
+func parseStatusFilter(s string) (code, class int, err error) {
+	if digit, ok := strings.CutSuffix(strings.ToLower(s), "xx"); ok && len(digit) == 1 && digit[0] >= '1' && digit[0] <= '5' {
+		return 0, int(digit[0] - '0'), nil
+	}
+	code, err = strconv.Atoi(s)
+	if err != nil || code < 100 || code > 599 {
+		return 0, 0, fmt.Errorf("invalid status filter %q: use a code such as 429 or a class such as 5xx", s)
+	}
+	return code, 0, nil
+}
+
+// Match reports whether the entry passes the filter.
+func (f LogFilter) Match(e LogEntry) bool {
+	if f.Sandbox != "" && e.Sandbox != f.Sandbox {
+		return false
+	}
+	if !f.Since.IsZero() && e.Timestamp.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !e.Timestamp.Before(f.Until) {
+		return false
+	}
+	if f.PathPrefix != "" && !strings.HasPrefix(e.Path, f.PathPrefix) {
+		return false
+	}
+	if e.Duration < f.MinDuration {
+		return false
+	}
+	if len(f.Status) == 0 {
+		return true
+	}
+	for _, status := range f.Status {
+		code, class, err := parseStatusFilter(status)
+		if err == nil && (e.StatusCode == code || e.StatusCode/100 == class) {
+			return true
+		}
+	}
+	return false
+}
+
+// LogFiles returns the audit log at path and its rotated predecessors that
+// exist, oldest first.
+func LogFiles(path string) []string {
+	var files []string
+	for i := auditKeepFiles; i > 0; i-- {
+		name := fmt.Sprintf("%s.%d", path, i)
+		if _, err := os.Stat(name); err == nil {
+			files = append(files, name)
+		}
+	}
+	if _, err := os.Stat(path); err == nil {
+		files = append(files, path)
+	}
+	return files
+}
+
+// ReadLog returns the entries of the audit log at path, including rotated
+// files, that match the filter, oldest first. Malformed lines are skipped.
+func ReadLog(path string, filter LogFilter) ([]LogEntry, error) {
+	var entries []LogEntry
+	for _, name := range LogFiles(path) {
+		f, err := os.Open(name)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue // rotated away meanwhile
+			}
+			return nil, fmt.Errorf("failed to open audit log: %w", err)
+		}
+		_, err = readLogEntries(f, filter, func(e LogEntry) { entries = append(entries, e) })
+		_ = f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read audit log %s: %w", name, err)
+		}
+	}
+	return entries, nil
+}
+
+// readLogEntries passes each complete line of r that parses as a matching
+// entry to fn. It returns the bytes of an incomplete last line, which a
+// follower retries once the rest is written.
+func readLogEntries(r io.Reader, filter LogFilter, fn func(LogEntry)) ([]byte, error) {
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadBytes('\n')
+		if err == io.EOF {
+			return line, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		var e LogEntry
+		if json.Unmarshal(bytes.TrimSpace(line), &e) != nil {
+			continue
+		}
+		if filter.Match(e) {
+			fn(e)
+		}
+	}
+}
+
+// FollowLog passes entries matching the filter to fn as they are appended
+// to the audit log at path, continuing into the new file when the log is
+// rotated, until ctx is done. With history, the entries already logged,
+// including rotated files, are passed first.
+func FollowLog(ctx context.Context, path string, filter LogFilter, history bool, fn func(LogEntry)) error {
+	f, err := openFollowed(ctx, path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	if history {
+		for _, name := range LogFiles(path) {
+			if name == path {
+				continue
+			}
+			old, err := os.Open(name)
+			if err != nil {
+				continue
+			}
+			_, err = readLogEntries(old, filter, fn)
+			_ = old.Close()
+			if err != nil {
+				return fmt.Errorf("failed to read audit log %s: %w", name, err)
+			}
+		}
+	} else if _, err := f.Seek(0, io.SeekEnd); err != nil {
+		return err
+	}
+
+	var partial []byte
+	for {
+		// The logger closes a file before rotating it, so once rotation is
+		// seen, reading the old file to its end gets all of its entries
+		wasRotated := rotated(f, path)
+		rest, err := readLogEntries(io.MultiReader(bytes.NewReader(partial), f), filter, fn)
+		if err != nil {
+			return fmt.Errorf("failed to read audit log: %w", err)
+		}
+		partial = rest
+
+		if wasRotated {
+			next, err := nextLogFile(f, path)
+			if err != nil {
+				return err
+			}
+			_ = f.Close()
+			f, partial = next, nil
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(followPollInterval):
+		}
+	}
+}
+
+// openFollowed opens the audit log, waiting for it to be created.
+func openFollowed(ctx context.Context, path string) (*os.File, error) {
+	for {
+		f, err := os.Open(path)
+		if err == nil {
+			return f, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to open audit log: %w", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(followPollInterval):
+		}
+	}
+}
+
+// nextLogFile opens the log file written after the rotated file f. When
+// the log rotated several times since f was opened, that is one of the
+// rotated files rather than the current log.
+func nextLogFile(f *os.File, path string) (*os.File, error) {
+	current, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	files := LogFiles(path)
+	next := 0 // f rotated out of retention: continue with the oldest file
+	for i, name := range files {
+		if info, err := os.Stat(name); err == nil && os.SameFile(current, info) {
+			next = i + 1
+			break
+		}
+	}
+	if next >= len(files) {
+		next = len(files) - 1
+	}
+	if next < 0 {
+		return os.Open(path)
+	}
+	return os.Open(files[next])
+}
+
+// rotated reports whether path no longer names the open file f.
+func rotated(f *os.File, path string) bool {
+	current, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	named, err := os.Stat(path)
+	if err != nil {
+		return false // the new file is not there yet
+	}
+	return !os.SameFile(current, named)
+}
+
+// SandboxLogSummary aggregates a sandbox's audit log entries.
+type SandboxLogSummary struct {
+	Sandbox      string        `json:"sandbox"`
+	Requests     int           `json:"requests"`
+	ClientErrors int           `json:"clientErrors"` // 4xx responses
+	ServerErrors int           `json:"serverErrors"` // 5xx responses
+	AvgDuration  time.Duration `json:"avgDurationNs"`
+	MaxDuration  time.Duration `json:"maxDurationNs"`
+}
+
+// ErrorRate is the fraction of requests that failed with 4xx or 5xx.
+func (s SandboxLogSummary) ErrorRate() float64 {
+	if s.Requests == 0 {
+		return 0
+	}
+	return float64(s.ClientErrors+s.ServerErrors) / float64(s.Requests)
+}
+
+// HourlyRequests counts a sandbox's requests within one hour.
+type HourlyRequests struct {
+	Sandbox  string    `json:"sandbox"`
+	Hour     time.Time `json:"hour"`
+	Requests int       `json:"requests"`
+	Errors   int       `json:"errors"` // 4xx and 5xx responses
+}
+
+// SummarizeLog aggregates entries per sandbox, sorted by sandbox, and per
+// sandbox and hour, sorted by hour then sandbox.
+func SummarizeLog(entries []LogEntry) ([]SandboxLogSummary, []HourlyRequests) {
+	type hourKey struct {
+		sandbox string
+		hour    int64
+	}
+	sandboxes := make(map[string]*SandboxLogSummary)
+	hours := make(map[hourKey]*HourlyRequests)
+	total := make(map[string]time.Duration)
+
+	for _, e := range entries {
+		s, ok := sandboxes[e.Sandbox]
+		if !ok {
+			s = &SandboxLogSummary{Sandbox: e.Sandbox}
+			sandboxes[e.Sandbox] = s
+		}
+		s.Requests++
+		total[e.Sandbox] += e.Duration
+		s.MaxDuration = max(s.MaxDuration, e.Duration)
+
+		hour := e.Timestamp.Truncate(time.Hour)
+		key := hourKey{sandbox: e.Sandbox, hour: hour.Unix()}
+		h, ok := hours[key]
+		if !ok {
+			h = &HourlyRequests{Sandbox: e.Sandbox, Hour: hour}
+			hours[key] = h
+		}
+		h.Requests++
+
+		switch e.StatusCode / 100 {
+		case 4:
+			s.ClientErrors++
+			h.Errors++
+		case 5:
+			s.ServerErrors++
+			h.Errors++
+		}
+	}
+
+	summaries := make([]SandboxLogSummary, 0, len(sandboxes))
+	for name, s := range sandboxes {
+		s.AvgDuration = total[name] / time.Duration(s.Requests)
+		summaries = append(summaries, *s)
+	}
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].Sandbox < summaries[j].Sandbox })
+
+	hourly := make([]HourlyRequests, 0, len(hours))
+	for _, h := range hours {
+		hourly = append(hourly, *h)
+	}
+	sort.Slice(hourly, func(i, j int) bool {
+		if !hourly[i].Hour.Equal(hourly[j].Hour) {
+			return hourly[i].Hour.Before(hourly[j].Hour)
+		}
+		return hourly[i].Sandbox < hourly[j].Sandbox
+	})
+	return summaries, hourly
+}
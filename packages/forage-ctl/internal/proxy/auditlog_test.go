@@ -0,0 +1,155 @@
+package proxy
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReadLog_FiltersAcrossRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	al, err := newAuditLogger(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	al.maxSize = 256 * 2 // rotate every two entries
+
+	start := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	for i, e := range []LogEntry{
+		{Sandbox: "a", Path: "/v1/messages", StatusCode: 200, Duration: time.Second},
+		{Sandbox: "b", Path: "/v1/messages", StatusCode: 529, Duration: 2 * time.Second},
+		{Sandbox: "a", Path: "/openai/v1/chat/completions", StatusCode: 429, Duration: 100 * time.Millisecond},
+		{Sandbox: "a", Path: "/v1/messages", StatusCode: 200, Duration: 40 * time.Second},
+		{Sandbox: "b", Path: "/v1/messages", StatusCode: 200, Duration: time.Second},
+	} {
+		e.Timestamp = start.Add(time.Duration(i) * 30 * time.Minute)
+		al.log(e)
+	}
+	if err := al.close(); err != nil {
+		t.Fatal(err)
+	}
+	if files := LogFiles(path); len(files) != 3 || files[2] != path {
+		t.Fatalf("LogFiles() = %v", files)
+	}
+
+	tests := []struct {
+		name   string
+		filter LogFilter
+		want   int
+	}{
+		{"all", LogFilter{}, 5},
+		{"sandbox", LogFilter{Sandbox: "a"}, 3},
+		{"since", LogFilter{Since: start.Add(time.Hour)}, 3},
+		{"until", LogFilter{Until: start.Add(time.Hour)}, 2},
+		{"status code", LogFilter{Status: []string{"429"}}, 1},
+		{"status classes", LogFilter{Status: []string{"4xx", "5xx"}}, 2},
+		{"path prefix", LogFilter{PathPrefix: "/openai/"}, 1},
+		{"slow", LogFilter{MinDuration: 30 * time.Second}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := ReadLog(path, tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != tt.want {
+				t.Errorf("got %d entries, want %d: %+v", len(entries), tt.want, entries)
+			}
+			for i := 1; i < len(entries); i++ {
+				if entries[i].Timestamp.Before(entries[i-1].Timestamp) {
+					t.Errorf("entries out of order: %+v", entries)
+				}
+			}
+		})
+	}
+
+	if err := (LogFilter{Status: []string{"6xx"}}).Validate(); err == nil {
+		t.Error("Validate() accepted status 6xx")
+	}
+}
+
+func TestFollowLog_AcrossRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	al, err := newAuditLogger(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer al.close()
+	al.maxSize = 256 * 2
+	al.log(LogEntry{Sandbox: "before", StatusCode: 200})
+
+	var mu sync.Mutex
+	var got []string
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- FollowLog(ctx, path, LogFilter{Status: []string{"2xx"}}, false, func(e LogEntry) {
+			mu.Lock()
+			got = append(got, e.Sandbox)
+			mu.Unlock()
+		})
+	}()
+
+	// Entries logged before following starts are skipped
+	time.Sleep(2 * followPollInterval)
+	for _, name := range []string{"one", "two", "three", "four", "five"} {
+		al.log(LogEntry{Sandbox: name, StatusCode: 200})
+	}
+	al.log(LogEntry{Sandbox: "failed", StatusCode: 500})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		n := len(got)
+		mu.Unlock()
+		if n >= 5 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(got) != 5 || got[0] != "one" || got[4] != "five" {
+		t.Errorf("followed entries = %v", got)
+	}
+}
+
+func TestSummarizeLog(t *testing.T) {
+	hour := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	summaries, hourly := SummarizeLog([]LogEntry{
+		{Timestamp: hour.Add(5 * time.Minute), Sandbox: "a", StatusCode: 200, Duration: time.Second},
+		{Timestamp: hour.Add(50 * time.Minute), Sandbox: "a", StatusCode: 429, Duration: 3 * time.Second},
+		{Timestamp: hour.Add(70 * time.Minute), Sandbox: "a", StatusCode: 500, Duration: 2 * time.Second},
+		{Timestamp: hour.Add(10 * time.Minute), Sandbox: "b", StatusCode: 200, Duration: time.Second},
+	})
+	if len(summaries) != 2 {
+		t.Fatalf("summaries = %+v", summaries)
+	}
+	a := summaries[0]
+	if a.Sandbox != "a" || a.Requests != 3 || a.ClientErrors != 1 || a.ServerErrors != 1 ||
+		a.AvgDuration != 2*time.Second || a.MaxDuration != 3*time.Second {
+		t.Errorf("summary of a = %+v", a)
+	}
+	if rate := a.ErrorRate(); rate < 0.66 || rate > 0.67 {
+		t.Errorf("error rate = %v, want 2/3", rate)
+	}
+	want := []HourlyRequests{
+		{Sandbox: "a", Hour: hour, Requests: 2, Errors: 1},
+		{Sandbox: "b", Hour: hour, Requests: 1},
+		{Sandbox: "a", Hour: hour.Add(time.Hour), Requests: 1, Errors: 1},
+	}
+	if len(hourly) != len(want) {
+		t.Fatalf("hourly = %+v", hourly)
+	}
+	for i := range want {
+		if hourly[i] != want[i] {
+			t.Errorf("hourly[%d] = %+v, want %+v", i, hourly[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/usage"
+)
+
+// budgetRefreshInterval is how often a sandbox's budget file is checked for
+// changes made by forage-ctl budget.
+const budgetRefreshInterval = time.Second
+
+// budgetTracker enforces per-sandbox budgets. Spend is recomputed from the
+// usage store whenever a budget file changes, so budgets survive proxy
+// restarts, and is then kept up to date as usage is recorded.
+type budgetTracker struct {
+	stateDir  string
+	usagePath string
+	prices    usage.Prices
+	now       func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*budgetEntry
+}
+
+// budgetEntry is the cached budget state of one sandbox.
+type budgetEntry struct {
+	state     *usage.BudgetState // nil if the sandbox has no budget
+	modTime   time.Time          // budget file mtime when loaded
+	checkedAt time.Time
+	day       time.Time // start of the day daily spend counts from
+	daily     usage.Spend
+	total     usage.Spend
+	exhausted bool // exhaustion has been reported
+}
+
+func newBudgetTracker(stateDir, usagePath string, prices usage.Prices) *budgetTracker {
+	return &budgetTracker{
+		stateDir:  stateDir,
+		usagePath: usagePath,
+		prices:    prices,
+		now:       time.Now,
+		entries:   make(map[string]*budgetEntry),
+	}
+}
+
+// entry returns the sandbox's budget state, reloading it if the budget file
+// changed. Callers must hold t.mu.
+func (t *budgetTracker) entry(sandbox string) (*budgetEntry, error) {
+	now := t.now()
+	e, ok := t.entries[sandbox]
+	if ok && now.Sub(e.checkedAt) < budgetRefreshInterval {
+		t.rollDay(e, now)
+		return e, nil
+	}
+
+	path, err := usage.BudgetPath(t.stateDir, sandbox)
+	if err != nil {
+		return nil, err
+	}
+	var modTime time.Time
+	if info, err := os.Stat(path); err == nil {
+		modTime = info.ModTime()
+	}
+	if ok && modTime.Equal(e.modTime) {
+		e.checkedAt = now
+		t.rollDay(e, now)
+		return e, nil
+	}
+
+	state, err := usage.LoadBudget(t.stateDir, sandbox)
+	if err != nil {
+		return nil, err
+	}
+	e = &budgetEntry{state: state, modTime: modTime, checkedAt: now, day: usage.DayStart(now)}
+	if state != nil && !state.Budget.IsEmpty() {
+		e.daily, e.total, err = usage.BudgetSpend(t.usagePath, sandbox, state, t.prices, now)
+		if err != nil {
+			return nil, err
+		}
+	}
+	t.entries[sandbox] = e
+	return e, nil
+}
+
+// rollDay resets daily spend at midnight.
+func (t *budgetTracker) rollDay(e *budgetEntry, now time.Time) {
+	if day := usage.DayStart(now); !day.Equal(e.day) {
+		e.day = day
+		e.daily = usage.Spend{}
+		e.exhausted = false
+	}
+}
+
+// budgetStatus is the result of a budget check.
+type budgetStatus struct {
+	reason string // why the budget is exhausted; empty if it is not
+	notify bool   // exhaustion is new and should be reported
+	pause  bool   // the sandbox should be stopped
+}
+
+// check reports whether the sandbox may make another request.
+func (t *budgetTracker) check(sandbox string) (budgetStatus, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	e, err := t.entry(sandbox)
+	if err != nil {
+		return budgetStatus{}, err
+	}
+	return t.status(e), nil
+}
+
+// record appends a usage record to store and counts it against the
+// sandbox's budget. Holding the tracker lock across both keeps a concurrent
+// reload from missing or double counting the record.
+func (t *budgetTracker) record(store *usage.Store, rec usage.Record) (budgetStatus, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := store.Add(rec); err != nil {
+		return budgetStatus{}, err
+	}
+	// Entries not loaded yet pick the record up from the store
+	e, ok := t.entries[rec.Sandbox]
+	if !ok || e.state == nil {
+		return budgetStatus{}, nil
+	}
+	if rec.Timestamp.Before(e.state.ResetAt) {
+		return budgetStatus{}, nil
+	}
+	t.rollDay(e, t.now())
+	s := usage.SpendOf(t.prices, rec.Model, rec.Tokens)
+	e.total = e.total.Add(s)
+	if !rec.Timestamp.Before(e.day) {
+		e.daily = e.daily.Add(s)
+	}
+	return t.status(e), nil
+}
+
+// status evaluates an entry, marking a newly exhausted budget as reported.
+func (t *budgetTracker) status(e *budgetEntry) budgetStatus {
+	if e.state == nil {
+		return budgetStatus{}
+	}
+	reason := e.state.Exceeded(e.daily, e.total)
+	if reason == "" {
+		e.exhausted = false
+		return budgetStatus{}
+	}
+	st := budgetStatus{reason: reason, notify: !e.exhausted, pause: e.state.Budget.Pause}
+	e.exhausted = true
+	return st
+}
+
+// writeBudgetError responds with an error both Anthropic and
+// OpenAI-compatible clients recognize as non-retryable.
+func writeBudgetError(w http.ResponseWriter, reason string) {
+	body, _ := json.Marshal(map[string]any{
+		"type": "error",
+		"error": map[string]string{
+			"type":    "billing_error",
+			"code":    "insufficient_quota",
+			"message": "Sandbox budget exhausted: " + reason,
+		},
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusPaymentRequired)
+	_, _ = w.Write(body)
+}
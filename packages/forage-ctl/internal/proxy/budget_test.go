@@ -0,0 +1,174 @@
+package proxy
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/audit"
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/config"
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/usage"
+)
+
+func TestProxy_EnforcesBudget(t *testing.T) {
+	upstreamCalls := 0
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamCalls++
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"model":"claude-sonnet-4-5","usage":{"input_tokens":10,"output_tokens":7}}`)
+	}))
+	defer upstream.Close()
+
+	tmpDir := t.TempDir()
+	stateDir := filepath.Join(tmpDir, "state")
+	if err := os.MkdirAll(filepath.Join(tmpDir, "test-sandbox"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(tmpDir, "test-sandbox", "anthropic-api-key"), []byte("sk-test"), 0600)
+
+	if err := usage.SaveBudget(stateDir, "test-sandbox", &usage.BudgetState{
+		Budget:  config.Budget{TotalTokens: 20, Pause: true},
+		ResetAt: time.Now().Add(-time.Minute),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	paused := make(chan string, 1)
+	newProxy := func() *Proxy {
+		p, err := New(&Config{
+			ListenAddr:   ":0",
+			SecretsDir:   tmpDir,
+			TargetURL:    upstream.URL,
+			UsagePath:    usage.Path(stateDir),
+			StateDir:     stateDir,
+			PauseSandbox: func(name string) error { paused <- name; return nil },
+			Transport:    upstream.Client().Transport,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := p.LoadAPIKeys(); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	send := func(p *Proxy) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/v1/messages", strings.NewReader(`{}`))
+		req.Header.Set("X-Forage-Sandbox", "test-sandbox")
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, req)
+		return w
+	}
+
+	p := newProxy()
+	// 17 tokens, then 34: the second request crosses the limit
+	for i := 0; i < 2; i++ {
+		if w := send(p); w.Code != http.StatusOK {
+			t.Fatalf("request %d: status %d, want 200", i+1, w.Code)
+		}
+	}
+	select {
+	case name := <-paused:
+		if name != "test-sandbox" {
+			t.Errorf("paused %q, want test-sandbox", name)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("sandbox was not paused")
+	}
+
+	w := send(p)
+	if w.Code != http.StatusPaymentRequired {
+		t.Fatalf("status %d, want 402", w.Code)
+	}
+	var body struct {
+		Type  string `json:"type"`
+		Error struct {
+			Type    string `json:"type"`
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("invalid error body: %v", err)
+	}
+	if body.Type != "error" || body.Error.Type != "billing_error" || body.Error.Code != "insufficient_quota" ||
+		!strings.Contains(body.Error.Message, "total token limit of 20") {
+		t.Errorf("unexpected error body: %s", w.Body.String())
+	}
+	if upstreamCalls != 2 {
+		t.Errorf("upstream called %d times, want 2", upstreamCalls)
+	}
+	p.Close()
+
+	events, err := audit.NewLogger(stateDir).Events("test-sandbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Type != audit.EventBudget {
+		t.Errorf("expected one budget audit event, got %+v", events)
+	}
+
+	// The budget stays exhausted across restarts
+	p = newProxy()
+	defer p.Close()
+	if w := send(p); w.Code != http.StatusPaymentRequired {
+		t.Errorf("after restart: status %d, want 402", w.Code)
+	}
+
+	// Resetting the budget lets requests through again
+	state, _ := usage.LoadBudget(stateDir, "test-sandbox")
+	state.ResetAt = time.Now()
+	if err := usage.SaveBudget(stateDir, "test-sandbox", state); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(2 * time.Second)
+	os.Chtimes(filepath.Join(stateDir, "budgets", "test-sandbox.json"), future, future)
+	p.budgets.now = func() time.Time { return time.Now().Add(2 * budgetRefreshInterval) }
+	if w := send(p); w.Code != http.StatusOK {
+		t.Errorf("after reset: status %d, want 200", w.Code)
+	}
+}
+
+func TestBudgetTracker_DailyRollover(t *testing.T) {
+	stateDir := t.TempDir()
+	store, err := usage.Open(usage.Path(stateDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	if err := usage.SaveBudget(stateDir, "sb", &usage.BudgetState{
+		Budget: config.Budget{DailyTokens: 100},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2026, 3, 1, 23, 0, 0, 0, time.Local)
+	tracker := newBudgetTracker(stateDir, usage.Path(stateDir), nil)
+	tracker.now = func() time.Time { return now }
+
+	if st, err := tracker.check("sb"); err != nil || st.reason != "" {
+		t.Fatalf("check = %+v, %v; want allowed", st, err)
+	}
+	st, err := tracker.record(store, usage.Record{Timestamp: now, Sandbox: "sb", Tokens: usage.Tokens{Input: 60, Output: 40}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.reason == "" || !st.notify {
+		t.Fatalf("record = %+v, want newly exhausted", st)
+	}
+	if st, _ := tracker.check("sb"); st.reason == "" || st.notify {
+		t.Fatalf("check = %+v, want exhausted without a second notification", st)
+	}
+
+	now = now.Add(2 * time.Hour)
+	if st, _ := tracker.check("sb"); st.reason != "" {
+		t.Errorf("check after midnight = %+v, want allowed", st)
+	}
+}
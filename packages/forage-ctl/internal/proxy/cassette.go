@@ -0,0 +1,423 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/config"
+)
+
+// CassetteMode selects whether the proxy records or replays API traffic.
+type CassetteMode string
+
+const (
+	// CassetteOff forwards requests upstream without recording them
+	CassetteOff CassetteMode = ""
+	// CassetteRecord forwards requests upstream and records each
+	// request/response pair to the sandbox's cassette
+	CassetteRecord CassetteMode = "record"
+	// CassetteReplay serves responses from the sandbox's cassette without
+	// contacting upstream
+	CassetteReplay CassetteMode = "replay"
+)
+
+// MatchMode selects how replayed requests are matched to recorded ones.
+type MatchMode string
+
+const (
+	// MatchExact requires method, route, path, query and body to be
+	// identical to the recording
+	MatchExact MatchMode = "exact"
+	// MatchNormalized compares JSON bodies structurally, ignoring
+	// formatting, key order and per-session fields such as metadata
+	MatchNormalized MatchMode = "normalized"
+	// MatchSequence serves recorded responses in order, only checking that
+	// method and path agree
+	MatchSequence MatchMode = "sequence"
+)
+
+// ParseCassetteMode parses a cassette mode name. "off" and "" disable
+// cassettes.
+func ParseCassetteMode(s string) (CassetteMode, error) {
+	switch s {
+	case "", "off":
+		return CassetteOff, nil
+	case string(CassetteRecord), string(CassetteReplay):
+		return CassetteMode(s), nil
+	}
+	return "", fmt.Errorf("invalid cassette mode %q (want off, record or replay)", s)
+}
+
+// ParseMatchMode parses a match mode name. "" selects MatchNormalized.
+func ParseMatchMode(s string) (MatchMode, error) {
+	switch s {
+	case "":
+		return MatchNormalized, nil
+	case string(MatchExact), string(MatchNormalized), string(MatchSequence):
+		return MatchMode(s), nil
+	}
+	return "", fmt.Errorf("invalid match mode %q (want exact, normalized or sequence)", s)
+}
+
+// Interaction is a recorded request/response pair.
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+// RecordedRequest is a request as sent by the sandbox. Credentials are
+// never recorded.
+type RecordedRequest struct {
+	Method string `json:"method"`
+	Route  string `json:"route,omitempty"`
+	Path   string `json:"path"`
+	Query  string `json:"query,omitempty"`
+	Body   string `json:"body,omitempty"`
+}
+
+// RecordedResponse is an upstream response. Streamed responses keep the
+// chunks they arrived in and the delay before each.
+type RecordedResponse struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header,omitempty"`
+	Chunks []Chunk     `json:"chunks"`
+}
+
+// Chunk is a piece of a response body.
+type Chunk struct {
+	DelayMs int64  `json:"delayMs,omitempty"` // Time since the previous chunk, or since the request
+	Data    string `json:"data"`
+}
+
+// unrecordedHeaders are response headers that describe the original
+// connection rather than the response, or that must not leak into tests.
+var unrecordedHeaders = []string{
+	"Connection", "Content-Encoding", "Content-Length", "Date",
+	"Keep-Alive", "Set-Cookie", "Transfer-Encoding",
+}
+
+// CassettePath returns the location of a sandbox's cassette within dir.
+// Requests from unidentified clients use the "default" cassette.
+func CassettePath(dir, sandbox string) (string, error) {
+	if sandbox == "" {
+		sandbox = "default"
+	}
+	if err := config.ValidateSandboxName(sandbox); err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, sandbox+".cassette.jsonl"), nil
+}
+
+// LoadCassette reads the interactions recorded in a cassette file.
+func LoadCassette(path string) ([]Interaction, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cassette: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	var interactions []Interaction
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var i Interaction
+		if err := json.Unmarshal(scanner.Bytes(), &i); err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid interaction: %w", path, line, err)
+		}
+		interactions = append(interactions, i)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading cassette: %w", err)
+	}
+	return interactions, nil
+}
+
+// cassetteStore records or replays the cassettes of all sandboxes.
+type cassetteStore struct {
+	dir   string
+	mode  CassetteMode
+	match MatchMode
+	speed float64 // Replay speed factor; 0 ignores recorded delays
+
+	mu    sync.Mutex
+	tapes map[string]*cassette
+}
+
+// cassette is the state of one sandbox's cassette.
+type cassette struct {
+	interactions []Interaction
+	used         []bool
+	next         int  // Position for sequence matching
+	started      bool // Recording has truncated the file this session
+}
+
+func newCassetteStore(dir string, mode CassetteMode, match MatchMode, speed float64) *cassetteStore {
+	if match == "" {
+		match = MatchNormalized
+	}
+	return &cassetteStore{
+		dir:   dir,
+		mode:  mode,
+		match: match,
+		speed: speed,
+		tapes: make(map[string]*cassette),
+	}
+}
+
+// record appends an interaction to the sandbox's cassette. The first
+// recording of a session replaces any previous cassette.
+func (s *cassetteStore) record(sandbox string, i *Interaction) error {
+	path, err := CassettePath(s.dir, sandbox)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(i)
+	if err != nil {
+		return fmt.Errorf("failed to marshal interaction: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tape := s.tapes[sandbox]
+	if tape == nil {
+		tape = &cassette{}
+		s.tapes[sandbox] = tape
+	}
+	flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	if !tape.started {
+		flags |= os.O_TRUNC
+	}
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return fmt.Errorf("failed to create cassette directory: %w", err)
+	}
+	f, err := os.OpenFile(path, flags, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open cassette: %w", err)
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to write cassette: %w", err)
+	}
+	tape.started = true
+	return f.Close()
+}
+
+// find returns the recorded interaction answering req, or nil if there is
+// none. Exact and normalized matching use each recording once, in order,
+// and then keep answering repeats of a request with its last recording.
+func (s *cassetteStore) find(sandbox string, req *RecordedRequest) (*Interaction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tape, err := s.load(sandbox)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.match == MatchSequence {
+		if tape.next >= len(tape.interactions) {
+			return nil, nil
+		}
+		i := &tape.interactions[tape.next]
+		if i.Request.Method != req.Method || i.Request.Path != req.Path {
+			return nil, nil
+		}
+		tape.next++
+		return i, nil
+	}
+
+	want := s.key(req)
+	last := -1
+	for n := range tape.interactions {
+		if s.key(&tape.interactions[n].Request) != want {
+			continue
+		}
+		if !tape.used[n] {
+			tape.used[n] = true
+			return &tape.interactions[n], nil
+		}
+		last = n
+	}
+	if last < 0 {
+		return nil, nil
+	}
+	return &tape.interactions[last], nil
+}
+
+// load reads a sandbox's cassette on first use. Callers must hold s.mu.
+func (s *cassetteStore) load(sandbox string) (*cassette, error) {
+	if tape, ok := s.tapes[sandbox]; ok {
+		return tape, nil
+	}
+	path, err := CassettePath(s.dir, sandbox)
+	if err != nil {
+		return nil, err
+	}
+	interactions, err := LoadCassette(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	tape := &cassette{interactions: interactions, used: make([]bool, len(interactions))}
+	s.tapes[sandbox] = tape
+	return tape, nil
+}
+
+// key renders the parts of a request that matching compares.
+func (s *cassetteStore) key(req *RecordedRequest) string {
+	body := req.Body
+	if s.match == MatchNormalized {
+		body = normalizeBody(body)
+	}
+	return req.Method + " " + req.Route + " " + req.Path + "?" + req.Query + "\n" + body
+}
+
+// volatileFields are top-level request fields that differ between runs of
+// the same session, such as Anthropic's metadata.user_id.
+var volatileFields = []string{"metadata", "user"}
+
+// normalizeBody re-encodes a JSON body canonically, without volatile
+// fields. Other bodies are compared with surrounding whitespace trimmed.
+func normalizeBody(body string) string {
+	var v any
+	if err := json.Unmarshal([]byte(body), &v); err != nil {
+		return string(bytes.TrimSpace([]byte(body)))
+	}
+	if obj, ok := v.(map[string]any); ok {
+		for _, field := range volatileFields {
+			delete(obj, field)
+		}
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return body
+	}
+	return string(data)
+}
+
+// replay writes a recorded response, pacing chunks by their recorded
+// delays scaled by the replay speed.
+func (s *cassetteStore) replay(w http.ResponseWriter, r *http.Request, i *Interaction) {
+	for key, values := range i.Response.Header {
+		for _, v := range values {
+			w.Header().Add(key, v)
+		}
+	}
+	w.WriteHeader(i.Response.Status)
+
+	rc := http.NewResponseController(w)
+	for _, chunk := range i.Response.Chunks {
+		if s.speed > 0 && chunk.DelayMs > 0 {
+			delay := time.Duration(float64(chunk.DelayMs) * float64(time.Millisecond) / s.speed)
+			select {
+			case <-time.After(delay):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		if _, err := io.WriteString(w, chunk.Data); err != nil {
+			return
+		}
+		_ = rc.Flush()
+	}
+}
+
+// recordRequest captures a request for the cassette, leaving its body
+// readable for forwarding.
+func recordRequest(r *http.Request, route string) (*RecordedRequest, error) {
+	req := &RecordedRequest{
+		Method: r.Method,
+		Route:  route,
+		Path:   r.URL.Path,
+		Query:  r.URL.RawQuery,
+	}
+	if r.Body != nil && r.Body != http.NoBody {
+		body, err := io.ReadAll(r.Body)
+		_ = r.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read request body: %w", err)
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		req.Body = string(body)
+	}
+	return req, nil
+}
+
+// wrapCassetteBody replaces resp.Body with a reader that records the
+// response as it passes through to the client. onDone is called once the
+// body has been read completely; responses cut short are not recorded.
+func wrapCassetteBody(resp *http.Response, req *RecordedRequest, start time.Time, onDone func(*Interaction)) {
+	header := resp.Header.Clone()
+	for _, h := range unrecordedHeaders {
+		header.Del(h)
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	rec := &cassetteRecorder{
+		interaction: Interaction{
+			Request:  *req,
+			Response: RecordedResponse{Status: resp.StatusCode, Header: header, Chunks: []Chunk{}},
+		},
+		stream: mediaType == "text/event-stream",
+		last:   start,
+		onDone: onDone,
+	}
+	if resp.Body == nil {
+		rec.finish()
+		return
+	}
+	rec.body = resp.Body
+	resp.Body = rec
+}
+
+// cassetteRecorder passes a response body through while recording it.
+type cassetteRecorder struct {
+	body        io.ReadCloser
+	interaction Interaction
+	stream      bool // Keep chunk boundaries and timing
+	last        time.Time
+	onDone      func(*Interaction)
+	once        sync.Once
+}
+
+func (c *cassetteRecorder) Read(p []byte) (int, error) {
+	n, err := c.body.Read(p)
+	if n > 0 {
+		c.add(p[:n])
+	}
+	if err == io.EOF {
+		c.finish()
+	}
+	return n, err
+}
+
+func (c *cassetteRecorder) Close() error {
+	return c.body.Close()
+}
+
+func (c *cassetteRecorder) add(p []byte) {
+	chunks := &c.interaction.Response.Chunks
+	if !c.stream && len(*chunks) > 0 {
+		(*chunks)[0].Data += string(p)
+		return
+	}
+	now := time.Now()
+	*chunks = append(*chunks, Chunk{DelayMs: now.Sub(c.last).Milliseconds(), Data: string(p)})
+	c.last = now
+}
+
+func (c *cassetteRecorder) finish() {
+	c.once.Do(func() { c.onDone(&c.interaction) })
+}
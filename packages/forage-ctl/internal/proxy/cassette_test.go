@@ -0,0 +1,167 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCassette_RecordAndReplay(t *testing.T) {
+	upstreamCalls := 0
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamCalls++
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Set-Cookie", "session=secret")
+		io.WriteString(w, "event: message_start\ndata: {\"n\":1}\n\n")
+		w.(http.Flusher).Flush()
+		time.Sleep(20 * time.Millisecond)
+		io.WriteString(w, "event: message_stop\ndata: "+string(body)+"\n\n")
+	}))
+	defer upstream.Close()
+
+	tmpDir := t.TempDir()
+	cassettes := filepath.Join(tmpDir, "cassettes")
+	os.MkdirAll(filepath.Join(tmpDir, "test-sandbox"), 0700)
+	os.WriteFile(filepath.Join(tmpDir, "test-sandbox", "anthropic-api-key"), []byte("sk-secret-key"), 0600)
+
+	newProxy := func(mode CassetteMode) *Proxy {
+		p, err := New(&Config{
+			SecretsDir:   tmpDir,
+			TargetURL:    upstream.URL,
+			CassetteMode: mode,
+			CassetteDir:  cassettes,
+			Transport:    upstream.Client().Transport,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := p.LoadAPIKeys(); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	send := func(p *Proxy, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/v1/messages", strings.NewReader(body))
+		req.Header.Set("X-Forage-Sandbox", "test-sandbox")
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, req)
+		return w
+	}
+
+	rec := newProxy(CassetteRecord)
+	recorded := send(rec, `{"model": "m", "n": 1}`)
+	rec.Close()
+	if recorded.Code != http.StatusOK {
+		t.Fatalf("record: status %d", recorded.Code)
+	}
+
+	interactions, err := LoadCassette(filepath.Join(cassettes, "test-sandbox.cassette.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(interactions) != 1 {
+		t.Fatalf("recorded %d interactions, want 1", len(interactions))
+	}
+	i := interactions[0]
+	if i.Request.Route != "default" || i.Request.Path != "/v1/messages" || i.Request.Body != `{"model": "m", "n": 1}` {
+		t.Errorf("unexpected recorded request: %+v", i.Request)
+	}
+	if len(i.Response.Chunks) < 2 {
+		t.Errorf("stream should be recorded in chunks, got %d", len(i.Response.Chunks))
+	}
+	if i.Response.Header.Get("Set-Cookie") != "" {
+		t.Error("Set-Cookie should not be recorded")
+	}
+	data, _ := os.ReadFile(filepath.Join(cassettes, "test-sandbox.cassette.jsonl"))
+	if strings.Contains(string(data), "sk-secret-key") {
+		t.Error("API key leaked into the cassette")
+	}
+
+	upstream.Close()
+	play := newProxy(CassetteReplay)
+	defer play.Close()
+
+	// Normalized matching ignores formatting and key order
+	replayed := send(play, `{"n":1,"model":"m"}`)
+	if replayed.Code != http.StatusOK || replayed.Body.String() != recorded.Body.String() {
+		t.Errorf("replay = %d %q, want %q", replayed.Code, replayed.Body.String(), recorded.Body.String())
+	}
+	if replayed.Header().Get("Content-Type") != "text/event-stream" {
+		t.Errorf("Content-Type = %q", replayed.Header().Get("Content-Type"))
+	}
+	if w := send(play, `{"model":"other"}`); w.Code != http.StatusNotFound {
+		t.Errorf("unmatched request: status %d, want 404", w.Code)
+	}
+	if upstreamCalls != 1 {
+		t.Errorf("upstream called %d times, want 1", upstreamCalls)
+	}
+}
+
+func TestCassetteStore_Matching(t *testing.T) {
+	dir := t.TempDir()
+	recording := newCassetteStore(dir, CassetteRecord, "", 0)
+	for _, i := range []Interaction{
+		{Request: RecordedRequest{Method: "POST", Path: "/v1/messages", Body: `{"q":1,"metadata":{"user_id":"a"}}`}, Response: RecordedResponse{Status: 200, Chunks: []Chunk{{Data: "first"}}}},
+		{Request: RecordedRequest{Method: "POST", Path: "/v1/messages", Body: `{"q":1,"metadata":{"user_id":"a"}}`}, Response: RecordedResponse{Status: 200, Chunks: []Chunk{{Data: "second"}}}},
+		{Request: RecordedRequest{Method: "POST", Path: "/v1/messages", Body: `{"q":2}`}, Response: RecordedResponse{Status: 200, Chunks: []Chunk{{Data: "third"}}}},
+	} {
+		if err := recording.record("sb", &i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	q1 := &RecordedRequest{Method: "POST", Path: "/v1/messages", Body: `{"metadata":{"user_id":"b"}, "q": 1}`}
+	q2 := &RecordedRequest{Method: "POST", Path: "/v1/messages", Body: `{"q":2}`}
+	data := func(i *Interaction) string {
+		if i == nil {
+			return "<miss>"
+		}
+		return i.Response.Chunks[0].Data
+	}
+
+	tests := []struct {
+		match MatchMode
+		reqs  []*RecordedRequest
+		want  []string
+	}{
+		// Repeats are answered in recording order, then with the last recording
+		{MatchNormalized, []*RecordedRequest{q1, q2, q1, q1}, []string{"first", "third", "second", "second"}},
+		{MatchExact, []*RecordedRequest{q1, q2}, []string{"<miss>", "third"}},
+		{MatchSequence, []*RecordedRequest{q2, q2, q2, q2}, []string{"first", "second", "third", "<miss>"}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.match), func(t *testing.T) {
+			store := newCassetteStore(dir, CassetteReplay, tt.match, 0)
+			for n, req := range tt.reqs {
+				i, err := store.find("sb", req)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := data(i); got != tt.want[n] {
+					t.Errorf("request %d: got %s, want %s", n, got, tt.want[n])
+				}
+			}
+		})
+	}
+}
+
+func TestParseCassetteModes(t *testing.T) {
+	if m, err := ParseCassetteMode("off"); err != nil || m != CassetteOff {
+		t.Errorf("ParseCassetteMode(off) = %q, %v", m, err)
+	}
+	if _, err := ParseCassetteMode("rewind"); err == nil {
+		t.Error("ParseCassetteMode should reject unknown modes")
+	}
+	if m, err := ParseMatchMode(""); err != nil || m != MatchNormalized {
+		t.Errorf("ParseMatchMode(\"\") = %q, %v", m, err)
+	}
+	if _, err := ParseMatchMode("fuzzy"); err == nil {
+		t.Error("ParseMatchMode should reject unknown modes")
+	}
+}
@@ -1,22 +1,39 @@
 // Package proxy provides an HTTP proxy for API key injection and rate limiting.
 //
 // This package implements a reverse proxy that sits between sandboxes and
-// external APIs (like the Anthropic API), injecting authentication and
-// enforcing rate limits without exposing API keys inside containers.
+// external APIs (Anthropic, OpenAI, Gemini, OpenRouter, ...), injecting
+// authentication and enforcing rate limits without exposing API keys inside
+// containers.
 //
 // # Key Features
 //
 //   - API key injection: Keys stay on the host, never enter containers
 //   - Per-sandbox rate limiting: Prevent runaway API usage
 //   - Audit logging: Track all API requests for compliance
-//   - Sandbox identification via X-Forage-Sandbox header
+//   - Sandbox identification via per-sandbox virtual API keys, falling
+//     back to the X-Forage-Sandbox header or source IP
+//   - A unix socket per sandbox, identifying requests by the socket they
+//     arrive on, for sandboxes without network access
+//   - Route table mapping path prefixes or virtual hosts to upstreams, each
+//     with its own key file and auth style
+//   - Retries with jittered backoff, failover to secondary upstreams or
+//     keys, and per-upstream circuit breakers reported by the admin API
+//   - Admin API (AdminHandler) with key reload, sandbox and rate limit
+//     state, per-sandbox request counters and Prometheus metrics
+//   - Secret redaction: known secret values and detector matches are
+//     redacted from outbound requests, or the requests blocked
+//   - Request policy from each sandbox's template: allowed models (rejected
+//     or rewritten to a default), max_tokens ceilings, and forbidden tools
+//     and beta features
+//   - Record and replay: cassettes of request/response pairs per sandbox,
+//     replayed without contacting upstream for offline agent tests
 //
 // # Configuration
 //
 //	cfg := &proxy.Config{
 //	    ListenAddr:        ":8080",
 //	    SecretsDir:        "/run/forage-secrets",
-//	    TargetURL:         "https://api.anthropic.com",
+//	    Routes:            proxy.DefaultRoutes(),
 //	    RateLimitRequests: 1000,
 //	    RateLimitWindow:   time.Hour,
 //	    AuditLogPath:      "/var/log/forage/proxy.log",
@@ -32,9 +49,11 @@
 //
 // # How It Works
 //
-//  1. Sandbox sends request with X-Forage-Sandbox header
-//  2. Proxy looks up API key for that sandbox
-//  3. Proxy injects Authorization header
-//  4. Request is forwarded to upstream API
-//  5. Response is returned to sandbox
+//  1. Sandbox sends request with its virtual API key (IssueToken)
+//  2. Proxy maps the key to the sandbox and selects the route by virtual
+//     host and path prefix
+//  3. Proxy looks up the route's real API key for that sandbox
+//  4. Proxy injects the key in the route's auth style
+//  5. Request is forwarded to the route's upstream with the prefix stripped
+//  6. Response is returned to sandbox
 package proxy
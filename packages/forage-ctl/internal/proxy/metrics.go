@@ -0,0 +1,187 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// latencyBuckets are the upper bounds, in seconds, of the request latency
+// histogram. API requests range from quick errors to minutes-long streams.
+var latencyBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300}
+
+// unknownSandbox labels requests that could not be attributed to a sandbox.
+const unknownSandbox = "unknown"
+
+// metrics counts proxied requests per sandbox.
+type metrics struct {
+	mu        sync.Mutex
+	sandboxes map[string]*sandboxMetrics
+}
+
+// sandboxMetrics are the request counters of one sandbox.
+type sandboxMetrics struct {
+	requests map[requestKey]int64
+	buckets  []int64 // per latencyBuckets bound, not cumulative
+	count    int64
+	sum      time.Duration
+	max      time.Duration
+}
+
+// requestKey groups requests for counting.
+type requestKey struct {
+	route string
+	code  int
+}
+
+func newMetrics() *metrics {
+	return &metrics{sandboxes: make(map[string]*sandboxMetrics)}
+}
+
+// observe records a completed request.
+func (m *metrics) observe(sandbox, route string, code int, d time.Duration) {
+	if sandbox == "" {
+		sandbox = unknownSandbox
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sm, ok := m.sandboxes[sandbox]
+	if !ok {
+		sm = &sandboxMetrics{
+			requests: make(map[requestKey]int64),
+			buckets:  make([]int64, len(latencyBuckets)),
+		}
+		m.sandboxes[sandbox] = sm
+	}
+	sm.requests[requestKey{route: route, code: code}]++
+	sm.count++
+	sm.sum += d
+	sm.max = max(sm.max, d)
+	for i, bound := range latencyBuckets {
+		if d.Seconds() <= bound {
+			sm.buckets[i]++
+			break
+		}
+	}
+}
+
+// SandboxStats are the request counters of one sandbox, as reported by the
+// admin API.
+type SandboxStats struct {
+	Sandbox      string           `json:"sandbox"`
+	Requests     int64            `json:"requests"`
+	ByStatus     map[string]int64 `json:"byStatus"` // status code -> requests
+	ByRoute      map[string]int64 `json:"byRoute"`  // route -> requests
+	AvgLatencyMs float64          `json:"avgLatencyMs"`
+	MaxLatencyMs float64          `json:"maxLatencyMs"`
+}
+
+// stats returns the counters of every sandbox, sorted by name.
+func (m *metrics) stats() []SandboxStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats := make([]SandboxStats, 0, len(m.sandboxes))
+	for name, sm := range m.sandboxes {
+		st := SandboxStats{
+			Sandbox:      name,
+			Requests:     sm.count,
+			ByStatus:     make(map[string]int64),
+			ByRoute:      make(map[string]int64),
+			MaxLatencyMs: float64(sm.max) / float64(time.Millisecond),
+		}
+		if sm.count > 0 {
+			st.AvgLatencyMs = float64(sm.sum) / float64(sm.count) / float64(time.Millisecond)
+		}
+		for key, n := range sm.requests {
+			st.ByStatus[strconv.Itoa(key.code)] += n
+			if key.route != "" {
+				st.ByRoute[key.route] += n
+			}
+		}
+		stats = append(stats, st)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Sandbox < stats[j].Sandbox })
+	return stats
+}
+
+// writeMetrics writes the proxy's metrics in the Prometheus text
+// exposition format.
+func (p *Proxy) writeMetrics(w io.Writer) {
+	p.metrics.mu.Lock()
+	names := make([]string, 0, len(p.metrics.sandboxes))
+	for name := range p.metrics.sandboxes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(w, "# HELP forage_proxy_requests_total Proxied API requests by sandbox, route and status code.")
+	fmt.Fprintln(w, "# TYPE forage_proxy_requests_total counter")
+	for _, name := range names {
+		sm := p.metrics.sandboxes[name]
+		keys := make([]requestKey, 0, len(sm.requests))
+		for key := range sm.requests {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			if keys[i].route != keys[j].route {
+				return keys[i].route < keys[j].route
+			}
+			return keys[i].code < keys[j].code
+		})
+		for _, key := range keys {
+			fmt.Fprintf(w, "forage_proxy_requests_total{sandbox=%s,route=%s,code=\"%d\"} %d\n",
+				promLabel(name), promLabel(key.route), key.code, sm.requests[key])
+		}
+	}
+
+	fmt.Fprintln(w, "# HELP forage_proxy_request_duration_seconds Latency of proxied API requests, until the response is complete.")
+	fmt.Fprintln(w, "# TYPE forage_proxy_request_duration_seconds histogram")
+	for _, name := range names {
+		sm := p.metrics.sandboxes[name]
+		var cumulative int64
+		for i, bound := range latencyBuckets {
+			cumulative += sm.buckets[i]
+			fmt.Fprintf(w, "forage_proxy_request_duration_seconds_bucket{sandbox=%s,le=\"%s\"} %d\n",
+				promLabel(name), strconv.FormatFloat(bound, 'g', -1, 64), cumulative)
+		}
+		fmt.Fprintf(w, "forage_proxy_request_duration_seconds_bucket{sandbox=%s,le=\"+Inf\"} %d\n", promLabel(name), sm.count)
+		fmt.Fprintf(w, "forage_proxy_request_duration_seconds_sum{sandbox=%s} %s\n",
+			promLabel(name), strconv.FormatFloat(sm.sum.Seconds(), 'g', -1, 64))
+		fmt.Fprintf(w, "forage_proxy_request_duration_seconds_count{sandbox=%s} %d\n", promLabel(name), sm.count)
+	}
+	p.metrics.mu.Unlock()
+
+	if p.rateLimiter != nil {
+		fmt.Fprintln(w, "# HELP forage_proxy_rate_limit_requests Requests counted against each sandbox's rate limit in the current window.")
+		fmt.Fprintln(w, "# TYPE forage_proxy_rate_limit_requests gauge")
+		for _, st := range p.RateLimits() {
+			fmt.Fprintf(w, "forage_proxy_rate_limit_requests{sandbox=%s} %d\n", promLabel(st.Sandbox), st.Requests)
+		}
+	}
+
+	fmt.Fprintln(w, "# HELP forage_proxy_upstream_circuit_open Whether an upstream's circuit breaker is open (1) or half-open (0.5).")
+	fmt.Fprintln(w, "# TYPE forage_proxy_upstream_circuit_open gauge")
+	for _, u := range p.Status().Upstreams {
+		value := "0"
+		switch u.State {
+		case BreakerOpen:
+			value = "1"
+		case BreakerHalfOpen:
+			value = "0.5"
+		}
+		fmt.Fprintf(w, "forage_proxy_upstream_circuit_open{route=%s,upstream=%s,secret_file=%s} %s\n",
+			promLabel(u.Route), promLabel(u.Upstream), promLabel(u.SecretFile), value)
+	}
+}
+
+// promLabel quotes a Prometheus label value.
+func promLabel(v string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return `"` + r.Replace(v) + `"`
+}
@@ -0,0 +1,298 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/audit"
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/config"
+)
+
+// policyRefreshInterval is how often a sandbox's template is reread, so
+// policy changes apply without restarting the proxy.
+const policyRefreshInterval = 10 * time.Second
+
+// maxTokenFields are the request fields that set the output token limit in
+// the Anthropic, OpenAI chat and OpenAI responses APIs.
+var maxTokenFields = []string{"max_tokens", "max_completion_tokens", "max_output_tokens"}
+
+// maxTokenEndpoints maps the path suffixes of generation endpoints to the
+// output token limit field set to the ceiling when a request leaves it out.
+var maxTokenEndpoints = map[string]string{
+	"/v1/messages":         "max_tokens",
+	"/v1/chat/completions": "max_completion_tokens",
+	"/v1/responses":        "max_output_tokens",
+}
+
+// pathModelRe extracts the model from Gemini-style request paths such as
+// /v1beta/models/gemini-2.5-pro:generateContent.
+var pathModelRe = regexp.MustCompile(`^(.*/models/)([^/:]+)(:.*)?$`)
+
+// policyStore caches the request policy of each sandbox's template.
+type policyStore struct {
+	sandboxesDir string
+	templatesDir string
+	now          func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]policyEntry
+}
+
+// policyEntry is the cached policy of one sandbox.
+type policyEntry struct {
+	policy   *config.RequestPolicy // nil if the template has no policy
+	loadedAt time.Time
+}
+
+func newPolicyStore(sandboxesDir, templatesDir string) *policyStore {
+	return &policyStore{
+		sandboxesDir: sandboxesDir,
+		templatesDir: templatesDir,
+		now:          time.Now,
+		entries:      make(map[string]policyEntry),
+	}
+}
+
+// get returns the sandbox's request policy. If its template can no longer
+// be read, the last policy loaded stays in force.
+func (s *policyStore) get(sandbox string) *config.RequestPolicy {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	e, ok := s.entries[sandbox]
+	if ok && now.Sub(e.loadedAt) < policyRefreshInterval {
+		return e.policy
+	}
+	e.loadedAt = now
+	if meta, err := config.LoadSandboxMetadata(s.sandboxesDir, sandbox); err == nil {
+		if tmpl, err := config.LoadTemplate(s.templatesDir, meta.Template); err == nil {
+			e.policy = nil
+			if !tmpl.Policy.IsEmpty() {
+				e.policy = tmpl.Policy
+			}
+		}
+	}
+	s.entries[sandbox] = e
+	return e.policy
+}
+
+// reset drops the cached policies.
+func (s *policyStore) reset() {
+	s.mu.Lock()
+	s.entries = make(map[string]policyEntry)
+	s.mu.Unlock()
+}
+
+// enforcePolicy applies the sandbox's request policy, rewriting the request
+// or rejecting it. Rejections are recorded in the sandbox's audit log. It
+// reports whether the request may proceed.
+func (p *Proxy) enforcePolicy(w http.ResponseWriter, r *http.Request, sandboxName, routeName string) bool {
+	policy := p.policies.get(sandboxName)
+	if policy == nil {
+		return true
+	}
+
+	rewrites, violation, err := applyPolicy(r, policy)
+	if err != nil {
+		http.Error(w, `{"error": {"type": "invalid_request_error", "message": "Failed to read request body"}}`,
+			http.StatusBadRequest)
+		return false
+	}
+	if violation != "" {
+		p.config.Logger.Warn("request violates policy", "sandbox", sandboxName, "route", routeName, "violation", violation)
+		if p.config.StateDir != "" {
+			if err := p.events.LogEvent(audit.EventPolicy, sandboxName, "blocked API request: "+violation); err != nil {
+				p.config.Logger.Warn("failed to log policy event", "sandbox", sandboxName, "error", err)
+			}
+		}
+		writePolicyError(w, violation)
+		return false
+	}
+	if len(rewrites) > 0 {
+		p.config.Logger.Debug("rewrote request per policy", "sandbox", sandboxName, "route", routeName, "rewrites", strings.Join(rewrites, ", "))
+	}
+	return true
+}
+
+// applyPolicy checks a request against a policy, rewriting disallowed
+// models to the default model and lowering output token limits to the
+// ceiling, or setting them to it where a generation request leaves them
+// out. It returns the rewrites made, or the first violation found.
+// Bodies that are not JSON objects are only checked for their path model
+// and beta headers.
+func applyPolicy(r *http.Request, policy *config.RequestPolicy) (rewrites []string, violation string, err error) {
+	for _, value := range r.Header.Values("anthropic-beta") {
+		for _, beta := range strings.Split(value, ",") {
+			if beta = strings.TrimSpace(beta); beta != "" && policy.ForbidsBeta(beta) {
+				return nil, fmt.Sprintf("beta feature %q is not allowed", beta), nil
+			}
+		}
+	}
+
+	if m := pathModelRe.FindStringSubmatch(r.URL.Path); m != nil && !policy.AllowsModel(m[2]) {
+		if policy.DefaultModel == "" {
+			return nil, fmt.Sprintf("model %q is not allowed", m[2]), nil
+		}
+		r.URL.Path = m[1] + policy.DefaultModel + m[3]
+		r.URL.RawPath = ""
+		rewrites = append(rewrites, fmt.Sprintf("model %s -> %s", m[2], policy.DefaultModel))
+	}
+
+	if r.Body == nil || r.Body == http.NoBody {
+		return rewrites, "", nil
+	}
+	body, err := io.ReadAll(r.Body)
+	_ = r.Body.Close()
+	if err != nil {
+		return nil, "", err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return rewrites, "", nil
+	}
+	changed := false
+
+	var model string
+	if raw, ok := fields["model"]; ok && json.Unmarshal(raw, &model) == nil && !policy.AllowsModel(model) {
+		if policy.DefaultModel == "" {
+			return nil, fmt.Sprintf("model %q is not allowed", model), nil
+		}
+		fields["model"], _ = json.Marshal(policy.DefaultModel)
+		rewrites = append(rewrites, fmt.Sprintf("model %s -> %s", model, policy.DefaultModel))
+		changed = true
+	}
+
+	if raw, ok := fields["tools"]; ok && len(policy.ForbiddenTools) > 0 {
+		var tools []struct {
+			Name     string `json:"name"`
+			Type     string `json:"type"`
+			Function struct {
+				Name string `json:"name"`
+			} `json:"function"`
+		}
+		_ = json.Unmarshal(raw, &tools)
+		for _, tool := range tools {
+			for _, name := range []string{tool.Name, tool.Type, tool.Function.Name} {
+				if name != "" && policy.ForbidsTool(name) {
+					return nil, fmt.Sprintf("tool %q is not allowed", name), nil
+				}
+			}
+		}
+	}
+
+	if policy.MaxTokens > 0 {
+		limited := false
+		for _, field := range maxTokenFields {
+			if _, ok := fields[field]; ok {
+				limited = true
+			}
+			if clampTokens(fields, field, policy.MaxTokens) {
+				rewrites = append(rewrites, fmt.Sprintf("%s -> %d", field, policy.MaxTokens))
+				changed = true
+			}
+		}
+		if field := maxTokenField(r.URL.Path); field != "" && !limited {
+			fields[field] = json.RawMessage(strconv.Itoa(policy.MaxTokens))
+			rewrites = append(rewrites, fmt.Sprintf("%s = %d", field, policy.MaxTokens))
+			changed = true
+		}
+		// Extended thinking budgets must stay below max_tokens
+		if raw, ok := fields["thinking"]; ok {
+			var thinking map[string]json.RawMessage
+			if json.Unmarshal(raw, &thinking) == nil && clampTokens(thinking, "budget_tokens", policy.MaxTokens-1) {
+				fields["thinking"], _ = json.Marshal(thinking)
+				changed = true
+			}
+		}
+		if raw, ok := fields["generationConfig"]; ok {
+			var gen map[string]json.RawMessage
+			if json.Unmarshal(raw, &gen) == nil && clampTokens(gen, "maxOutputTokens", policy.MaxTokens) {
+				fields["generationConfig"], _ = json.Marshal(gen)
+				rewrites = append(rewrites, fmt.Sprintf("maxOutputTokens -> %d", policy.MaxTokens))
+				changed = true
+			}
+		}
+		if isGeminiGeneration(r.URL.Path) {
+			gen := make(map[string]json.RawMessage)
+			if raw, ok := fields["generationConfig"]; ok && json.Unmarshal(raw, &gen) != nil {
+				gen = nil
+			}
+			if _, ok := gen["maxOutputTokens"]; gen != nil && !ok {
+				gen["maxOutputTokens"] = json.RawMessage(strconv.Itoa(policy.MaxTokens))
+				fields["generationConfig"], _ = json.Marshal(gen)
+				rewrites = append(rewrites, fmt.Sprintf("maxOutputTokens = %d", policy.MaxTokens))
+				changed = true
+			}
+		}
+	}
+
+	if changed {
+		body, err = json.Marshal(fields)
+		if err != nil {
+			return nil, "", err
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		r.ContentLength = int64(len(body))
+		r.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	}
+	return rewrites, "", nil
+}
+
+// maxTokenField returns the output token limit field of the generation
+// endpoint at path, or "" if it is not one.
+func maxTokenField(path string) string {
+	for suffix, field := range maxTokenEndpoints {
+		if strings.HasSuffix(path, suffix) {
+			return field
+		}
+	}
+	return ""
+}
+
+// isGeminiGeneration reports whether path is a Gemini content generation
+// endpoint, whose output token limit is generationConfig.maxOutputTokens.
+func isGeminiGeneration(path string) bool {
+	m := pathModelRe.FindStringSubmatch(path)
+	return m != nil && (m[3] == ":generateContent" || m[3] == ":streamGenerateContent")
+}
+
+// clampTokens lowers the numeric field to ceiling if it exceeds it,
+// reporting whether it did.
+func clampTokens(fields map[string]json.RawMessage, field string, ceiling int) bool {
+	raw, ok := fields[field]
+	if !ok {
+		return false
+	}
+	var n int
+	if err := json.Unmarshal(raw, &n); err != nil || n <= ceiling {
+		return false
+	}
+	fields[field] = json.RawMessage(strconv.Itoa(ceiling))
+	return true
+}
+
+// writePolicyError answers a request that violates its sandbox's policy
+// with an API-style permission error.
+func writePolicyError(w http.ResponseWriter, violation string) {
+	body, _ := json.Marshal(map[string]any{
+		"type": "error",
+		"error": map[string]string{
+			"type":    "permission_error",
+			"message": "Request blocked by the forage proxy policy: " + violation,
+		},
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusForbidden)
+	_, _ = w.Write(body)
+}
@@ -0,0 +1,243 @@
+package proxy
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/audit"
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/config"
+)
+
+func TestApplyPolicy(t *testing.T) {
+	policy := &config.RequestPolicy{
+		AllowedModels:  []string{"claude-sonnet-*", "gemini-2.5-flash"},
+		DefaultModel:   "claude-sonnet-4-5",
+		MaxTokens:      8192,
+		ForbiddenTools: []string{"web_search*", "shell"},
+		ForbiddenBetas: []string{"computer-use-*"},
+	}
+	tests := []struct {
+		name          string
+		path          string
+		body          string
+		beta          string
+		wantPath      string
+		wantBody      string // compared as JSON; empty = unchanged
+		wantViolation string
+	}{
+		{
+			name: "allowed request passes unchanged",
+			path: "/v1/messages",
+			body: `{"model":"claude-sonnet-4-5","max_tokens":1024}`,
+		},
+		{
+			name:     "model rewritten and tokens clamped",
+			path:     "/v1/messages",
+			body:     `{"model":"claude-opus-4-1","max_tokens":32000,"thinking":{"type":"enabled","budget_tokens":16000}}`,
+			wantBody: `{"model":"claude-sonnet-4-5","max_tokens":8192,"thinking":{"type":"enabled","budget_tokens":8191}}`,
+		},
+		{
+			name:     "OpenAI token field clamped",
+			path:     "/openai/v1/chat/completions",
+			body:     `{"model":"claude-sonnet-4","max_completion_tokens":10000}`,
+			wantBody: `{"model":"claude-sonnet-4","max_completion_tokens":8192}`,
+		},
+		{
+			name:     "OpenAI chat token limit added",
+			path:     "/openai/v1/chat/completions",
+			body:     `{"model":"claude-sonnet-4","messages":[]}`,
+			wantBody: `{"model":"claude-sonnet-4","messages":[],"max_completion_tokens":8192}`,
+		},
+		{
+			name: "OpenAI deprecated token field kept",
+			path: "/openai/v1/chat/completions",
+			body: `{"model":"claude-sonnet-4","max_tokens":1024}`,
+		},
+		{
+			name:     "OpenAI responses token limit added",
+			path:     "/openai/v1/responses",
+			body:     `{"model":"claude-sonnet-4","input":"hi"}`,
+			wantBody: `{"model":"claude-sonnet-4","input":"hi","max_output_tokens":8192}`,
+		},
+		{
+			name:     "Gemini token limit added",
+			path:     "/gemini/v1beta/models/gemini-2.5-flash:generateContent",
+			body:     `{"contents":[],"generationConfig":{"temperature":0}}`,
+			wantBody: `{"contents":[],"generationConfig":{"temperature":0,"maxOutputTokens":8192}}`,
+		},
+		{
+			name: "token limit not added outside generation endpoints",
+			path: "/v1/messages/count_tokens",
+			body: `{"model":"claude-sonnet-4-5","messages":[]}`,
+		},
+		{
+			name:          "forbidden server tool",
+			path:          "/v1/messages",
+			body:          `{"model":"claude-sonnet-4-5","tools":[{"type":"web_search_20250305","name":"web_search"}]}`,
+			wantViolation: `tool "web_search" is not allowed`,
+		},
+		{
+			name:          "forbidden OpenAI function",
+			path:          "/openai/v1/chat/completions",
+			body:          `{"model":"claude-sonnet-4-5","tools":[{"type":"function","function":{"name":"shell"}}]}`,
+			wantViolation: `tool "shell" is not allowed`,
+		},
+		{
+			name:          "forbidden beta",
+			path:          "/v1/messages",
+			body:          `{"model":"claude-sonnet-4-5"}`,
+			beta:          "prompt-caching-2024-07-31, computer-use-2025-01-24",
+			wantViolation: `beta feature "computer-use-2025-01-24" is not allowed`,
+		},
+		{
+			name:     "Gemini path model rewritten",
+			path:     "/gemini/v1beta/models/gemini-2.5-pro:generateContent",
+			body:     `{"generationConfig":{"maxOutputTokens":65536}}`,
+			wantPath: "/gemini/v1beta/models/claude-sonnet-4-5:generateContent",
+			wantBody: `{"generationConfig":{"maxOutputTokens":8192}}`,
+		},
+		{
+			name: "non-JSON body passes",
+			path: "/v1/files",
+			body: "plain upload",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", tt.path, strings.NewReader(tt.body))
+			if tt.beta != "" {
+				r.Header.Set("anthropic-beta", tt.beta)
+			}
+			_, violation, err := applyPolicy(r, policy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if violation != tt.wantViolation {
+				t.Fatalf("violation = %q, want %q", violation, tt.wantViolation)
+			}
+			if violation != "" {
+				return
+			}
+			wantPath := tt.path
+			if tt.wantPath != "" {
+				wantPath = tt.wantPath
+			}
+			if r.URL.Path != wantPath {
+				t.Errorf("path = %q, want %q", r.URL.Path, wantPath)
+			}
+			body, _ := io.ReadAll(r.Body)
+			if tt.wantBody == "" {
+				if string(body) != tt.body {
+					t.Errorf("body = %s, want it unchanged", body)
+				}
+				return
+			}
+			var got, want any
+			_ = json.Unmarshal(body, &got)
+			_ = json.Unmarshal([]byte(tt.wantBody), &want)
+			gotJSON, _ := json.Marshal(got)
+			wantJSON, _ := json.Marshal(want)
+			if string(gotJSON) != string(wantJSON) {
+				t.Errorf("body = %s, want %s", gotJSON, wantJSON)
+			}
+			if r.ContentLength != int64(len(body)) {
+				t.Errorf("ContentLength = %d, want %d", r.ContentLength, len(body))
+			}
+		})
+	}
+}
+
+func TestProxy_Policy(t *testing.T) {
+	var models []string
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Model string `json:"model"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		models = append(models, req.Model)
+		io.WriteString(w, "{}")
+	}))
+	defer upstream.Close()
+
+	tmpDir := t.TempDir()
+	stateDir := filepath.Join(tmpDir, "state")
+	sandboxesDir := filepath.Join(tmpDir, "sandboxes")
+	templatesDir := filepath.Join(tmpDir, "templates")
+	os.MkdirAll(templatesDir, 0755)
+	if err := config.SaveSandboxMetadata(sandboxesDir, &config.SandboxMetadata{Name: "sb", Template: "strict"}); err != nil {
+		t.Fatal(err)
+	}
+	writeTemplate := func(allowed string) {
+		tmpl := config.Template{
+			Name:   "strict",
+			Agents: map[string]config.AgentConfig{"claude": {PackagePath: "/nix/store/claude", SecretName: "anthropic", AuthEnvVar: "ANTHROPIC_API_KEY"}},
+			Policy: &config.RequestPolicy{AllowedModels: []string{allowed}},
+		}
+		data, _ := json.Marshal(tmpl)
+		if err := os.WriteFile(filepath.Join(templatesDir, "strict.json"), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeTemplate("claude-haiku-*")
+
+	p, err := New(&Config{
+		SecretsDir:   filepath.Join(tmpDir, "secrets"),
+		StateDir:     stateDir,
+		SandboxesDir: sandboxesDir,
+		TemplatesDir: templatesDir,
+		TargetURL:    upstream.URL,
+		Transport:    upstream.Client().Transport,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	if err := p.LoadAPIKeys(); err != nil {
+		t.Fatal(err)
+	}
+	send := func(sandbox, model string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/v1/messages", strings.NewReader(`{"model":"`+model+`"}`))
+		req.Header.Set("X-Forage-Sandbox", sandbox)
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := send("sb", "claude-haiku-4-5"); w.Code != http.StatusOK {
+		t.Fatalf("allowed model: status %d", w.Code)
+	}
+	w := send("sb", "claude-opus-4-1")
+	if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), `"permission_error"`) {
+		t.Fatalf("disallowed model: status %d, body %s", w.Code, w.Body)
+	}
+	// Sandboxes without metadata have no policy
+	if w := send("other", "claude-opus-4-1"); w.Code != http.StatusOK {
+		t.Errorf("sandbox without policy: status %d", w.Code)
+	}
+	if strings.Join(models, ",") != "claude-haiku-4-5,claude-opus-4-1" {
+		t.Errorf("upstream saw models %v", models)
+	}
+
+	events, err := audit.NewLogger(stateDir).Events("sb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Type != audit.EventPolicy || !strings.Contains(events[0].Details, "claude-opus-4-1") {
+		t.Errorf("audit events = %+v", events)
+	}
+
+	// A reload picks up template changes at once
+	writeTemplate("claude-opus-*")
+	if err := p.LoadAPIKeys(); err != nil {
+		t.Fatal(err)
+	}
+	if w := send("sb", "claude-opus-4-1"); w.Code != http.StatusOK {
+		t.Errorf("after template change: status %d", w.Code)
+	}
+}
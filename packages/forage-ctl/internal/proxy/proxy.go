@@ -2,20 +2,27 @@
 package proxy
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"net"
 	"net/http"
 	"net/http/httputil"
+	"net/netip"
 	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/audit"
 	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/config"
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/usage"
 )
 
 // Config holds proxy configuration
@@ -23,12 +30,30 @@ type Config struct {
 	// ListenAddr is the address to listen on (e.g., ":8080")
 	ListenAddr string
 
+	// AdminAddr is where the admin API and Prometheus metrics are served:
+	// a host-local TCP address or "unix:<path>" (empty = no admin API)
+	AdminAddr string
+
 	// SecretsDir is the directory containing API key files
 	SecretsDir string
 
-	// TargetURL is the upstream API URL (e.g., "https://api.anthropic.com")
+	// TargetURL is the upstream API URL (e.g., "https://api.anthropic.com").
+	// Used as the single route when Routes is empty.
 	TargetURL string
 
+	// Routes maps path prefixes and virtual hosts to upstream APIs, each
+	// with its own key file and auth style. When empty, every request goes
+	// to TargetURL with the key from APIKeyFilename in X-Api-Key.
+	Routes []Route
+
+	// Retry retries upstream requests that fail before the response has
+	// started (zero value = no retries)
+	Retry RetryPolicy
+
+	// Breaker opens a per-upstream circuit after consecutive failures,
+	// failing over to the route's next upstream (zero value = no breaker)
+	Breaker BreakerPolicy
+
 	// RateLimitRequests is the max requests per window (0 = unlimited)
 	RateLimitRequests int
 
@@ -38,14 +63,78 @@ type Config struct {
 	// AuditLogPath is the path to write audit logs (empty = no logging)
 	AuditLogPath string
 
+	// UsagePath is the token usage store to record API usage in
+	// (empty = no usage accounting)
+	UsagePath string
+
+	// StateDir is the forage state directory. When set, sandboxes are
+	// identified by the virtual API keys issued to them, and together with
+	// UsagePath, per-sandbox budgets are enforced and budget events are
+	// written to the sandboxes' audit logs.
+	StateDir string
+
+	// AuditKey signs the events written to sandboxes' audit logs
+	// (nil = unsigned)
+	AuditKey []byte
+
+	// Sockets additionally serves each sandbox on a unix socket in its
+	// token directory (requires StateDir). Requests arriving on a socket
+	// are identified by it, which lets sandboxes without network access
+	// reach the proxy.
+	Sockets bool
+
+	// RequireToken rejects requests that do not carry a virtual API key
+	// instead of identifying them by header or source IP
+	RequireToken bool
+
+	// Prices estimates API cost for cost budgets
+	Prices usage.Prices
+
+	// PauseSandbox stops a sandbox whose budget asks to be paused once
+	// exhausted (nil = never pause)
+	PauseSandbox func(name string) error
+
+	// Redact scans outbound request bodies for secrets and redacts them or
+	// blocks the request (RedactOff = no scanning). Secrets are the values
+	// of the HostSecrets files and of every file in the sandbox's secrets
+	// directory, plus matches of Detectors.
+	Redact RedactMode
+
+	// HostSecrets maps the host's secret names to the files holding them
+	HostSecrets map[string]string
+
+	// Detectors find secrets by pattern when redacting
+	Detectors []Detector
+
 	// APIKeyFilename is the name of the file within each sandbox's secrets
-	// directory that contains the API key. Defaults to "anthropic-api-key".
+	// directory that contains the API key for TargetURL. Defaults to
+	// "anthropic-api-key".
 	APIKeyFilename string
 
+	// CassetteMode records API traffic to per-sandbox cassettes or replays
+	// it from them without contacting upstream (CassetteOff = neither)
+	CassetteMode CassetteMode
+
+	// CassetteDir is the directory holding the cassettes
+	CassetteDir string
+
+	// CassetteMatch selects how replayed requests are matched to
+	// recordings (default MatchNormalized)
+	CassetteMatch MatchMode
+
+	// ReplaySpeed scales the recorded delays between streamed chunks when
+	// replaying (1 = as recorded, 0 = no delays)
+	ReplaySpeed float64
+
 	// SandboxesDir is the directory containing sandbox metadata files.
 	// When set, enables IP-based sandbox identity verification.
 	SandboxesDir string
 
+	// TemplatesDir is the directory containing template files. Together
+	// with SandboxesDir, it enforces the request policy of each sandbox's
+	// template.
+	TemplatesDir string
+
 	// Logger for proxy operations
 	Logger *slog.Logger
 
@@ -56,37 +145,50 @@ type Config struct {
 
 // Proxy is an HTTP reverse proxy with auth injection
 type Proxy struct {
-	config       *Config
-	reverseProxy *httputil.ReverseProxy
-	rateLimiter  *rateLimiter
-	auditLog     *auditLogger
-	apiKeys      map[string]string // sandbox name -> API key
-	ipToSandbox  map[string]string // container IP -> sandbox name
-	keysMu       sync.RWMutex
+	config         *Config
+	routes         *routeTable
+	reverseProxies map[*route]*httputil.ReverseProxy
+	rateLimiter    *rateLimiter
+	auditLog       *auditLogger
+	usage          *usage.Store
+	budgets        *budgetTracker
+	cassettes      *cassetteStore
+	tokens         *tokenIndex
+	redactor       *redactor
+	policies       *policyStore
+	events         *audit.Logger
+	metrics        *metrics
+	apiKeys        map[string]map[string]string // sandbox name -> secret file -> API key
+	secrets        map[string][]namedSecret     // sandbox name -> secrets to redact
+	ipToSandbox    map[string]string            // container IP -> sandbox name
+	hostSecrets    []namedSecret
+	keysMu         sync.RWMutex
 }
 
 // New creates a new proxy instance
 func New(cfg *Config) (*Proxy, error) {
-	target, err := url.Parse(cfg.TargetURL)
-	if err != nil {
-		return nil, fmt.Errorf("invalid target URL: %w", err)
-	}
-
-	// Validate the target URL scheme to prevent plaintext key transmission
-	if target.Scheme != "https" {
-		return nil, fmt.Errorf("proxy target must use HTTPS (got %q) to protect API keys in transit", target.Scheme)
+	if cfg.APIKeyFilename == "" {
+		cfg.APIKeyFilename = "anthropic-api-key"
 	}
 
-	// Reject targets that could be used for SSRF against internal services.
-	// Skip this check when a custom Transport is provided (used in tests
-	// with httptest.NewTLSServer which binds to 127.0.0.1).
-	targetHost := target.Hostname()
-	if cfg.Transport == nil && isInternalHost(targetHost) {
-		return nil, fmt.Errorf("proxy target must not point to internal/link-local addresses: %s", targetHost)
+	routes := cfg.Routes
+	if len(routes) == 0 {
+		if _, err := url.Parse(cfg.TargetURL); err != nil {
+			return nil, fmt.Errorf("invalid target URL: %w", err)
+		}
+		routes = []Route{{
+			Name:       "default",
+			Upstream:   cfg.TargetURL,
+			SecretFile: cfg.APIKeyFilename,
+			AuthStyle:  AuthStyleAPIKey,
+		}}
 	}
 
-	if cfg.APIKeyFilename == "" {
-		cfg.APIKeyFilename = "anthropic-api-key"
+	// Skip the internal-address check when a custom Transport is provided
+	// (used in tests with httptest.NewTLSServer which binds to 127.0.0.1).
+	table, err := newRouteTable(routes, cfg.Transport == nil)
+	if err != nil {
+		return nil, err
 	}
 
 	if cfg.Logger == nil {
@@ -94,31 +196,47 @@ func New(cfg *Config) (*Proxy, error) {
 	}
 
 	p := &Proxy{
-		config:      cfg,
-		apiKeys:     make(map[string]string),
-		ipToSandbox: make(map[string]string),
+		config:         cfg,
+		routes:         table,
+		reverseProxies: make(map[*route]*httputil.ReverseProxy, len(table.routes)),
+		apiKeys:        make(map[string]map[string]string),
+		secrets:        make(map[string][]namedSecret),
+		metrics:        newMetrics(),
+		ipToSandbox:    make(map[string]string),
 	}
 
-	// Create reverse proxy
-	p.reverseProxy = &httputil.ReverseProxy{
-		Director: func(req *http.Request) {
-			req.URL.Scheme = target.Scheme
-			req.URL.Host = target.Host
-			req.Host = target.Host
-
-			// Remove hop-by-hop headers
-			req.Header.Del("Connection")
-			req.Header.Del("Proxy-Connection")
-			req.Header.Del("Proxy-Authenticate")
-			req.Header.Del("Proxy-Authorization")
-		},
-		ModifyResponse: p.modifyResponse,
-		ErrorHandler:   p.errorHandler,
-	}
+	// Create a reverse proxy per route
+	for _, rt := range table.routes {
+		rt := rt
+		rp := &httputil.ReverseProxy{
+			Director: func(req *http.Request) {
+				rt.rewrite(req)
+
+				// Let the transport negotiate compression so that response
+				// bodies arrive decoded for usage accounting
+				if p.usage != nil {
+					req.Header.Del("Accept-Encoding")
+				}
 
-	// Use custom transport if provided (e.g., for TLS test servers)
-	if cfg.Transport != nil {
-		p.reverseProxy.Transport = cfg.Transport
+				// Remove hop-by-hop headers
+				req.Header.Del("Connection")
+				req.Header.Del("Proxy-Connection")
+				req.Header.Del("Proxy-Authenticate")
+				req.Header.Del("Proxy-Authorization")
+			},
+			ModifyResponse: p.modifyResponse,
+			ErrorHandler:   p.errorHandler,
+		}
+		// Use custom transport if provided (e.g., for TLS test servers)
+		base := http.DefaultTransport
+		if cfg.Transport != nil {
+			base = cfg.Transport
+		}
+		for _, target := range rt.targets {
+			target.breaker = newBreaker(cfg.Breaker)
+		}
+		rp.Transport = newResilientTransport(base, rt, p, cfg.Retry)
+		p.reverseProxies[rt] = rp
 	}
 
 	// Create rate limiter if configured
@@ -135,78 +253,180 @@ func New(cfg *Config) (*Proxy, error) {
 		p.auditLog = al
 	}
 
+	// Open usage store if configured
+	if cfg.UsagePath != "" {
+		store, err := usage.Open(cfg.UsagePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open usage store: %w", err)
+		}
+		p.usage = store
+
+		if cfg.StateDir != "" {
+			p.budgets = newBudgetTracker(cfg.StateDir, cfg.UsagePath, cfg.Prices)
+		}
+	}
+
+	if cfg.StateDir != "" {
+		p.tokens = newTokenIndex(cfg.StateDir)
+		p.events = audit.NewLogger(cfg.StateDir, audit.WithKey(cfg.AuditKey))
+	}
+
+	if cfg.Redact != RedactOff {
+		r, err := newRedactor(cfg.Redact, cfg.Detectors)
+		if err != nil {
+			return nil, err
+		}
+		p.redactor = r
+	}
+
+	if cfg.SandboxesDir != "" && cfg.TemplatesDir != "" {
+		p.policies = newPolicyStore(cfg.SandboxesDir, cfg.TemplatesDir)
+	}
+
+	if cfg.CassetteMode != CassetteOff {
+		if cfg.CassetteDir == "" {
+			return nil, fmt.Errorf("cassette mode %q requires a cassette directory", cfg.CassetteMode)
+		}
+		p.cassettes = newCassetteStore(cfg.CassetteDir, cfg.CassetteMode, cfg.CassetteMatch, cfg.ReplaySpeed)
+	}
+
 	return p, nil
 }
 
 // ServeHTTP implements http.Handler
 func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	startTime := time.Now()
+	// Wrap response writer for logging
+	lw := &loggingResponseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+	sandboxName, routeName := p.serve(lw, r, startTime)
+	p.metrics.observe(sandboxName, routeName, lw.statusCode, time.Since(startTime))
 
-	// Extract and verify sandbox identity.
-	// Prefer X-Forage-Sandbox header but verify it matches source IP.
-	sandboxName := r.Header.Get("X-Forage-Sandbox")
-	if sandboxName != "" {
-		sandboxName = p.verifySandboxIdentity(sandboxName, r.RemoteAddr)
-	} else {
-		// Fall back to checking source IP against known sandbox IPs
-		sandboxName = p.identifySandbox(r.RemoteAddr)
+	// Audit log, including requests rejected before forwarding
+	if p.auditLog != nil {
+		p.auditLog.log(LogEntry{
+			Timestamp:   startTime,
+			Duration:    time.Since(startTime),
+			Sandbox:     sandboxName,
+			Route:       routeName,
+			Method:      r.Method,
+			Path:        r.URL.Path,
+			StatusCode:  lw.statusCode,
+			RequestSize: r.ContentLength,
+			RemoteAddr:  r.RemoteAddr,
+		})
+	}
+}
+
+// serve proxies a request, reporting the sandbox and route it was
+// attributed to.
+func (p *Proxy) serve(lw *loggingResponseWriter, r *http.Request, startTime time.Time) (sandboxName, routeName string) {
+	sandboxName, ok := p.identify(r)
+	if !ok {
+		p.config.Logger.Warn("rejected unauthenticated request", "path", r.URL.Path, "remote", r.RemoteAddr)
+		http.Error(lw, `{"type": "error", "error": {"type": "authentication_error", "message": "Invalid or revoked sandbox API key"}}`,
+			http.StatusUnauthorized)
+		return
+	}
+
+	rt := p.routes.match(r)
+	if rt != nil {
+		routeName = rt.Name
 	}
 
 	p.config.Logger.Debug("proxy request",
 		"method", r.Method,
 		"path", r.URL.Path,
+		"route", routeName,
 		"sandbox", sandboxName,
 		"remote", r.RemoteAddr)
 
+	if rt == nil {
+		http.Error(lw, `{"error": {"type": "not_found_error", "message": "No proxy route for this path"}}`,
+			http.StatusNotFound)
+		return
+	}
+
 	// Check rate limit
 	if p.rateLimiter != nil && sandboxName != "" {
 		if !p.rateLimiter.allow(sandboxName) {
 			p.config.Logger.Warn("rate limit exceeded", "sandbox", sandboxName)
-			http.Error(w, `{"error": {"type": "rate_limit_error", "message": "Rate limit exceeded"}}`,
+			http.Error(lw, `{"error": {"type": "rate_limit_error", "message": "Rate limit exceeded"}}`,
 				http.StatusTooManyRequests)
 			return
 		}
 	}
 
-	// Inject API key if available
-	if sandboxName != "" {
-		apiKey := p.getAPIKey(sandboxName)
-		if apiKey != "" {
-			r.Header.Set("X-Api-Key", apiKey)
-			// Only set X-Api-Key (used by Anthropic API). Do not also
-			// set Authorization: Bearer as it doubles leakage surface.
-			// Remove the sandbox header before forwarding
-			r.Header.Del("X-Forage-Sandbox")
+	// Check budget
+	if p.budgets != nil && sandboxName != "" {
+		status, err := p.budgets.check(sandboxName)
+		if err != nil {
+			p.config.Logger.Warn("failed to check budget", "sandbox", sandboxName, "error", err)
+		} else if status.reason != "" {
+			p.budgetExhausted(sandboxName, status)
+			writeBudgetError(lw, status.reason)
+			return
 		}
 	}
 
-	// Wrap response writer for logging
-	lw := &loggingResponseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+	// Keep secrets out of outbound prompts, and out of cassettes
+	if p.redactor != nil && !p.redact(lw, r, sandboxName, routeName) {
+		return
+	}
 
-	// Forward request
-	p.reverseProxy.ServeHTTP(lw, r)
+	// Enforce the template's model, token and feature policy
+	if p.policies != nil && sandboxName != "" && !p.enforcePolicy(lw, r, sandboxName, routeName) {
+		return
+	}
 
-	// Audit log
-	if p.auditLog != nil {
-		p.auditLog.log(auditEntry{
-			Timestamp:   startTime,
-			Duration:    time.Since(startTime),
-			Sandbox:     sandboxName,
-			Method:      r.Method,
-			Path:        r.URL.Path,
-			StatusCode:  lw.statusCode,
-			RequestSize: r.ContentLength,
-			RemoteAddr:  r.RemoteAddr,
-		})
+	info := requestInfo{sandbox: sandboxName, route: routeName, start: startTime}
+
+	// Capture the request for the cassette before credentials are added
+	if p.cassettes != nil {
+		recorded, err := recordRequest(r, routeName)
+		if err != nil {
+			http.Error(lw, `{"error": {"type": "invalid_request_error", "message": "Failed to read request body"}}`,
+				http.StatusBadRequest)
+			return
+		}
+		info.recorded = recorded
 	}
+
+	if p.cassettes != nil && p.cassettes.mode == CassetteReplay {
+		p.replay(lw, r, info)
+	} else {
+		// Inject API key if available
+		if sandboxName != "" {
+			apiKey := p.getAPIKey(sandboxName, rt.SecretFile)
+			if apiKey != "" {
+				// Only use the route's auth style. Setting the key in several
+				// places would multiply the leakage surface.
+				rt.injectAuth(r, apiKey)
+				// Remove the sandbox header before forwarding
+				r.Header.Del("X-Forage-Sandbox")
+			}
+		}
+
+		// Forward request
+		r = r.WithContext(withRequestInfo(r.Context(), info))
+		p.reverseProxies[rt].ServeHTTP(lw, r)
+	}
+	return sandboxName, routeName
 }
 
 // LoadAPIKeys loads API keys from the secrets directory and builds the
 // IP-to-sandbox mapping from sandbox metadata (if SandboxesDir is configured).
+// Cached template policies are reread on next use.
 func (p *Proxy) LoadAPIKeys() error {
 	p.keysMu.Lock()
 	defer p.keysMu.Unlock()
 
+	if p.redactor != nil {
+		p.hostSecrets = loadHostSecrets(p.config.HostSecrets)
+	}
+	if p.policies != nil {
+		p.policies.reset()
+	}
+
 	entries, err := os.ReadDir(p.config.SecretsDir)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -215,20 +435,34 @@ func (p *Proxy) LoadAPIKeys() error {
 		return fmt.Errorf("failed to read secrets directory: %w", err)
 	}
 
+	secretFiles := p.routes.secretFiles()
 	for _, entry := range entries {
-		if entry.IsDir() {
-			// Each sandbox has a subdirectory with its secrets
-			sandboxName := entry.Name()
-			keyPath := filepath.Join(p.config.SecretsDir, sandboxName, p.config.APIKeyFilename)
+		if !entry.IsDir() {
+			continue
+		}
+		// Each sandbox has a subdirectory with its secrets
+		sandboxName := entry.Name()
+		for _, secretFile := range secretFiles {
+			keyPath := filepath.Join(p.config.SecretsDir, sandboxName, secretFile)
 			data, err := os.ReadFile(keyPath)
 			if err != nil {
 				if !os.IsNotExist(err) {
-					p.config.Logger.Warn("failed to read API key", "sandbox", sandboxName, "error", err)
+					p.config.Logger.Warn("failed to read API key", "sandbox", sandboxName, "file", secretFile, "error", err)
 				}
 				continue
 			}
-			p.apiKeys[sandboxName] = strings.TrimSpace(string(data))
-			p.config.Logger.Debug("loaded API key", "sandbox", sandboxName)
+			if p.apiKeys[sandboxName] == nil {
+				p.apiKeys[sandboxName] = make(map[string]string)
+			}
+			p.apiKeys[sandboxName][secretFile] = strings.TrimSpace(string(data))
+			p.config.Logger.Debug("loaded API key", "sandbox", sandboxName, "file", secretFile)
+		}
+		if p.redactor != nil {
+			secrets, err := loadSecretFiles(filepath.Join(p.config.SecretsDir, sandboxName))
+			if err != nil {
+				p.config.Logger.Warn("failed to read secrets to redact", "sandbox", sandboxName, "error", err)
+			}
+			p.secrets[sandboxName] = secrets
 		}
 	}
 
@@ -250,24 +484,101 @@ func (p *Proxy) loadIPMapping() {
 	}
 	p.ipToSandbox = make(map[string]string, len(metadatas))
 	for _, meta := range metadatas {
-		ip := meta.ContainerIP()
-		p.ipToSandbox[ip] = meta.Name
-		p.config.Logger.Debug("mapped sandbox IP", "sandbox", meta.Name, "ip", ip)
+		addrs := meta.Addresses()
+		for _, ip := range []string{addrs.ContainerIP, addrs.ContainerIPv6} {
+			if ip == "" {
+				continue
+			}
+			p.ipToSandbox[ip] = meta.Name
+			p.config.Logger.Debug("mapped sandbox IP", "sandbox", meta.Name, "ip", ip)
+		}
+	}
+}
+
+// remoteIP extracts the IP address from a request's remote address in the
+// canonical form used as ipToSandbox keys. IPv4-mapped IPv6 addresses, as
+// seen on dual-stack listeners, are unmapped to plain IPv4.
+func remoteIP(remoteAddr string) (string, bool) {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return "", false
 	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return host, true
+	}
+	return addr.Unmap().WithZone("").String(), true
 }
 
-// getAPIKey returns the API key for a sandbox
-func (p *Proxy) getAPIKey(sandboxName string) string {
+// getAPIKey returns a sandbox's API key from the given secret file
+func (p *Proxy) getAPIKey(sandboxName, secretFile string) string {
 	p.keysMu.RLock()
 	defer p.keysMu.RUnlock()
-	return p.apiKeys[sandboxName]
+	return p.apiKeys[sandboxName][secretFile]
+}
+
+// identify determines which sandbox sent a request. Requests arriving on a
+// sandbox's socket belong to that sandbox. Otherwise a virtual API key
+// identifies its sandbox and is removed from the request; requests without
+// one are identified by the X-Forage-Sandbox header, verified against the
+// source IP, or by source IP alone. It reports false if the request must be
+// rejected: its key is unknown, revoked or another sandbox's, it arrived on
+// the socket of a sandbox whose key was revoked, or keys are required.
+func (p *Proxy) identify(r *http.Request) (string, bool) {
+	socket := socketSandbox(r.Context())
+	if socket != "" {
+		r.Header.Del("X-Forage-Sandbox")
+	}
+
+	if token := requestToken(r); token != "" {
+		stripToken(r)
+		if p.tokens == nil {
+			return "", false
+		}
+		name, err := p.tokens.lookup(token)
+		if err != nil {
+			p.config.Logger.Error("failed to look up sandbox token", "error", err)
+			return "", false
+		}
+		if name == "" || (socket != "" && name != socket) {
+			return "", false
+		}
+		// The key is proof enough; drop the unverifiable header
+		r.Header.Del("X-Forage-Sandbox")
+		return name, true
+	}
+	if socket != "" {
+		if p.tokens == nil {
+			return "", false
+		}
+		// A connection opened before the sandbox's key was revoked
+		issued, err := p.tokens.issued(socket)
+		if err != nil {
+			p.config.Logger.Error("failed to look up sandbox token", "error", err)
+			return "", false
+		}
+		if !issued {
+			return "", false
+		}
+		return socket, true
+	}
+	if p.config.RequireToken {
+		return "", false
+	}
+
+	// Prefer X-Forage-Sandbox header but verify it matches source IP
+	if header := r.Header.Get("X-Forage-Sandbox"); header != "" {
+		return p.verifySandboxIdentity(header, r.RemoteAddr), true
+	}
+	// Fall back to checking source IP against known sandbox IPs
+	return p.identifySandbox(r.RemoteAddr), true
 }
 
 // identifySandbox identifies the sandbox from the remote address using the
 // IP-to-sandbox mapping built from sandbox metadata.
 func (p *Proxy) identifySandbox(remoteAddr string) string {
-	host, _, err := net.SplitHostPort(remoteAddr)
-	if err != nil {
+	host, ok := remoteIP(remoteAddr)
+	if !ok {
 		return ""
 	}
 	p.keysMu.RLock()
@@ -283,8 +594,8 @@ func (p *Proxy) verifySandboxIdentity(headerName, remoteAddr string) string {
 	}
 	// If we have IP mapping, verify the header matches the source
 	if len(p.ipToSandbox) > 0 {
-		host, _, err := net.SplitHostPort(remoteAddr)
-		if err != nil {
+		host, ok := remoteIP(remoteAddr)
+		if !ok {
 			return headerName // can't verify, trust header
 		}
 		p.keysMu.RLock()
@@ -302,27 +613,184 @@ func (p *Proxy) verifySandboxIdentity(headerName, remoteAddr string) string {
 }
 
 // isInternalHost returns true if the host resolves to a loopback, link-local,
-// or private address that could be used for SSRF attacks.
+// or unspecified address that could be used for SSRF attacks. Hostnames are
+// checked against every A and AAAA record, and IPv6 literals (including
+// zoned, IPv4-mapped and IPv4-embedding forms) are checked for the IPv4
+// address they carry.
 func isInternalHost(host string) bool {
-	ip := net.ParseIP(host)
-	if ip == nil {
-		// Try resolving hostname
-		ips, err := net.LookupIP(host)
-		if err != nil || len(ips) == 0 {
-			return false
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return isInternalAddr(addr)
+	}
+
+	// Try resolving hostname
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return false
+	}
+	for _, ip := range ips {
+		if addr, ok := netip.AddrFromSlice(ip); ok && isInternalAddr(addr) {
+			return true
 		}
-		ip = ips[0]
 	}
-	return ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast()
+	return false
+}
+
+// nat64Prefix is the well-known NAT64 prefix (RFC 6052); its last 32 bits
+// carry an IPv4 address.
+var nat64Prefix = netip.MustParsePrefix("64:ff9b::/96")
+
+// sixToFourPrefix is the 6to4 prefix (RFC 3056); bits 16-47 carry an IPv4
+// address.
+var sixToFourPrefix = netip.MustParsePrefix("2002::/16")
+
+func isInternalAddr(addr netip.Addr) bool {
+	addr = addr.WithZone("").Unmap()
+	if addr.IsLoopback() || addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsUnspecified() {
+		return true
+	}
+	if addr.Is6() {
+		b := addr.As16()
+		switch {
+		case nat64Prefix.Contains(addr):
+			return isInternalAddr(netip.AddrFrom4([4]byte{b[12], b[13], b[14], b[15]}))
+		case sixToFourPrefix.Contains(addr):
+			return isInternalAddr(netip.AddrFrom4([4]byte{b[2], b[3], b[4], b[5]}))
+		}
+	}
+	return false
 }
 
 func (p *Proxy) modifyResponse(resp *http.Response) error {
 	// No CORS headers - the proxy should only be accessed by sandboxes
 	// directly, not from browsers. Adding Access-Control-Allow-Origin: *
 	// would allow any website to make API calls through the proxy.
+
+	info := requestInfoFrom(resp.Request.Context())
+	if info.recorded != nil {
+		wrapCassetteBody(resp, info.recorded, info.start, func(i *Interaction) {
+			if err := p.cassettes.record(info.sandbox, i); err != nil {
+				p.config.Logger.Warn("failed to record interaction", "sandbox", info.sandbox, "error", err)
+			}
+		})
+	}
+
+	if p.usage != nil {
+		wrapUsageBody(resp, func(model string, tokens usage.Tokens) {
+			rec := usage.Record{
+				Timestamp: time.Now(),
+				Sandbox:   info.sandbox,
+				Route:     info.route,
+				Model:     model,
+				Tokens:    tokens,
+			}
+			if p.budgets == nil || info.sandbox == "" {
+				if err := p.usage.Add(rec); err != nil {
+					p.config.Logger.Warn("failed to record usage", "sandbox", info.sandbox, "error", err)
+				}
+				return
+			}
+			status, err := p.budgets.record(p.usage, rec)
+			if err != nil {
+				p.config.Logger.Warn("failed to record usage", "sandbox", info.sandbox, "error", err)
+				return
+			}
+			p.budgetExhausted(info.sandbox, status)
+		})
+	}
 	return nil
 }
 
+// budgetExhausted reports a newly exhausted budget and pauses the sandbox
+// if its budget asks for it.
+func (p *Proxy) budgetExhausted(sandboxName string, status budgetStatus) {
+	if !status.notify {
+		return
+	}
+	p.config.Logger.Warn("budget exhausted", "sandbox", sandboxName, "reason", status.reason)
+	details := "budget exhausted: " + status.reason
+	if status.pause && p.config.PauseSandbox != nil {
+		details += "; pausing sandbox"
+	}
+	if err := p.events.LogEvent(audit.EventBudget, sandboxName, details); err != nil {
+		p.config.Logger.Warn("failed to log budget event", "sandbox", sandboxName, "error", err)
+	}
+	if status.pause && p.config.PauseSandbox != nil {
+		go func() {
+			if err := p.config.PauseSandbox(sandboxName); err != nil {
+				p.config.Logger.Error("failed to pause sandbox", "sandbox", sandboxName, "error", err)
+			}
+		}()
+	}
+}
+
+// redact scans the request body for secrets, replacing them or, in block
+// mode, rejecting the request. Hits are recorded in the sandbox's audit
+// log. It reports whether the request may proceed.
+func (p *Proxy) redact(w http.ResponseWriter, r *http.Request, sandboxName, routeName string) bool {
+	if r.Body == nil || r.Body == http.NoBody {
+		return true
+	}
+	body, err := io.ReadAll(r.Body)
+	_ = r.Body.Close()
+	if err != nil {
+		http.Error(w, `{"error": {"type": "invalid_request_error", "message": "Failed to read request body"}}`,
+			http.StatusBadRequest)
+		return false
+	}
+
+	p.keysMu.RLock()
+	secrets := append(append([]namedSecret(nil), p.hostSecrets...), p.secrets[sandboxName]...)
+	p.keysMu.RUnlock()
+
+	redacted, hits := p.redactor.scan(body, secrets)
+	if len(hits) == 0 {
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		return true
+	}
+
+	found := describeHits(hits)
+	blocked := p.redactor.mode == RedactBlock
+	p.config.Logger.Warn("secrets in outbound request", "sandbox", sandboxName, "route", routeName, "found", found, "blocked", blocked)
+	details := "redacted secrets from API request: " + found
+	if blocked {
+		details = "blocked API request containing secrets: " + found
+	}
+	if p.config.StateDir != "" && sandboxName != "" {
+		if err := p.events.LogEvent(audit.EventSecret, sandboxName, details); err != nil {
+			p.config.Logger.Warn("failed to log secret event", "sandbox", sandboxName, "error", err)
+		}
+	}
+
+	if blocked {
+		writeRedactionError(w, found)
+		return false
+	}
+	r.Body = io.NopCloser(bytes.NewReader(redacted))
+	r.ContentLength = int64(len(redacted))
+	r.Header.Set("Content-Length", strconv.Itoa(len(redacted)))
+	return true
+}
+
+// replay answers a request from the sandbox's cassette.
+func (p *Proxy) replay(w http.ResponseWriter, r *http.Request, info requestInfo) {
+	interaction, err := p.cassettes.find(info.sandbox, info.recorded)
+	if err != nil {
+		p.config.Logger.Error("failed to load cassette", "sandbox", info.sandbox, "error", err)
+		http.Error(w, `{"error": {"type": "proxy_error", "message": "Failed to load cassette"}}`,
+			http.StatusInternalServerError)
+		return
+	}
+	if interaction == nil {
+		p.config.Logger.Warn("no recorded response for request",
+			"sandbox", info.sandbox, "method", r.Method, "path", r.URL.Path)
+		http.Error(w, `{"type": "error", "error": {"type": "not_found_error", "message": "No recorded response matches this request"}}`,
+			http.StatusNotFound)
+		return
+	}
+	p.cassettes.replay(w, r, interaction)
+}
+
 func (p *Proxy) errorHandler(w http.ResponseWriter, r *http.Request, err error) {
 	p.config.Logger.Error("proxy error", "error", err, "path", r.URL.Path)
 	http.Error(w, `{"error": {"type": "proxy_error", "message": "Proxy error"}}`,
@@ -334,6 +802,11 @@ func (p *Proxy) Close() error {
 	if p.rateLimiter != nil {
 		p.rateLimiter.stop()
 	}
+	if p.usage != nil {
+		if err := p.usage.Close(); err != nil {
+			return err
+		}
+	}
 	if p.auditLog != nil {
 		return p.auditLog.close()
 	}
@@ -346,6 +819,12 @@ type loggingResponseWriter struct {
 	statusCode int
 }
 
+// Unwrap lets http.ResponseController reach the underlying writer, so
+// streamed responses are flushed to the client as they arrive.
+func (lw *loggingResponseWriter) Unwrap() http.ResponseWriter {
+	return lw.ResponseWriter
+}
+
 func (lw *loggingResponseWriter) WriteHeader(code int) {
 	lw.statusCode = code
 	lw.ResponseWriter.WriteHeader(code)
@@ -451,10 +930,12 @@ const (
 	auditKeepFiles      = 3                // keep current + 3 rotated files
 )
 
-type auditEntry struct {
+// LogEntry is a request recorded in the proxy's audit log.
+type LogEntry struct {
 	Timestamp   time.Time     `json:"timestamp"`
 	Duration    time.Duration `json:"duration_ns"`
 	Sandbox     string        `json:"sandbox,omitempty"`
+	Route       string        `json:"route,omitempty"`
 	Method      string        `json:"method"`
 	Path        string        `json:"path"`
 	StatusCode  int           `json:"status_code"`
@@ -482,7 +963,7 @@ func newAuditLogger(path string) (*auditLogger, error) {
 	}, nil
 }
 
-func (al *auditLogger) log(entry auditEntry) {
+func (al *auditLogger) log(entry LogEntry) {
 	al.mu.Lock()
 	defer al.mu.Unlock()
 
@@ -531,8 +1012,10 @@ func (al *auditLogger) close() error {
 
 // Server wraps the proxy with lifecycle management
 type Server struct {
-	proxy  *Proxy
-	server *http.Server
+	proxy   *Proxy
+	server  *http.Server
+	admin   *http.Server
+	sockets *socketManager
 }
 
 // NewServer creates a new proxy server
@@ -553,22 +1036,57 @@ func NewServer(cfg *Config) (*Server, error) {
 		ReadTimeout:  30 * time.Second,
 		WriteTimeout: 120 * time.Second, // Longer for streaming responses
 		IdleTimeout:  60 * time.Second,
+		ConnContext:  socketConnContext,
 	}
 
-	return &Server{
+	s := &Server{
 		proxy:  proxy,
 		server: server,
-	}, nil
+	}
+	if cfg.Sockets {
+		if cfg.StateDir == "" {
+			return nil, fmt.Errorf("serving sandbox sockets requires a state directory")
+		}
+		s.sockets = newSocketManager(cfg.StateDir, server, cfg.Logger)
+	}
+	if cfg.AdminAddr != "" {
+		s.admin = &http.Server{
+			Handler:     proxy.AdminHandler(),
+			ReadTimeout: 10 * time.Second,
+			IdleTimeout: 60 * time.Second,
+		}
+	}
+	return s, nil
 }
 
 // Start starts the proxy server
 func (s *Server) Start() error {
 	s.proxy.config.Logger.Info("starting proxy server", "addr", s.server.Addr)
+	if s.admin != nil {
+		l, err := listenAdmin(s.proxy.config.AdminAddr)
+		if err != nil {
+			return fmt.Errorf("failed to open admin listener: %w", err)
+		}
+		go func() {
+			if err := s.admin.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				s.proxy.config.Logger.Error("admin API stopped", "error", err)
+			}
+		}()
+	}
+	if s.sockets != nil {
+		s.sockets.start()
+	}
 	return s.server.ListenAndServe()
 }
 
 // Stop stops the proxy server
 func (s *Server) Stop() error {
+	if s.sockets != nil {
+		s.sockets.close()
+	}
+	if s.admin != nil {
+		_ = s.admin.Close()
+	}
 	if err := s.server.Close(); err != nil {
 		return err
 	}
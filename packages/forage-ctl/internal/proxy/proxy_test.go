@@ -10,6 +10,8 @@ import (
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/config"
 )
 
 func TestProxy_AuthInjection(t *testing.T) {
@@ -198,7 +200,7 @@ func TestProxy_AuditLogging(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	var entry auditEntry
+	var entry LogEntry
 	if err := json.Unmarshal(data, &entry); err != nil {
 		t.Fatalf("failed to parse audit log: %v\ndata: %s", err, string(data))
 	}
@@ -217,6 +219,53 @@ func TestProxy_AuditLogging(t *testing.T) {
 	}
 }
 
+func TestProxy_AuditLoggingRejected(t *testing.T) {
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+
+	tmpDir := t.TempDir()
+	auditPath := filepath.Join(tmpDir, "audit.log")
+	cfg := &Config{
+		ListenAddr:        ":0",
+		SecretsDir:        tmpDir,
+		TargetURL:         upstream.URL,
+		Transport:         upstream.Client().Transport,
+		AuditLogPath:      auditPath,
+		RateLimitRequests: 1,
+		RateLimitWindow:   time.Minute,
+	}
+	proxy, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The second request is rejected before it is forwarded
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest("POST", "/v1/messages", strings.NewReader("test body"))
+		req.Header.Set("X-Forage-Sandbox", "test-sandbox")
+		proxy.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	proxy.Close()
+
+	data, err := os.ReadFile(auditPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 log entries, got %d:\n%s", len(lines), data)
+	}
+	var entry LogEntry
+	if err := json.Unmarshal([]byte(lines[1]), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry.StatusCode != http.StatusTooManyRequests || entry.Sandbox != "test-sandbox" || entry.Path != "/v1/messages" {
+		t.Errorf("rejected request entry = %+v, want a 429 for test-sandbox", entry)
+	}
+}
+
 func TestProxy_SandboxHeaderRemoved(t *testing.T) {
 	// Verify X-Forage-Sandbox header is not forwarded
 	var receivedHeaders http.Header
@@ -318,7 +367,7 @@ func TestProxy_LoadAPIKeys(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		got := proxy.getAPIKey(tt.sandbox)
+		got := proxy.getAPIKey(tt.sandbox, "anthropic-api-key")
 		if got != tt.wantKey {
 			t.Errorf("getAPIKey(%q) = %q, want %q", tt.sandbox, got, tt.wantKey)
 		}
@@ -394,3 +443,74 @@ func TestProxy_StreamingResponse(t *testing.T) {
 		t.Error("expected streaming data in response")
 	}
 }
+
+func TestIsInternalHost(t *testing.T) {
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{"127.0.0.1", true},
+		{"169.254.169.254", true},
+		{"0.0.0.0", true},
+		{"::1", true},
+		{"::", true},
+		{"fe80::1", true},
+		{"fe80::1%eth0", true},
+		{"::ffff:127.0.0.1", true},
+		{"::ffff:169.254.169.254", true},
+		{"64:ff9b::a9fe:a9fe", true}, // NAT64 of 169.254.169.254
+		{"2002:7f00:1::", true},      // 6to4 of 127.0.0.1
+		{"93.184.216.34", false},
+		{"2606:4700:4700::1111", false},
+		{"64:ff9b::5db8:d822", false}, // NAT64 of 93.184.216.34
+		{"localhost", true},
+	}
+
+	for _, tt := range tests {
+		if got := isInternalHost(tt.host); got != tt.want {
+			t.Errorf("isInternalHost(%q) = %v, want %v", tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestProxy_IdentifySandboxDualStack(t *testing.T) {
+	sandboxesDir := t.TempDir()
+	meta := &config.SandboxMetadata{
+		Name:        "dual",
+		Template:    "claude",
+		Workspace:   "/ws",
+		NetworkSlot: 3,
+		Subnet:      "10.100.3.0/24",
+		SubnetIPv6:  "fd42:0:0:3::/64",
+	}
+	if err := config.SaveSandboxMetadata(sandboxesDir, meta); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := New(&Config{
+		ListenAddr:   ":0",
+		SecretsDir:   t.TempDir(),
+		TargetURL:    "https://api.example.com",
+		SandboxesDir: sandboxesDir,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.LoadAPIKeys(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, remote := range []string{
+		"10.100.3.2:41000",
+		"[::ffff:10.100.3.2]:41000",
+		"[fd42:0:0:3::2]:41000",
+		"[fd42::3:0:0:0:2]:41000",
+	} {
+		if got := p.identifySandbox(remote); got != "dual" {
+			t.Errorf("identifySandbox(%q) = %q, want %q", remote, got, "dual")
+		}
+	}
+	if got := p.identifySandbox("[fd42:0:0:4::2]:41000"); got != "" {
+		t.Errorf("identifySandbox() for unknown IPv6 = %q, want empty", got)
+	}
+}
@@ -0,0 +1,227 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// RedactMode selects what the proxy does with secrets found in outbound
+// request bodies.
+type RedactMode string
+
+const (
+	// RedactOff forwards request bodies unchanged.
+	RedactOff RedactMode = ""
+
+	// RedactReplace replaces each secret with a placeholder naming it.
+	RedactReplace RedactMode = "redact"
+
+	// RedactBlock rejects requests containing secrets.
+	RedactBlock RedactMode = "block"
+)
+
+// ParseRedactMode parses a redaction mode; "off" and "" disable redaction.
+func ParseRedactMode(s string) (RedactMode, error) {
+	switch s {
+	case "", "off":
+		return RedactOff, nil
+	case string(RedactReplace), string(RedactBlock):
+		return RedactMode(s), nil
+	default:
+		return RedactOff, fmt.Errorf("invalid redaction mode %q (must be off, redact or block)", s)
+	}
+}
+
+// minSecretLength is the shortest secret value matched literally. Shorter
+// values would redact ordinary words.
+const minSecretLength = 8
+
+// Detector finds secrets by pattern rather than by value.
+type Detector struct {
+	Name    string `json:"name"`
+	Pattern string `json:"pattern"`
+}
+
+// DefaultDetectors returns the built-in secret detectors.
+func DefaultDetectors() []Detector {
+	return []Detector{
+		{Name: "aws-access-key", Pattern: `\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`},
+		{Name: "github-token", Pattern: `\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})\b`},
+		// Bodies are JSON, so the key's line breaks appear escaped
+		{Name: "private-key", Pattern: `-----BEGIN [A-Z ]*PRIVATE KEY-----.*?-----END [A-Z ]*PRIVATE KEY-----`},
+	}
+}
+
+// LoadDetectors reads a JSON array of detectors from a file.
+func LoadDetectors(path string) ([]Detector, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read detectors file: %w", err)
+	}
+	var detectors []Detector
+	if err := json.Unmarshal(data, &detectors); err != nil {
+		return nil, fmt.Errorf("failed to parse detectors file: %w", err)
+	}
+	return detectors, nil
+}
+
+// compiledDetector is a Detector with its compiled pattern.
+type compiledDetector struct {
+	name string
+	re   *regexp.Regexp
+}
+
+// namedSecret is a known secret value and the file it came from.
+type namedSecret struct {
+	name  string
+	value string
+}
+
+// redactor scans request bodies for known secret values and detector
+// matches.
+type redactor struct {
+	mode      RedactMode
+	detectors []compiledDetector
+}
+
+func newRedactor(mode RedactMode, detectors []Detector) (*redactor, error) {
+	r := &redactor{mode: mode}
+	for _, d := range detectors {
+		if d.Name == "" {
+			return nil, fmt.Errorf("detector with pattern %q has no name", d.Pattern)
+		}
+		re, err := regexp.Compile(d.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("detector %s: invalid pattern: %w", d.Name, err)
+		}
+		r.detectors = append(r.detectors, compiledDetector{name: d.Name, re: re})
+	}
+	return r, nil
+}
+
+// scan finds the secrets in body, returning the body with them replaced
+// and how often each secret or detector matched.
+func (r *redactor) scan(body []byte, secrets []namedSecret) ([]byte, map[string]int) {
+	hits := make(map[string]int)
+	for _, s := range secrets {
+		name := "secret:" + s.name
+		for _, form := range secretForms(s.value) {
+			if n := bytes.Count(body, form); n > 0 {
+				hits[name] += n
+				body = bytes.ReplaceAll(body, form, redactionFor(name))
+			}
+		}
+	}
+	for _, d := range r.detectors {
+		matches := d.re.FindAllIndex(body, -1)
+		if len(matches) == 0 {
+			continue
+		}
+		hits[d.name] += len(matches)
+		body = d.re.ReplaceAllLiteral(body, redactionFor(d.name))
+	}
+	return body, hits
+}
+
+// secretForms returns the ways a secret value can appear in a JSON body:
+// as is, and escaped inside a JSON string.
+func secretForms(value string) [][]byte {
+	forms := [][]byte{[]byte(value)}
+	if quoted, err := json.Marshal(value); err == nil {
+		if escaped := quoted[1 : len(quoted)-1]; !bytes.Equal(escaped, forms[0]) {
+			forms = append(forms, escaped)
+		}
+	}
+	return forms
+}
+
+// redactionFor returns the placeholder replacing a secret.
+func redactionFor(name string) []byte {
+	return []byte("[REDACTED:" + name + "]")
+}
+
+// describeHits renders hits as a sorted list such as
+// "aws-access-key x2, secret:openai-api-key".
+func describeHits(hits map[string]int) string {
+	names := make([]string, 0, len(hits))
+	for name, n := range hits {
+		if n > 1 {
+			name = fmt.Sprintf("%s x%d", name, n)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// loadSecretFiles reads every file in dir as a secret value.
+func loadSecretFiles(dir string) ([]namedSecret, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var secrets []namedSecret
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		if s, ok := readSecret(entry.Name(), filepath.Join(dir, entry.Name())); ok {
+			secrets = append(secrets, s)
+		}
+	}
+	return secrets, nil
+}
+
+// loadHostSecrets reads the host's secrets, keyed by name.
+func loadHostSecrets(files map[string]string) []namedSecret {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var secrets []namedSecret
+	for _, name := range names {
+		if s, ok := readSecret(name, files[name]); ok {
+			secrets = append(secrets, s)
+		}
+	}
+	return secrets
+}
+
+// readSecret reads a secret file, skipping values too short to match
+// safely.
+func readSecret(name, path string) (namedSecret, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return namedSecret{}, false
+	}
+	value := strings.TrimSpace(string(data))
+	if len(value) < minSecretLength {
+		return namedSecret{}, false
+	}
+	return namedSecret{name: name, value: value}, true
+}
+
+// writeRedactionError rejects a request that contains secrets.
+func writeRedactionError(w http.ResponseWriter, found string) {
+	body, _ := json.Marshal(map[string]any{
+		"type": "error",
+		"error": map[string]string{
+			"type":    "invalid_request_error",
+			"message": "Request blocked by the forage proxy: it contains secrets (" + found + ")",
+		},
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	_, _ = w.Write(body)
+}
@@ -0,0 +1,367 @@
+package proxy
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RetryPolicy controls how failed upstream requests are retried. Requests
+// are retried on connection errors and on 429, 529 and 5xx responses, and
+// only before any of the response has reached the client.
+type RetryPolicy struct {
+	// MaxRetries is the number of retries per upstream (0 = no retries)
+	MaxRetries int
+
+	// BaseDelay is the backoff before the first retry; it doubles with
+	// each further retry, with jitter
+	BaseDelay time.Duration
+
+	// MaxDelay caps the backoff. A Retry-After longer than this fails over
+	// instead of waiting.
+	MaxDelay time.Duration
+}
+
+// BreakerPolicy controls the per-upstream circuit breakers.
+type BreakerPolicy struct {
+	// Failures is the number of consecutive failures that opens an
+	// upstream's circuit (0 = no circuit breaking)
+	Failures int
+
+	// Cooldown is how long an open circuit rejects requests before letting
+	// a trial request through
+	Cooldown time.Duration
+}
+
+// Circuit breaker states.
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half-open"
+)
+
+// breaker is the circuit breaker of one upstream. It opens after
+// consecutive failures, rejecting requests until its cooldown has passed,
+// then lets a single trial request through: success closes it, failure
+// opens it again.
+type breaker struct {
+	policy BreakerPolicy
+	now    func() time.Time
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	trial    bool // a half-open trial request is in flight
+}
+
+func newBreaker(policy BreakerPolicy) *breaker {
+	return &breaker{policy: policy, now: time.Now, state: BreakerClosed}
+}
+
+// allow reports whether a request may be sent to the upstream.
+func (b *breaker) allow() bool {
+	if b.policy.Failures <= 0 {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BreakerOpen:
+		if b.now().Sub(b.openedAt) < b.policy.Cooldown {
+			return false
+		}
+		b.state = BreakerHalfOpen
+		b.trial = true
+		return true
+	case BreakerHalfOpen:
+		if b.trial {
+			return false
+		}
+		b.trial = true
+		return true
+	}
+	return true
+}
+
+// success records a request the upstream handled.
+func (b *breaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.state = BreakerClosed
+	b.failures = 0
+	b.trial = false
+}
+
+// failure records a request the upstream failed.
+func (b *breaker) failure() {
+	if b.policy.Failures <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	b.trial = false
+	if b.state == BreakerHalfOpen || b.failures >= b.policy.Failures {
+		b.state = BreakerOpen
+		b.openedAt = b.now()
+	}
+}
+
+// snapshot returns the breaker's state for the status endpoint.
+func (b *breaker) snapshot() (state string, failures int, openedAt time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state, b.failures, b.openedAt
+}
+
+// retryableStatus reports whether a response status is worth retrying:
+// rate limiting, overload and server errors.
+func retryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code == 529 || code >= 500
+}
+
+// breakerFailure reports whether a response status counts against the
+// upstream's circuit. Rate limiting is specific to the key, not a sign of
+// an unhealthy upstream.
+func breakerFailure(code int) bool {
+	return code == 529 || code >= 500
+}
+
+// resilientTransport sends a route's requests with retries, failover to
+// the route's secondary upstreams and keys, and circuit breaking.
+type resilientTransport struct {
+	base   http.RoundTripper
+	route  *route
+	proxy  *Proxy
+	policy RetryPolicy
+	sleep  func(r *http.Request, d time.Duration) bool
+}
+
+func newResilientTransport(base http.RoundTripper, rt *route, p *Proxy, policy RetryPolicy) *resilientTransport {
+	return &resilientTransport{base: base, route: rt, proxy: p, policy: policy, sleep: sleepContext}
+}
+
+// sleepContext waits for d, reporting false if the request was canceled.
+func sleepContext(r *http.Request, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-r.Context().Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+func (t *resilientTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.policy.MaxRetries <= 0 && len(t.route.targets) == 1 && t.route.targets[0].breaker.policy.Failures <= 0 {
+		return t.base.RoundTrip(req)
+	}
+
+	// Buffer the body so that it can be sent again
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		_ = req.Body.Close()
+	}
+
+	info := requestInfoFrom(req.Context())
+	var lastResp *http.Response
+	var lastErr error
+	tried := false
+	for i, target := range t.route.targets {
+		var key string
+		if i > 0 && target.secretFile != t.route.SecretFile {
+			// Without its own key, the target would get the primary key,
+			// which may belong to another provider
+			if key = t.proxy.getAPIKey(info.sandbox, target.secretFile); key == "" {
+				t.proxy.config.Logger.Warn("skipping failover upstream without a key",
+					"route", t.route.Name, "upstream", target.url.Host, "secretFile", target.secretFile, "sandbox", info.sandbox)
+				continue
+			}
+		}
+		for attempt := 0; attempt <= t.policy.MaxRetries; attempt++ {
+			if !target.breaker.allow() {
+				break
+			}
+			tried = true
+			if lastResp != nil {
+				drainAndClose(lastResp)
+				lastResp = nil
+			}
+
+			out := req.Clone(req.Context())
+			if body != nil {
+				out.Body = io.NopCloser(bytes.NewReader(body))
+				out.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(body)), nil }
+			}
+			if i > 0 {
+				t.route.retarget(out, target.url)
+			}
+			if key != "" {
+				t.route.injectAuth(out, key)
+			}
+
+			resp, err := t.base.RoundTrip(out)
+			switch {
+			case err != nil:
+				target.breaker.failure()
+				lastErr = err
+			case retryableStatus(resp.StatusCode):
+				if breakerFailure(resp.StatusCode) {
+					target.breaker.failure()
+				} else {
+					target.breaker.success()
+				}
+				lastResp, lastErr = resp, nil
+			default:
+				target.breaker.success()
+				return resp, nil
+			}
+			if req.Context().Err() != nil {
+				if lastResp != nil {
+					drainAndClose(lastResp)
+				}
+				return nil, req.Context().Err()
+			}
+
+			if attempt == t.policy.MaxRetries {
+				break
+			}
+			delay := t.backoff(attempt)
+			if lastResp != nil {
+				if after, ok := retryAfter(lastResp.Header.Get("Retry-After"), time.Now()); ok {
+					if after > t.policy.MaxDelay {
+						break // not worth waiting for; fail over
+					}
+					delay = after
+				}
+			}
+			t.proxy.config.Logger.Debug("retrying upstream request",
+				"route", t.route.Name, "upstream", target.url.Host, "attempt", attempt+1, "delay", delay)
+			if !t.sleep(req, delay) {
+				if lastResp != nil {
+					drainAndClose(lastResp)
+				}
+				return nil, req.Context().Err()
+			}
+		}
+		if i+1 < len(t.route.targets) {
+			t.proxy.config.Logger.Warn("failing over upstream", "route", t.route.Name, "from", target.url.Host)
+		}
+	}
+
+	if lastResp != nil {
+		return lastResp, nil
+	}
+	if !tried {
+		return circuitOpenResponse(req), nil
+	}
+	if lastErr == nil {
+		lastErr = errors.New("upstream request failed")
+	}
+	return nil, lastErr
+}
+
+// backoff returns the jittered exponential delay before retry attempt+1:
+// a random duration between half and all of BaseDelay * 2^attempt, capped
+// at MaxDelay.
+func (t *resilientTransport) backoff(attempt int) time.Duration {
+	d := t.policy.BaseDelay << attempt
+	if d <= 0 || (t.policy.MaxDelay > 0 && d > t.policy.MaxDelay) {
+		d = t.policy.MaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+// retryAfter parses a Retry-After header, given in seconds or as an HTTP
+// date.
+func retryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(value); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(at.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// drainAndClose discards a response that is being replaced by a retry, so
+// that its connection can be reused.
+func drainAndClose(resp *http.Response) {
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	_ = resp.Body.Close()
+}
+
+// circuitOpenResponse answers a request whose upstreams all have open
+// circuits, in the overload error format clients already back off on.
+func circuitOpenResponse(req *http.Request) *http.Response {
+	body := `{"type":"error","error":{"type":"overloaded_error","message":"Upstream unavailable: circuit breaker open"}}`
+	return &http.Response{
+		Status:        "503 Service Unavailable",
+		StatusCode:    http.StatusServiceUnavailable,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"application/json"}},
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// Status is the proxy state reported by the admin API.
+type Status struct {
+	Upstreams []UpstreamStatus `json:"upstreams"`
+}
+
+// UpstreamStatus is the circuit breaker state of one upstream of a route.
+type UpstreamStatus struct {
+	Route      string     `json:"route"`
+	Upstream   string     `json:"upstream"`
+	SecretFile string     `json:"secretFile"`
+	Failover   bool       `json:"failover,omitempty"` // a secondary upstream or key
+	State      string     `json:"state"`
+	Failures   int        `json:"failures"`
+	OpenedAt   *time.Time `json:"openedAt,omitempty"`
+}
+
+// Status returns the state of the proxy's upstreams.
+func (p *Proxy) Status() Status {
+	var st Status
+	for _, rt := range p.routes.routes {
+		for i, target := range rt.targets {
+			state, failures, openedAt := target.breaker.snapshot()
+			us := UpstreamStatus{
+				Route:      rt.Name,
+				Upstream:   target.url.String(),
+				SecretFile: target.secretFile,
+				Failover:   i > 0,
+				State:      state,
+				Failures:   failures,
+			}
+			if state != BreakerClosed {
+				us.OpenedAt = &openedAt
+			}
+			st.Upstreams = append(st.Upstreams, us)
+		}
+	}
+	return st
+}
@@ -0,0 +1,262 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{"", 0, false},
+		{"3", 3 * time.Second, true},
+		{now.Add(90 * time.Second).Format(http.TimeFormat), 90 * time.Second, true},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0, true},
+		{"soon", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := retryAfter(tt.value, now)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("retryAfter(%q) = %v, %v; want %v, %v", tt.value, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tr := &resilientTransport{policy: RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}}
+	for attempt, ceiling := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second} {
+		for range 20 {
+			if d := tr.backoff(attempt); d < ceiling/2 || d > ceiling {
+				t.Fatalf("backoff(%d) = %v, want between %v and %v", attempt, d, ceiling/2, ceiling)
+			}
+		}
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	now := time.Now()
+	b := newBreaker(BreakerPolicy{Failures: 2, Cooldown: time.Minute})
+	b.now = func() time.Time { return now }
+
+	b.failure()
+	if !b.allow() {
+		t.Fatal("breaker opened before reaching the failure threshold")
+	}
+	b.failure()
+	if b.allow() {
+		t.Fatal("breaker should be open")
+	}
+
+	// After the cooldown a single trial request is let through
+	now = now.Add(time.Minute)
+	if !b.allow() || b.allow() {
+		t.Fatal("half-open breaker should allow exactly one trial")
+	}
+	b.failure()
+	if state, _, _ := b.snapshot(); state != BreakerOpen {
+		t.Fatalf("failed trial: state %s, want open", state)
+	}
+
+	now = now.Add(time.Minute)
+	if !b.allow() {
+		t.Fatal("trial not allowed")
+	}
+	b.success()
+	if state, failures, _ := b.snapshot(); state != BreakerClosed || failures != 0 {
+		t.Errorf("successful trial: state %s, failures %d; want closed, 0", state, failures)
+	}
+}
+
+func TestProxy_RetryAndFailover(t *testing.T) {
+	var calls atomic.Int32
+	var failing atomic.Bool
+	var keys []string
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		body, _ := io.ReadAll(r.Body)
+		keys = append(keys, r.Header.Get("X-Api-Key"))
+		if string(body) != `{"n":1}` {
+			t.Errorf("upstream got body %q on call %d", body, n)
+		}
+		switch {
+		case failing.Load() && r.Header.Get("X-Api-Key") == "sk-primary":
+			w.WriteHeader(http.StatusInternalServerError)
+		case n == 1:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(529)
+		default:
+			io.WriteString(w, "{}")
+		}
+	}))
+	defer upstream.Close()
+
+	secretsDir := t.TempDir()
+	os.MkdirAll(filepath.Join(secretsDir, "sb"), 0700)
+	os.WriteFile(filepath.Join(secretsDir, "sb", "anthropic-api-key"), []byte("sk-primary"), 0600)
+	os.WriteFile(filepath.Join(secretsDir, "sb", "anthropic-api-key-2"), []byte("sk-secondary"), 0600)
+
+	p, err := New(&Config{
+		SecretsDir: secretsDir,
+		Routes: []Route{{
+			Name:       "anthropic",
+			Upstream:   upstream.URL,
+			SecretFile: "anthropic-api-key",
+			Failover:   []Failover{{SecretFile: "anthropic-api-key-2"}},
+		}},
+		Retry:     RetryPolicy{MaxRetries: 1, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond},
+		Breaker:   BreakerPolicy{Failures: 2, Cooldown: time.Hour},
+		Transport: upstream.Client().Transport,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	if err := p.LoadAPIKeys(); err != nil {
+		t.Fatal(err)
+	}
+	send := func() int {
+		keys = nil
+		req := httptest.NewRequest("POST", "/v1/messages", strings.NewReader(`{"n":1}`))
+		req.Header.Set("X-Forage-Sandbox", "sb")
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// An overloaded response is retried with the same body
+	if code := send(); code != http.StatusOK {
+		t.Fatalf("status %d, want 200 after retry", code)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("upstream called %d times, want 2", calls.Load())
+	}
+
+	// A failing key fails over to the secondary key and opens the circuit
+	failing.Store(true)
+	if code := send(); code != http.StatusOK {
+		t.Fatalf("status %d, want 200 after failover", code)
+	}
+	if strings.Join(keys, ",") != "sk-primary,sk-primary,sk-secondary" {
+		t.Errorf("keys tried = %v", keys)
+	}
+
+	// With the primary circuit open, requests go straight to the failover
+	if code := send(); code != http.StatusOK || strings.Join(keys, ",") != "sk-secondary" {
+		t.Errorf("status %d, keys tried %v; want 200 via sk-secondary only", code, keys)
+	}
+
+	status := p.Status()
+	if len(status.Upstreams) != 2 || status.Upstreams[0].State != BreakerOpen || status.Upstreams[0].OpenedAt == nil ||
+		status.Upstreams[1].State != BreakerClosed || !status.Upstreams[1].Failover {
+		t.Errorf("status = %+v", status)
+	}
+}
+
+func TestProxy_FailoverWithoutKey(t *testing.T) {
+	var keys []string
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys = append(keys, r.Header.Get("X-Api-Key"))
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer upstream.Close()
+
+	secretsDir := t.TempDir()
+	os.MkdirAll(filepath.Join(secretsDir, "sb"), 0700)
+	os.WriteFile(filepath.Join(secretsDir, "sb", "anthropic-api-key"), []byte("sk-primary"), 0600)
+
+	p, err := New(&Config{
+		SecretsDir: secretsDir,
+		Routes: []Route{{
+			Name:       "anthropic",
+			Upstream:   upstream.URL,
+			SecretFile: "anthropic-api-key",
+			Failover:   []Failover{{Upstream: upstream.URL + "/other", SecretFile: "other-api-key"}},
+		}},
+		Breaker:   BreakerPolicy{Failures: 5, Cooldown: time.Hour},
+		Transport: upstream.Client().Transport,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	if err := p.LoadAPIKeys(); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("POST", "/v1/messages", strings.NewReader(`{}`))
+	req.Header.Set("X-Forage-Sandbox", "sb")
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, req)
+
+	// The sandbox has no key for the failover, which must not get the
+	// primary key instead
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status %d, want the primary's 500", w.Code)
+	}
+	if strings.Join(keys, ",") != "sk-primary" {
+		t.Errorf("keys sent = %v, want only sk-primary to the primary", keys)
+	}
+}
+
+// cancelingTransport fails every request, canceling it on the first.
+type cancelingTransport struct {
+	cancel context.CancelFunc
+	calls  int
+}
+
+func (c *cancelingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	c.calls++
+	c.cancel()
+	return &http.Response{StatusCode: http.StatusInternalServerError, Body: http.NoBody, Request: req}, nil
+}
+
+func TestResilientTransport_CanceledNoFailover(t *testing.T) {
+	secretsDir := t.TempDir()
+	os.MkdirAll(filepath.Join(secretsDir, "sb"), 0700)
+	os.WriteFile(filepath.Join(secretsDir, "sb", "anthropic-api-key"), []byte("sk-primary"), 0600)
+	os.WriteFile(filepath.Join(secretsDir, "sb", "anthropic-api-key-2"), []byte("sk-secondary"), 0600)
+	p, err := New(&Config{
+		SecretsDir: secretsDir,
+		Routes: []Route{{
+			Name:       "anthropic",
+			Upstream:   "https://api.example.com",
+			SecretFile: "anthropic-api-key",
+			Failover:   []Failover{{SecretFile: "anthropic-api-key-2"}},
+		}},
+		Retry: RetryPolicy{MaxRetries: 2, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	if err := p.LoadAPIKeys(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(withRequestInfo(context.Background(), requestInfo{sandbox: "sb"}))
+	defer cancel()
+	base := &cancelingTransport{cancel: cancel}
+	tr := newResilientTransport(base, p.routes.routes[0], p, p.config.Retry)
+	req := httptest.NewRequest("POST", "https://api.example.com/v1/messages", strings.NewReader(`{}`)).WithContext(ctx)
+
+	resp, err := tr.RoundTrip(req)
+	if err == nil {
+		resp.Body.Close()
+		t.Fatal("RoundTrip succeeded, want the cancellation")
+	}
+	if base.calls != 1 {
+		t.Errorf("upstream called %d times, want no retry or failover after cancellation", base.calls)
+	}
+}
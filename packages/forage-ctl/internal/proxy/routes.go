@@ -0,0 +1,418 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// AuthStyle is how a route presents the API key to its upstream.
+type AuthStyle string
+
+// Supported auth styles.
+const (
+	AuthStyleAPIKey AuthStyle = "x-api-key" // X-Api-Key: <key> (Anthropic)
+	AuthStyleBearer AuthStyle = "bearer"    // Authorization: Bearer <key> (OpenAI, OpenRouter)
+	AuthStyleQuery  AuthStyle = "query"     // ?<AuthParam>=<key>
+	AuthStyleHeader AuthStyle = "header"    // <AuthParam>: <key>
+)
+
+// Route maps requests to an upstream API. A request matches a route when
+// its Host matches the route's Host (if set) and its path starts with the
+// route's PathPrefix. The prefix is stripped before forwarding, so
+// "/openai/v1/models" on a route with prefix "/openai" reaches the upstream
+// as "/v1/models".
+type Route struct {
+	Name       string    `json:"name"`
+	PathPrefix string    `json:"pathPrefix,omitempty"` // e.g. "/openai"; empty matches every path
+	Host       string    `json:"host,omitempty"`       // Virtual host to match (e.g. "openai.proxy.local"); empty matches any
+	Upstream   string    `json:"upstream"`             // Upstream base URL; must be HTTPS
+	SecretFile string    `json:"secretFile"`           // Key file within each sandbox's secrets directory
+	AuthStyle  AuthStyle `json:"authStyle,omitempty"`  // Defaults to x-api-key
+	AuthParam  string    `json:"authParam,omitempty"`  // Header name or query parameter for the header and query styles
+
+	// Failover lists secondary upstreams or keys, tried in order when the
+	// upstream keeps failing or its circuit breaker is open
+	Failover []Failover `json:"failover,omitempty"`
+}
+
+// Failover is a secondary upstream or key of a route. Fields left empty
+// default to the route's own.
+type Failover struct {
+	Upstream   string `json:"upstream,omitempty"`   // Secondary upstream base URL; must be HTTPS
+	SecretFile string `json:"secretFile,omitempty"` // Secondary key file within each sandbox's secrets directory
+}
+
+// headerNameRegex validates HTTP header field names (RFC 9110 tokens).
+var headerNameRegex = regexp.MustCompile("^[!#$%&'*+.^_`|~0-9A-Za-z-]+$")
+
+// Validate checks that the route is well formed.
+func (r *Route) Validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("route name is required")
+	}
+	if r.PathPrefix != "" && (!strings.HasPrefix(r.PathPrefix, "/") || strings.HasSuffix(r.PathPrefix, "/")) {
+		return fmt.Errorf("route %s: path prefix must start with / and not end with / (got %q)", r.Name, r.PathPrefix)
+	}
+	if r.Upstream == "" {
+		return fmt.Errorf("route %s: upstream is required", r.Name)
+	}
+	if !validSecretFile(r.SecretFile) {
+		return fmt.Errorf("route %s: invalid secret file %q", r.Name, r.SecretFile)
+	}
+	for i, f := range r.Failover {
+		if f.Upstream == "" && f.SecretFile == "" {
+			return fmt.Errorf("route %s: failover %d needs an upstream or a secret file", r.Name, i+1)
+		}
+		if f.SecretFile != "" && !validSecretFile(f.SecretFile) {
+			return fmt.Errorf("route %s: failover %d: invalid secret file %q", r.Name, i+1, f.SecretFile)
+		}
+	}
+	switch r.authStyle() {
+	case AuthStyleAPIKey, AuthStyleBearer:
+	case AuthStyleQuery:
+		if r.AuthParam == "" {
+			return fmt.Errorf("route %s: authParam is required for the query auth style", r.Name)
+		}
+	case AuthStyleHeader:
+		if !headerNameRegex.MatchString(r.AuthParam) {
+			return fmt.Errorf("route %s: authParam must be a header name for the header auth style (got %q)", r.Name, r.AuthParam)
+		}
+	default:
+		return fmt.Errorf("route %s: unknown auth style %q", r.Name, r.AuthStyle)
+	}
+	return nil
+}
+
+// validSecretFile reports whether name is a plain file name.
+func validSecretFile(name string) bool {
+	return name != "" && !strings.ContainsAny(name, `/\`) && name != "." && name != ".."
+}
+
+func (r *Route) authStyle() AuthStyle {
+	if r.AuthStyle == "" {
+		return AuthStyleAPIKey
+	}
+	return r.AuthStyle
+}
+
+// authHeaders are the headers the well-known providers take API keys in.
+var authHeaders = []string{"X-Api-Key", "X-Goog-Api-Key", "Authorization"}
+
+// stripAuth removes any credentials the sandbox sent from an outgoing
+// request: the well-known auth headers and the route's own auth parameter.
+func (r *Route) stripAuth(req *http.Request) {
+	for _, h := range authHeaders {
+		req.Header.Del(h)
+	}
+	switch r.authStyle() {
+	case AuthStyleHeader:
+		req.Header.Del(r.AuthParam)
+	case AuthStyleQuery:
+		if q := req.URL.Query(); q.Has(r.AuthParam) {
+			q.Del(r.AuthParam)
+			req.URL.RawQuery = q.Encode()
+		}
+	}
+}
+
+// injectAuth sets the API key on an outgoing request in the route's auth
+// style, first removing any credentials the sandbox sent (see stripAuth).
+func (r *Route) injectAuth(req *http.Request, key string) {
+	r.stripAuth(req)
+	switch r.authStyle() {
+	case AuthStyleAPIKey:
+		req.Header.Set("X-Api-Key", key)
+	case AuthStyleBearer:
+		req.Header.Set("Authorization", "Bearer "+key)
+	case AuthStyleHeader:
+		req.Header.Set(r.AuthParam, key)
+	case AuthStyleQuery:
+		q := req.URL.Query()
+		q.Set(r.AuthParam, key)
+		req.URL.RawQuery = q.Encode()
+	}
+}
+
+// matches reports whether the route serves a request for host and path.
+func (r *Route) matches(host, path string) bool {
+	if r.Host != "" && !strings.EqualFold(r.Host, host) {
+		return false
+	}
+	if r.PathPrefix == "" {
+		return true
+	}
+	return path == r.PathPrefix || strings.HasPrefix(path, r.PathPrefix+"/")
+}
+
+// Provider describes a well-known API provider: the route the proxy serves
+// it on by default and the environment variables that point its SDKs and
+// CLIs at the proxy.
+type Provider struct {
+	Name string
+
+	// AuthEnvVar is the agent auth variable that identifies the provider.
+	AuthEnvVar string
+
+	// BaseURLEnvVars are set to the proxy URL plus the route prefix and
+	// BasePath for agents using this provider.
+	BaseURLEnvVars []string
+
+	// BasePath is the upstream path that clients expect in their base URL
+	// (e.g. "/v1" for OpenAI-compatible clients).
+	BasePath string
+
+	// Route is the provider's default route.
+	Route Route
+}
+
+// Providers lists the built-in providers. Anthropic is served at the proxy
+// root so existing ANTHROPIC_BASE_URL setups keep working.
+var Providers = []Provider{
+	{
+		Name:           "anthropic",
+		AuthEnvVar:     "ANTHROPIC_API_KEY",
+		BaseURLEnvVars: []string{"ANTHROPIC_BASE_URL"},
+		Route: Route{
+			Name:       "anthropic",
+			Upstream:   "https://api.anthropic.com",
+			SecretFile: "anthropic-api-key",
+			AuthStyle:  AuthStyleAPIKey,
+		},
+	},
+	{
+		Name:           "openai",
+		AuthEnvVar:     "OPENAI_API_KEY",
+		BaseURLEnvVars: []string{"OPENAI_BASE_URL"},
+		BasePath:       "/v1",
+		Route: Route{
+			Name:       "openai",
+			PathPrefix: "/openai",
+			Upstream:   "https://api.openai.com",
+			SecretFile: "openai-api-key",
+			AuthStyle:  AuthStyleBearer,
+		},
+	},
+	{
+		Name:           "gemini",
+		AuthEnvVar:     "GEMINI_API_KEY",
+		BaseURLEnvVars: []string{"GOOGLE_GEMINI_BASE_URL"},
+		Route: Route{
+			Name:       "gemini",
+			PathPrefix: "/gemini",
+			Upstream:   "https://generativelanguage.googleapis.com",
+			SecretFile: "gemini-api-key",
+			AuthStyle:  AuthStyleHeader,
+			AuthParam:  "X-Goog-Api-Key",
+		},
+	},
+	{
+		Name:           "openrouter",
+		AuthEnvVar:     "OPENROUTER_API_KEY",
+		BaseURLEnvVars: []string{"OPENROUTER_BASE_URL"},
+		BasePath:       "/api/v1",
+		Route: Route{
+			Name:       "openrouter",
+			PathPrefix: "/openrouter",
+			Upstream:   "https://openrouter.ai",
+			SecretFile: "openrouter-api-key",
+			AuthStyle:  AuthStyleBearer,
+		},
+	},
+}
+
+// ProviderForAuthEnvVar returns the built-in provider whose agents
+// authenticate with envVar.
+func ProviderForAuthEnvVar(envVar string) (Provider, bool) {
+	for _, p := range Providers {
+		if p.AuthEnvVar == envVar {
+			return p, true
+		}
+	}
+	return Provider{}, false
+}
+
+// BaseURL returns the URL clients of the provider should use to reach it
+// through the proxy at proxyURL.
+func (p Provider) BaseURL(proxyURL string) string {
+	return strings.TrimSuffix(proxyURL, "/") + p.Route.PathPrefix + p.BasePath
+}
+
+// DefaultRoutes returns the routes of every built-in provider.
+func DefaultRoutes() []Route {
+	routes := make([]Route, 0, len(Providers))
+	for _, p := range Providers {
+		routes = append(routes, p.Route)
+	}
+	return routes
+}
+
+// LoadRoutes reads a JSON array of routes from path.
+func LoadRoutes(path string) ([]Route, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read routes file: %w", err)
+	}
+	var routes []Route
+	if err := json.Unmarshal(data, &routes); err != nil {
+		return nil, fmt.Errorf("failed to parse routes file: %w", err)
+	}
+	return routes, nil
+}
+
+// routeTable selects the route for a request.
+type routeTable struct {
+	routes []*route
+}
+
+// route is a validated Route with its parsed upstream.
+type route struct {
+	Route
+	target  *url.URL
+	targets []*upstreamTarget // primary first, then failovers
+}
+
+// upstreamTarget is an upstream and key a route can send requests to.
+type upstreamTarget struct {
+	url        *url.URL
+	secretFile string
+	breaker    *breaker
+}
+
+// newRouteTable validates routes and orders them for matching: virtual
+// host routes before host-agnostic ones, then longest path prefix first.
+func newRouteTable(routes []Route, checkInternal bool) (*routeTable, error) {
+	if len(routes) == 0 {
+		return nil, fmt.Errorf("no proxy routes configured")
+	}
+	t := &routeTable{}
+	names := make(map[string]bool, len(routes))
+	for _, r := range routes {
+		if err := r.Validate(); err != nil {
+			return nil, err
+		}
+		if names[r.Name] {
+			return nil, fmt.Errorf("duplicate route name %q", r.Name)
+		}
+		names[r.Name] = true
+
+		target, err := parseUpstream(r.Name, r.Upstream, checkInternal)
+		if err != nil {
+			return nil, err
+		}
+		rt := &route{Route: r, target: target}
+		rt.targets = append(rt.targets, &upstreamTarget{url: target, secretFile: r.SecretFile})
+		for _, f := range r.Failover {
+			ft := &upstreamTarget{url: target, secretFile: r.SecretFile}
+			if f.Upstream != "" {
+				if ft.url, err = parseUpstream(r.Name, f.Upstream, checkInternal); err != nil {
+					return nil, err
+				}
+			}
+			if f.SecretFile != "" {
+				ft.secretFile = f.SecretFile
+			}
+			rt.targets = append(rt.targets, ft)
+		}
+		t.routes = append(t.routes, rt)
+	}
+	sort.SliceStable(t.routes, func(i, j int) bool {
+		a, b := t.routes[i], t.routes[j]
+		if (a.Host != "") != (b.Host != "") {
+			return a.Host != ""
+		}
+		return len(a.PathPrefix) > len(b.PathPrefix)
+	})
+	return t, nil
+}
+
+// parseUpstream parses and checks an upstream URL of a route.
+func parseUpstream(routeName, upstream string, checkInternal bool) (*url.URL, error) {
+	target, err := url.Parse(upstream)
+	if err != nil {
+		return nil, fmt.Errorf("route %s: invalid upstream URL: %w", routeName, err)
+	}
+	// Validate the target URL scheme to prevent plaintext key transmission
+	if target.Scheme != "https" {
+		return nil, fmt.Errorf("route %s: proxy target must use HTTPS (got %q) to protect API keys in transit", routeName, target.Scheme)
+	}
+	// Reject targets that could be used for SSRF against internal services
+	if checkInternal && isInternalHost(target.Hostname()) {
+		return nil, fmt.Errorf("route %s: proxy target must not point to internal/link-local addresses: %s", routeName, target.Hostname())
+	}
+	return target, nil
+}
+
+// match returns the route serving req, or nil if none does.
+func (t *routeTable) match(req *http.Request) *route {
+	host := req.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	for _, r := range t.routes {
+		if r.matches(host, req.URL.Path) {
+			return r
+		}
+	}
+	return nil
+}
+
+// secretFiles returns the distinct secret files used by the routes.
+func (t *routeTable) secretFiles() []string {
+	var files []string
+	seen := make(map[string]bool)
+	for _, r := range t.routes {
+		for _, target := range r.targets {
+			if !seen[target.secretFile] {
+				seen[target.secretFile] = true
+				files = append(files, target.secretFile)
+			}
+		}
+	}
+	return files
+}
+
+// retarget moves a request rewritten for the route's primary upstream to
+// another of its upstreams.
+func (r *route) retarget(req *http.Request, to *url.URL) {
+	if to == r.target {
+		return
+	}
+	base := strings.TrimSuffix(r.target.Path, "/")
+	req.URL.Scheme = to.Scheme
+	req.URL.Host = to.Host
+	req.URL.Path = joinURLPath(to.Path, strings.TrimPrefix(req.URL.Path, base))
+	if req.URL.RawPath != "" {
+		req.URL.RawPath = joinURLPath(to.EscapedPath(), strings.TrimPrefix(req.URL.RawPath, strings.TrimSuffix(r.target.EscapedPath(), "/")))
+	}
+	req.Host = to.Host
+}
+
+// rewrite points req at the route's upstream, stripping the path prefix.
+func (r *route) rewrite(req *http.Request) {
+	path := strings.TrimPrefix(req.URL.Path, r.PathPrefix)
+	rawPath := req.URL.RawPath
+	if rawPath != "" {
+		rawPath = strings.TrimPrefix(rawPath, r.PathPrefix)
+	}
+	req.URL.Scheme = r.target.Scheme
+	req.URL.Host = r.target.Host
+	req.URL.Path = joinURLPath(r.target.Path, path)
+	if rawPath != "" {
+		req.URL.RawPath = joinURLPath(r.target.EscapedPath(), rawPath)
+	}
+	req.Host = r.target.Host
+}
+
+func joinURLPath(base, path string) string {
+	if path == "" {
+		path = "/"
+	}
+	return strings.TrimSuffix(base, "/") + "/" + strings.TrimPrefix(path, "/")
+}
@@ -0,0 +1,193 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestProxy_Routes(t *testing.T) {
+	type received struct {
+		path, query, apiKey, auth, goog string
+	}
+	var got received
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = received{
+			path:   r.URL.Path,
+			query:  r.URL.RawQuery,
+			apiKey: r.Header.Get("X-Api-Key"),
+			auth:   r.Header.Get("Authorization"),
+			goog:   r.Header.Get("X-Goog-Api-Key"),
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+
+	tmpDir := t.TempDir()
+	sandboxDir := filepath.Join(tmpDir, "test-sandbox")
+	if err := os.MkdirAll(sandboxDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	for file, key := range map[string]string{
+		"anthropic-api-key": "sk-ant",
+		"openai-api-key":    "sk-openai",
+		"gemini-api-key":    "gm-key",
+		"search-key":        "q-key",
+	} {
+		if err := os.WriteFile(filepath.Join(sandboxDir, file), []byte(key+"\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p, err := New(&Config{
+		ListenAddr: ":0",
+		SecretsDir: tmpDir,
+		Transport:  upstream.Client().Transport,
+		Routes: []Route{
+			{Name: "anthropic", Upstream: upstream.URL, SecretFile: "anthropic-api-key"},
+			{Name: "openai", PathPrefix: "/openai", Upstream: upstream.URL, SecretFile: "openai-api-key", AuthStyle: AuthStyleBearer},
+			{Name: "gemini", PathPrefix: "/gemini", Upstream: upstream.URL + "/base", SecretFile: "gemini-api-key", AuthStyle: AuthStyleHeader, AuthParam: "X-Goog-Api-Key"},
+			{Name: "search", Host: "search.proxy.local", Upstream: upstream.URL, SecretFile: "search-key", AuthStyle: AuthStyleQuery, AuthParam: "key"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.LoadAPIKeys(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		host   string
+		target string
+		want   received
+	}{
+		{
+			name:   "root route uses x-api-key",
+			target: "/v1/messages",
+			want:   received{path: "/v1/messages", apiKey: "sk-ant"},
+		},
+		{
+			name:   "prefix is stripped and bearer injected",
+			target: "/openai/v1/chat/completions",
+			want:   received{path: "/v1/chat/completions", auth: "Bearer sk-openai"},
+		},
+		{
+			name:   "custom header and upstream base path",
+			target: "/gemini/v1beta/models",
+			want:   received{path: "/base/v1beta/models", goog: "gm-key"},
+		},
+		{
+			name:   "virtual host with query parameter",
+			host:   "search.proxy.local:8080",
+			target: "/openai/search?q=go",
+			want:   received{path: "/openai/search", query: "key=q-key&q=go"},
+		},
+		{
+			name:   "prefix must match a whole segment",
+			target: "/openaix/v1",
+			want:   received{path: "/openaix/v1", apiKey: "sk-ant"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got = received{}
+			req := httptest.NewRequest("POST", tt.target, nil)
+			if tt.host != "" {
+				req.Host = tt.host
+			}
+			req.Header.Set("X-Forage-Sandbox", "test-sandbox")
+			// Sandbox-supplied credentials must be replaced or removed, in
+			// any position, not forwarded
+			req.Header.Set("Authorization", "Bearer sandbox-value")
+			req.Header.Set("X-Api-Key", "sandbox-value")
+
+			w := httptest.NewRecorder()
+			p.ServeHTTP(w, req)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200", w.Code)
+			}
+			if got != tt.want {
+				t.Errorf("upstream received %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProxy_NoMatchingRoute(t *testing.T) {
+	p, err := New(&Config{
+		ListenAddr: ":0",
+		SecretsDir: t.TempDir(),
+		Routes: []Route{
+			{Name: "openai", PathPrefix: "/openai", Upstream: "https://api.example.com", SecretFile: "openai-api-key", AuthStyle: AuthStyleBearer},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest("GET", "/v1/messages", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404", w.Code)
+	}
+}
+
+func TestRoute_Validate(t *testing.T) {
+	valid := Route{Name: "r", Upstream: "https://api.example.com", SecretFile: "key"}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("Validate() unexpected error: %v", err)
+	}
+
+	invalid := map[string]Route{
+		"no name":            {Upstream: "https://api.example.com", SecretFile: "key"},
+		"prefix no slash":    {Name: "r", PathPrefix: "openai", Upstream: "https://api.example.com", SecretFile: "key"},
+		"prefix trailing":    {Name: "r", PathPrefix: "/openai/", Upstream: "https://api.example.com", SecretFile: "key"},
+		"no upstream":        {Name: "r", SecretFile: "key"},
+		"secret traversal":   {Name: "r", Upstream: "https://api.example.com", SecretFile: "../key"},
+		"unknown style":      {Name: "r", Upstream: "https://api.example.com", SecretFile: "key", AuthStyle: "basic"},
+		"query without name": {Name: "r", Upstream: "https://api.example.com", SecretFile: "key", AuthStyle: AuthStyleQuery},
+		"bad header name":    {Name: "r", Upstream: "https://api.example.com", SecretFile: "key", AuthStyle: AuthStyleHeader, AuthParam: "X Key"},
+		"empty failover":     {Name: "r", Upstream: "https://api.example.com", SecretFile: "key", Failover: []Failover{{}}},
+		"failover traversal": {Name: "r", Upstream: "https://api.example.com", SecretFile: "key", Failover: []Failover{{SecretFile: "../key"}}},
+	}
+	for name, r := range invalid {
+		if err := r.Validate(); err == nil {
+			t.Errorf("Validate() expected error for %s", name)
+		}
+	}
+
+	if _, err := newRouteTable([]Route{valid, valid}, false); err == nil {
+		t.Error("newRouteTable() expected error for duplicate route names")
+	}
+	plain := valid
+	plain.Upstream = "http://api.example.com"
+	if _, err := newRouteTable([]Route{plain}, false); err == nil {
+		t.Error("newRouteTable() expected error for non-HTTPS upstream")
+	}
+	plainFailover := valid
+	plainFailover.Failover = []Failover{{Upstream: "http://backup.example.com"}}
+	if _, err := newRouteTable([]Route{plainFailover}, false); err == nil {
+		t.Error("newRouteTable() expected error for non-HTTPS failover upstream")
+	}
+}
+
+func TestDefaultRoutes(t *testing.T) {
+	if _, err := newRouteTable(DefaultRoutes(), false); err != nil {
+		t.Fatalf("default routes invalid: %v", err)
+	}
+
+	p, ok := ProviderForAuthEnvVar("OPENAI_API_KEY")
+	if !ok {
+		t.Fatal("expected built-in OpenAI provider")
+	}
+	if got := p.BaseURL("http://10.100.0.1:8080/"); got != "http://10.100.0.1:8080/openai/v1" {
+		t.Errorf("BaseURL() = %q", got)
+	}
+	if _, ok := ProviderForAuthEnvVar("UNKNOWN_KEY"); ok {
+		t.Error("expected no provider for unknown env var")
+	}
+}
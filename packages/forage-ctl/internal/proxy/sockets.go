@@ -0,0 +1,270 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	// socketFile is the unix socket within a sandbox's token directory.
+	socketFile = "api.sock"
+
+	// SocketContainerPath is the proxy socket as seen inside the sandbox.
+	SocketContainerPath = TokenContainerDir + "/" + socketFile
+
+	// ShimPort is the loopback port of the in-container shim that forwards
+	// to the proxy socket, for sandboxes without network access.
+	ShimPort = 8788
+
+	// ShimURL is the proxy URL agents use in sandboxes that reach the proxy
+	// through the shim.
+	ShimURL = "http://127.0.0.1:8788"
+
+	// socketSyncInterval is how often the proxy looks for sandboxes that
+	// gained or lost their token directory.
+	socketSyncInterval = 2 * time.Second
+)
+
+// SocketPath returns the host path of a sandbox's proxy socket.
+func SocketPath(stateDir, sandbox string) (string, error) {
+	dir, err := TokenDir(stateDir, sandbox)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, socketFile), nil
+}
+
+// socketSandboxKey is the context key holding the sandbox a connection
+// arrived on.
+type socketSandboxKey struct{}
+
+// socketSandbox returns the sandbox whose socket a request arrived on, or
+// "" for requests over TCP.
+func socketSandbox(ctx context.Context) string {
+	name, _ := ctx.Value(socketSandboxKey{}).(string)
+	return name
+}
+
+// socketConnContext tags connections accepted on a sandbox socket with the
+// sandbox's name.
+func socketConnContext(ctx context.Context, c net.Conn) context.Context {
+	if sc, ok := c.(*sandboxConn); ok {
+		return context.WithValue(ctx, socketSandboxKey{}, sc.sandbox)
+	}
+	return ctx
+}
+
+// sandboxListener accepts connections on one sandbox's socket. It keeps
+// track of them, so that closing it also cuts off the sandbox's open
+// keep-alive connections.
+type sandboxListener struct {
+	net.Listener
+	sandbox string
+
+	mu     sync.Mutex
+	conns  map[*sandboxConn]struct{}
+	closed bool
+}
+
+func newSandboxListener(l net.Listener, sandbox string) *sandboxListener {
+	return &sandboxListener{Listener: l, sandbox: sandbox, conns: make(map[*sandboxConn]struct{})}
+}
+
+func (l *sandboxListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	sc := &sandboxConn{Conn: c, sandbox: l.sandbox, listener: l}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		_ = c.Close()
+		return nil, net.ErrClosed
+	}
+	l.conns[sc] = struct{}{}
+	return sc, nil
+}
+
+// Close stops accepting connections and closes those already accepted.
+func (l *sandboxListener) Close() error {
+	err := l.Listener.Close()
+	l.mu.Lock()
+	conns := l.conns
+	l.conns = nil
+	l.closed = true
+	l.mu.Unlock()
+	for c := range conns {
+		_ = c.Conn.Close()
+	}
+	return err
+}
+
+// forget drops a connection that was closed.
+func (l *sandboxListener) forget(c *sandboxConn) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.conns, c)
+}
+
+// sandboxConn is a connection that arrived on a sandbox's socket.
+type sandboxConn struct {
+	net.Conn
+	sandbox  string
+	listener *sandboxListener
+}
+
+func (c *sandboxConn) Close() error {
+	c.listener.forget(c)
+	return c.Conn.Close()
+}
+
+// socketManager serves the proxy on one unix socket per sandbox. The socket
+// lives in the sandbox's token directory, which is mounted into the
+// sandbox, so which socket a request arrives on identifies its sandbox.
+type socketManager struct {
+	stateDir string
+	server   *http.Server
+	logger   *slog.Logger
+
+	mu        sync.Mutex
+	listeners map[string]*sandboxListener // sandbox name -> listener
+	started   bool
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+func newSocketManager(stateDir string, server *http.Server, logger *slog.Logger) *socketManager {
+	return &socketManager{
+		stateDir:  stateDir,
+		server:    server,
+		logger:    logger,
+		listeners: make(map[string]*sandboxListener),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+// start opens the sockets of existing sandboxes and keeps them in sync
+// with the token directories until close.
+func (m *socketManager) start() {
+	m.mu.Lock()
+	m.started = true
+	m.mu.Unlock()
+	m.sync()
+	go m.run()
+}
+
+func (m *socketManager) run() {
+	defer close(m.done)
+	ticker := time.NewTicker(socketSyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.stop:
+			return
+		case <-ticker.C:
+			m.sync()
+		}
+	}
+}
+
+// sync opens sockets for new sandboxes and closes those of removed ones,
+// along with their open connections.
+func (m *socketManager) sync() {
+	entries, err := os.ReadDir(tokensDir(m.stateDir))
+	if err != nil && !os.IsNotExist(err) {
+		m.logger.Warn("failed to read tokens directory", "error", err)
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	present := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		name := entry.Name()
+		present[name] = true
+		path, err := SocketPath(m.stateDir, name)
+		if err != nil {
+			continue
+		}
+		if l, ok := m.listeners[name]; ok {
+			// Keep the listener while its socket file is in place
+			if _, err := os.Stat(path); err == nil {
+				continue
+			}
+			_ = l.Close()
+			delete(m.listeners, name)
+		}
+		l, err := m.listen(name, path)
+		if err != nil {
+			m.logger.Warn("failed to open sandbox socket", "sandbox", name, "error", err)
+			continue
+		}
+		m.listeners[name] = l
+		m.logger.Debug("serving sandbox socket", "sandbox", name, "path", path)
+	}
+
+	for name, l := range m.listeners {
+		if !present[name] {
+			_ = l.Close()
+			delete(m.listeners, name)
+			m.logger.Debug("closed sandbox socket", "sandbox", name)
+		}
+	}
+}
+
+// listen opens a sandbox's socket and starts serving it.
+func (m *socketManager) listen(sandbox, path string) (*sandboxListener, error) {
+	// A socket left behind by a previous proxy would make bind fail
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	// The container user must be able to connect; the token directories
+	// themselves keep other host users out
+	if err := os.Chmod(path, 0666); err != nil {
+		_ = l.Close()
+		return nil, err
+	}
+	sl := newSandboxListener(l, sandbox)
+	go func() {
+		if err := m.server.Serve(sl); err != nil && !errors.Is(err, http.ErrServerClosed) && !errors.Is(err, net.ErrClosed) {
+			m.logger.Warn("sandbox socket stopped", "sandbox", sandbox, "error", err)
+		}
+	}()
+	return sl, nil
+}
+
+// close stops syncing and closes all sockets.
+func (m *socketManager) close() {
+	m.mu.Lock()
+	started := m.started
+	m.mu.Unlock()
+	if !started {
+		return
+	}
+	close(m.stop)
+	<-m.done
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for name, l := range m.listeners {
+		_ = l.Close()
+		delete(m.listeners, name)
+	}
+}
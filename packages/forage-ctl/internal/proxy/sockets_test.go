@@ -0,0 +1,141 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProxy_UnixSockets(t *testing.T) {
+	var gotKey, gotSandboxHeader string
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotKey = r.Header.Get("X-Api-Key")
+		gotSandboxHeader = r.Header.Get("X-Forage-Sandbox")
+		io.WriteString(w, "{}")
+	}))
+	defer upstream.Close()
+
+	tmpDir := t.TempDir()
+	secretsDir := filepath.Join(tmpDir, "secrets")
+	stateDir := filepath.Join(tmpDir, "state")
+	for name, key := range map[string]string{"alpha": "sk-alpha", "beta": "sk-beta"} {
+		os.MkdirAll(filepath.Join(secretsDir, name), 0700)
+		os.WriteFile(filepath.Join(secretsDir, name, "anthropic-api-key"), []byte(key), 0600)
+	}
+	if _, err := IssueToken(stateDir, "alpha"); err != nil {
+		t.Fatal(err)
+	}
+	betaToken, err := IssueToken(stateDir, "beta")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := New(&Config{
+		SecretsDir:   secretsDir,
+		TargetURL:    upstream.URL,
+		StateDir:     stateDir,
+		RequireToken: true,
+		Transport:    upstream.Client().Transport,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	if err := p.LoadAPIKeys(); err != nil {
+		t.Fatal(err)
+	}
+
+	server := &http.Server{Handler: p, ConnContext: socketConnContext}
+	sockets := newSocketManager(stateDir, server, p.config.Logger)
+	sockets.start()
+	defer sockets.close()
+
+	alphaSocket, err := SocketPath(stateDir, "alpha")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", alphaSocket)
+		},
+	}}
+	send := func(headers map[string]string) int {
+		t.Helper()
+		gotKey, gotSandboxHeader = "", ""
+		req, _ := http.NewRequest("POST", "http://proxy/v1/messages", strings.NewReader("{}"))
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// The socket identifies the sandbox, even with keys required and a
+	// spoofed sandbox header
+	if code := send(map[string]string{"X-Forage-Sandbox": "beta"}); code != http.StatusOK {
+		t.Fatalf("status %d, want 200", code)
+	}
+	if gotKey != "sk-alpha" || gotSandboxHeader != "" {
+		t.Errorf("upstream got key %q, sandbox header %q; want sk-alpha and none", gotKey, gotSandboxHeader)
+	}
+
+	// Another sandbox's key on this socket is rejected
+	if code := send(map[string]string{"X-Api-Key": betaToken}); code != http.StatusUnauthorized {
+		t.Errorf("foreign key: status %d, want 401", code)
+	}
+
+	// A keep-alive connection opened before revocation
+	conn, err := net.Dial("unix", alphaSocket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	connReader := bufio.NewReader(conn)
+	sendOnConn := func() (int, error) {
+		t.Helper()
+		req, _ := http.NewRequest("POST", "http://proxy/v1/messages", strings.NewReader("{}"))
+		if err := req.Write(conn); err != nil {
+			return 0, err
+		}
+		resp, err := http.ReadResponse(connReader, req)
+		if err != nil {
+			return 0, err
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		return resp.StatusCode, nil
+	}
+	if code, err := sendOnConn(); err != nil || code != http.StatusOK {
+		t.Fatalf("keep-alive connection: status %d, error %v; want 200", code, err)
+	}
+
+	// Once its key is revoked, the sandbox's open connections are refused
+	// before the socket is closed, then closed with it
+	if err := RevokeToken(stateDir, "alpha"); err != nil {
+		t.Fatal(err)
+	}
+	p.tokens.now = func() time.Time { return time.Now().Add(2 * tokenRefreshInterval) }
+	if code, err := sendOnConn(); err != nil || code != http.StatusUnauthorized {
+		t.Errorf("revoked sandbox: status %d, error %v; want 401", code, err)
+	}
+	sockets.sync()
+	if _, err := sendOnConn(); err == nil {
+		t.Error("keep-alive connection still served after its socket was closed")
+	}
+	client.CloseIdleConnections()
+	if _, err := client.Get("http://proxy/v1/models"); err == nil {
+		t.Error("socket still served after revocation")
+	}
+}
@@ -0,0 +1,217 @@
+package proxy
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/config"
+)
+
+const (
+	// TokenPrefix marks virtual API keys minted by forage. Sandboxes send
+	// them in place of real keys; the proxy swaps them for the real key.
+	TokenPrefix = "forage-"
+
+	// TokenContainerDir is where a sandbox's token directory is mounted.
+	TokenContainerDir = "/run/forage-proxy"
+
+	// TokenContainerPath is the token file as seen inside the sandbox.
+	TokenContainerPath = TokenContainerDir + "/" + tokenFile
+
+	// tokenFile is the file holding the token within its directory.
+	tokenFile = "token"
+
+	// tokenRefreshInterval is how often the proxy rescans issued tokens, so
+	// new, rotated and revoked tokens take effect without a restart.
+	tokenRefreshInterval = time.Second
+)
+
+// tokensDir returns the directory holding the token directories of all
+// sandboxes.
+func tokensDir(stateDir string) string {
+	return filepath.Join(stateDir, "proxy-tokens")
+}
+
+// TokenDir returns the host directory holding a sandbox's token. It is
+// mounted read-only into the sandbox at TokenContainerDir.
+func TokenDir(stateDir, sandbox string) (string, error) {
+	if err := config.ValidateSandboxName(sandbox); err != nil {
+		return "", err
+	}
+	return filepath.Join(tokensDir(stateDir), sandbox), nil
+}
+
+// IssueToken mints a new token for a sandbox, replacing any previous one.
+func IssueToken(stateDir, sandbox string) (string, error) {
+	dir, err := TokenDir(stateDir, sandbox)
+	if err != nil {
+		return "", err
+	}
+	// Only the sandbox's own directory is mounted; keep the others private
+	if err := os.MkdirAll(tokensDir(stateDir), 0700); err != nil {
+		return "", fmt.Errorf("failed to create tokens directory: %w", err)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create token directory: %w", err)
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	token := TokenPrefix + hex.EncodeToString(buf)
+
+	// Replace the file atomically so the bind mount sees the new token
+	path := filepath.Join(dir, tokenFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(token+"\n"), 0644); err != nil {
+		return "", fmt.Errorf("failed to write token: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return "", fmt.Errorf("failed to write token: %w", err)
+	}
+	return token, nil
+}
+
+// LoadToken returns a sandbox's token, or "" if none was issued.
+func LoadToken(stateDir, sandbox string) (string, error) {
+	dir, err := TokenDir(stateDir, sandbox)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(filepath.Join(dir, tokenFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to read token: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// RevokeToken removes a sandbox's token.
+func RevokeToken(stateDir, sandbox string) error {
+	dir, err := TokenDir(stateDir, sandbox)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
+
+// tokenIndex maps issued tokens to their sandboxes.
+type tokenIndex struct {
+	stateDir string
+	now      func() time.Time
+
+	mu        sync.Mutex
+	scannedAt time.Time
+	sandboxes map[string]string // token -> sandbox name
+}
+
+func newTokenIndex(stateDir string) *tokenIndex {
+	return &tokenIndex{stateDir: stateDir, now: time.Now}
+}
+
+// lookup returns the sandbox a token was issued to, or "" if the token is
+// unknown or revoked.
+func (t *tokenIndex) lookup(token string) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := t.refresh(); err != nil {
+		return "", err
+	}
+	return t.sandboxes[token], nil
+}
+
+// issued reports whether a sandbox holds a token that is not revoked.
+func (t *tokenIndex) issued(sandbox string) (bool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := t.refresh(); err != nil {
+		return false, err
+	}
+	for _, name := range t.sandboxes {
+		if name == sandbox {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// refresh rescans the issued tokens if the last scan is too old. Callers
+// must hold t.mu.
+func (t *tokenIndex) refresh() error {
+	if now := t.now(); t.sandboxes == nil || now.Sub(t.scannedAt) >= tokenRefreshInterval {
+		if err := t.scan(); err != nil {
+			return err
+		}
+		t.scannedAt = now
+	}
+	return nil
+}
+
+// scan reloads all issued tokens. Callers must hold t.mu.
+func (t *tokenIndex) scan() error {
+	entries, err := os.ReadDir(tokensDir(t.stateDir))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read tokens directory: %w", err)
+	}
+	sandboxes := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		token, err := LoadToken(t.stateDir, entry.Name())
+		if err != nil || token == "" {
+			continue
+		}
+		sandboxes[token] = entry.Name()
+	}
+	t.sandboxes = sandboxes
+	return nil
+}
+
+// requestToken returns the forage token a request authenticates with, if
+// any, from wherever the provider clients put their API key.
+func requestToken(r *http.Request) string {
+	candidates := []string{
+		r.Header.Get("X-Api-Key"),
+		r.Header.Get("X-Goog-Api-Key"),
+		r.URL.Query().Get("key"),
+	}
+	if auth, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		candidates = append(candidates, auth)
+	}
+	for _, c := range candidates {
+		if strings.HasPrefix(c, TokenPrefix) {
+			return c
+		}
+	}
+	return ""
+}
+
+// stripToken removes the forage token from a request so that it never
+// reaches upstream or a cassette.
+func stripToken(r *http.Request) {
+	for _, h := range []string{"X-Api-Key", "X-Goog-Api-Key"} {
+		if strings.HasPrefix(r.Header.Get(h), TokenPrefix) {
+			r.Header.Del(h)
+		}
+	}
+	if strings.HasPrefix(r.Header.Get("Authorization"), "Bearer "+TokenPrefix) {
+		r.Header.Del("Authorization")
+	}
+	if q := r.URL.Query(); strings.HasPrefix(q.Get("key"), TokenPrefix) {
+		q.Del("key")
+		r.URL.RawQuery = q.Encode()
+	}
+}
@@ -0,0 +1,151 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTokens_IssueLoadRevoke(t *testing.T) {
+	stateDir := t.TempDir()
+
+	token, err := IssueToken(stateDir, "sb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(token, TokenPrefix) || len(token) != len(TokenPrefix)+64 {
+		t.Errorf("unexpected token %q", token)
+	}
+	if got, err := LoadToken(stateDir, "sb"); err != nil || got != token {
+		t.Errorf("LoadToken() = %q, %v; want %q", got, err, token)
+	}
+
+	rotated, err := IssueToken(stateDir, "sb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotated == token {
+		t.Error("IssueToken should mint a new token")
+	}
+
+	if err := RevokeToken(stateDir, "sb"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := LoadToken(stateDir, "sb"); got != "" {
+		t.Errorf("token %q still present after revocation", got)
+	}
+	if _, err := IssueToken(stateDir, "../escape"); err == nil {
+		t.Error("IssueToken should reject invalid sandbox names")
+	}
+}
+
+func TestProxy_VirtualKeys(t *testing.T) {
+	var gotKey, gotAuth, gotSandboxHeader string
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotKey = r.Header.Get("X-Api-Key")
+		gotAuth = r.Header.Get("Authorization")
+		gotSandboxHeader = r.Header.Get("X-Forage-Sandbox")
+		io.WriteString(w, "{}")
+	}))
+	defer upstream.Close()
+
+	tmpDir := t.TempDir()
+	secretsDir := filepath.Join(tmpDir, "secrets")
+	stateDir := filepath.Join(tmpDir, "state")
+	for name, key := range map[string]string{"alpha": "sk-alpha", "beta": "sk-beta"} {
+		os.MkdirAll(filepath.Join(secretsDir, name), 0700)
+		os.WriteFile(filepath.Join(secretsDir, name, "anthropic-api-key"), []byte(key), 0600)
+	}
+	alphaToken, err := IssueToken(stateDir, "alpha")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newProxy := func(requireToken bool) *Proxy {
+		p, err := New(&Config{
+			SecretsDir:   secretsDir,
+			TargetURL:    upstream.URL,
+			StateDir:     stateDir,
+			RequireToken: requireToken,
+			Transport:    upstream.Client().Transport,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := p.LoadAPIKeys(); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	send := func(p *Proxy, headers map[string]string) int {
+		gotKey, gotAuth, gotSandboxHeader = "", "", ""
+		req := httptest.NewRequest("POST", "/v1/messages", strings.NewReader("{}"))
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	p := newProxy(false)
+	defer p.Close()
+
+	// The virtual key wins over a spoofed sandbox header
+	if code := send(p, map[string]string{"X-Api-Key": alphaToken, "X-Forage-Sandbox": "beta"}); code != http.StatusOK {
+		t.Fatalf("status %d, want 200", code)
+	}
+	if gotKey != "sk-alpha" || gotSandboxHeader != "" {
+		t.Errorf("upstream got key %q, sandbox header %q; want sk-alpha and none", gotKey, gotSandboxHeader)
+	}
+
+	// Bearer tokens are recognized and never forwarded
+	if code := send(p, map[string]string{"Authorization": "Bearer " + alphaToken}); code != http.StatusOK {
+		t.Fatalf("status %d, want 200", code)
+	}
+	if gotKey != "sk-alpha" || strings.Contains(gotAuth, TokenPrefix) {
+		t.Errorf("upstream got key %q, authorization %q", gotKey, gotAuth)
+	}
+
+	// Unknown keys are rejected
+	if code := send(p, map[string]string{"X-Api-Key": TokenPrefix + "bogus"}); code != http.StatusUnauthorized {
+		t.Errorf("unknown key: status %d, want 401", code)
+	}
+
+	// Without a key, legacy header identification still works
+	if code := send(p, map[string]string{"X-Forage-Sandbox": "beta"}); code != http.StatusOK || gotKey != "sk-beta" {
+		t.Errorf("header identity: status %d, key %q", code, gotKey)
+	}
+
+	// Rotation and revocation take effect on the next rescan
+	rotated, err := IssueToken(stateDir, "alpha")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.tokens.now = func() time.Time { return time.Now().Add(tokenRefreshInterval) }
+	if code := send(p, map[string]string{"X-Api-Key": alphaToken}); code != http.StatusUnauthorized {
+		t.Errorf("rotated-out key: status %d, want 401", code)
+	}
+	if code := send(p, map[string]string{"X-Api-Key": rotated}); code != http.StatusOK {
+		t.Errorf("rotated key: status %d, want 200", code)
+	}
+	if err := RevokeToken(stateDir, "alpha"); err != nil {
+		t.Fatal(err)
+	}
+	p.tokens.now = func() time.Time { return time.Now().Add(2 * tokenRefreshInterval) }
+	if code := send(p, map[string]string{"X-Api-Key": rotated}); code != http.StatusUnauthorized {
+		t.Errorf("revoked key: status %d, want 401", code)
+	}
+
+	// Requiring keys disables the fallback
+	strict := newProxy(true)
+	defer strict.Close()
+	if code := send(strict, map[string]string{"X-Forage-Sandbox": "beta"}); code != http.StatusUnauthorized {
+		t.Errorf("require token: status %d, want 401", code)
+	}
+}
@@ -0,0 +1,275 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/usage"
+)
+
+const (
+	// maxUsageJSONBody caps how much of a JSON response is kept for usage
+	// parsing. Larger responses are forwarded untouched but not accounted.
+	maxUsageJSONBody = 8 * 1024 * 1024
+
+	// maxUsageSSELine caps a single SSE line kept for usage parsing.
+	maxUsageSSELine = 1024 * 1024
+)
+
+// requestInfoKey is the context key carrying requestInfo from ServeHTTP to
+// the reverse proxy's response hook.
+type requestInfoKey struct{}
+
+// requestInfo identifies the sandbox and route of a proxied request.
+type requestInfo struct {
+	sandbox  string
+	route    string
+	start    time.Time
+	recorded *RecordedRequest // Request to record to the cassette, if recording
+}
+
+func withRequestInfo(ctx context.Context, info requestInfo) context.Context {
+	return context.WithValue(ctx, requestInfoKey{}, info)
+}
+
+func requestInfoFrom(ctx context.Context) requestInfo {
+	info, _ := ctx.Value(requestInfoKey{}).(requestInfo)
+	return info
+}
+
+// wrapUsageBody replaces resp.Body with a reader that extracts token usage
+// as the body passes through to the client. JSON bodies are parsed once
+// fully read; SSE streams are parsed line by line without being held back.
+// onDone is called once, when the body is exhausted or closed.
+func wrapUsageBody(resp *http.Response, onDone func(model string, tokens usage.Tokens)) {
+	if resp.Body == nil || resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	var parser usageParser
+	switch mediaType {
+	case "application/json":
+		parser = &jsonUsageParser{}
+	case "text/event-stream":
+		parser = &sseUsageParser{}
+	default:
+		return
+	}
+	resp.Body = &usageReader{body: resp.Body, parser: parser, onDone: onDone}
+}
+
+// usageParser incrementally consumes a response body.
+type usageParser interface {
+	write(p []byte)
+	result() (model string, tokens usage.Tokens)
+}
+
+// usageReader passes a response body through while feeding it to a parser.
+type usageReader struct {
+	body   io.ReadCloser
+	parser usageParser
+	onDone func(model string, tokens usage.Tokens)
+	once   sync.Once
+}
+
+func (u *usageReader) Read(p []byte) (int, error) {
+	n, err := u.body.Read(p)
+	if n > 0 {
+		u.parser.write(p[:n])
+	}
+	if err == io.EOF {
+		u.finish()
+	}
+	return n, err
+}
+
+// Close reports the usage seen so far, so interrupted streams are still
+// accounted for the tokens they did consume.
+func (u *usageReader) Close() error {
+	u.finish()
+	return u.body.Close()
+}
+
+func (u *usageReader) finish() {
+	u.once.Do(func() {
+		model, tokens := u.parser.result()
+		if !tokens.IsZero() {
+			u.onDone(model, tokens)
+		}
+	})
+}
+
+// apiResponse holds the usage-related fields of Anthropic and
+// OpenAI-compatible responses and stream events.
+type apiResponse struct {
+	Type    string       `json:"type"`
+	Model   string       `json:"model"`
+	Usage   *apiUsage    `json:"usage"`
+	Message *apiResponse `json:"message"` // Anthropic message_start
+}
+
+type apiUsage struct {
+	// Anthropic
+	InputTokens              int64 `json:"input_tokens"`
+	OutputTokens             int64 `json:"output_tokens"`
+	CacheCreationInputTokens int64 `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int64 `json:"cache_read_input_tokens"`
+
+	// OpenAI-compatible
+	PromptTokens        int64 `json:"prompt_tokens"`
+	CompletionTokens    int64 `json:"completion_tokens"`
+	PromptTokensDetails *struct {
+		CachedTokens int64 `json:"cached_tokens"`
+	} `json:"prompt_tokens_details"`
+}
+
+// tokens normalizes the usage. OpenAI counts cached tokens as part of the
+// prompt; they are reported separately here, as Anthropic does.
+func (u *apiUsage) tokens() usage.Tokens {
+	t := usage.Tokens{
+		Input:      u.InputTokens,
+		Output:     u.OutputTokens,
+		CacheWrite: u.CacheCreationInputTokens,
+		CacheRead:  u.CacheReadInputTokens,
+	}
+	if u.PromptTokens != 0 || u.CompletionTokens != 0 {
+		cached := int64(0)
+		if u.PromptTokensDetails != nil {
+			cached = u.PromptTokensDetails.CachedTokens
+		}
+		t.Input += u.PromptTokens - cached
+		t.Output += u.CompletionTokens
+		t.CacheRead += cached
+	}
+	return t
+}
+
+// jsonUsageParser reads usage from a complete JSON response.
+type jsonUsageParser struct {
+	buf      bytes.Buffer
+	overflow bool
+}
+
+func (j *jsonUsageParser) write(p []byte) {
+	if j.overflow {
+		return
+	}
+	if j.buf.Len()+len(p) > maxUsageJSONBody {
+		j.overflow = true
+		j.buf.Reset()
+		return
+	}
+	j.buf.Write(p)
+}
+
+func (j *jsonUsageParser) result() (string, usage.Tokens) {
+	if j.overflow {
+		return "", usage.Tokens{}
+	}
+	var resp apiResponse
+	if err := json.Unmarshal(j.buf.Bytes(), &resp); err != nil || resp.Usage == nil {
+		return "", usage.Tokens{}
+	}
+	return resp.Model, resp.Usage.tokens()
+}
+
+// sseUsageParser reads usage from a server-sent event stream. Anthropic
+// reports input and cache tokens in message_start and cumulative output
+// tokens in message_delta; OpenAI-compatible streams send a final chunk
+// carrying the whole usage.
+type sseUsageParser struct {
+	line     []byte
+	skipping bool // discarding the rest of an oversized line
+	model    string
+	tokens   usage.Tokens
+}
+
+func (s *sseUsageParser) write(p []byte) {
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			s.appendLine(p)
+			return
+		}
+		s.appendLine(p[:i])
+		if !s.skipping {
+			s.handleLine(bytes.TrimSuffix(s.line, []byte("\r")))
+		}
+		s.line = s.line[:0]
+		s.skipping = false
+		p = p[i+1:]
+	}
+}
+
+func (s *sseUsageParser) appendLine(p []byte) {
+	if s.skipping {
+		return
+	}
+	if len(s.line)+len(p) > maxUsageSSELine {
+		s.skipping = true
+		s.line = s.line[:0]
+		return
+	}
+	s.line = append(s.line, p...)
+}
+
+func (s *sseUsageParser) handleLine(line []byte) {
+	data, ok := bytes.CutPrefix(line, []byte("data:"))
+	if !ok {
+		return
+	}
+	data = bytes.TrimSpace(data)
+	// Skip events that cannot carry usage without decoding them
+	if !bytes.Contains(data, []byte(`"usage"`)) {
+		return
+	}
+	var event apiResponse
+	if err := json.Unmarshal(data, &event); err != nil {
+		return
+	}
+
+	switch event.Type {
+	case "message_start":
+		if event.Message != nil {
+			if event.Message.Model != "" {
+				s.model = event.Message.Model
+			}
+			if event.Message.Usage != nil {
+				s.tokens = event.Message.Usage.tokens()
+			}
+		}
+	case "message_delta":
+		if event.Usage == nil {
+			return
+		}
+		// Counts in message_delta are cumulative for the message
+		t := event.Usage.tokens()
+		s.tokens.Output = t.Output
+		if t.Input != 0 {
+			s.tokens.Input = t.Input
+		}
+		if t.CacheWrite != 0 {
+			s.tokens.CacheWrite = t.CacheWrite
+		}
+		if t.CacheRead != 0 {
+			s.tokens.CacheRead = t.CacheRead
+		}
+	default:
+		if event.Usage != nil {
+			if event.Model != "" {
+				s.model = event.Model
+			}
+			s.tokens = event.Usage.tokens()
+		}
+	}
+}
+
+func (s *sseUsageParser) result() (string, usage.Tokens) {
+	return s.model, s.tokens
+}
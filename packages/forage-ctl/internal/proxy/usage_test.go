@@ -0,0 +1,173 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/usage"
+)
+
+func TestUsageParsers(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		wantModel   string
+		want        usage.Tokens
+	}{
+		{
+			name:        "anthropic json",
+			contentType: "application/json",
+			body:        `{"id":"msg_1","model":"claude-sonnet-4-20250514","usage":{"input_tokens":12,"output_tokens":34,"cache_creation_input_tokens":5,"cache_read_input_tokens":100}}`,
+			wantModel:   "claude-sonnet-4-20250514",
+			want:        usage.Tokens{Input: 12, Output: 34, CacheWrite: 5, CacheRead: 100},
+		},
+		{
+			name:        "openai json",
+			contentType: "application/json; charset=utf-8",
+			body:        `{"model":"gpt-4o","usage":{"prompt_tokens":100,"completion_tokens":20,"prompt_tokens_details":{"cached_tokens":60}}}`,
+			wantModel:   "gpt-4o",
+			want:        usage.Tokens{Input: 40, Output: 20, CacheRead: 60},
+		},
+		{
+			name:        "anthropic stream",
+			contentType: "text/event-stream",
+			body: "event: message_start\r\n" +
+				`data: {"type":"message_start","message":{"model":"claude-opus-4-1","usage":{"input_tokens":25,"cache_read_input_tokens":1000,"output_tokens":1}}}` + "\r\n\r\n" +
+				"event: content_block_delta\n" +
+				`data: {"type":"content_block_delta","delta":{"text":"usage is \"fine\""}}` + "\n\n" +
+				"event: message_delta\n" +
+				`data: {"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":15}}` + "\n\n" +
+				"event: message_delta\n" +
+				`data: {"type":"message_delta","usage":{"output_tokens":42}}` + "\n\n",
+			wantModel: "claude-opus-4-1",
+			want:      usage.Tokens{Input: 25, Output: 42, CacheRead: 1000},
+		},
+		{
+			name:        "openai stream",
+			contentType: "text/event-stream",
+			body: `data: {"model":"gpt-4o-mini","choices":[{"delta":{"content":"hi"}}],"usage":null}` + "\n\n" +
+				`data: {"model":"gpt-4o-mini","choices":[],"usage":{"prompt_tokens":9,"completion_tokens":3}}` + "\n\n" +
+				"data: [DONE]\n\n",
+			wantModel: "gpt-4o-mini",
+			want:      usage.Tokens{Input: 9, Output: 3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{"Content-Type": {tt.contentType}},
+				Body:       io.NopCloser(strings.NewReader(tt.body)),
+			}
+			var gotModel string
+			var got usage.Tokens
+			calls := 0
+			wrapUsageBody(resp, func(model string, tokens usage.Tokens) {
+				calls++
+				gotModel, got = model, tokens
+			})
+
+			// Read in small chunks so events straddle reads
+			var out strings.Builder
+			buf := make([]byte, 7)
+			for {
+				n, err := resp.Body.Read(buf)
+				out.Write(buf[:n])
+				if err != nil {
+					break
+				}
+			}
+			resp.Body.Close()
+
+			if out.String() != tt.body {
+				t.Error("body was altered in transit")
+			}
+			if calls != 1 {
+				t.Fatalf("onDone called %d times, want 1", calls)
+			}
+			if gotModel != tt.wantModel || got != tt.want {
+				t.Errorf("got %q %+v, want %q %+v", gotModel, got, tt.wantModel, tt.want)
+			}
+		})
+	}
+}
+
+func TestUsageParsers_Ignored(t *testing.T) {
+	for _, resp := range []*http.Response{
+		{StatusCode: http.StatusBadRequest, Header: http.Header{"Content-Type": {"application/json"}}},
+		{StatusCode: http.StatusOK, Header: http.Header{"Content-Type": {"text/plain"}}},
+	} {
+		body := io.NopCloser(strings.NewReader(`{"usage":{"input_tokens":1}}`))
+		resp.Body = body
+		wrapUsageBody(resp, func(string, usage.Tokens) { t.Error("unexpected usage callback") })
+		if resp.Body != body {
+			t.Error("body should not be wrapped")
+		}
+	}
+}
+
+func TestProxy_RecordsUsage(t *testing.T) {
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept-Encoding") == "identity" {
+			t.Error("client Accept-Encoding should not reach upstream")
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "event: message_start\n"+
+			`data: {"type":"message_start","message":{"model":"claude-sonnet-4-5","usage":{"input_tokens":10,"output_tokens":1}}}`+"\n\n"+
+			"event: message_delta\n"+
+			`data: {"type":"message_delta","usage":{"output_tokens":7}}`+"\n\n")
+	}))
+	defer upstream.Close()
+
+	tmpDir := t.TempDir()
+	usagePath := filepath.Join(tmpDir, "state", "usage.jsonl")
+	if err := os.MkdirAll(filepath.Join(tmpDir, "test-sandbox"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(tmpDir, "test-sandbox", "anthropic-api-key"), []byte("sk-test"), 0600)
+
+	p, err := New(&Config{
+		ListenAddr: ":0",
+		SecretsDir: tmpDir,
+		TargetURL:  upstream.URL,
+		UsagePath:  usagePath,
+		Transport:  upstream.Client().Transport,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	if err := p.LoadAPIKeys(); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("POST", "/v1/messages", strings.NewReader(`{"stream":true}`))
+	req.Header.Set("X-Forage-Sandbox", "test-sandbox")
+	req.Header.Set("Accept-Encoding", "identity")
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, req)
+
+	if !strings.Contains(w.Body.String(), "message_delta") {
+		t.Fatalf("stream not forwarded: %q", w.Body.String())
+	}
+
+	records, err := usage.Read(usagePath, usage.Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("expected 1 usage record, got %d", len(records))
+	}
+	r := records[0]
+	if r.Sandbox != "test-sandbox" || r.Route != "default" || r.Model != "claude-sonnet-4-5" ||
+		r.Tokens != (usage.Tokens{Input: 10, Output: 7}) {
+		t.Errorf("unexpected record: %+v", r)
+	}
+}
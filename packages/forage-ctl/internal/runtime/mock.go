@@ -48,6 +48,8 @@ func NewMockRuntime() *MockRuntime {
 	}
 }
 
+// record logs a call. Callers must hold m.mu for writing, since calls can
+// come from several goroutines.
 func (m *MockRuntime) record(method string, args ...interface{}) {
 	m.CallLog = append(m.CallLog, MockCall{Method: method, Args: args})
 }
@@ -188,8 +190,8 @@ func (m *MockRuntime) Destroy(ctx context.Context, name string) error {
 
 // IsRunning checks if a container is currently running
 func (m *MockRuntime) IsRunning(ctx context.Context, name string) (bool, error) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	m.record("IsRunning", name)
 
 	if err, ok := m.Errors["IsRunning"]; ok {
@@ -205,8 +207,8 @@ func (m *MockRuntime) IsRunning(ctx context.Context, name string) (bool, error)
 
 // Status returns detailed status of a container
 func (m *MockRuntime) Status(ctx context.Context, name string) (*ContainerInfo, error) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	m.record("Status", name)
 
 	if err, ok := m.Errors["Status"]; ok {
@@ -222,8 +224,8 @@ func (m *MockRuntime) Status(ctx context.Context, name string) (*ContainerInfo,
 
 // Exec executes a command inside a container
 func (m *MockRuntime) Exec(ctx context.Context, name string, command []string, opts ExecOptions) (*ExecResult, error) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	m.record("Exec", name, command, opts)
 
 	if err, ok := m.Errors["Exec"]; ok {
@@ -252,8 +254,8 @@ func (m *MockRuntime) ExecInteractive(ctx context.Context, name string, command
 
 // List returns all containers managed by this runtime
 func (m *MockRuntime) List(ctx context.Context) ([]*ContainerInfo, error) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	m.record("List")
 
 	if err, ok := m.Errors["List"]; ok {
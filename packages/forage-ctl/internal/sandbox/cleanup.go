@@ -5,9 +5,13 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/audit"
 	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/config"
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/health"
 	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/logging"
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/proxy"
 	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/runtime"
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/usage"
 	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/workspace"
 )
 
@@ -36,6 +40,19 @@ type CleanupOptions struct {
 
 	// CleanupAuditLog if true, removes the sandbox audit log.
 	CleanupAuditLog bool
+
+	// ArchiveAuditLog if true, moves the audit log to the audit archive
+	// instead of removing it (with CleanupAuditLog).
+	ArchiveAuditLog bool
+
+	// CleanupServiceData if true, removes persisted sidecar service data.
+	CleanupServiceData bool
+
+	// CleanupBudget if true, removes the sandbox's API budget.
+	CleanupBudget bool
+
+	// CleanupProxyToken if true, revokes the sandbox's virtual API key.
+	CleanupProxyToken bool
 }
 
 // DefaultCleanupOptions returns options that clean up everything.
@@ -49,6 +66,9 @@ func DefaultCleanupOptions() CleanupOptions {
 		CleanupPermissions: true,
 		CleanupMetadata:    true,
 		CleanupAuditLog:    true,
+		CleanupServiceData: true,
+		CleanupBudget:      true,
+		CleanupProxyToken:  true,
 	}
 }
 
@@ -164,11 +184,36 @@ func Cleanup(metadata *config.SandboxMetadata, paths *config.Paths, opts Cleanup
 		}
 	}
 
-	// Remove audit log
+	// Remove audit log, or keep it in the archive
 	if opts.CleanupAuditLog {
-		auditPath := filepath.Join(paths.StateDir, "sandboxes", name+".events.jsonl")
-		if err := os.Remove(auditPath); err != nil && !os.IsNotExist(err) {
-			logging.Warn("failed to remove audit log", "path", auditPath, "error", err)
+		if opts.ArchiveAuditLog {
+			if err := audit.NewLogger(paths.StateDir).Archive(name); err != nil {
+				logging.Warn("failed to archive audit log", "name", name, "error", err)
+			}
+		} else if err := audit.NewLogger(paths.StateDir).Remove(name); err != nil {
+			logging.Warn("failed to remove audit log", "name", name, "error", err)
+		}
+	}
+
+	// Remove persisted service data
+	if opts.CleanupServiceData && paths.StateDir != "" {
+		servicesDir := filepath.Join(paths.StateDir, "services", name)
+		if err := os.RemoveAll(servicesDir); err != nil {
+			logging.Warn("failed to remove service data", "path", servicesDir, "error", err)
+		}
+	}
+
+	// Remove API budget
+	if opts.CleanupBudget && paths.StateDir != "" {
+		if err := usage.RemoveBudget(paths.StateDir, name); err != nil {
+			logging.Warn("failed to remove budget", "name", name, "error", err)
+		}
+	}
+
+	// Revoke virtual API key
+	if opts.CleanupProxyToken && paths.StateDir != "" {
+		if err := proxy.RevokeToken(paths.StateDir, name); err != nil {
+			logging.Warn("failed to revoke proxy API key", "name", name, "error", err)
 		}
 	}
 
@@ -178,5 +223,13 @@ func Cleanup(metadata *config.SandboxMetadata, paths *config.Paths, opts Cleanup
 		if err := config.DeleteSandboxMetadata(paths.SandboxesDir, name); err != nil {
 			logging.Warn("failed to remove metadata", "name", name, "error", err)
 		}
+		if err := health.RemoveProbeStates(paths.SandboxesDir, name); err != nil {
+			logging.Warn("failed to remove probe states", "name", name, "error", err)
+		}
+
+		// Drop the sandbox from its group's hosts file and firewall rules
+		if err := SyncGroups(context.Background(), paths); err != nil {
+			logging.Warn("failed to sync sandbox groups", "error", err)
+		}
 	}
 }
@@ -5,6 +5,7 @@ import (
 	"path/filepath"
 	"testing"
 
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/audit"
 	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/config"
 )
 
@@ -72,3 +73,30 @@ func TestDefaultCleanupOptions_IncludesPermissions(t *testing.T) {
 		t.Error("DefaultCleanupOptions should have CleanupPermissions = true")
 	}
 }
+
+func TestCleanup_ArchivesAuditLog(t *testing.T) {
+	tmpDir := t.TempDir()
+	paths := &config.Paths{
+		StateDir:     tmpDir,
+		SandboxesDir: filepath.Join(tmpDir, "sandboxes"),
+	}
+	metadata := &config.SandboxMetadata{Name: "test-sandbox", Template: "claude"}
+
+	logger := audit.NewLogger(tmpDir)
+	if err := logger.LogEvent(audit.EventDestroy, "test-sandbox", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	Cleanup(metadata, paths, CleanupOptions{CleanupAuditLog: true, ArchiveAuditLog: true}, nil)
+
+	if events, _ := logger.Events("test-sandbox"); len(events) != 0 {
+		t.Errorf("live audit log should be gone, has %+v", events)
+	}
+	events, err := logger.Query(audit.Filter{Sandbox: "test-sandbox"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Type != audit.EventDestroy {
+		t.Errorf("archived events = %+v", events)
+	}
+}
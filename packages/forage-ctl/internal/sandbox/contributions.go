@@ -11,6 +11,8 @@ import (
 	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/generator"
 	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/injection"
 	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/multiplexer"
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/network"
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/proxy"
 	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/reproducibility"
 	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/runtime"
 	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/workspace"
@@ -28,8 +30,11 @@ type ContributionSourcesParams struct {
 	SourceRepo    string
 	SecretsPath   string
 	ProxyURL      string
+	ProxyTokenDir string // Host directory holding the sandbox's virtual API key
 	SandboxName   string
 	HostConfig    *config.HostConfig
+	GroupDir      string // Host directory of the sandbox's group, if any
+	StateDir      string // Host state directory (persisted service data)
 
 	// Multi-mount fields (when set, override single-workspace fields)
 	WorkspaceMounts []config.WorkspaceMountMeta
@@ -141,8 +146,14 @@ func buildContributionSources(params ContributionSourcesParams) ContributionSour
 
 	// 7. Proxy contributor (if proxy is configured)
 	if proxyURL != "" {
-		proxy := injection.NewProxyContributor(proxyURL, sandboxName)
-		contributors = append(contributors, proxy)
+		var authEnvVars []string
+		for _, agentCfg := range template.Agents {
+			if agentCfg.AuthEnvVar != "" {
+				authEnvVars = append(authEnvVars, agentCfg.AuthEnvVar)
+			}
+		}
+		proxyContrib := injection.NewProxyContributor(proxyURL, sandboxName, authEnvVars, params.ProxyTokenDir)
+		contributors = append(contributors, proxyContrib)
 	}
 
 	// 8. Base tmpfiles contributor
@@ -182,9 +193,22 @@ func buildContributionSources(params ContributionSourcesParams) ContributionSour
 	// 10. Skills contributor (generates system prompt and skill files)
 	if params.Metadata != nil && template != nil {
 		skillsContrib := NewSkillsContributor(containerInfo.HomeDir, template, params.Metadata)
+		if hostConfig != nil {
+			skillsContrib.HostGroups = hostConfig.HostGroups
+		}
 		contributors = append(contributors, skillsContrib)
 	}
 
+	// 11. Group contributor (shared hosts file for sandbox groups)
+	if params.GroupDir != "" {
+		contributors = append(contributors, injection.NewGroupContributor(params.GroupDir, network.GroupHostsDir))
+	}
+
+	// 12. Services contributor (sidecar service packages and data directories)
+	if template != nil && len(template.Services) > 0 {
+		contributors = append(contributors, NewServicesContributor(template.Services, params.StateDir, sandboxName, containerInfo.Username))
+	}
+
 	// Build request contexts
 	mountReq := &injection.MountRequest{
 		WorkspacePath:     workspacePath,
@@ -246,9 +270,10 @@ type RebuildContainerConfigParams struct {
 // This is useful for commands that need to regenerate configs for existing sandboxes.
 func RebuildContainerConfig(ctx context.Context, params RebuildContainerConfigParams) (*generator.ContainerConfig, error) {
 	metadata := params.Metadata
-	template := params.Template
 	hostConfig := params.HostConfig
 	paths := params.Paths
+	// Include the proxy shim with the template's services
+	template := withServices(params.Template, hostConfig)
 
 	// Determine secrets path (if secrets are used)
 	secretsPath := ""
@@ -259,15 +284,40 @@ func RebuildContainerConfig(ctx context.Context, params RebuildContainerConfigPa
 		}
 	}
 
-	// Determine proxy URL
+	// Determine proxy URL, issuing a virtual API key to sandboxes created
+	// before keys existed
 	proxyURL := ""
+	proxyTokenDir := ""
 	if template.UseProxy && hostConfig.ProxyURL != "" {
 		proxyURL = hostConfig.ProxyURL
+		if UsesProxySocket(template, hostConfig) {
+			proxyURL = proxy.ShimURL
+		}
+		token, err := proxy.LoadToken(paths.StateDir, metadata.Name)
+		if err == nil && token == "" {
+			_, err = proxy.IssueToken(paths.StateDir, metadata.Name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to issue proxy API key: %w", err)
+		}
+		if proxyTokenDir, err = proxy.TokenDir(paths.StateDir, metadata.Name); err != nil {
+			return nil, err
+		}
 	}
 
 	// Create multiplexer instance
 	mux := multiplexer.New(multiplexer.Type(metadata.Multiplexer))
 
+	// Resolve the sandbox group directory
+	groupDir := ""
+	if metadata.Group != "" {
+		dir, err := config.GroupDir(paths.StateDir, metadata.Group)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sandbox group: %w", err)
+		}
+		groupDir = dir
+	}
+
 	// Detect workspace backend from metadata
 	var wsBackend workspace.Backend
 	if metadata.SourceRepo != "" {
@@ -296,8 +346,11 @@ func RebuildContainerConfig(ctx context.Context, params RebuildContainerConfigPa
 		SourceRepo:    metadata.SourceRepo,
 		SecretsPath:   secretsPath,
 		ProxyURL:      proxyURL,
+		ProxyTokenDir: proxyTokenDir,
 		SandboxName:   metadata.Name,
 		HostConfig:    hostConfig,
+		GroupDir:      groupDir,
+		StateDir:      paths.StateDir,
 	}
 
 	// Use multi-mount data from metadata if present
@@ -327,6 +380,7 @@ func RebuildContainerConfig(ctx context.Context, params RebuildContainerConfigPa
 	return &generator.ContainerConfig{
 		Name:            metadata.Name,
 		NetworkSlot:     metadata.NetworkSlot,
+		Addresses:       metadata.Addresses(),
 		AuthorizedKeys:  hostConfig.AuthorizedKeys,
 		Template:        template,
 		UID:             hostConfig.UID,
@@ -337,6 +391,9 @@ func RebuildContainerConfig(ctx context.Context, params RebuildContainerConfigPa
 		Username:        hostConfig.ResolvedContainerUsername(),
 		WorkspaceDir:    hostConfig.ResolvedWorkspacePath(),
 		StateVersion:    hostConfig.ResolvedStateVersion(),
+		HostGroups:      hostConfig.HostGroups,
+		Group:           metadata.Group,
+		GroupNetworks:   groupNetworks(hostConfig),
 		Contributions:   contributions,
 		Reproducibility: contribResult.Reproducibility,
 	}, nil
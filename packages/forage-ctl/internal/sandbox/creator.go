@@ -15,8 +15,11 @@ import (
 	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/injection"
 	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/logging"
 	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/multiplexer"
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/network"
 	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/port"
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/proxy"
 	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/runtime"
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/usage"
 	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/workspace"
 )
 
@@ -132,6 +135,19 @@ func (c *Creator) Create(ctx context.Context, opts CreateOptions) (*CreateResult
 		return nil, fmt.Errorf("failed to save metadata: %w", err)
 	}
 
+	// Record the API budget for the proxy to enforce
+	if err := c.saveBudget(opts, resources.template); err != nil {
+		cleanup()
+		return nil, err
+	}
+
+	// Publish the new member to its group before the container mounts the
+	// hosts file. Without the group rules, grouped sandboxes are not isolated.
+	if err := SyncGroups(ctx, c.paths); err != nil {
+		cleanup()
+		return nil, fmt.Errorf("failed to sync sandbox groups: %w", err)
+	}
+
 	// Phase 8: Create and start container
 	if err := c.startContainer(opts.Name, configPath); err != nil {
 		cleanup()
@@ -141,11 +157,18 @@ func (c *Creator) Create(ctx context.Context, opts CreateOptions) (*CreateResult
 	// Phase 9: Post-creation setup (wait for SSH)
 	c.postCreationSetup(metadata)
 
-	// Phase 10: Run init commands
+	// Phase 10: Start sidecar services on runtimes without systemd units
+	StartServices(ctx, c.rt, opts.Name, Services(resources.template, c.hostConfig))
+
+	// Phase 11: Run init commands
 	initResult := c.runInitCommands(ctx, metadata, resources.template)
 
 	// Log creation event
-	auditLogger := audit.NewLogger(c.paths.StateDir)
+	auditKey, err := audit.LoadKey(c.hostConfig.AuditKeyFile)
+	if err != nil {
+		logging.Warn("audit events will not be signed", "error", err)
+	}
+	auditLogger := audit.NewLogger(c.paths.StateDir, audit.WithKey(auditKey))
 	_ = auditLogger.LogEvent(audit.EventCreate, opts.Name, "template="+opts.Template)
 
 	return &CreateResult{
@@ -162,6 +185,7 @@ func (c *Creator) Create(ctx context.Context, opts CreateOptions) (*CreateResult
 type resourceAllocation struct {
 	template    *config.Template
 	networkSlot int
+	addresses   network.Addresses
 }
 
 // validateInputs validates the sandbox creation inputs.
@@ -174,6 +198,12 @@ func (c *Creator) validateInputs(opts CreateOptions) error {
 		return fmt.Errorf("sandbox %s already exists", opts.Name)
 	}
 
+	if opts.Group != "" {
+		if err := config.ValidateGroupName(opts.Group); err != nil {
+			return fmt.Errorf("invalid sandbox group: %w", err)
+		}
+	}
+
 	return nil
 }
 
@@ -190,15 +220,21 @@ func (c *Creator) loadResources(opts CreateOptions) (*resourceAllocation, error)
 		sandboxes = []*config.SandboxMetadata{}
 	}
 
-	networkSlot, err := port.AllocateSlot(sandboxes)
+	plan, err := c.hostConfig.AddressPlan()
+	if err != nil {
+		return nil, fmt.Errorf("invalid address plan: %w", err)
+	}
+
+	networkSlot, addresses, err := port.AllocateNetwork(plan, sandboxes)
 	if err != nil {
 		return nil, fmt.Errorf("slot allocation failed: %w", err)
 	}
-	logging.Debug("network slot allocated", "slot", networkSlot)
+	logging.Debug("network slot allocated", "slot", networkSlot, "subnet", addresses.Subnet)
 
 	return &resourceAllocation{
 		template:    template,
 		networkSlot: networkSlot,
+		addresses:   addresses,
 	}, nil
 }
 
@@ -213,7 +249,9 @@ func (c *Creator) createMetadata(opts CreateOptions, resources *resourceAllocati
 		Multiplexer:   resources.template.Multiplexer,
 		ContainerName: config.ContainerNameForSlot(resources.networkSlot),
 		Runtime:       c.rt.Name(),
+		Group:         opts.Group,
 	}
+	meta.SetAddresses(resources.addresses)
 
 	if len(ws.mounts) > 0 {
 		// Multi-mount path
@@ -242,18 +280,45 @@ func (c *Creator) createMetadata(opts CreateOptions, resources *resourceAllocati
 func (c *Creator) writeContainerConfig(ctx context.Context, opts CreateOptions, resources *resourceAllocation, ws *workspaceSetup, secretsPath string, identity *config.AgentIdentity, metadata *config.SandboxMetadata) (string, error) {
 	// Determine proxy URL
 	proxyURL := ""
+	proxyTokenDir := ""
 	if resources.template.UseProxy && c.hostConfig.ProxyURL != "" {
 		proxyURL = c.hostConfig.ProxyURL
+		if UsesProxySocket(resources.template, c.hostConfig) {
+			proxyURL = proxy.ShimURL
+		}
 		logging.Debug("using API proxy", "url", proxyURL)
+
+		// Mint the sandbox's virtual API key
+		if _, err := proxy.IssueToken(c.paths.StateDir, opts.Name); err != nil {
+			return "", fmt.Errorf("failed to issue proxy API key: %w", err)
+		}
+		dir, err := proxy.TokenDir(c.paths.StateDir, opts.Name)
+		if err != nil {
+			return "", err
+		}
+		proxyTokenDir = dir
 	}
 
+	// Include the proxy shim with the template's services
+	template := withServices(resources.template, c.hostConfig)
+
 	// Create multiplexer instance
 	mux := multiplexer.New(multiplexer.Type(resources.template.Multiplexer))
 
+	// Resolve the sandbox group directory
+	groupDir := ""
+	if opts.Group != "" {
+		dir, err := config.GroupDir(c.paths.StateDir, opts.Group)
+		if err != nil {
+			return "", fmt.Errorf("invalid sandbox group: %w", err)
+		}
+		groupDir = dir
+	}
+
 	// Build contribution sources from all backends
 	contribParams := ContributionSourcesParams{
 		Runtime:       c.rt,
-		Template:      resources.template,
+		Template:      template,
 		Metadata:      metadata,
 		WsBackend:     ws.backend,
 		Mux:           mux,
@@ -262,8 +327,11 @@ func (c *Creator) writeContainerConfig(ctx context.Context, opts CreateOptions,
 		SourceRepo:    ws.sourceRepo,
 		SecretsPath:   secretsPath,
 		ProxyURL:      proxyURL,
+		ProxyTokenDir: proxyTokenDir,
 		SandboxName:   opts.Name,
 		HostConfig:    c.hostConfig,
+		GroupDir:      groupDir,
+		StateDir:      c.paths.StateDir,
 	}
 	if len(ws.mounts) > 0 {
 		contribParams.WorkspaceMounts = ws.mounts
@@ -290,8 +358,9 @@ func (c *Creator) writeContainerConfig(ctx context.Context, opts CreateOptions,
 	containerCfg := &generator.ContainerConfig{
 		Name:            opts.Name,
 		NetworkSlot:     resources.networkSlot,
+		Addresses:       resources.addresses,
 		AuthorizedKeys:  c.resolveSSHKeys(opts),
-		Template:        resources.template,
+		Template:        template,
 		UID:             c.hostConfig.UID,
 		GID:             c.hostConfig.GID,
 		Mux:             mux,
@@ -301,6 +370,9 @@ func (c *Creator) writeContainerConfig(ctx context.Context, opts CreateOptions,
 		WorkspaceDir:    c.hostConfig.ResolvedWorkspacePath(),
 		StateVersion:    c.hostConfig.ResolvedStateVersion(),
 		ResourceLimits:  resourceLimits,
+		HostGroups:      c.hostConfig.HostGroups,
+		Group:           opts.Group,
+		GroupNetworks:   groupNetworks(c.hostConfig),
 		Contributions:   contributions,
 		Reproducibility: contribResult.Reproducibility,
 	}
@@ -694,11 +766,30 @@ func (c *Creator) waitForSSH(host string, timeoutSeconds int) bool {
 }
 
 // cleanup removes resources created during a failed sandbox creation.
+// saveBudget writes the sandbox's API budget, taken from the options or
+// else the template.
+func (c *Creator) saveBudget(opts CreateOptions, template *config.Template) error {
+	budget := template.Budget
+	if opts.Budget != nil {
+		budget = opts.Budget
+	}
+	if budget.IsEmpty() {
+		return nil
+	}
+	state := &usage.BudgetState{Budget: *budget, ResetAt: time.Now()}
+	if err := usage.SaveBudget(c.paths.StateDir, opts.Name, state); err != nil {
+		return fmt.Errorf("failed to save budget: %w", err)
+	}
+	return nil
+}
+
 func (c *Creator) cleanup(metadata *config.SandboxMetadata) {
 	logging.Debug("cleaning up failed sandbox creation", "name", metadata.Name)
 
 	// Use unified cleanup function with all options enabled
-	Cleanup(metadata, c.paths, DefaultCleanupOptions(), c.rt)
+	opts := DefaultCleanupOptions()
+	opts.ArchiveAuditLog = c.hostConfig.AuditArchive
+	Cleanup(metadata, c.paths, opts, c.rt)
 }
 
 // resolveIdentity merges identity from four levels (lowest to highest priority):
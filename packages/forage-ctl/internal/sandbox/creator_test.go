@@ -2,12 +2,14 @@ package sandbox
 
 import (
 	"context"
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
 
 	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/config"
 	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/runtime"
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/system"
 	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/testutil"
 )
 
@@ -103,6 +105,47 @@ func TestCreator_Create_ValidName(t *testing.T) {
 	}
 }
 
+func TestCreator_Create_GroupFirewallFails(t *testing.T) {
+	env := testutil.NewTestEnv(t)
+	defer env.Cleanup()
+
+	runtime.SetGlobal(env.Runtime)
+	defer runtime.SetGlobal(nil)
+
+	mock := system.NewMockExecutor()
+	mock.AddResponse("sudo nft", []byte("Operation not permitted"), errors.New("exit status 1"))
+	prev := system.DefaultExecutor()
+	system.SetDefaultExecutor(mock)
+	defer system.SetDefaultExecutor(prev)
+
+	env.AddTemplate("test", testutil.DefaultTemplate())
+	workspacePath := env.CreateWorkspace("myproject")
+
+	creator := &Creator{
+		paths:      env.Paths,
+		hostConfig: env.HostConfig,
+		rt:         env.Runtime,
+	}
+
+	_, err := creator.Create(context.Background(), CreateOptions{
+		Name:     "myproject",
+		Template: "test",
+		RepoPath: workspacePath,
+		Direct:   true,
+		Group:    "web",
+	})
+	if err == nil {
+		t.Fatal("Create() should fail when the group firewall rules cannot be loaded")
+	}
+
+	if env.SandboxExists("myproject") {
+		t.Error("Sandbox metadata should have been cleaned up")
+	}
+	if _, exists := env.Runtime.Containers["myproject"]; exists {
+		t.Error("Container should not have been created")
+	}
+}
+
 func TestCreator_Create_DuplicateName(t *testing.T) {
 	env := testutil.NewTestEnv(t)
 	defer env.Cleanup()
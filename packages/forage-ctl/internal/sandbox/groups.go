@@ -0,0 +1,101 @@
+package sandbox
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/config"
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/logging"
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/network"
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/system"
+)
+
+// SyncGroups brings the host's sandbox group state in line with sandbox
+// metadata. It rewrites the hosts file of every group, removes the
+// directories of groups without members and reloads the host forwarding
+// rules that keep groups private, with sudo like the runtime's privileged
+// commands. Hosts without groups are left untouched.
+func SyncGroups(ctx context.Context, paths *config.Paths) error {
+	sandboxes, err := config.ListSandboxes(paths.SandboxesDir)
+	if err != nil {
+		return fmt.Errorf("failed to list sandboxes: %w", err)
+	}
+
+	groups := make(map[string][]network.GroupMember)
+	var links []network.Addresses
+	for _, sb := range sandboxes {
+		links = append(links, sb.Addresses())
+		if sb.Group != "" {
+			groups[sb.Group] = append(groups[sb.Group], network.GroupMember{
+				Name:      sb.Name,
+				Addresses: sb.Addresses(),
+			})
+		}
+	}
+
+	groupsDir := filepath.Join(paths.StateDir, "groups")
+	entries, err := os.ReadDir(groupsDir)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read groups directory: %w", err)
+	}
+	if len(groups) == 0 && len(entries) == 0 {
+		return nil
+	}
+
+	for name, members := range groups {
+		if err := writeGroupHosts(paths.StateDir, name, members); err != nil {
+			return err
+		}
+	}
+	for _, entry := range entries {
+		if _, ok := groups[entry.Name()]; ok {
+			continue
+		}
+		stale := filepath.Join(groupsDir, entry.Name())
+		logging.Debug("removing empty sandbox group", "path", stale)
+		if err := os.RemoveAll(stale); err != nil {
+			logging.Warn("failed to remove sandbox group directory", "path", stale, "error", err)
+		}
+	}
+
+	rules := network.GenerateGroupForwardRules(groups, links)
+	if out, err := system.DefaultExecutor().ExecuteWithStdin(ctx, rules, "sudo", "nft", "-f", "-"); err != nil {
+		return fmt.Errorf("failed to load sandbox group firewall rules: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// writeGroupHosts atomically replaces a group's hosts file. The temporary
+// file starts with a dot so dnsmasq's hostsdir watcher ignores it.
+func writeGroupHosts(stateDir, group string, members []network.GroupMember) error {
+	dir, err := config.GroupDir(stateDir, group)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create group directory: %w", err)
+	}
+
+	tmp := filepath.Join(dir, "."+network.GroupHostsFile+".tmp")
+	if err := os.WriteFile(tmp, []byte(network.GenerateGroupHosts(members)), 0644); err != nil {
+		return fmt.Errorf("failed to write group hosts file: %w", err)
+	}
+	if err := os.Rename(tmp, filepath.Join(dir, network.GroupHostsFile)); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("failed to write group hosts file: %w", err)
+	}
+	return nil
+}
+
+// groupNetworks returns the prefixes grouped sandboxes may reach their
+// peers in: those of the host's address plan.
+func groupNetworks(hostConfig *config.HostConfig) []string {
+	plan, err := hostConfig.AddressPlan()
+	if err != nil {
+		return network.DefaultAddressPlan().Networks()
+	}
+	return plan.Networks()
+}
@@ -0,0 +1,93 @@
+package sandbox
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/config"
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/system"
+)
+
+func TestSyncGroups(t *testing.T) {
+	tmpDir := t.TempDir()
+	paths := &config.Paths{
+		StateDir:     tmpDir,
+		SandboxesDir: filepath.Join(tmpDir, "sandboxes"),
+	}
+	if err := os.MkdirAll(paths.SandboxesDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	mock := system.NewMockExecutor()
+	prev := system.DefaultExecutor()
+	system.SetDefaultExecutor(mock)
+	t.Cleanup(func() { system.SetDefaultExecutor(prev) })
+
+	save := func(name, group string, slot int) {
+		t.Helper()
+		meta := &config.SandboxMetadata{
+			Name:        name,
+			Template:    "claude",
+			NetworkSlot: slot,
+			Workspace:   "/tmp/workspace",
+			Group:       group,
+		}
+		if err := config.SaveSandboxMetadata(paths.SandboxesDir, meta); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Without groups nothing is written and no rules are loaded
+	save("solo", "", 3)
+	if err := SyncGroups(context.Background(), paths); err != nil {
+		t.Fatalf("SyncGroups() error: %v", err)
+	}
+	if len(mock.Commands) != 0 {
+		t.Errorf("expected no commands without groups, got %v", mock.Commands)
+	}
+
+	save("api", "web", 1)
+	save("db", "web", 2)
+	if err := SyncGroups(context.Background(), paths); err != nil {
+		t.Fatalf("SyncGroups() error: %v", err)
+	}
+
+	hosts, err := os.ReadFile(filepath.Join(tmpDir, "groups", "web", "hosts"))
+	if err != nil {
+		t.Fatalf("group hosts file not written: %v", err)
+	}
+	for _, line := range []string{"10.100.1.2 api", "10.100.2.2 db"} {
+		if !strings.Contains(string(hosts), line) {
+			t.Errorf("hosts file should contain %q, got:\n%s", line, hosts)
+		}
+	}
+	if strings.Contains(string(hosts), "solo") {
+		t.Errorf("hosts file should not list ungrouped sandboxes, got:\n%s", hosts)
+	}
+
+	if len(mock.Commands) != 1 || mock.Commands[0].Name != "sudo" || strings.Join(mock.Commands[0].Args, " ") != "nft -f -" {
+		t.Fatalf("expected one nft invocation, got %v", mock.Commands)
+	}
+	if !strings.Contains(mock.Commands[0].Stdin, "10.100.3.0/24") {
+		t.Errorf("rules should isolate the ungrouped sandbox, got:\n%s", mock.Commands[0].Stdin)
+	}
+
+	// Removing the last members removes the group and its rules
+	for _, name := range []string{"api", "db"} {
+		if err := config.DeleteSandboxMetadata(paths.SandboxesDir, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := SyncGroups(context.Background(), paths); err != nil {
+		t.Fatalf("SyncGroups() error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "groups", "web")); !os.IsNotExist(err) {
+		t.Error("empty group directory should have been removed")
+	}
+	if len(mock.Commands) != 2 || strings.Contains(mock.Commands[1].Stdin, "chain forward") {
+		t.Errorf("expected the group table to be deleted, got %v", mock.Commands)
+	}
+}
@@ -40,6 +40,14 @@ type CreateOptions struct {
 
 	// SSHKeyPath is the absolute path to a private SSH key on the host (optional)
 	SSHKeyPath string
+
+	// Group is the sandbox group to join (optional). Members of a group
+	// share a private network and resolve each other by name.
+	Group string
+
+	// Budget overrides the template's API budget (optional). An empty
+	// budget disables the template's.
+	Budget *config.Budget
 }
 
 // WorkspaceMode specifies the workspace setup strategy.
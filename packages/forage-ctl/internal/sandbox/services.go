@@ -0,0 +1,180 @@
+package sandbox
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	shellquote "github.com/kballard/go-shellquote"
+
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/config"
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/injection"
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/logging"
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/proxy"
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/runtime"
+)
+
+// proxyShimService is the name of the service forwarding the API proxy's
+// loopback port to the proxy socket in sandboxes without network access.
+const proxyShimService = "api-proxy"
+
+// UsesProxySocket reports whether a sandbox reaches the API proxy through
+// the unix socket mounted into it rather than over the network, because
+// its template has no network access.
+func UsesProxySocket(template *config.Template, hostConfig *config.HostConfig) bool {
+	return template.UseProxy && template.Network == "none" &&
+		hostConfig != nil && hostConfig.ProxyURL != ""
+}
+
+// Services returns the sidecar services a sandbox runs: its template's,
+// plus the API proxy shim if the sandbox uses the proxy socket.
+func Services(template *config.Template, hostConfig *config.HostConfig) []config.Service {
+	if !UsesProxySocket(template, hostConfig) {
+		return template.Services
+	}
+	services := append([]config.Service(nil), template.Services...)
+	return append(services, config.Service{
+		Name:    proxyShimService,
+		Package: "socat",
+		Command: fmt.Sprintf("socat TCP-LISTEN:%d,bind=127.0.0.1,fork,reuseaddr UNIX-CONNECT:%s",
+			proxy.ShimPort, proxy.SocketContainerPath),
+		Ports: []int{proxy.ShimPort},
+	})
+}
+
+// withServices returns the template with its services replaced by those
+// the sandbox runs, leaving the loaded template untouched.
+func withServices(template *config.Template, hostConfig *config.HostConfig) *config.Template {
+	if !UsesProxySocket(template, hostConfig) {
+		return template
+	}
+	t := *template
+	t.Services = Services(template, hostConfig)
+	return &t
+}
+
+// ServicesContributor provides what a template's sidecar services need in
+// the container: their packages, data directories, and host-backed mounts
+// for persisted data. The systemd units themselves are rendered by the
+// generator.
+type ServicesContributor struct {
+	Services    []config.Service
+	StateDir    string // Host state directory; persisted data lives under services/<sandbox>/
+	SandboxName string
+	Username    string // Container user the services run as
+}
+
+// NewServicesContributor creates a new services contributor.
+func NewServicesContributor(services []config.Service, stateDir, sandboxName, username string) *ServicesContributor {
+	return &ServicesContributor{
+		Services:    services,
+		StateDir:    stateDir,
+		SandboxName: sandboxName,
+		Username:    username,
+	}
+}
+
+// ContributeMounts returns bind mounts for persisted service data, creating
+// the host directories as needed.
+func (s *ServicesContributor) ContributeMounts(ctx context.Context, req *injection.MountRequest) ([]injection.Mount, error) {
+	var mounts []injection.Mount
+	for _, svc := range s.Services {
+		if !svc.Persistent() {
+			continue
+		}
+		hostDir, err := config.ServiceDataDir(s.StateDir, s.SandboxName, svc.Name)
+		if err != nil {
+			return nil, fmt.Errorf("service %s: %w", svc.Name, err)
+		}
+		if err := os.MkdirAll(hostDir, 0700); err != nil {
+			return nil, fmt.Errorf("failed to create data directory for service %s: %w", svc.Name, err)
+		}
+		mounts = append(mounts, injection.Mount{
+			HostPath:      hostDir,
+			ContainerPath: svc.DataDir(),
+		})
+	}
+	return mounts, nil
+}
+
+// ContributePackages returns the service packages, which also puts their
+// client tools (psql, redis-cli, ...) on the agent's PATH.
+func (s *ServicesContributor) ContributePackages(ctx context.Context) ([]injection.Package, error) {
+	var pkgs []injection.Package
+	for _, svc := range s.Services {
+		pkgs = append(pkgs, injection.Package{Name: svc.Package})
+	}
+	return pkgs, nil
+}
+
+// ContributeTmpfilesRules creates each service's data directory, owned by
+// the container user so services do not run as root.
+func (s *ServicesContributor) ContributeTmpfilesRules(ctx context.Context, req *injection.TmpfilesRequest) ([]string, error) {
+	username := s.Username
+	if req != nil && req.Username != "" {
+		username = req.Username
+	}
+	var rules []string
+	for _, svc := range s.Services {
+		rules = append(rules, fmt.Sprintf("d %s 0700 %s users -", svc.DataDir(), username))
+	}
+	return rules, nil
+}
+
+// Ensure ServicesContributor implements the contributor interfaces
+var _ injection.MountContributor = (*ServicesContributor)(nil)
+var _ injection.PackageContributor = (*ServicesContributor)(nil)
+var _ injection.TmpfilesContributor = (*ServicesContributor)(nil)
+
+// StartServices launches a template's services as background processes on
+// runtimes that do not boot the generated NixOS config, and so have no
+// systemd units for them. It is a no-op on NixOS runtimes. Failures are
+// logged and do not stop the remaining services.
+func StartServices(ctx context.Context, rt runtime.Runtime, name string, services []config.Service) {
+	if len(services) == 0 || runtime.GetCapabilities(rt).NixOSConfig {
+		return
+	}
+	for _, svc := range services {
+		logging.Debug("starting service", "sandbox", name, "service", svc.Name)
+		result, err := rt.Exec(ctx, name, serviceLaunchCommand(svc), runtime.ExecOptions{})
+		if err == nil && result.ExitCode != 0 {
+			err = fmt.Errorf("exit code %d: %s", result.ExitCode, strings.TrimSpace(result.Stderr))
+		}
+		if err != nil {
+			logging.Warn("failed to start service", "sandbox", name, "service", svc.Name, "error", err)
+		}
+	}
+}
+
+// serviceLaunchCommand builds the command that starts svc in the
+// background with its package from nixpkgs, mirroring the environment of
+// the generated systemd unit.
+func serviceLaunchCommand(svc config.Service) []string {
+	dataDir := svc.DataDir()
+
+	env := []string{"FORAGE_SERVICE_DATA=" + dataDir}
+	keys := make([]string, 0, len(svc.Env))
+	for k := range svc.Env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		env = append(env, k+"="+svc.Env[k])
+	}
+
+	nixShell := shellquote.Join(
+		"nix", "--extra-experimental-features", "nix-command flakes",
+		"shell", "nixpkgs#"+svc.Package,
+		"--command", "sh", "-c", svc.Command,
+	)
+	script := fmt.Sprintf("mkdir -p %s && cd %s && export %s && nohup %s >%s 2>&1 &",
+		shellquote.Join(dataDir),
+		shellquote.Join(dataDir),
+		shellquote.Join(env...),
+		nixShell,
+		shellquote.Join(svc.LogPath()),
+	)
+	return []string{"sh", "-c", script}
+}
@@ -0,0 +1,113 @@
+package sandbox
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/config"
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/injection"
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/proxy"
+)
+
+func TestServicesContributor(t *testing.T) {
+	tmpDir := t.TempDir()
+	services := []config.Service{
+		{Name: "postgres", Package: "postgresql_16", Command: "postgres", Storage: config.ServiceStoragePersist},
+		{Name: "redis", Package: "redis", Command: "redis-server"},
+	}
+	c := NewServicesContributor(services, tmpDir, "my-sandbox", "agent")
+	ctx := context.Background()
+
+	mounts, err := c.ContributeMounts(ctx, &injection.MountRequest{})
+	if err != nil {
+		t.Fatalf("ContributeMounts() error: %v", err)
+	}
+	if len(mounts) != 1 {
+		t.Fatalf("expected 1 mount for the persisted service, got %d", len(mounts))
+	}
+	wantHost := filepath.Join(tmpDir, "services", "my-sandbox", "postgres")
+	if mounts[0].HostPath != wantHost || mounts[0].ContainerPath != "/var/lib/forage-services/postgres" {
+		t.Errorf("unexpected mount: %+v", mounts[0])
+	}
+	if _, err := os.Stat(wantHost); err != nil {
+		t.Errorf("host data directory not created: %v", err)
+	}
+
+	pkgs, err := c.ContributePackages(ctx)
+	if err != nil || len(pkgs) != 2 || pkgs[0].Name != "postgresql_16" || pkgs[1].Name != "redis" {
+		t.Errorf("ContributePackages() = %+v, %v", pkgs, err)
+	}
+
+	rules, err := c.ContributeTmpfilesRules(ctx, &injection.TmpfilesRequest{})
+	if err != nil {
+		t.Fatalf("ContributeTmpfilesRules() error: %v", err)
+	}
+	want := []string{
+		"d /var/lib/forage-services/postgres 0700 agent users -",
+		"d /run/forage-services/redis 0700 agent users -",
+	}
+	if strings.Join(rules, "\n") != strings.Join(want, "\n") {
+		t.Errorf("ContributeTmpfilesRules() = %q, want %q", rules, want)
+	}
+}
+
+func TestServiceLaunchCommand(t *testing.T) {
+	svc := config.Service{
+		Name:    "redis",
+		Package: "redis",
+		Command: "redis-server --dir \"$FORAGE_SERVICE_DATA\"",
+		Env:     map[string]string{"B": "2", "A": "1 2"},
+	}
+	cmd := serviceLaunchCommand(svc)
+	if len(cmd) != 3 || cmd[0] != "sh" || cmd[1] != "-c" {
+		t.Fatalf("unexpected command: %q", cmd)
+	}
+	script := cmd[2]
+	for _, want := range []string{
+		"cd /run/forage-services/redis",
+		"export FORAGE_SERVICE_DATA=/run/forage-services/redis 'A=1 2' B=2",
+		"nix --extra-experimental-features 'nix-command flakes' shell nixpkgs#redis --command sh -c",
+		">/tmp/forage-service-redis.log 2>&1 &",
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("launch script missing %q:\n%s", want, script)
+		}
+	}
+}
+
+func TestServices_ProxyShim(t *testing.T) {
+	hostConfig := &config.HostConfig{ProxyURL: "http://10.100.0.1:8080"}
+	redis := config.Service{Name: "redis", Package: "redis", Command: "redis-server"}
+	template := &config.Template{UseProxy: true, Network: "none", Services: []config.Service{redis}}
+
+	services := Services(template, hostConfig)
+	if len(services) != 2 || services[1].Name != proxyShimService {
+		t.Fatalf("Services() = %+v, want redis and the proxy shim", services)
+	}
+	if !strings.Contains(services[1].Command, proxy.SocketContainerPath) {
+		t.Errorf("shim command %q does not forward to the proxy socket", services[1].Command)
+	}
+	if err := services[1].Validate(); err != nil {
+		t.Errorf("shim service is invalid: %v", err)
+	}
+	if len(template.Services) != 1 {
+		t.Error("Services() must not modify the template")
+	}
+
+	for _, tc := range []struct {
+		name       string
+		template   *config.Template
+		hostConfig *config.HostConfig
+	}{
+		{"networked", &config.Template{UseProxy: true, Network: "full"}, hostConfig},
+		{"no proxy", &config.Template{Network: "none"}, hostConfig},
+		{"proxy disabled on host", &config.Template{UseProxy: true, Network: "none"}, &config.HostConfig{}},
+	} {
+		if UsesProxySocket(tc.template, tc.hostConfig) {
+			t.Errorf("%s: UsesProxySocket() = true, want false", tc.name)
+		}
+	}
+}
@@ -15,6 +15,10 @@ type SkillsContributor struct {
 	HomeDir  string // Container home directory (e.g., "/home/agent")
 	Template *config.Template
 	Metadata *config.SandboxMetadata
+
+	// HostGroups are custom allowlist host groups, used to spell out
+	// "@name" entries in the system prompt.
+	HostGroups map[string][]string
 }
 
 // NewSkillsContributor creates a new SkillsContributor.
@@ -42,7 +46,7 @@ func (s *SkillsContributor) ContributeGeneratedFiles(ctx context.Context, req *i
 	projectInfo := analyzer.Analyze()
 
 	// Generate system prompt using existing skills package
-	promptContent := skills.GenerateSystemPrompt(s.Metadata, s.Template)
+	promptContent := skills.GenerateSystemPrompt(s.Metadata, s.Template, s.HostGroups)
 	files = append(files, injection.GeneratedFile{
 		ContainerPath: filepath.Join(s.HomeDir, ".config", "forage", "system-prompt.md"),
 		Content:       []byte(promptContent),
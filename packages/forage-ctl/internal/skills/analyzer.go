@@ -9,11 +9,13 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/config"
 	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/logging"
 	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/multiplexer"
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/network"
 )
 
 // ProjectType represents the detected project type
@@ -269,9 +271,10 @@ func (a *Analyzer) hasFilesMatching(pattern string) bool {
 
 // GenerateSystemPrompt generates a compact system prompt with environmental context.
 // This is always injected via --append-system-prompt and contains brief factual info
-// about the sandbox environment.
-func GenerateSystemPrompt(metadata *config.SandboxMetadata, template *config.Template) string {
-	data := buildSystemPromptData(metadata, template)
+// about the sandbox environment. hostGroups are the custom allowlist host
+// groups from host config, used to spell out "@name" allowed hosts.
+func GenerateSystemPrompt(metadata *config.SandboxMetadata, template *config.Template, hostGroups map[string][]string) string {
+	data := buildSystemPromptData(metadata, template, hostGroups)
 	return renderTemplate("system-prompt.md.tmpl", data)
 }
 
@@ -306,9 +309,55 @@ func GenerateSkillFiles(metadata *config.SandboxMetadata, template *config.Templ
 		result["forage-nix"] = renderTemplate("skill-nix.md.tmpl", nil)
 	}
 
+	// Services skill
+	if template != nil && len(template.Services) > 0 {
+		result["forage-services"] = renderTemplate("skill-services.md.tmpl", buildServicesSkillData(metadata, template.Services))
+	}
+
 	return result
 }
 
+// servicesSkillData is the template data for the services skill.
+type servicesSkillData struct {
+	Systemd  bool // services run as systemd units rather than background processes
+	Services []serviceEntry
+}
+
+type serviceEntry struct {
+	Name       string
+	Package    string
+	Ports      []int
+	Env        []string // "NAME=value", sorted
+	DataDir    string
+	Persistent bool
+	Unit       string
+	LogPath    string
+}
+
+func buildServicesSkillData(metadata *config.SandboxMetadata, services []config.Service) *servicesSkillData {
+	data := &servicesSkillData{
+		// Only NixOS containers boot the generated config with its systemd units
+		Systemd: metadata.Runtime == "" || metadata.Runtime == "nspawn",
+	}
+	for _, svc := range services {
+		entry := serviceEntry{
+			Name:       svc.Name,
+			Package:    svc.Package,
+			Ports:      svc.Ports,
+			DataDir:    svc.DataDir(),
+			Persistent: svc.Persistent(),
+			Unit:       svc.UnitName(),
+			LogPath:    svc.LogPath(),
+		}
+		for name, value := range svc.Env {
+			entry.Env = append(entry.Env, name+"="+value)
+		}
+		sort.Strings(entry.Env)
+		data.Services = append(data.Services, entry)
+	}
+	return data
+}
+
 func vcsSkillTemplate(metadata *config.SandboxMetadata, info *ProjectInfo) (string, any) {
 	// Check multi-mount modes
 	if len(metadata.WorkspaceMounts) > 0 {
@@ -349,7 +398,13 @@ type systemPromptData struct {
 	Agents          []agentEntry
 	UseProxy        bool
 	MuxInstructions string
-	Mounts          []mountEntry // non-nil when using composable mounts
+	Mounts          []mountEntry   // non-nil when using composable mounts
+	Services        []serviceBrief // sidecar services declared by the template
+}
+
+type serviceBrief struct {
+	Name  string
+	Ports []int
 }
 
 type agentEntry struct {
@@ -362,7 +417,7 @@ type mountEntry struct {
 	Description   string // e.g. "jj workspace from ~/my-project"
 }
 
-func buildSystemPromptData(metadata *config.SandboxMetadata, template *config.Template) *systemPromptData {
+func buildSystemPromptData(metadata *config.SandboxMetadata, template *config.Template, hostGroups map[string][]string) *systemPromptData {
 	mux := multiplexer.New(multiplexer.Type(metadata.Multiplexer))
 	data := &systemPromptData{
 		Name:            metadata.Name,
@@ -371,11 +426,15 @@ func buildSystemPromptData(metadata *config.SandboxMetadata, template *config.Te
 		SourceRepo:      metadata.SourceRepo,
 		GitBranch:       metadata.GitBranch,
 		Network:         template.Network,
-		AllowedHosts:    template.AllowedHosts,
+		AllowedHosts:    network.DescribeAllowedHosts(template.AllowedHosts, hostGroups),
 		UseProxy:        template.UseProxy,
 		MuxInstructions: mux.PromptInstructions(),
 	}
 
+	for _, svc := range template.Services {
+		data.Services = append(data.Services, serviceBrief{Name: svc.Name, Ports: svc.Ports})
+	}
+
 	// Populate composable mount descriptions
 	if len(metadata.WorkspaceMounts) > 0 {
 		for _, m := range metadata.WorkspaceMounts {
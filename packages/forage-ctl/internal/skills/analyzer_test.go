@@ -447,7 +447,7 @@ func TestGenerateSystemPrompt(t *testing.T) {
 		},
 	}
 
-	result := GenerateSystemPrompt(metadata, template)
+	result := GenerateSystemPrompt(metadata, template, nil)
 
 	expected := []string{
 		"test-sandbox",
@@ -486,7 +486,7 @@ func TestGenerateSystemPrompt_GitWorktreeMode(t *testing.T) {
 		Network: "full",
 	}
 
-	result := GenerateSystemPrompt(metadata, template)
+	result := GenerateSystemPrompt(metadata, template, nil)
 
 	if !strings.Contains(result, "git worktree") {
 		t.Errorf("system prompt should mention git worktree mode\nGot:\n%s", result)
@@ -496,6 +496,27 @@ func TestGenerateSystemPrompt_GitWorktreeMode(t *testing.T) {
 	}
 }
 
+func TestGenerateSystemPrompt_HostGroups(t *testing.T) {
+	metadata := &config.SandboxMetadata{Name: "test-sandbox", Template: "python"}
+	template := &config.Template{
+		Name:         "python",
+		Network:      "restricted",
+		AllowedHosts: []string{"@pypi", "@internal"},
+	}
+	hostGroups := map[string][]string{"internal": {"registry.corp.example"}}
+
+	result := GenerateSystemPrompt(metadata, template, hostGroups)
+
+	for _, s := range []string{
+		"@pypi (pypi.org, files.pythonhosted.org)",
+		"@internal (registry.corp.example)",
+	} {
+		if !strings.Contains(result, s) {
+			t.Errorf("system prompt should contain %q\nGot:\n%s", s, result)
+		}
+	}
+}
+
 func TestGenerateSkillFiles_AllSkills(t *testing.T) {
 	metadata := &config.SandboxMetadata{
 		Name:          "test-sandbox",
@@ -599,3 +620,59 @@ func contains(slice []string, item string) bool {
 	}
 	return false
 }
+
+func TestGenerateSkillFiles_Services(t *testing.T) {
+	template := &config.Template{
+		Name:    "web",
+		Network: "full",
+		Services: []config.Service{
+			{Name: "postgres", Package: "postgresql_16", Command: "postgres", Ports: []int{5432}, Storage: config.ServiceStoragePersist, Env: map[string]string{"PGDATA": "/var/lib/forage-services/postgres"}},
+			{Name: "redis", Package: "redis", Command: "redis-server", Ports: []int{6379}},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		runtime string
+		want    []string
+		notWant []string
+	}{
+		{
+			name:    "nspawn uses systemd units",
+			runtime: "nspawn",
+			want:    []string{"localhost:5432", "localhost:6379", "PGDATA=", "journalctl -u forage-service-postgres", "persisted", "ephemeral"},
+			notWant: []string{"/tmp/forage-service-redis.log"},
+		},
+		{
+			name:    "docker uses log files",
+			runtime: "docker",
+			want:    []string{"/tmp/forage-service-redis.log"},
+			notWant: []string{"journalctl"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metadata := &config.SandboxMetadata{Name: "test-sandbox", Template: "web", Runtime: tt.runtime}
+			skill, ok := GenerateSkillFiles(metadata, template, nil)["forage-services"]
+			if !ok {
+				t.Fatal("expected forage-services skill")
+			}
+			for _, s := range tt.want {
+				if !strings.Contains(skill, s) {
+					t.Errorf("services skill should contain %q", s)
+				}
+			}
+			for _, s := range tt.notWant {
+				if strings.Contains(skill, s) {
+					t.Errorf("services skill should not contain %q", s)
+				}
+			}
+		})
+	}
+
+	prompt := GenerateSystemPrompt(&config.SandboxMetadata{Name: "test-sandbox", Template: "web"}, template, nil)
+	if !strings.Contains(prompt, "**Services:** postgres (localhost:5432), redis (localhost:6379)") {
+		t.Errorf("system prompt should list services, got:\n%s", prompt)
+	}
+}
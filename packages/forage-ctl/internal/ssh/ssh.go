@@ -5,6 +5,7 @@ package ssh
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
@@ -126,10 +127,15 @@ func Exec(host string, args ...string) error {
 
 // ExecWithOutput executes a command and returns output.
 func ExecWithOutput(host string, args ...string) (string, error) {
+	return ExecWithOutputContext(context.Background(), host, args...)
+}
+
+// ExecWithOutputContext is ExecWithOutput, killing ssh when ctx is done.
+func ExecWithOutputContext(ctx context.Context, host string, args ...string) (string, error) {
 	opts := DefaultOptions(host).WithBatchMode()
 	sshArgs := opts.BuildArgs(args...)
 
-	cmd := exec.Command("ssh", sshArgs...)
+	cmd := exec.CommandContext(ctx, "ssh", sshArgs...)
 	output, err := cmd.Output()
 	return string(output), err
 }
@@ -172,9 +178,14 @@ func ReplaceWithSession(host string, command string) error {
 
 // CheckConnection checks if SSH is reachable.
 func CheckConnection(host string) bool {
+	return CheckConnectionContext(context.Background(), host)
+}
+
+// CheckConnectionContext is CheckConnection, giving up when ctx is done.
+func CheckConnectionContext(ctx context.Context, host string) bool {
 	opts := DefaultOptions(host).WithBatchMode()
 	sshArgs := opts.BuildArgs("true")
 
-	cmd := exec.Command("ssh", sshArgs...)
+	cmd := exec.CommandContext(ctx, "ssh", sshArgs...)
 	return cmd.Run() == nil
 }
@@ -1,6 +1,7 @@
 package tui
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"sort"
@@ -12,7 +13,6 @@ import (
 
 	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/config"
 	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/health"
-	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/multiplexer"
 	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/runtime"
 )
 
@@ -36,8 +36,9 @@ func groupKey(sb *config.SandboxMetadata) string {
 
 // buildGroupedItems groups sandboxes by project and returns list items
 // with headerItem separators. The rt parameter is optional; if nil, all
-// sandboxes will show as stopped.
-func buildGroupedItems(sandboxes []*config.SandboxMetadata, rt runtime.Runtime) []list.Item {
+// sandboxes will show as stopped. Template probes are checked if paths is
+// set.
+func buildGroupedItems(sandboxes []*config.SandboxMetadata, paths *config.Paths, rt runtime.Runtime) []list.Item {
 	if len(sandboxes) == 0 {
 		return nil
 	}
@@ -68,20 +69,21 @@ func buildGroupedItems(sandboxes []*config.SandboxMetadata, rt runtime.Runtime)
 	})
 
 	// Build items with headers
+	statuses := collectStatuses(sandboxes, paths, rt)
 	var items []list.Item
 	for _, g := range groups {
 		items = append(items, headerItem{label: g.key})
 		for _, sb := range g.sandboxes {
-			mux := multiplexer.New(multiplexer.Type(sb.Multiplexer))
-			status := health.GetSummary(sb.Name, sb.ContainerIP(), rt, mux)
+			status := statuses[sb.Name]
 			uptime := "stopped"
-			if status != health.StatusStopped {
-				uptime = health.GetUptime(sb.Name, rt)
+			if status.Status != health.StatusStopped {
+				uptime = status.Uptime
 			}
 			items = append(items, sandboxItem{
 				metadata: sb,
-				status:   status,
+				status:   health.ApplyRestarts(status.Status, sb),
 				uptime:   uptime,
+				failing:  status.Failing(),
 			})
 		}
 	}
@@ -89,6 +91,21 @@ func buildGroupedItems(sandboxes []*config.SandboxMetadata, rt runtime.Runtime)
 	return items
 }
 
+// collectStatuses checks the sandboxes concurrently, taking the health
+// monitor's recent statuses if paths is set, and returns their statuses by
+// name.
+func collectStatuses(sandboxes []*config.SandboxMetadata, paths *config.Paths, rt runtime.Runtime) map[string]health.SandboxStatus {
+	var opts health.CollectOptions
+	if paths != nil && paths.StateDir != "" {
+		opts.Cache = health.StatusCachePath(paths.StateDir)
+	}
+	statuses := make(map[string]health.SandboxStatus, len(sandboxes))
+	for _, s := range health.Collect(context.Background(), rt, paths, sandboxes, opts) {
+		statuses[s.Name] = s
+	}
+	return statuses
+}
+
 // headerStyle is the style for group header items.
 var headerStyle = lipgloss.NewStyle().
 	Bold(true).
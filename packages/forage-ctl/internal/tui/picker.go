@@ -11,7 +11,6 @@ import (
 
 	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/config"
 	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/health"
-	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/multiplexer"
 	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/runtime"
 )
 
@@ -64,6 +63,7 @@ type sandboxItem struct {
 	metadata *config.SandboxMetadata
 	status   health.Status
 	uptime   string
+	failing  []string // unhealthy template probes
 }
 
 func (i sandboxItem) Title() string {
@@ -83,6 +83,8 @@ func (i sandboxItem) Description() string {
 		statusIcon = "○"
 	case health.StatusStopped:
 		statusIcon = "●"
+	case health.StatusCrashLoop:
+		statusIcon = "✗"
 	}
 
 	// Show source repo for jj/git-worktree modes, workspace otherwise
@@ -91,15 +93,26 @@ func (i sandboxItem) Description() string {
 		location = i.metadata.SourceRepo
 	}
 
-	return fmt.Sprintf("%s %s | %s | %s",
+	desc := fmt.Sprintf("%s %s | %s | %s",
 		statusIcon,
 		i.metadata.Template,
 		mode,
 		truncatePath(location, 40),
 	)
+	if i.metadata.Group != "" {
+		desc += " | group " + i.metadata.Group
+	}
+	if len(i.failing) > 0 {
+		desc += " | failing " + strings.Join(i.failing, ", ")
+	}
+	return desc
 }
 
 func (i sandboxItem) FilterValue() string {
+	// Include the group so typing a group name filters to its members
+	if i.metadata.Group != "" {
+		return i.metadata.Name + " " + i.metadata.Group
+	}
 	return i.metadata.Name
 }
 
@@ -142,7 +155,7 @@ type Model struct {
 // NewPicker creates a new sandbox picker.
 // The rt parameter is optional; if nil, all sandboxes will show as stopped.
 func NewPicker(sandboxes []*config.SandboxMetadata, paths *config.Paths, rt runtime.Runtime, opts PickerOptions) Model {
-	items := buildGroupedItems(sandboxes, rt)
+	items := buildGroupedItems(sandboxes, paths, rt)
 
 	delegate := newGroupedDelegate()
 	l := list.New(items, delegate, 80, 20)
@@ -363,9 +376,11 @@ func SimplePicker(sandboxes []*config.SandboxMetadata, paths *config.Paths, rt r
 		return sb.String()
 	}
 
+	statuses := collectStatuses(sandboxes, paths, rt)
 	for i, sandbox := range sandboxes {
-		mux := multiplexer.New(multiplexer.Type(sandbox.Multiplexer))
-		status := health.GetSummary(sandbox.Name, sandbox.ContainerIP(), rt, mux)
+		collected := statuses[sandbox.Name]
+		status := health.ApplyRestarts(collected.Status, sandbox)
+		failing := collected.Failing()
 		statusIcon := "●"
 		switch status {
 		case health.StatusHealthy:
@@ -374,6 +389,8 @@ func SimplePicker(sandboxes []*config.SandboxMetadata, paths *config.Paths, rt r
 			statusIcon = "⚠"
 		case health.StatusNoMux:
 			statusIcon = "○"
+		case health.StatusCrashLoop:
+			statusIcon = "✗"
 		}
 
 		// Show source repo for jj/git-worktree modes, workspace otherwise
@@ -384,8 +401,12 @@ func SimplePicker(sandboxes []*config.SandboxMetadata, paths *config.Paths, rt r
 
 		sb.WriteString(fmt.Sprintf("%d. %s %s (%s)\n",
 			i+1, statusIcon, sandbox.Name, sandbox.Template))
-		sb.WriteString(fmt.Sprintf("   IP: %s | %s\n\n",
+		sb.WriteString(fmt.Sprintf("   IP: %s | %s\n",
 			sandbox.ContainerIP(), truncatePath(location, 40)))
+		if len(failing) > 0 {
+			sb.WriteString(fmt.Sprintf("   Failing probes: %s\n", strings.Join(failing, ", ")))
+		}
+		sb.WriteString("\n")
 	}
 
 	return sb.String()
@@ -0,0 +1,144 @@
+package usage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/config"
+)
+
+// BudgetState is a sandbox's budget as stored on disk: its limits and the
+// point from which spend counts toward them.
+type BudgetState struct {
+	Budget  config.Budget `json:"budget"`
+	ResetAt time.Time     `json:"resetAt,omitempty"` // Spend before this time is not counted
+}
+
+// BudgetPath returns the location of a sandbox's budget file within
+// stateDir.
+func BudgetPath(stateDir, sandbox string) (string, error) {
+	if err := config.ValidateSandboxName(sandbox); err != nil {
+		return "", err
+	}
+	return filepath.Join(stateDir, "budgets", sandbox+".json"), nil
+}
+
+// LoadBudget reads a sandbox's budget. It returns nil if the sandbox has
+// no budget.
+func LoadBudget(stateDir, sandbox string) (*BudgetState, error) {
+	path, err := BudgetPath(stateDir, sandbox)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read budget: %w", err)
+	}
+	var state BudgetState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse budget: %w", err)
+	}
+	return &state, nil
+}
+
+// SaveBudget writes a sandbox's budget atomically.
+func SaveBudget(stateDir, sandbox string, state *BudgetState) error {
+	path, err := BudgetPath(stateDir, sandbox)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create budgets directory: %w", err)
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal budget: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write budget: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write budget: %w", err)
+	}
+	return nil
+}
+
+// RemoveBudget deletes a sandbox's budget file.
+func RemoveBudget(stateDir, sandbox string) error {
+	path, err := BudgetPath(stateDir, sandbox)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Spend is usage counted against a budget.
+type Spend struct {
+	Tokens int64   // Input, output and cache write tokens
+	Cost   float64 // Estimated cost in USD
+}
+
+// SpendOf returns what a call's usage counts against a budget.
+func SpendOf(prices Prices, model string, t Tokens) Spend {
+	s := Spend{Tokens: t.Input + t.Output + t.CacheWrite}
+	if price, ok := prices.Lookup(model); ok {
+		s.Cost = Cost(price, t)
+	}
+	return s
+}
+
+// Add returns the sum of s and o.
+func (s Spend) Add(o Spend) Spend {
+	return Spend{Tokens: s.Tokens + o.Tokens, Cost: s.Cost + o.Cost}
+}
+
+// DayStart returns the start of the local calendar day containing t.
+func DayStart(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+// BudgetSpend sums a sandbox's spend for today and since the budget's last
+// reset from the records in the usage store at path.
+func BudgetSpend(path, sandbox string, state *BudgetState, prices Prices, now time.Time) (daily, total Spend, err error) {
+	records, err := Read(path, Filter{Sandbox: sandbox, Since: state.ResetAt})
+	if err != nil {
+		return Spend{}, Spend{}, err
+	}
+	today := DayStart(now)
+	for i := range records {
+		r := &records[i]
+		s := SpendOf(prices, r.Model, r.Tokens)
+		total = total.Add(s)
+		if !r.Timestamp.Before(today) {
+			daily = daily.Add(s)
+		}
+	}
+	return daily, total, nil
+}
+
+// Exceeded returns why spend exhausts the budget, or "" if it does not.
+func (b *BudgetState) Exceeded(daily, total Spend) string {
+	limits := &b.Budget
+	switch {
+	case limits.TotalCost > 0 && total.Cost >= limits.TotalCost:
+		return fmt.Sprintf("total cost limit of $%.2f reached", limits.TotalCost)
+	case limits.TotalTokens > 0 && total.Tokens >= limits.TotalTokens:
+		return fmt.Sprintf("total token limit of %d reached", limits.TotalTokens)
+	case limits.DailyCost > 0 && daily.Cost >= limits.DailyCost:
+		return fmt.Sprintf("daily cost limit of $%.2f reached", limits.DailyCost)
+	case limits.DailyTokens > 0 && daily.Tokens >= limits.DailyTokens:
+		return fmt.Sprintf("daily token limit of %d reached", limits.DailyTokens)
+	}
+	return ""
+}
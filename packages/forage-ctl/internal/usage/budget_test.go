@@ -0,0 +1,94 @@
+package usage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/config"
+)
+
+func TestBudget_SaveLoadRemove(t *testing.T) {
+	stateDir := t.TempDir()
+
+	state, err := LoadBudget(stateDir, "sb")
+	if err != nil || state != nil {
+		t.Fatalf("LoadBudget() = %v, %v; want nil, nil", state, err)
+	}
+
+	want := &BudgetState{
+		Budget:  config.Budget{DailyCost: 5, TotalTokens: 1000, Pause: true},
+		ResetAt: time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC),
+	}
+	if err := SaveBudget(stateDir, "sb", want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := LoadBudget(stateDir, "sb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Budget != want.Budget || !got.ResetAt.Equal(want.ResetAt) {
+		t.Errorf("LoadBudget() = %+v, want %+v", got, want)
+	}
+
+	if err := RemoveBudget(stateDir, "sb"); err != nil {
+		t.Fatal(err)
+	}
+	if state, _ := LoadBudget(stateDir, "sb"); state != nil {
+		t.Error("budget still present after RemoveBudget")
+	}
+
+	if _, err := BudgetPath(stateDir, "../escape"); err == nil {
+		t.Error("BudgetPath should reject invalid sandbox names")
+	}
+}
+
+func TestBudgetSpend(t *testing.T) {
+	stateDir := t.TempDir()
+	path := Path(stateDir)
+	store, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2026, 3, 2, 15, 0, 0, 0, time.Local)
+	for _, r := range []Record{
+		// Before the reset: not counted
+		{Timestamp: now.Add(-72 * time.Hour), Sandbox: "sb", Model: "claude-sonnet-4", Tokens: Tokens{Input: 1000000}},
+		// Yesterday
+		{Timestamp: now.Add(-24 * time.Hour), Sandbox: "sb", Model: "claude-sonnet-4", Tokens: Tokens{Input: 1000000, CacheRead: 500}},
+		// Today
+		{Timestamp: now.Add(-time.Hour), Sandbox: "sb", Model: "claude-sonnet-4", Tokens: Tokens{Output: 100000, CacheWrite: 10}},
+		// Other sandbox
+		{Timestamp: now, Sandbox: "other", Model: "claude-sonnet-4", Tokens: Tokens{Input: 5}},
+	} {
+		if err := store.Add(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	store.Close()
+
+	state := &BudgetState{
+		Budget:  config.Budget{DailyTokens: 200000, TotalCost: 4},
+		ResetAt: now.Add(-48 * time.Hour),
+	}
+	daily, total, err := BudgetSpend(path, "sb", state, DefaultPrices(nil), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if daily.Tokens != 100010 || total.Tokens != 1100010 {
+		t.Errorf("tokens: daily %d, total %d; want 100010, 1100010", daily.Tokens, total.Tokens)
+	}
+	// 1M input at $3 + 500 cache reads + 100k output at $15 + 10 cache writes
+	wantTotal := 3 + 500*0.30/1e6 + 1.5 + 10*3.75/1e6
+	if diff := total.Cost - wantTotal; diff > 1e-9 || diff < -1e-9 {
+		t.Errorf("total cost = %f, want %f", total.Cost, wantTotal)
+	}
+
+	if reason := state.Exceeded(daily, total); reason != "total cost limit of $4.00 reached" {
+		t.Errorf("Exceeded() = %q", reason)
+	}
+	state.Budget.TotalCost = 10
+	if reason := state.Exceeded(daily, total); reason != "" {
+		t.Errorf("Exceeded() = %q, want within budget", reason)
+	}
+}
@@ -0,0 +1,68 @@
+package usage
+
+import (
+	"strings"
+
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/config"
+)
+
+// Prices maps model names or name prefixes to token prices. Prefixes let
+// one entry cover dated releases such as "claude-sonnet-4-20250514".
+type Prices map[string]config.ModelPrice
+
+// defaultPrices are list prices in USD per million tokens. They are
+// estimates only; hosts can override or extend them with modelPrices in
+// the host config.
+var defaultPrices = Prices{
+	"claude-opus-4":     {Input: 15, Output: 75, CacheWrite: 18.75, CacheRead: 1.50},
+	"claude-opus-4-5":   {Input: 5, Output: 25, CacheWrite: 6.25, CacheRead: 0.50},
+	"claude-sonnet-4":   {Input: 3, Output: 15, CacheWrite: 3.75, CacheRead: 0.30},
+	"claude-3-7-sonnet": {Input: 3, Output: 15, CacheWrite: 3.75, CacheRead: 0.30},
+	"claude-3-5-sonnet": {Input: 3, Output: 15, CacheWrite: 3.75, CacheRead: 0.30},
+	"claude-haiku-4-5":  {Input: 1, Output: 5, CacheWrite: 1.25, CacheRead: 0.10},
+	"claude-3-5-haiku":  {Input: 0.80, Output: 4, CacheWrite: 1, CacheRead: 0.08},
+	"gpt-4o":            {Input: 2.50, Output: 10, CacheRead: 1.25},
+	"gpt-4o-mini":       {Input: 0.15, Output: 0.60, CacheRead: 0.075},
+	"gpt-4.1":           {Input: 2, Output: 8, CacheRead: 0.50},
+	"gpt-4.1-mini":      {Input: 0.40, Output: 1.60, CacheRead: 0.10},
+	"gemini-2.5-pro":    {Input: 1.25, Output: 10, CacheRead: 0.31},
+	"gemini-2.5-flash":  {Input: 0.30, Output: 2.50, CacheRead: 0.075},
+}
+
+// DefaultPrices returns the built-in price table merged with overrides.
+func DefaultPrices(overrides map[string]config.ModelPrice) Prices {
+	prices := make(Prices, len(defaultPrices)+len(overrides))
+	for model, price := range defaultPrices {
+		prices[model] = price
+	}
+	for model, price := range overrides {
+		prices[model] = price
+	}
+	return prices
+}
+
+// Lookup returns the price of model: an exact entry if there is one,
+// otherwise the entry with the longest matching prefix.
+func (p Prices) Lookup(model string) (config.ModelPrice, bool) {
+	if price, ok := p[model]; ok {
+		return price, true
+	}
+	best := ""
+	for prefix := range p {
+		if strings.HasPrefix(model, prefix) && len(prefix) > len(best) {
+			best = prefix
+		}
+	}
+	if best == "" {
+		return config.ModelPrice{}, false
+	}
+	return p[best], true
+}
+
+// Cost estimates the cost of tokens in USD.
+func Cost(price config.ModelPrice, t Tokens) float64 {
+	return (float64(t.Input)*price.Input +
+		float64(t.Output)*price.Output +
+		float64(t.CacheWrite)*price.CacheWrite +
+		float64(t.CacheRead)*price.CacheRead) / 1e6
+}
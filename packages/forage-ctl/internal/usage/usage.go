@@ -0,0 +1,184 @@
+// Package usage records API token usage per sandbox and model and estimates
+// what it cost. Records are written by the API proxy as JSON Lines (JSONL)
+// to a single file under the state directory.
+package usage
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Tokens counts the tokens of one or more API calls.
+type Tokens struct {
+	Input      int64 `json:"input_tokens"`
+	Output     int64 `json:"output_tokens"`
+	CacheWrite int64 `json:"cache_write_tokens,omitempty"`
+	CacheRead  int64 `json:"cache_read_tokens,omitempty"`
+}
+
+// IsZero reports whether no tokens were counted.
+func (t Tokens) IsZero() bool {
+	return t == Tokens{}
+}
+
+// Add returns the sum of t and o.
+func (t Tokens) Add(o Tokens) Tokens {
+	return Tokens{
+		Input:      t.Input + o.Input,
+		Output:     t.Output + o.Output,
+		CacheWrite: t.CacheWrite + o.CacheWrite,
+		CacheRead:  t.CacheRead + o.CacheRead,
+	}
+}
+
+// Record is the usage of a single API call.
+type Record struct {
+	Timestamp time.Time `json:"timestamp"`
+	Sandbox   string    `json:"sandbox,omitempty"`
+	Route     string    `json:"route,omitempty"`
+	Model     string    `json:"model,omitempty"`
+	Tokens
+}
+
+// Path returns the usage store location within stateDir.
+func Path(stateDir string) string {
+	return filepath.Join(stateDir, "usage.jsonl")
+}
+
+// Store appends usage records to a JSONL file.
+type Store struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// Open opens the store at path for appending, creating it if needed.
+func Open(path string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create usage directory: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open usage store: %w", err)
+	}
+	return &Store{file: f}, nil
+}
+
+// Add appends a record to the store.
+func (s *Store) Add(r Record) error {
+	if r.Timestamp.IsZero() {
+		r.Timestamp = time.Now()
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("failed to marshal usage record: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write usage record: %w", err)
+	}
+	return nil
+}
+
+// Close closes the store.
+func (s *Store) Close() error {
+	return s.file.Close()
+}
+
+// Filter selects records when reading the store. Zero fields match
+// everything.
+type Filter struct {
+	Sandbox string
+	Since   time.Time
+}
+
+func (f Filter) matches(r *Record) bool {
+	if f.Sandbox != "" && r.Sandbox != f.Sandbox {
+		return false
+	}
+	return f.Since.IsZero() || !r.Timestamp.Before(f.Since)
+}
+
+// Read returns the records at path matching filter, in the order they were
+// written. A missing store has no records.
+func Read(path string, filter Filter) ([]Record, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to open usage store: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	var records []Record
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var r Record
+		if err := json.Unmarshal(line, &r); err != nil {
+			continue // Skip malformed lines
+		}
+		if filter.matches(&r) {
+			records = append(records, r)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return records, fmt.Errorf("error reading usage store: %w", err)
+	}
+	return records, nil
+}
+
+// Total aggregates the usage of one sandbox and model.
+type Total struct {
+	Sandbox  string
+	Model    string
+	Requests int
+	Tokens
+	Cost   float64 // Estimated cost in USD
+	Priced bool    // Whether the model was found in the price table
+}
+
+// Summarize aggregates records per sandbox and model, sorted by sandbox
+// then model, and estimates their cost with prices.
+func Summarize(records []Record, prices Prices) []Total {
+	type key struct{ sandbox, model string }
+	totals := make(map[key]*Total)
+	for i := range records {
+		r := &records[i]
+		k := key{r.Sandbox, r.Model}
+		t, ok := totals[k]
+		if !ok {
+			t = &Total{Sandbox: r.Sandbox, Model: r.Model}
+			totals[k] = t
+		}
+		t.Requests++
+		t.Tokens = t.Tokens.Add(r.Tokens)
+	}
+
+	result := make([]Total, 0, len(totals))
+	for _, t := range totals {
+		if price, ok := prices.Lookup(t.Model); ok {
+			t.Cost = Cost(price, t.Tokens)
+			t.Priced = true
+		}
+		result = append(result, *t)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Sandbox != result[j].Sandbox {
+			return result[i].Sandbox < result[j].Sandbox
+		}
+		return result[i].Model < result[j].Model
+	})
+	return result
+}
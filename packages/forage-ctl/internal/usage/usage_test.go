@@ -0,0 +1,98 @@
+package usage
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/firefly-engineering/firefly-forage/packages/forage-ctl/internal/config"
+)
+
+func TestStore_AddAndRead(t *testing.T) {
+	path := Path(filepath.Join(t.TempDir(), "state"))
+	store, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().Truncate(time.Second)
+	records := []Record{
+		{Timestamp: now.Add(-2 * time.Hour), Sandbox: "a", Model: "claude-sonnet-4", Tokens: Tokens{Input: 100, Output: 10}},
+		{Timestamp: now.Add(-time.Minute), Sandbox: "a", Model: "claude-sonnet-4", Tokens: Tokens{Input: 50, Output: 5, CacheRead: 1000}},
+		{Timestamp: now, Sandbox: "b", Model: "gpt-4o", Tokens: Tokens{Input: 1, Output: 1}},
+	}
+	for _, r := range records {
+		if err := store.Add(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	all, err := Read(path, Filter{})
+	if err != nil || len(all) != 3 {
+		t.Fatalf("Read() = %d records, %v; want 3", len(all), err)
+	}
+
+	recent, _ := Read(path, Filter{Sandbox: "a", Since: now.Add(-time.Hour)})
+	if len(recent) != 1 || recent[0].Tokens.CacheRead != 1000 {
+		t.Errorf("filtered Read() = %+v", recent)
+	}
+
+	missing, err := Read(filepath.Join(t.TempDir(), "none.jsonl"), Filter{})
+	if err != nil || missing != nil {
+		t.Errorf("Read() of missing store = %v, %v", missing, err)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	records := []Record{
+		{Sandbox: "b", Model: "mystery-model", Tokens: Tokens{Input: 10}},
+		{Sandbox: "a", Model: "claude-sonnet-4-20250514", Tokens: Tokens{Input: 1_000_000, Output: 100_000}},
+		{Sandbox: "a", Model: "claude-sonnet-4-20250514", Tokens: Tokens{CacheWrite: 1_000_000, CacheRead: 1_000_000}},
+	}
+	totals := Summarize(records, DefaultPrices(nil))
+	if len(totals) != 2 {
+		t.Fatalf("expected 2 totals, got %d", len(totals))
+	}
+
+	a := totals[0]
+	if a.Sandbox != "a" || a.Requests != 2 || !a.Priced {
+		t.Errorf("unexpected total: %+v", a)
+	}
+	// 3 input + 1.5 output + 3.75 cache write + 0.30 cache read
+	if math.Abs(a.Cost-8.55) > 1e-9 {
+		t.Errorf("Cost = %v, want 8.55", a.Cost)
+	}
+	if b := totals[1]; b.Sandbox != "b" || b.Priced {
+		t.Errorf("unpriced model should not be priced: %+v", b)
+	}
+}
+
+func TestPrices_Lookup(t *testing.T) {
+	prices := DefaultPrices(map[string]config.ModelPrice{
+		"claude-sonnet-4": {Input: 1, Output: 2},
+		"local-llm":       {},
+	})
+
+	tests := []struct {
+		model     string
+		wantInput float64
+		wantOK    bool
+	}{
+		{"claude-sonnet-4-20250514", 1, true}, // override wins
+		{"claude-opus-4-1-20250805", 15, true},
+		{"claude-opus-4-5-20251101", 5, true}, // longest prefix
+		{"gpt-4o-mini-2024-07-18", 0.15, true},
+		{"local-llm", 0, true},
+		{"unknown", 0, false},
+	}
+	for _, tt := range tests {
+		price, ok := prices.Lookup(tt.model)
+		if ok != tt.wantOK || price.Input != tt.wantInput {
+			t.Errorf("Lookup(%q) = %+v, %v; want input %v, %v", tt.model, price, ok, tt.wantInput, tt.wantOK)
+		}
+	}
+}